@@ -5,7 +5,14 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/lockout"
+	"github.com/garycarr/book_club/mailer"
+	"github.com/garycarr/book_club/metadata"
+	"github.com/garycarr/book_club/oidc"
 	"github.com/garycarr/book_club/util"
 	"github.com/garycarr/book_club/warehouse"
 	"github.com/gorilla/mux"
@@ -17,7 +24,12 @@ import (
 type app struct {
 	conf             *config
 	connectionString string
+	emailLockout     lockout.TrackerIn
+	ipLockout        lockout.TrackerIn
 	logrus           *logrus.Logger
+	mailer           mailer.MailerIn
+	metadataProvider metadata.ProviderIn
+	oidcProviders    map[string]oidc.ProviderIn
 	util             util.UtilIn
 	Router           *mux.Router
 	warehouse        warehouse.WarehouseIn
@@ -25,15 +37,47 @@ type app struct {
 
 type config struct {
 	Port     string `json:"port"`
+	BaseURL  string `json:"base_url"`
 	Database struct {
 		DBName   string `json:"db_name"`
 		Host     string `json:"host"`
 		Password string `json:"password"`
 		Username string `json:"username"`
 	} `json:"database"`
+	Mailer struct {
+		Type string `json:"type"`
+		From string `json:"from"`
+		Dir  string `json:"dir"`
+	} `json:"mailer"`
+	Lockout struct {
+		Type              string `json:"type"`
+		EmailThreshold    int    `json:"email_threshold"`
+		IPThreshold       int    `json:"ip_threshold"`
+		LockoutSeconds    int    `json:"lockout_seconds"`
+		MaxLockoutSeconds int    `json:"max_lockout_seconds"`
+		WindowSeconds     int    `json:"window_seconds"`
+		// TrustForwardedFor uses the last X-Forwarded-For address as the client IP, only turn it on
+		// behind a load balancer that sets the header
+		TrustForwardedFor bool `json:"trust_forwarded_for"`
+	} `json:"lockout"`
+	JWT struct {
+		SigningKey       util.KeyFile   `json:"signing_key"`
+		VerificationKeys []util.KeyFile `json:"verification_keys"`
+	} `json:"jwt"`
+	OIDC struct {
+		Providers []oidc.ProviderConfig `json:"providers"`
+	} `json:"oidc"`
+	Metadata       metadata.Config           `json:"metadata"`
+	PasswordPolicy util.PasswordPolicyConfig `json:"password_policy"`
+	PasswordHash   util.PasswordHashConfig   `json:"password_hash"`
+	// SecretKeyFile holds the base64 encoded key that encrypts secrets stored in the warehouse
+	SecretKeyFile string `json:"secret_key_file"`
+	// UnverifiedRoutes are the authenticated routes that can be used before the email is verified
+	UnverifiedRoutes []string `json:"unverified_routes"`
 }
 
 func (a *app) run() {
+	go a.sweepRevokedTokens(revokedTokenSweepInterval)
 	a.logrus.Fatal(http.ListenAndServe(a.conf.Port, a.Router))
 }
 
@@ -52,7 +96,51 @@ func (a *app) initialize(configFile string) {
 		a.logrus.WithError(err).Fatal("Error creating warehouse")
 	}
 	a.warehouse = wh
-	a.util = util.NewUtil()
+	m, err := mailer.NewMailer(a.conf.Mailer.Type, a.conf.Mailer.From, a.conf.Mailer.Dir, a.logrus)
+	if err != nil {
+		a.logrus.WithError(err).Fatal("Error creating mailer")
+	}
+	a.mailer = m
+	lc := a.conf.Lockout
+	lockoutConf := lockout.Config{
+		Lockout:    time.Duration(lc.LockoutSeconds) * time.Second,
+		MaxLockout: time.Duration(lc.MaxLockoutSeconds) * time.Second,
+		Window:     time.Duration(lc.WindowSeconds) * time.Second,
+	}
+	lockoutConf.Threshold = lc.EmailThreshold
+	if a.emailLockout, err = lockout.NewTracker(lc.Type, lockoutConf, a.warehouse); err != nil {
+		a.logrus.WithError(err).Fatal("Error creating email lockout tracker")
+	}
+	lockoutConf.Threshold = lc.IPThreshold
+	if a.ipLockout, err = lockout.NewTracker(lc.Type, lockoutConf, a.warehouse); err != nil {
+		a.logrus.WithError(err).Fatal("Error creating IP lockout tracker")
+	}
+	if a.metadataProvider, err = metadata.NewProvider(a.conf.Metadata); err != nil {
+		a.logrus.WithError(err).Fatal("Error creating book metadata provider")
+	}
+	a.oidcProviders = map[string]oidc.ProviderIn{}
+	for _, pc := range a.conf.OIDC.Providers {
+		provider, err := oidc.NewProvider(pc, fmt.Sprintf("%s/login/oidc/%s/callback", a.conf.BaseURL, pc.Name))
+		if err != nil {
+			a.logrus.WithError(err).Fatal("Error creating OIDC provider")
+		}
+		a.oidcProviders[pc.Name] = provider
+	}
+	secretKey, err := util.LoadSecretKey(a.conf.SecretKeyFile)
+	if err != nil {
+		a.logrus.WithError(err).Fatal("Error loading secret key")
+	}
+	u, err := util.NewUtil(util.Config{
+		SecretKey:        secretKey,
+		SigningKey:       a.conf.JWT.SigningKey,
+		VerificationKeys: a.conf.JWT.VerificationKeys,
+		PasswordPolicy:   a.conf.PasswordPolicy,
+		PasswordHash:     a.conf.PasswordHash,
+	})
+	if err != nil {
+		a.logrus.WithError(err).Fatal("Error creating util")
+	}
+	a.util = u
 	a.Router = mux.NewRouter()
 	a.initializeRoutes()
 }
@@ -60,24 +148,252 @@ func (a *app) initialize(configFile string) {
 func (a *app) initializeRoutes() {
 	a.Router.HandleFunc("/login", a.loginPost).Methods(http.MethodPost)
 	a.Router.HandleFunc("/login", a.loginOptions).Methods(http.MethodOptions)
+	a.Router.HandleFunc("/login/mfa", a.loginMFAPost).Methods(http.MethodPost)
+	a.Router.HandleFunc("/login/mfa", a.loginMFAOptions).Methods(http.MethodOptions)
+	a.Router.HandleFunc("/login/oidc/{provider}", a.oidcLoginGet).Methods(http.MethodGet)
+	a.Router.HandleFunc("/login/oidc/{provider}", a.oidcLoginOptions).Methods(http.MethodOptions)
+	a.Router.HandleFunc("/login/oidc/{provider}/callback", a.oidcCallbackGet).Methods(http.MethodGet)
+	a.Router.HandleFunc("/login/oidc/{provider}/callback", a.oidcLoginOptions).Methods(http.MethodOptions)
 
 	a.Router.HandleFunc("/user", a.userPost).Methods(http.MethodPost)
 	a.Router.HandleFunc("/user", a.userOptions).Methods(http.MethodOptions)
+	a.Router.HandleFunc("/user/verify", a.userVerifyGet).Methods(http.MethodGet)
+	a.Router.HandleFunc("/user/verify", a.userVerifyOptions).Methods(http.MethodOptions)
+
+	a.Router.HandleFunc("/.well-known/jwks.json", a.jwksGet).Methods(http.MethodGet)
+	a.Router.HandleFunc("/.well-known/jwks.json", a.jwksOptions).Methods(http.MethodOptions)
+
+	a.Router.HandleFunc("/token/refresh", a.tokenRefreshPost).Methods(http.MethodPost)
+	a.Router.HandleFunc("/token/refresh", a.tokenRefreshOptions).Methods(http.MethodOptions)
+
+	a.Router.HandleFunc("/password/forgot", a.passwordForgotPost).Methods(http.MethodPost)
+	a.Router.HandleFunc("/password/forgot", a.passwordForgotOptions).Methods(http.MethodOptions)
+	a.Router.HandleFunc("/password/reset", a.passwordResetPost).Methods(http.MethodPost)
+	a.Router.HandleFunc("/password/reset", a.passwordResetOptions).Methods(http.MethodOptions)
 
 	authMiddleware := alice.New(a.authMiddleware)
-	a.Router.Handle("/homepage", authMiddleware.ThenFunc(a.homePageGet)).Methods(http.MethodGet)
+	jsonTokenMiddleware := authMiddleware.Append(a.requireJSONToken)
+	userReadMiddleware := authMiddleware.Append(a.requireScope(common.ScopeUserRead))
+	a.Router.Handle("/homepage", userReadMiddleware.ThenFunc(a.homePageGet)).Methods(http.MethodGet)
 	a.Router.Handle("/homepage", authMiddleware.ThenFunc(a.homePageOptions)).Methods(http.MethodOptions)
+
+	a.Router.Handle("/user/verify/resend", jsonTokenMiddleware.ThenFunc(a.userVerifyResendPost)).Methods(http.MethodPost)
+	a.Router.Handle("/user/verify/resend", authMiddleware.ThenFunc(a.userVerifyOptions)).Methods(http.MethodOptions)
+
+	a.Router.Handle("/logout", jsonTokenMiddleware.ThenFunc(a.logoutPost)).Methods(http.MethodPost)
+	a.Router.Handle("/logout", authMiddleware.ThenFunc(a.logoutOptions)).Methods(http.MethodOptions)
+
+	a.Router.Handle("/user/me", userReadMiddleware.ThenFunc(a.userMeGet)).Methods(http.MethodGet)
+	a.Router.Handle("/user/me", jsonTokenMiddleware.ThenFunc(a.userMePatch)).Methods(http.MethodPatch)
+	a.Router.Handle("/user/me", jsonTokenMiddleware.ThenFunc(a.userMeDelete)).Methods(http.MethodDelete)
+	a.Router.Handle("/user/me", authMiddleware.ThenFunc(a.userMeOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/user/me/password", jsonTokenMiddleware.ThenFunc(a.userMePasswordPut)).Methods(http.MethodPut)
+	a.Router.Handle("/user/me/password", authMiddleware.ThenFunc(a.userMePasswordOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/user/me/export", jsonTokenMiddleware.ThenFunc(a.userMeExportGet)).Methods(http.MethodGet)
+	a.Router.Handle("/user/me/export", authMiddleware.ThenFunc(a.userMeExportOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/user/me/tokens", jsonTokenMiddleware.ThenFunc(a.userMeTokensPost)).Methods(http.MethodPost)
+	a.Router.Handle("/user/me/tokens", jsonTokenMiddleware.ThenFunc(a.userMeTokensGet)).Methods(http.MethodGet)
+	a.Router.Handle("/user/me/tokens", authMiddleware.ThenFunc(a.userMeTokensOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/user/me/tokens/{tokenID}", jsonTokenMiddleware.ThenFunc(a.userMeTokenDelete)).Methods(http.MethodDelete)
+	a.Router.Handle("/user/me/tokens/{tokenID}", authMiddleware.ThenFunc(a.userMeTokensOptions)).Methods(http.MethodOptions)
+
+	a.Router.Handle("/user/totp/enroll", jsonTokenMiddleware.ThenFunc(a.userTOTPEnrollPost)).Methods(http.MethodPost)
+	a.Router.Handle("/user/totp/enroll", authMiddleware.ThenFunc(a.userTOTPOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/user/totp/confirm", jsonTokenMiddleware.ThenFunc(a.userTOTPConfirmPost)).Methods(http.MethodPost)
+	a.Router.Handle("/user/totp/confirm", authMiddleware.ThenFunc(a.userTOTPOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/user/totp/disable", jsonTokenMiddleware.ThenFunc(a.userTOTPDisablePost)).Methods(http.MethodPost)
+	a.Router.Handle("/user/totp/disable", authMiddleware.ThenFunc(a.userTOTPOptions)).Methods(http.MethodOptions)
+
+	bookCreateMiddleware := authMiddleware.Append(a.requirePermission(common.PermissionBookCreate))
+	bookManageMiddleware := authMiddleware.Append(a.requirePermission(common.PermissionBookManage))
+	bookReadMiddleware := authMiddleware.Append(a.requireScope(common.ScopeBookRead))
+	reviewWriteMiddleware := authMiddleware.Append(a.requireScope(common.ScopeReviewWrite))
+	progressReadMiddleware := authMiddleware.Append(a.requireScope(common.ScopeProgressRead))
+	progressWriteMiddleware := authMiddleware.Append(a.requireScope(common.ScopeProgressWrite))
+	a.Router.Handle("/books", bookReadMiddleware.ThenFunc(a.booksGet)).Methods(http.MethodGet)
+	a.Router.Handle("/books", bookCreateMiddleware.ThenFunc(a.booksPost)).Methods(http.MethodPost)
+	a.Router.Handle("/books", authMiddleware.ThenFunc(a.booksOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/books/import", bookCreateMiddleware.ThenFunc(a.booksImportPost)).Methods(http.MethodPost)
+	a.Router.Handle("/books/import", authMiddleware.ThenFunc(a.booksImportOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/books/{bookID}", bookReadMiddleware.ThenFunc(a.bookGet)).Methods(http.MethodGet)
+	a.Router.Handle("/books/{bookID}", bookManageMiddleware.ThenFunc(a.bookPatch)).Methods(http.MethodPatch)
+	a.Router.Handle("/books/{bookID}", bookManageMiddleware.ThenFunc(a.bookDelete)).Methods(http.MethodDelete)
+	a.Router.Handle("/books/{bookID}", authMiddleware.ThenFunc(a.bookOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/books/{bookID}/progress", progressWriteMiddleware.ThenFunc(a.bookProgressPut)).Methods(http.MethodPut)
+	a.Router.Handle("/books/{bookID}/progress", progressReadMiddleware.ThenFunc(a.bookProgressGet)).Methods(http.MethodGet)
+	a.Router.Handle("/books/{bookID}/progress", authMiddleware.ThenFunc(a.bookProgressOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/books/{bookID}/reviews", bookReadMiddleware.ThenFunc(a.bookReviewsGet)).Methods(http.MethodGet)
+	a.Router.Handle("/books/{bookID}/reviews", reviewWriteMiddleware.ThenFunc(a.bookReviewsPost)).Methods(http.MethodPost)
+	a.Router.Handle("/books/{bookID}/reviews", reviewWriteMiddleware.ThenFunc(a.bookReviewsPatch)).Methods(http.MethodPatch)
+	a.Router.Handle("/books/{bookID}/reviews", reviewWriteMiddleware.ThenFunc(a.bookReviewsDelete)).Methods(http.MethodDelete)
+	a.Router.Handle("/books/{bookID}/reviews", authMiddleware.ThenFunc(a.bookReviewsOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/books/{bookID}/reviews/{reviewID}/helpful", reviewWriteMiddleware.ThenFunc(a.bookReviewHelpfulPut)).Methods(http.MethodPut)
+	a.Router.Handle("/books/{bookID}/reviews/{reviewID}/helpful", reviewWriteMiddleware.ThenFunc(a.bookReviewHelpfulDelete)).Methods(http.MethodDelete)
+	a.Router.Handle("/books/{bookID}/reviews/{reviewID}/helpful", authMiddleware.ThenFunc(a.bookReviewHelpfulOptions)).Methods(http.MethodOptions)
+
+	clubCreateMiddleware := authMiddleware.Append(a.requirePermission(common.PermissionClubCreate))
+	clubReadMiddleware := authMiddleware.Append(a.requirePermission(common.PermissionClubRead))
+	clubModerateMiddleware := authMiddleware.Append(a.requirePermission(common.PermissionClubModerate))
+	clubManageMiddleware := authMiddleware.Append(a.requirePermission(common.PermissionClubManage))
+	// Anyone can see a club, a personal access token only needs the scope
+	clubScopeMiddleware := authMiddleware.Append(a.requireScope(common.PermissionClubRead))
+	a.Router.Handle("/clubs", clubCreateMiddleware.ThenFunc(a.clubsPost)).Methods(http.MethodPost)
+	a.Router.Handle("/clubs", authMiddleware.ThenFunc(a.clubsOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}", clubScopeMiddleware.ThenFunc(a.clubGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}", clubManageMiddleware.ThenFunc(a.clubPatch)).Methods(http.MethodPatch)
+	a.Router.Handle("/clubs/{clubID}", authMiddleware.ThenFunc(a.clubOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/join", authMiddleware.ThenFunc(a.clubJoinPost)).Methods(http.MethodPost)
+	a.Router.Handle("/clubs/{clubID}/join", authMiddleware.ThenFunc(a.clubMembershipOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/leave", authMiddleware.ThenFunc(a.clubLeavePost)).Methods(http.MethodPost)
+	a.Router.Handle("/clubs/{clubID}/leave", authMiddleware.ThenFunc(a.clubMembershipOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/members", clubReadMiddleware.ThenFunc(a.clubMembersGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/members", authMiddleware.ThenFunc(a.clubMembershipOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/members/{userID}", clubManageMiddleware.ThenFunc(a.clubMemberPatch)).Methods(http.MethodPatch)
+	a.Router.Handle("/clubs/{clubID}/members/{userID}", clubModerateMiddleware.ThenFunc(a.clubMemberDelete)).Methods(http.MethodDelete)
+	a.Router.Handle("/clubs/{clubID}/members/{userID}", authMiddleware.ThenFunc(a.clubMembershipOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/requests", clubModerateMiddleware.ThenFunc(a.clubJoinRequestsGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/requests", authMiddleware.ThenFunc(a.clubMembershipOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/requests/{userID}/approve", clubModerateMiddleware.ThenFunc(a.clubJoinRequestApprovePost)).Methods(http.MethodPost)
+	a.Router.Handle("/clubs/{clubID}/requests/{userID}/approve", authMiddleware.ThenFunc(a.clubMembershipOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/requests/{userID}", clubModerateMiddleware.ThenFunc(a.clubJoinRequestDelete)).Methods(http.MethodDelete)
+	a.Router.Handle("/clubs/{clubID}/requests/{userID}", authMiddleware.ThenFunc(a.clubMembershipOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/invites", clubManageMiddleware.ThenFunc(a.clubInvitesPost)).Methods(http.MethodPost)
+	a.Router.Handle("/clubs/{clubID}/invites", clubManageMiddleware.ThenFunc(a.clubInvitesGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/invites", authMiddleware.ThenFunc(a.clubInvitesOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/invites/{inviteID}", clubManageMiddleware.ThenFunc(a.clubInviteDelete)).Methods(http.MethodDelete)
+	a.Router.Handle("/clubs/{clubID}/invites/{inviteID}", authMiddleware.ThenFunc(a.clubInvitesOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/meetings", clubModerateMiddleware.ThenFunc(a.clubMeetingsPost)).Methods(http.MethodPost)
+	a.Router.Handle("/clubs/{clubID}/meetings", clubReadMiddleware.ThenFunc(a.clubMeetingsGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/meetings", authMiddleware.ThenFunc(a.clubMeetingsOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/meetings/{meetingID}", clubReadMiddleware.ThenFunc(a.clubMeetingGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/meetings/{meetingID}", clubModerateMiddleware.ThenFunc(a.clubMeetingPatch)).Methods(http.MethodPatch)
+	a.Router.Handle("/clubs/{clubID}/meetings/{meetingID}", clubModerateMiddleware.ThenFunc(a.clubMeetingDelete)).Methods(http.MethodDelete)
+	a.Router.Handle("/clubs/{clubID}/meetings/{meetingID}", authMiddleware.ThenFunc(a.clubMeetingOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/meetings/{meetingID}/rsvps", clubReadMiddleware.ThenFunc(a.clubMeetingRSVPsGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/meetings/{meetingID}/rsvps", authMiddleware.ThenFunc(a.clubMeetingRSVPOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/meetings/{meetingID}/rsvp", clubReadMiddleware.ThenFunc(a.clubMeetingRSVPPut)).Methods(http.MethodPut)
+	a.Router.Handle("/clubs/{clubID}/meetings/{meetingID}/rsvp", clubReadMiddleware.ThenFunc(a.clubMeetingRSVPDelete)).Methods(http.MethodDelete)
+	a.Router.Handle("/clubs/{clubID}/meetings/{meetingID}/rsvp", authMiddleware.ThenFunc(a.clubMeetingRSVPOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/plans", clubModerateMiddleware.ThenFunc(a.clubPlansPost)).Methods(http.MethodPost)
+	a.Router.Handle("/clubs/{clubID}/plans", clubReadMiddleware.ThenFunc(a.clubPlansGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/plans", authMiddleware.ThenFunc(a.clubPlansOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/plans/generate", clubModerateMiddleware.ThenFunc(a.clubPlansGeneratePost)).Methods(http.MethodPost)
+	a.Router.Handle("/clubs/{clubID}/plans/generate", authMiddleware.ThenFunc(a.clubPlansOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/plans/{planID}", clubReadMiddleware.ThenFunc(a.clubPlanGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/plans/{planID}", clubModerateMiddleware.ThenFunc(a.clubPlanPut)).Methods(http.MethodPut)
+	a.Router.Handle("/clubs/{clubID}/plans/{planID}", clubModerateMiddleware.ThenFunc(a.clubPlanDelete)).Methods(http.MethodDelete)
+	a.Router.Handle("/clubs/{clubID}/plans/{planID}", authMiddleware.ThenFunc(a.clubPlanOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/plans/{planID}/progress", clubReadMiddleware.ThenFunc(a.clubPlanProgressGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/plans/{planID}/progress", authMiddleware.ThenFunc(a.clubPlanOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/progress-sharing", clubReadMiddleware.ThenFunc(a.clubProgressSharingPut)).Methods(http.MethodPut)
+	a.Router.Handle("/clubs/{clubID}/progress-sharing", authMiddleware.ThenFunc(a.clubProgressSharingOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/threads", clubReadMiddleware.ThenFunc(a.clubThreadsGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/threads", clubReadMiddleware.ThenFunc(a.clubThreadsPost)).Methods(http.MethodPost)
+	a.Router.Handle("/clubs/{clubID}/threads", authMiddleware.ThenFunc(a.clubThreadsOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/threads/{threadID}", clubReadMiddleware.ThenFunc(a.clubThreadGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/threads/{threadID}", clubReadMiddleware.ThenFunc(a.clubThreadPatch)).Methods(http.MethodPatch)
+	a.Router.Handle("/clubs/{clubID}/threads/{threadID}", clubReadMiddleware.ThenFunc(a.clubThreadDelete)).Methods(http.MethodDelete)
+	a.Router.Handle("/clubs/{clubID}/threads/{threadID}", authMiddleware.ThenFunc(a.clubThreadOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/threads/{threadID}/posts", clubReadMiddleware.ThenFunc(a.clubThreadPostsGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/threads/{threadID}/posts", clubReadMiddleware.ThenFunc(a.clubThreadPostsPost)).Methods(http.MethodPost)
+	a.Router.Handle("/clubs/{clubID}/threads/{threadID}/posts", authMiddleware.ThenFunc(a.clubThreadPostsOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/threads/{threadID}/posts/{postID}", clubReadMiddleware.ThenFunc(a.clubThreadPostPatch)).Methods(http.MethodPatch)
+	a.Router.Handle("/clubs/{clubID}/threads/{threadID}/posts/{postID}", clubReadMiddleware.ThenFunc(a.clubThreadPostDelete)).Methods(http.MethodDelete)
+	a.Router.Handle("/clubs/{clubID}/threads/{threadID}/posts/{postID}", authMiddleware.ThenFunc(a.clubThreadPostOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/threads/{threadID}/posts/{postID}/history", clubReadMiddleware.ThenFunc(a.clubThreadPostHistoryGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/threads/{threadID}/posts/{postID}/history", authMiddleware.ThenFunc(a.clubThreadPostHistoryOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/nominations", clubReadMiddleware.ThenFunc(a.clubNominationsGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/nominations", clubReadMiddleware.ThenFunc(a.clubNominationsPost)).Methods(http.MethodPost)
+	a.Router.Handle("/clubs/{clubID}/nominations", authMiddleware.ThenFunc(a.clubNominationsOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/nominations/{nominationID}", clubReadMiddleware.ThenFunc(a.clubNominationDelete)).Methods(http.MethodDelete)
+	a.Router.Handle("/clubs/{clubID}/nominations/{nominationID}", authMiddleware.ThenFunc(a.clubNominationOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/polls", clubReadMiddleware.ThenFunc(a.clubPollsGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/polls", clubModerateMiddleware.ThenFunc(a.clubPollsPost)).Methods(http.MethodPost)
+	a.Router.Handle("/clubs/{clubID}/polls", authMiddleware.ThenFunc(a.clubPollsOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/polls/{pollID}", clubReadMiddleware.ThenFunc(a.clubPollGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/polls/{pollID}", clubModerateMiddleware.ThenFunc(a.clubPollDelete)).Methods(http.MethodDelete)
+	a.Router.Handle("/clubs/{clubID}/polls/{pollID}", authMiddleware.ThenFunc(a.clubPollOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/polls/{pollID}/close", clubModerateMiddleware.ThenFunc(a.clubPollClosePost)).Methods(http.MethodPost)
+	a.Router.Handle("/clubs/{clubID}/polls/{pollID}/close", authMiddleware.ThenFunc(a.clubPollCloseOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/polls/{pollID}/ballot", clubReadMiddleware.ThenFunc(a.clubPollBallotGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/polls/{pollID}/ballot", clubReadMiddleware.ThenFunc(a.clubPollBallotPut)).Methods(http.MethodPut)
+	a.Router.Handle("/clubs/{clubID}/polls/{pollID}/ballot", clubReadMiddleware.ThenFunc(a.clubPollBallotDelete)).Methods(http.MethodDelete)
+	a.Router.Handle("/clubs/{clubID}/polls/{pollID}/ballot", authMiddleware.ThenFunc(a.clubPollBallotOptions)).Methods(http.MethodOptions)
+	a.Router.Handle("/clubs/{clubID}/polls/{pollID}/results", clubReadMiddleware.ThenFunc(a.clubPollResultsGet)).Methods(http.MethodGet)
+	a.Router.Handle("/clubs/{clubID}/polls/{pollID}/results", authMiddleware.ThenFunc(a.clubPollResultsOptions)).Methods(http.MethodOptions)
+	a.Router.HandleFunc("/invites/{code}", a.inviteGet).Methods(http.MethodGet)
+	a.Router.HandleFunc("/invites/{code}", a.inviteOptions).Methods(http.MethodOptions)
+	a.Router.Handle("/invites/{code}/accept", authMiddleware.ThenFunc(a.inviteAcceptPost)).Methods(http.MethodPost)
+	a.Router.Handle("/invites/{code}/accept", authMiddleware.ThenFunc(a.inviteOptions)).Methods(http.MethodOptions)
+
+	userAdminMiddleware := authMiddleware.Append(a.requirePermission(common.PermissionUserAdmin))
+	a.Router.Handle("/admin/users/{userID}/erase", userAdminMiddleware.ThenFunc(a.adminUserErasePost)).Methods(http.MethodPost)
+	a.Router.Handle("/admin/users/{userID}/erase", authMiddleware.ThenFunc(a.adminUserEraseOptions)).Methods(http.MethodOptions)
 }
 
 func (a *app) respondWithError(w http.ResponseWriter, code int, message string) {
 	a.respondWithJSON(w, code, map[string]string{"error": message})
 }
 
+// authMiddleware accepts a JSON token or a personal access token as the Bearer token. A personal
+// access token is only accepted when the next middleware is requirePermission or requireScope, so a
+// route has to choose the scope a token needs to use it
 func (a *app) authMiddleware(next http.Handler) http.Handler {
+	_, scoped := next.(scopedHandler)
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		if err := a.util.CheckJSONToken(r.Header.Get("Authorization")); err != nil {
-			a.logrus.WithError(err).Debug("Ivalid JSON token. Redirecting user to homepage")
-			http.Redirect(w, r, "/login", http.StatusUnauthorized)
+		authorization := r.Header.Get("Authorization")
+		var claims *common.TokenClaims
+		var ok bool
+		if strings.HasPrefix(authorization, "Bearer "+common.PersonalAccessTokenPrefix) {
+			claims, ok = a.personalAccessTokenClaims(w, r, strings.TrimPrefix(authorization, "Bearer "))
+		} else {
+			claims, ok = a.jsonTokenClaims(w, r, authorization)
+		}
+		if !ok {
+			return
+		}
+		if claims.PersonalAccessToken && !scoped {
+			a.respondWithError(w, http.StatusForbidden, common.ErrPersonalAccessTokenNotAllowed.Error())
+			return
+		}
+		if !claims.EmailVerified && !a.unverifiedRouteAllowed(r) {
+			a.respondWithError(w, http.StatusForbidden, common.ErrEmailNotVerified.Error())
+			return
+		}
+		next.ServeHTTP(w, withRequestClaims(r, claims))
+	}
+	return http.HandlerFunc(fn)
+}
+
+// jsonTokenClaims verifies the JSON token and checks it has not been revoked. If it returns false
+// the response has already been written
+func (a *app) jsonTokenClaims(w http.ResponseWriter, r *http.Request, authorization string) (*common.TokenClaims, bool) {
+	claims, err := a.util.CheckJSONToken(authorization)
+	if err != nil {
+		a.logrus.WithError(err).Debug("Ivalid JSON token. Redirecting user to homepage")
+		http.Redirect(w, r, "/login", http.StatusUnauthorized)
+		return nil, false
+	}
+	revoked, err := a.warehouse.IsJSONTokenRevoked(claims)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to check if JSON token is revoked")
+		a.respondWithError(w, http.StatusInternalServerError, "Error checking JSON token")
+		return nil, false
+	}
+	if revoked {
+		a.logrus.WithError(common.ErrJSONTokenRevoked).Debug("Revoked JSON token. Redirecting user to homepage")
+		http.Redirect(w, r, "/login", http.StatusUnauthorized)
+		return nil, false
+	}
+	return claims, true
+}
+
+// requireJSONToken returns a middleware for routes behind authMiddleware that change the account or
+// its credentials, these need the user to have logged in rather than use a personal access token
+func (a *app) requireJSONToken(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := requestClaims(r); !ok || claims.PersonalAccessToken {
+			a.respondWithError(w, http.StatusForbidden, common.ErrPersonalAccessTokenNotAllowed.Error())
 			return
 		}
 		next.ServeHTTP(w, r)
@@ -85,6 +401,69 @@ func (a *app) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// scopedHandler is the handler of requirePermission and requireScope, which authMiddleware looks for
+// before it accepts a personal access token
+type scopedHandler struct {
+	http.HandlerFunc
+}
+
+// requirePermission returns a middleware for routes behind authMiddleware that need the permission.
+// Club permissions are checked for the club in the clubID route variable. The roles come from the
+// JSON token so a role change is only seen once the user gets a new token
+func (a *app) requirePermission(permission string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := requestClaims(r)
+			if !ok || !claims.HasPermission(permission, mux.Vars(r)["clubID"]) {
+				a.respondWithPermissionDenied(w, permission)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return scopedHandler{fn}
+	}
+}
+
+// requireScope returns a middleware for routes behind authMiddleware that any user can use, but a
+// personal access token only with the scope
+func (a *app) requireScope(scope string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := requestClaims(r)
+			if !ok || !claims.HasScope(scope) {
+				a.respondWithPermissionDenied(w, scope)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return scopedHandler{fn}
+	}
+}
+
+// respondWithPermissionDenied is the response for every request that is missing a permission
+func (a *app) respondWithPermissionDenied(w http.ResponseWriter, permission string) {
+	a.respondWithJSON(w, http.StatusForbidden, map[string]string{
+		"error":      common.ErrPermissionDenied.Error(),
+		"permission": permission,
+	})
+}
+
+// unverifiedRouteAllowed checks if the route can be used by a user who has not verified their email
+func (a *app) unverifiedRouteAllowed(r *http.Request) bool {
+	path := r.URL.Path
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			path = template
+		}
+	}
+	for _, allowed := range a.conf.UnverifiedRoutes {
+		if allowed == path {
+			return true
+		}
+	}
+	return false
+}
+
 func (a *app) respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	response, _ := json.Marshal(payload)
 	w.Header().Set("Content-Type", "application/json")
@@ -110,5 +489,5 @@ func (a *app) loadConfiguration(file string) error {
 func (a *app) optionsHeaders(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept, Authorization")
-	w.Header().Set("Access-Control-Allow-Methods", "POST")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
 }
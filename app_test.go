@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -8,19 +9,29 @@ import (
 
 	"github.com/garycarr/book_club/common"
 	"github.com/garycarr/book_club/util"
+	"github.com/garycarr/book_club/warehouse"
+	"github.com/justinas/alice"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 type authTestData struct {
 	description        string
 	expectedHTTPStatus int
 	jwToken            string
+	revoked            bool
 	validJWT           bool
 }
 
 func authJWTTestTable(t *testing.T) []authTestData {
-	util := util.NewUtil()
-	jwToken, err := util.CreateJSONToken(&common.User{
+	u, err := util.NewUtil(util.Config{
+		SecretKey:  make([]byte, 32),
+		SigningKey: util.KeyFile{ID: "test", File: "testdata/jwt_test_key.pem"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwToken, err := u.CreateJSONToken(&common.User{
 		ID:          "123",
 		Email:       "email@example.com",
 		DisplayName: "JSmith",
@@ -36,6 +47,13 @@ func authJWTTestTable(t *testing.T) []authTestData {
 			jwToken:            fmt.Sprintf("Bearer %s", jwToken),
 			validJWT:           true,
 		},
+		authTestData{
+			description:        "Revoked JWT",
+			expectedHTTPStatus: http.StatusUnauthorized,
+			jwToken:            fmt.Sprintf("Bearer %s", jwToken),
+			revoked:            true,
+			validJWT:           true,
+		},
 		authTestData{
 			description:        "Invalid JWT",
 			expectedHTTPStatus: http.StatusUnauthorized,
@@ -66,7 +84,163 @@ func authEndpointTests(t *testing.T, path string) {
 		}
 		req.Header.Add("Authorization", td.jwToken)
 		a, responseRecorder := setupTest(req)
+		mockWarehouse := warehouse.MockWarehouse{}
+		mockWarehouse.On("IsJSONTokenRevoked", mock.AnythingOfType("*common.TokenClaims")).Return(td.revoked, nil)
+		a.warehouse = &mockWarehouse
 		a.Router.ServeHTTP(responseRecorder, req)
 		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
 	}
 }
+
+func TestAuthMiddlewareUnverifiedEmail(t *testing.T) {
+	type testData struct {
+		description        string
+		emailVerified      bool
+		expectedHTTPStatus int
+		unverifiedRoutes   []string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Unverified email on an allowed route",
+			expectedHTTPStatus: http.StatusOK,
+			unverifiedRoutes:   []string{"/homepage"},
+		},
+		testData{
+			description:        "Unverified email on a route that needs verification",
+			expectedHTTPStatus: http.StatusForbidden,
+		},
+		testData{
+			description:        "Verified email",
+			emailVerified:      true,
+			expectedHTTPStatus: http.StatusOK,
+		},
+	}
+	validJWT := "JWT"
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodGet, "/homepage", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		req.Header.Add("Authorization", validJWT)
+		a, responseRecorder := setupTest(req)
+		a.conf.UnverifiedRoutes = td.unverifiedRoutes
+		claims := &common.TokenClaims{ID: "jti", EmailVerified: td.emailVerified}
+		mockUtil := util.MockUtil{}
+		mockUtil.On("CheckJSONToken", validJWT).Return(claims, nil)
+		mockWarehouse := warehouse.MockWarehouse{}
+		mockWarehouse.On("IsJSONTokenRevoked", claims).Return(false, nil)
+		a.util = &mockUtil
+		a.warehouse = &mockWarehouse
+		a.Router.ServeHTTP(responseRecorder, req)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	type testData struct {
+		description        string
+		claims             *common.TokenClaims
+		expectedHTTPStatus int
+		path               string
+		permission         string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Club owner can manage the club",
+			claims:             &common.TokenClaims{ClubRoles: map[string]string{"club1": common.ClubRoleOwner}},
+			expectedHTTPStatus: http.StatusOK,
+			path:               "/test/clubs/club1",
+			permission:         common.PermissionClubManage,
+		},
+		testData{
+			description:        "Club moderator can not manage the club",
+			claims:             &common.TokenClaims{ClubRoles: map[string]string{"club1": common.ClubRoleModerator}},
+			expectedHTTPStatus: http.StatusForbidden,
+			path:               "/test/clubs/club1",
+			permission:         common.PermissionClubManage,
+		},
+		testData{
+			description:        "Club moderator can moderate the club",
+			claims:             &common.TokenClaims{ClubRoles: map[string]string{"club1": common.ClubRoleModerator}},
+			expectedHTTPStatus: http.StatusOK,
+			path:               "/test/clubs/club1",
+			permission:         common.PermissionClubModerate,
+		},
+		testData{
+			description:        "Club owner can not manage another club",
+			claims:             &common.TokenClaims{ClubRoles: map[string]string{"club1": common.ClubRoleOwner}},
+			expectedHTTPStatus: http.StatusForbidden,
+			path:               "/test/clubs/club2",
+			permission:         common.PermissionClubManage,
+		},
+		testData{
+			description:        "Site admin can manage any club",
+			claims:             &common.TokenClaims{Roles: []string{common.RoleAdmin}},
+			expectedHTTPStatus: http.StatusOK,
+			path:               "/test/clubs/club2",
+			permission:         common.PermissionClubManage,
+		},
+		testData{
+			description:        "Site member can create a club",
+			claims:             &common.TokenClaims{Roles: []string{common.RoleMember}},
+			expectedHTTPStatus: http.StatusOK,
+			path:               "/test/clubs/club1",
+			permission:         common.PermissionClubCreate,
+		},
+		testData{
+			description:        "Site member is not an admin",
+			claims:             &common.TokenClaims{Roles: []string{common.RoleMember}},
+			expectedHTTPStatus: http.StatusForbidden,
+			path:               "/test/clubs/club1",
+			permission:         common.PermissionUserAdmin,
+		},
+		testData{
+			description: "Personal access token with the scope",
+			claims: &common.TokenClaims{ClubRoles: map[string]string{"club1": common.ClubRoleOwner},
+				PersonalAccessToken: true, Scopes: []string{common.PermissionClubManage}},
+			expectedHTTPStatus: http.StatusOK,
+			path:               "/test/clubs/club1",
+			permission:         common.PermissionClubManage,
+		},
+		testData{
+			description: "Personal access token without the scope",
+			claims: &common.TokenClaims{Roles: []string{common.RoleAdmin},
+				PersonalAccessToken: true, Scopes: []string{common.PermissionClubRead}},
+			expectedHTTPStatus: http.StatusForbidden,
+			path:               "/test/clubs/club1",
+			permission:         common.PermissionClubManage,
+		},
+	}
+	validJWT := "JWT"
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodGet, td.path, nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		req.Header.Add("Authorization", validJWT)
+		a, responseRecorder := setupTest(req)
+		td.claims.EmailVerified = true
+		mockUtil := util.MockUtil{}
+		mockUtil.On("CheckJSONToken", validJWT).Return(td.claims, nil)
+		mockWarehouse := warehouse.MockWarehouse{}
+		mockWarehouse.On("IsJSONTokenRevoked", td.claims).Return(false, nil)
+		a.util = &mockUtil
+		a.warehouse = &mockWarehouse
+		a.Router.Handle("/test/clubs/{clubID}", alice.New(a.authMiddleware, a.requirePermission(td.permission)).ThenFunc(a.homePageGet))
+		a.Router.ServeHTTP(responseRecorder, req)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			continue
+		}
+		if td.expectedHTTPStatus == http.StatusForbidden {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Equal(t, common.ErrPermissionDenied.Error(), jsonResp["error"], td.description)
+			assert.Equal(t, td.permission, jsonResp["permission"], td.description)
+		}
+	}
+}
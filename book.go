@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/gorilla/mux"
+)
+
+// booksGet lists the catalog a page at a time. The title, author and isbn query parameters filter
+// the list
+func (a *app) booksGet(w http.ResponseWriter, r *http.Request) {
+	pagination, ok := a.requestPagination(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	filter := common.BookFilter{
+		Title:      query.Get("title"),
+		Author:     query.Get("author"),
+		ISBN:       common.NormaliseISBN(query.Get("isbn")),
+		Pagination: pagination,
+	}
+	books, total, err := a.warehouse.ListBooks(filter)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to list books")
+		a.respondWithError(w, http.StatusInternalServerError, "Error listing the books")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"books":  books,
+		"total":  total,
+		"limit":  pagination.Limit,
+		"offset": pagination.Offset,
+	})
+}
+
+// booksPost adds a book to the catalog
+func (a *app) booksPost(w http.ResponseWriter, r *http.Request) {
+	book := &common.Book{}
+	if err := json.NewDecoder(r.Body).Decode(&book.BookDetails); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := book.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	if err := a.warehouse.CreateBook(book); err != nil {
+		if err == common.ErrBookAlreadyExists {
+			a.respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to create book")
+		a.respondWithError(w, http.StatusInternalServerError, "Error creating the book")
+		return
+	}
+	a.respondWithJSON(w, http.StatusCreated, book)
+}
+
+// booksOptions returns the allowed options
+func (a *app) booksOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// bookGet returns a single book
+func (a *app) bookGet(w http.ResponseWriter, r *http.Request) {
+	book, ok := a.requestBook(w, r)
+	if !ok {
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, book)
+}
+
+// bookPatch changes the details of a book, the changed book has to pass the same checks as a new one
+func (a *app) bookPatch(w http.ResponseWriter, r *http.Request) {
+	bur := common.BookUpdateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&bur); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := bur.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	book, ok := a.requestBook(w, r)
+	if !ok {
+		return
+	}
+	bur.Apply(&book.BookDetails)
+	if err := book.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	if err := a.warehouse.UpdateBook(book); err != nil {
+		switch err {
+		case common.ErrBookNotFound:
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+		case common.ErrBookAlreadyExists:
+			a.respondWithError(w, http.StatusConflict, err.Error())
+		default:
+			a.logrus.WithError(err).Error("Unable to update book")
+			a.respondWithError(w, http.StatusInternalServerError, "Error updating the book")
+		}
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, book)
+}
+
+// bookDelete removes a book from the catalog
+func (a *app) bookDelete(w http.ResponseWriter, r *http.Request) {
+	if err := a.warehouse.DeleteBook(mux.Vars(r)["bookID"]); err != nil {
+		if err == common.ErrBookNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to delete book")
+		a.respondWithError(w, http.StatusInternalServerError, "Error deleting the book")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Book deleted"})
+}
+
+// bookOptions returns the allowed options
+func (a *app) bookOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// requestBook loads the book in the bookID route variable. If it returns false the error response
+// has already been written
+func (a *app) requestBook(w http.ResponseWriter, r *http.Request) (*common.Book, bool) {
+	book, err := a.warehouse.GetBook(mux.Vars(r)["bookID"])
+	if err != nil {
+		if err == common.ErrBookNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return nil, false
+		}
+		a.logrus.WithError(err).Error("Unable to get book")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the book")
+		return nil, false
+	}
+	return book, true
+}
+
+// lookupBook loads a book given in the body of a request, so a missing book is a bad request rather
+// than not found. If it returns false the error response has already been written
+func (a *app) lookupBook(w http.ResponseWriter, bookID string) (*common.Book, bool) {
+	book, err := a.warehouse.GetBook(bookID)
+	if err != nil {
+		if err == common.ErrBookNotFound {
+			a.respondWithError(w, http.StatusBadRequest, err.Error())
+			return nil, false
+		}
+		a.logrus.WithError(err).Error("Unable to get book")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the book")
+		return nil, false
+	}
+	return book, true
+}
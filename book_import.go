@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+)
+
+// bookMetadataMissExpiration is how long an ISBN the metadata provider did not know is remembered
+// for, after that it is looked up again in case the provider has added it
+const bookMetadataMissExpiration = time.Duration(24 * time.Hour)
+
+// booksImportPost adds a book to the catalog from the details the metadata provider has for an ISBN
+func (a *app) booksImportPost(w http.ResponseWriter, r *http.Request) {
+	bir := common.BookImportRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&bir); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := bir.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	existing, _, err := a.warehouse.ListBooks(common.BookFilter{ISBN: bir.ISBN, Pagination: common.Pagination{Limit: 1}})
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to list books")
+		a.respondWithError(w, http.StatusInternalServerError, "Error importing the book")
+		return
+	}
+	if len(existing) > 0 {
+		a.respondWithJSON(w, http.StatusConflict, map[string]interface{}{
+			"error": common.ErrBookAlreadyExists.Error(),
+			"book":  existing[0],
+		})
+		return
+	}
+	details, err := a.bookMetadata(bir.ISBN)
+	if err != nil {
+		if err == common.ErrBookMetadataNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to look up book metadata")
+		a.respondWithError(w, http.StatusBadGateway, "Error looking up the ISBN")
+		return
+	}
+	book := &common.Book{BookDetails: *details}
+	book.ISBN13 = bir.ISBN
+	book.ISBN10 = common.ISBN13To10(bir.ISBN)
+	if err = book.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).WithField("isbn", bir.ISBN).Warn("Metadata provider returned invalid book details")
+		a.respondWithError(w, http.StatusBadGateway, common.ErrBookMetadataInvalid.Error())
+		return
+	}
+	if err = a.warehouse.CreateBook(book); err != nil {
+		if err == common.ErrBookAlreadyExists {
+			a.respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to create book")
+		a.respondWithError(w, http.StatusInternalServerError, "Error importing the book")
+		return
+	}
+	a.respondWithJSON(w, http.StatusCreated, book)
+}
+
+// booksImportOptions returns the allowed options
+func (a *app) booksImportOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// bookMetadata returns the details for the ISBN-13, from the warehouse if it has been looked up
+// before and otherwise from the metadata provider. Provider errors are not cached so the lookup is
+// tried again next time
+func (a *app) bookMetadata(isbn13 string) (*common.BookDetails, error) {
+	cached, err := a.warehouse.GetBookMetadata(isbn13)
+	if err == nil {
+		if cached.Details != nil {
+			return cached.Details, nil
+		}
+		if time.Since(cached.FetchedAt) < bookMetadataMissExpiration {
+			return nil, common.ErrBookMetadataNotFound
+		}
+	} else if err != common.ErrBookMetadataNotCached {
+		return nil, err
+	}
+	details, err := a.metadataProvider.Lookup(isbn13)
+	if err != nil && err != common.ErrBookMetadataNotFound {
+		return nil, err
+	}
+	if err := a.warehouse.SaveBookMetadata(common.BookMetadata{ISBN13: isbn13, Details: details, FetchedAt: time.Now()}); err != nil {
+		// The import can still go ahead, the ISBN is just looked up again next time
+		a.logrus.WithError(err).Error("Unable to cache book metadata")
+	}
+	if details == nil {
+		return nil, common.ErrBookMetadataNotFound
+	}
+	return details, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBooksImportPost(t *testing.T) {
+	type testData struct {
+		description        string
+		cached             *common.BookMetadata
+		existing           []common.Book
+		expectedError      error
+		expectedHTTPStatus int
+		isbn               string
+		lookedUp           bool
+		lookupDetails      *common.BookDetails
+		lookupError        error
+	}
+
+	details := &common.BookDetails{Title: "Dune", Authors: []string{"Frank Herbert"}, PageCount: 535}
+	testTable := []testData{
+		testData{
+			description:        "Looks up an ISBN-10 as an ISBN-13 and caches it",
+			expectedHTTPStatus: http.StatusCreated,
+			isbn:               "0-441-17271-7",
+			lookedUp:           true,
+			lookupDetails:      details,
+		},
+		testData{
+			description:        "Uses the cached details",
+			cached:             &common.BookMetadata{ISBN13: "9780441172719", Details: details, FetchedAt: time.Now().Add(-48 * time.Hour)},
+			expectedHTTPStatus: http.StatusCreated,
+			isbn:               "9780441172719",
+		},
+		testData{
+			description:        "Recently cached miss",
+			cached:             &common.BookMetadata{ISBN13: "9780441172719", FetchedAt: time.Now().Add(-time.Hour)},
+			expectedError:      common.ErrBookMetadataNotFound,
+			expectedHTTPStatus: http.StatusNotFound,
+			isbn:               "9780441172719",
+		},
+		testData{
+			description:        "Old cached miss is looked up again",
+			cached:             &common.BookMetadata{ISBN13: "9780441172719", FetchedAt: time.Now().Add(-48 * time.Hour)},
+			expectedHTTPStatus: http.StatusCreated,
+			isbn:               "9780441172719",
+			lookedUp:           true,
+			lookupDetails:      details,
+		},
+		testData{
+			description:        "Provider does not know the book",
+			expectedError:      common.ErrBookMetadataNotFound,
+			expectedHTTPStatus: http.StatusNotFound,
+			isbn:               "9780441172719",
+			lookedUp:           true,
+			lookupError:        common.ErrBookMetadataNotFound,
+		},
+		testData{
+			description:        "Provider failure is not cached",
+			expectedHTTPStatus: http.StatusBadGateway,
+			isbn:               "9780441172719",
+			lookupError:        errors.New("connection refused"),
+		},
+		testData{
+			description:        "Provider details are not valid",
+			expectedError:      common.ErrBookMetadataInvalid,
+			expectedHTTPStatus: http.StatusBadGateway,
+			isbn:               "9780441172719",
+			lookedUp:           true,
+			lookupDetails:      &common.BookDetails{Authors: []string{"Frank Herbert"}},
+		},
+		testData{
+			description:        "Already in the catalog",
+			existing:           []common.Book{*validBook()},
+			expectedError:      common.ErrBookAlreadyExists,
+			expectedHTTPStatus: http.StatusConflict,
+			isbn:               "9780441172719",
+		},
+		testData{
+			description:        "Check digit is wrong",
+			expectedError:      common.ErrBookISBNInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			isbn:               "0441172718",
+		},
+		testData{
+			description:        "ISBN not present",
+			expectedError:      common.ErrBookISBNNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+		},
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(map[string]string{"isbn": td.isbn})
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/books/import", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, memberClaims)
+		mockProvider := metadata.MockProvider{}
+		a.metadataProvider = &mockProvider
+		isbn13 := "9780441172719"
+		if td.expectedHTTPStatus != http.StatusBadRequest {
+			mockWarehouse.On("ListBooks", common.BookFilter{ISBN: isbn13, Pagination: common.Pagination{Limit: 1}}).
+				Return(td.existing, len(td.existing), nil)
+		}
+		if td.existing == nil && td.expectedHTTPStatus != http.StatusBadRequest {
+			if td.cached != nil {
+				mockWarehouse.On("GetBookMetadata", isbn13).Return(td.cached, nil)
+			} else {
+				mockWarehouse.On("GetBookMetadata", isbn13).Return(nil, common.ErrBookMetadataNotCached)
+			}
+		}
+		if td.lookedUp || td.lookupError != nil {
+			mockProvider.On("Lookup", isbn13).Return(td.lookupDetails, td.lookupError)
+		}
+		if td.lookedUp {
+			mockWarehouse.On("SaveBookMetadata", mock.MatchedBy(func(bm common.BookMetadata) bool {
+				return bm.ISBN13 == isbn13 && bm.Details == td.lookupDetails && time.Since(bm.FetchedAt) < time.Minute
+			})).Return(nil)
+		}
+		if td.expectedHTTPStatus == http.StatusCreated {
+			expected := &common.Book{BookDetails: *details}
+			expected.ISBN10 = "0441172717"
+			expected.ISBN13 = isbn13
+			mockWarehouse.On("CreateBook", expected).Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		mockProvider.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]interface{}{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+		}
+	}
+}
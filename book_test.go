@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	memberClaims = &common.TokenClaims{UserID: validUserID, EmailVerified: true, Roles: []string{common.RoleMember}}
+	adminClaims  = &common.TokenClaims{UserID: "adminID", EmailVerified: true, Roles: []string{common.RoleAdmin}}
+)
+
+func validBook() *common.Book {
+	now := time.Now().Round(time.Second)
+	return &common.Book{
+		ID: "bookID",
+		BookDetails: common.BookDetails{
+			Title:         "The Left Hand of Darkness",
+			Authors:       []string{"Ursula K. Le Guin"},
+			ISBN10:        "0441478123",
+			ISBN13:        "9780441478125",
+			Publisher:     "Ace Books",
+			PublishedDate: "1969",
+			PageCount:     286,
+			Language:      "en",
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func TestBooksGet(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedError      error
+		expectedFilter     common.BookFilter
+		expectedHTTPStatus int
+		query              string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "First page by default",
+			expectedFilter:     common.BookFilter{Pagination: common.Pagination{Limit: common.DefaultPageLimit}},
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description: "Filters and a page",
+			expectedFilter: common.BookFilter{Title: "darkness", Author: "le guin", ISBN: "0441478123",
+				Pagination: common.Pagination{Limit: 5, Offset: 10}},
+			expectedHTTPStatus: http.StatusOK,
+			query:              "?title=darkness&author=le+guin&isbn=0-441-47812-3&limit=5&offset=10",
+		},
+		testData{
+			description:        "Limit too large",
+			expectedError:      common.ErrPaginationInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			query:              "?limit=1000",
+		},
+		testData{
+			description:        "Offset not a number",
+			expectedError:      common.ErrPaginationInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			query:              "?offset=ten",
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodGet, "/books"+td.query, nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, memberClaims)
+		if td.expectedError == nil {
+			mockWarehouse.On("ListBooks", td.expectedFilter).Return([]common.Book{*validBook()}, 1, nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+			continue
+		}
+		jsonResp := struct {
+			Books  []common.Book `json:"books"`
+			Total  int           `json:"total"`
+			Limit  int           `json:"limit"`
+			Offset int           `json:"offset"`
+		}{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		assert.Equal(t, 1, jsonResp.Total, td.description)
+		assert.Equal(t, td.expectedFilter.Limit, jsonResp.Limit, td.description)
+		assert.Equal(t, td.expectedFilter.Offset, jsonResp.Offset, td.description)
+		if assert.Len(t, jsonResp.Books, 1, td.description) {
+			assert.Equal(t, validBook().Title, jsonResp.Books[0].Title, td.description)
+		}
+	}
+}
+
+func TestBooksPost(t *testing.T) {
+	type testData struct {
+		description        string
+		claims             *common.TokenClaims
+		createError        error
+		expectedBook       *common.BookDetails
+		expectedError      error
+		expectedHTTPStatus int
+		params             map[string]interface{}
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Adds the book and works out the ISBN-13",
+			claims:      memberClaims,
+			expectedBook: &common.BookDetails{Title: "The Left Hand of Darkness", Authors: []string{"Ursula K. Le Guin"},
+				ISBN10: "0441478123", ISBN13: "9780441478125", Language: "en"},
+			expectedHTTPStatus: http.StatusCreated,
+			params: map[string]interface{}{"title": " The Left Hand of Darkness ", "authors": []string{"Ursula K. Le Guin"},
+				"isbn10": "0-441-47812-3", "language": "EN"},
+		},
+		testData{
+			description:        "Title not present",
+			claims:             memberClaims,
+			expectedError:      common.ErrBookTitleNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"isbn13": "9780441478125"},
+		},
+		testData{
+			description:        "ISBN-13 check digit is wrong",
+			claims:             memberClaims,
+			expectedError:      common.ErrBookISBN13Invalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"title": "Dune", "isbn13": "9780441478126"},
+		},
+		testData{
+			description:        "ISBNs are for different books",
+			claims:             memberClaims,
+			expectedError:      common.ErrBookISBNMismatch,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"title": "Dune", "isbn10": "0441478123", "isbn13": "9780306406157"},
+		},
+		testData{
+			description:        "Published date is not a date",
+			claims:             memberClaims,
+			expectedError:      common.ErrBookPublishedDateInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"title": "Dune", "publishedDate": "March 1969"},
+		},
+		testData{
+			description:        "Cover URL is not http",
+			claims:             memberClaims,
+			expectedError:      common.ErrBookCoverURLInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"title": "Dune", "coverURL": "javascript:alert(1)"},
+		},
+		testData{
+			description:        "ISBN already in the catalog",
+			claims:             memberClaims,
+			createError:        common.ErrBookAlreadyExists,
+			expectedBook:       &common.BookDetails{Title: "Dune", Authors: []string{}, ISBN13: "9780441478125"},
+			expectedError:      common.ErrBookAlreadyExists,
+			expectedHTTPStatus: http.StatusConflict,
+			params:             map[string]interface{}{"title": "Dune", "isbn13": "978-0-441-47812-5"},
+		},
+		testData{
+			description: "Personal access token without the scope",
+			claims: &common.TokenClaims{UserID: validUserID, EmailVerified: true, Roles: []string{common.RoleMember},
+				PersonalAccessToken: true, Scopes: []string{common.PermissionClubRead}},
+			expectedError:      common.ErrPermissionDenied,
+			expectedHTTPStatus: http.StatusForbidden,
+			params:             map[string]interface{}{"title": "Dune"},
+		},
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/books", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, td.claims)
+		if td.expectedBook != nil {
+			mockWarehouse.On("CreateBook", &common.Book{BookDetails: *td.expectedBook}).Return(td.createError).
+				Run(func(args mock.Arguments) {
+					args.Get(0).(*common.Book).ID = "bookID"
+				})
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+			continue
+		}
+		book := common.Book{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&book); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		assert.Equal(t, "bookID", book.ID, td.description)
+		assert.Equal(t, *td.expectedBook, book.BookDetails, td.description)
+	}
+}
+
+func TestBookGet(t *testing.T) {
+	for _, found := range []bool{true, false} {
+		req, err := http.NewRequest(http.MethodGet, "/books/bookID", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request: %v", err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, memberClaims)
+		expectedHTTPStatus := http.StatusOK
+		if found {
+			mockWarehouse.On("GetBook", "bookID").Return(validBook(), nil)
+		} else {
+			mockWarehouse.On("GetBook", "bookID").Return(nil, common.ErrBookNotFound)
+			expectedHTTPStatus = http.StatusNotFound
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, expectedHTTPStatus, responseRecorder.Code)
+	}
+}
+
+func TestBookPatch(t *testing.T) {
+	type testData struct {
+		description        string
+		claims             *common.TokenClaims
+		expectedError      error
+		expectedHTTPStatus int
+		getError           error
+		params             map[string]interface{}
+		updated            func(*common.Book)
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Changes the page count",
+			claims:             adminClaims,
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]interface{}{"pageCount": 304},
+			updated:            func(b *common.Book) { b.PageCount = 304 },
+		},
+		testData{
+			description:        "Changing the ISBN-10 has to match the ISBN-13",
+			claims:             adminClaims,
+			expectedError:      common.ErrBookISBNMismatch,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"isbn10": "0306406152"},
+		},
+		testData{
+			description:        "No fields",
+			claims:             adminClaims,
+			expectedError:      common.ErrBookUpdateNoFields,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{},
+		},
+		testData{
+			description:        "Unknown book",
+			claims:             adminClaims,
+			expectedError:      common.ErrBookNotFound,
+			expectedHTTPStatus: http.StatusNotFound,
+			getError:           common.ErrBookNotFound,
+			params:             map[string]interface{}{"pageCount": 304},
+		},
+		testData{
+			description:        "Members can not change books",
+			claims:             memberClaims,
+			expectedError:      common.ErrPermissionDenied,
+			expectedHTTPStatus: http.StatusForbidden,
+			params:             map[string]interface{}{"pageCount": 304},
+		},
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPatch, "/books/bookID", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, td.claims)
+		if td.getError != nil {
+			mockWarehouse.On("GetBook", "bookID").Return(nil, td.getError)
+		} else if td.expectedHTTPStatus != http.StatusForbidden && td.expectedError != common.ErrBookUpdateNoFields {
+			mockWarehouse.On("GetBook", "bookID").Return(validBook(), nil)
+		}
+		if td.updated != nil {
+			expected := validBook()
+			td.updated(expected)
+			mockWarehouse.On("UpdateBook", expected).Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+		}
+	}
+}
+
+func TestBookDelete(t *testing.T) {
+	type testData struct {
+		description        string
+		claims             *common.TokenClaims
+		deleteError        error
+		expectedHTTPStatus int
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Admin deletes the book",
+			claims:             adminClaims,
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description:        "Unknown or deleted book",
+			claims:             adminClaims,
+			deleteError:        common.ErrBookNotFound,
+			expectedHTTPStatus: http.StatusNotFound,
+		},
+		testData{
+			description:        "Members can not delete books",
+			claims:             memberClaims,
+			expectedHTTPStatus: http.StatusForbidden,
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodDelete, "/books/bookID", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, td.claims)
+		if td.expectedHTTPStatus != http.StatusForbidden {
+			mockWarehouse.On("DeleteBook", "bookID").Return(td.deleteError)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
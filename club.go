@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/gorilla/mux"
+)
+
+// clubsPost creates a club with the current user as its owner. The owner role is in the JSON token
+// once the user refreshes it
+func (a *app) clubsPost(w http.ResponseWriter, r *http.Request) {
+	cr := common.ClubRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&cr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := cr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	club := &common.Club{Name: cr.Name, Description: cr.Description, Visibility: cr.Visibility}
+	if err := a.warehouse.CreateClub(club, claims.UserID); err != nil {
+		a.logrus.WithError(err).Error("Unable to create club")
+		a.respondWithError(w, http.StatusInternalServerError, "Error creating the club")
+		return
+	}
+	a.respondWithJSON(w, http.StatusCreated, club)
+}
+
+// clubsOptions returns the allowed options
+func (a *app) clubsOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubGet returns a club. Private clubs are only shown to their members
+func (a *app) clubGet(w http.ResponseWriter, r *http.Request) {
+	club, ok := a.requestClub(w, r)
+	if !ok {
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, club)
+}
+
+// clubPatch changes the name, description or visibility of a club
+func (a *app) clubPatch(w http.ResponseWriter, r *http.Request) {
+	cur := common.ClubUpdateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&cur); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := cur.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	club, ok := a.requestClub(w, r)
+	if !ok {
+		return
+	}
+	if err := cur.Apply(club); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	if err := a.warehouse.UpdateClub(club); err != nil {
+		if err == common.ErrClubNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to update club")
+		a.respondWithError(w, http.StatusInternalServerError, "Error updating the club")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, club)
+}
+
+// clubOptions returns the allowed options
+func (a *app) clubOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubJoinPost makes the current user a member of a public club, or asks to join a private club
+func (a *app) clubJoinPost(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	pending, err := a.warehouse.JoinClub(mux.Vars(r)["clubID"], claims.UserID)
+	if err != nil {
+		switch err {
+		case common.ErrClubNotFound:
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+		case common.ErrClubAlreadyMember, common.ErrClubJoinRequestExists:
+			a.respondWithError(w, http.StatusConflict, err.Error())
+		default:
+			a.logrus.WithError(err).Error("Unable to join club")
+			a.respondWithError(w, http.StatusInternalServerError, "Error joining the club")
+		}
+		return
+	}
+	if pending {
+		a.respondWithJSON(w, http.StatusAccepted, map[string]string{"message": "Asked to join the club"})
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Joined the club"})
+}
+
+// clubLeavePost takes the current user out of a club, or withdraws their request to join it
+func (a *app) clubLeavePost(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	if err := a.warehouse.LeaveClub(mux.Vars(r)["clubID"], claims.UserID); err != nil {
+		switch err {
+		case common.ErrClubNotFound, common.ErrClubNotMember:
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+		case common.ErrClubLastOwner:
+			a.respondWithError(w, http.StatusConflict, err.Error())
+		default:
+			a.logrus.WithError(err).Error("Unable to leave club")
+			a.respondWithError(w, http.StatusInternalServerError, "Error leaving the club")
+		}
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Left the club"})
+}
+
+// clubMembershipOptions returns the allowed options
+func (a *app) clubMembershipOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubMembersGet lists the members of a club a page at a time
+func (a *app) clubMembersGet(w http.ResponseWriter, r *http.Request) {
+	pagination, ok := a.requestPagination(w, r)
+	if !ok {
+		return
+	}
+	members, total, err := a.warehouse.ListClubMembers(mux.Vars(r)["clubID"], pagination)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to list club members")
+		a.respondWithError(w, http.StatusInternalServerError, "Error listing the club members")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"members": members,
+		"total":   total,
+		"limit":   pagination.Limit,
+		"offset":  pagination.Offset,
+	})
+}
+
+// clubMemberPatch changes the role of a member of a club
+func (a *app) clubMemberPatch(w http.ResponseWriter, r *http.Request) {
+	crr := common.ClubRoleRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&crr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := crr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	member, ok := a.requestClubMember(w, r)
+	if !ok {
+		return
+	}
+	if err := a.warehouse.ChangeClubRole(mux.Vars(r)["clubID"], member.UserID, crr.Role); err != nil {
+		switch err {
+		case common.ErrClubNotFound, common.ErrClubNotMember:
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+		case common.ErrClubLastOwner:
+			a.respondWithError(w, http.StatusConflict, err.Error())
+		default:
+			a.logrus.WithError(err).Error("Unable to change club role")
+			a.respondWithError(w, http.StatusInternalServerError, "Error changing the role")
+		}
+		return
+	}
+	member.Role = crr.Role
+	a.respondWithJSON(w, http.StatusOK, member)
+}
+
+// clubMemberDelete removes a member from a club. Moderators can remove members, removing a moderator
+// needs club:manage and owners have to be given another role before they can be removed
+func (a *app) clubMemberDelete(w http.ResponseWriter, r *http.Request) {
+	member, ok := a.requestClubMember(w, r)
+	if !ok {
+		return
+	}
+	clubID := mux.Vars(r)["clubID"]
+	switch member.Role {
+	case common.ClubRoleOwner:
+		a.respondWithError(w, http.StatusConflict, common.ErrClubOwnerNotRemovable.Error())
+		return
+	case common.ClubRoleModerator:
+		if claims, ok := requestClaims(r); !ok || !claims.HasPermission(common.PermissionClubManage, clubID) {
+			a.respondWithPermissionDenied(w, common.PermissionClubManage)
+			return
+		}
+	}
+	if err := a.warehouse.DeleteClubRole(clubID, member.UserID); err != nil {
+		a.logrus.WithError(err).Error("Unable to remove club member")
+		a.respondWithError(w, http.StatusInternalServerError, "Error removing the member")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Member removed"})
+}
+
+// clubJoinRequestsGet lists the requests to join a club a page at a time, oldest first
+func (a *app) clubJoinRequestsGet(w http.ResponseWriter, r *http.Request) {
+	pagination, ok := a.requestPagination(w, r)
+	if !ok {
+		return
+	}
+	requests, total, err := a.warehouse.ListClubJoinRequests(mux.Vars(r)["clubID"], pagination)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to list club join requests")
+		a.respondWithError(w, http.StatusInternalServerError, "Error listing the join requests")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"requests": requests,
+		"total":    total,
+		"limit":    pagination.Limit,
+		"offset":   pagination.Offset,
+	})
+}
+
+// clubJoinRequestApprovePost lets a user who asked to join a club in as a member
+func (a *app) clubJoinRequestApprovePost(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := a.warehouse.ApproveClubJoinRequest(vars["clubID"], vars["userID"]); err != nil {
+		if err == common.ErrClubJoinRequestNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to approve club join request")
+		a.respondWithError(w, http.StatusInternalServerError, "Error approving the join request")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Join request approved"})
+}
+
+// clubJoinRequestDelete turns down a request to join a club
+func (a *app) clubJoinRequestDelete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := a.warehouse.RejectClubJoinRequest(vars["clubID"], vars["userID"]); err != nil {
+		if err == common.ErrClubJoinRequestNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to reject club join request")
+		a.respondWithError(w, http.StatusInternalServerError, "Error rejecting the join request")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Join request rejected"})
+}
+
+// requestClub loads the club in the clubID route variable. A private club is not found unless the
+// user can read it. If it returns false the error response has already been written
+func (a *app) requestClub(w http.ResponseWriter, r *http.Request) (*common.Club, bool) {
+	clubID := mux.Vars(r)["clubID"]
+	club, err := a.warehouse.GetClub(clubID)
+	if err != nil {
+		if err == common.ErrClubNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return nil, false
+		}
+		a.logrus.WithError(err).Error("Unable to get club")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the club")
+		return nil, false
+	}
+	if club.Visibility == common.ClubVisibilityPrivate {
+		if claims, ok := requestClaims(r); !ok || !claims.HasPermission(common.PermissionClubRead, clubID) {
+			a.respondWithError(w, http.StatusNotFound, common.ErrClubNotFound.Error())
+			return nil, false
+		}
+	}
+	return club, true
+}
+
+// requestClubMember loads the member in the userID route variable of the club in the clubID route
+// variable. If it returns false the error response has already been written
+func (a *app) requestClubMember(w http.ResponseWriter, r *http.Request) (*common.ClubMember, bool) {
+	vars := mux.Vars(r)
+	member, err := a.warehouse.GetClubMember(vars["clubID"], vars["userID"])
+	if err != nil {
+		if err == common.ErrClubNotMember {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return nil, false
+		}
+		a.logrus.WithError(err).Error("Unable to get club member")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the member")
+		return nil, false
+	}
+	return member, true
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/util"
+	"github.com/gorilla/mux"
+)
+
+// clubInvitesPost creates an invite to a club. An invite with an email is sent to that address,
+// otherwise the code and link are returned so they can be shared. Either way the code is only shown once
+func (a *app) clubInvitesPost(w http.ResponseWriter, r *http.Request) {
+	cir := common.ClubInviteRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&cir); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := cir.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	club, ok := a.requestClub(w, r)
+	if !ok {
+		return
+	}
+	code, err := a.util.CreateRandomToken()
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to create invite code")
+		a.respondWithError(w, http.StatusInternalServerError, "Error creating the invite")
+		return
+	}
+	invite := &common.ClubInvite{
+		ClubID:    club.ID,
+		Email:     cir.Email,
+		MaxUses:   cir.MaxUses,
+		CreatedBy: claims.UserID,
+		ExpiresAt: *cir.ExpiresAt,
+	}
+	if err = a.warehouse.CreateClubInvite(invite, util.HashToken(code)); err != nil {
+		a.logrus.WithError(err).Error("Unable to store invite")
+		a.respondWithError(w, http.StatusInternalServerError, "Error creating the invite")
+		return
+	}
+	link := fmt.Sprintf("%s/invites/%s", a.conf.BaseURL, code)
+	if invite.Email == "" {
+		a.respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+			"code":   code,
+			"link":   link,
+			"invite": invite,
+		})
+		return
+	}
+	err = a.mailer.Send(common.Email{
+		To:      invite.Email,
+		Subject: fmt.Sprintf("You have been invited to join %s", club.Name),
+		Body: fmt.Sprintf("Hi,\n\nYou have been invited to join the book club %s. Use the link below to join, it expires on %s.\n\n%s\n",
+			club.Name, invite.ExpiresAt.Format("2 January 2006"), link),
+	})
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to send invite email")
+		// Nobody has the code, so the invite would only clutter the list
+		if err = a.warehouse.RevokeClubInvite(club.ID, invite.ID); err != nil {
+			a.logrus.WithError(err).Error("Unable to revoke unsent invite")
+		}
+		a.respondWithError(w, http.StatusInternalServerError, "Error sending the invite")
+		return
+	}
+	a.respondWithJSON(w, http.StatusCreated, map[string]interface{}{"invite": invite})
+}
+
+// clubInvitesGet lists the invites of a club that can still be used
+func (a *app) clubInvitesGet(w http.ResponseWriter, r *http.Request) {
+	invites, err := a.warehouse.ListClubInvites(mux.Vars(r)["clubID"])
+	if err != nil {
+		if err == common.ErrClubNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to list invites")
+		a.respondWithError(w, http.StatusInternalServerError, "Error listing the invites")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]interface{}{"invites": invites})
+}
+
+// clubInviteDelete revokes an invite so it can no longer be used
+func (a *app) clubInviteDelete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := a.warehouse.RevokeClubInvite(vars["clubID"], vars["inviteID"]); err != nil {
+		if err == common.ErrClubInviteNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to revoke invite")
+		a.respondWithError(w, http.StatusInternalServerError, "Error revoking the invite")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Invite revoked"})
+}
+
+// clubInvitesOptions returns the allowed options
+func (a *app) clubInvitesOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// inviteGet shows which club an invite is for, so the link can be opened before logging in or
+// registering
+func (a *app) inviteGet(w http.ResponseWriter, r *http.Request) {
+	invite, err := a.warehouse.GetClubInviteWithCode(util.HashToken(mux.Vars(r)["code"]))
+	if err != nil {
+		if err == common.ErrClubInviteNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to get invite")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the invite")
+		return
+	}
+	club, err := a.warehouse.GetClub(invite.ClubID)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to get club of invite")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the invite")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"club":      club,
+		"expiresAt": invite.ExpiresAt,
+	})
+}
+
+// inviteAcceptPost makes the current user a member of the club of the invite. The role is in the JSON
+// token once the user refreshes it
+func (a *app) inviteAcceptPost(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	clubID, err := a.warehouse.AcceptClubInvite(util.HashToken(mux.Vars(r)["code"]), claims.UserID)
+	if err != nil {
+		switch err {
+		case common.ErrClubInviteNotFound:
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+		case common.ErrClubInviteEmailMismatch:
+			a.respondWithError(w, http.StatusForbidden, err.Error())
+		case common.ErrClubAlreadyMember:
+			a.respondWithError(w, http.StatusConflict, err.Error())
+		default:
+			a.logrus.WithError(err).Error("Unable to accept invite")
+			a.respondWithError(w, http.StatusInternalServerError, "Error accepting the invite")
+		}
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Joined the club", "clubID": clubID})
+}
+
+// inviteOptions returns the allowed options
+func (a *app) inviteOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
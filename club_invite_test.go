@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/mailer"
+	"github.com/garycarr/book_club/util"
+	"github.com/garycarr/book_club/warehouse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestClubInvitesPost(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedError      error
+		expectedHTTPStatus int
+		params             map[string]interface{}
+		sendError          error
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Link anyone can use",
+			expectedHTTPStatus: http.StatusCreated,
+			params:             map[string]interface{}{"maxUses": 10},
+		},
+		testData{
+			description:        "Sent to an email",
+			expectedHTTPStatus: http.StatusCreated,
+			params:             map[string]interface{}{"email": "Friend@Example.com"},
+		},
+		testData{
+			description:        "Email could not be sent",
+			expectedHTTPStatus: http.StatusInternalServerError,
+			params:             map[string]interface{}{"email": "friend@example.com"},
+			sendError:          errors.New("mail server down"),
+		},
+		testData{
+			description:        "Email invites are used once",
+			expectedError:      common.ErrClubInviteEmailMaxUses,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"email": "friend@example.com", "maxUses": 5},
+		},
+		testData{
+			description:        "Email invalid",
+			expectedError:      common.ErrClubInviteEmailInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"email": "Friend <friend@example.com>"},
+		},
+		testData{
+			description:        "Too many uses",
+			expectedError:      common.ErrClubInviteMaxUsesInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"maxUses": common.MaxClubInviteUses + 1},
+		},
+		testData{
+			description:        "Expiry too far away",
+			expectedError:      common.ErrClubInviteExpiryInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"expiresAt": time.Now().AddDate(0, 2, 0)},
+		},
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/clubs/clubID/invites", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, clubClaims(common.ClubRoleOwner))
+		mockMailer := mailer.MockMailer{}
+		a.mailer = &mockMailer
+		email, _ := td.params["email"].(string)
+		email = strings.ToLower(email)
+		if td.expectedError == nil {
+			mockWarehouse.On("GetClub", "clubID").Return(validClub(common.ClubVisibilityPrivate), nil)
+			mockUtil.On("CreateRandomToken").Return("inviteCode", nil)
+			mockWarehouse.On("CreateClubInvite", mock.MatchedBy(func(ci *common.ClubInvite) bool {
+				return ci.ClubID == "clubID" && ci.Email == email && ci.CreatedBy == validUserID
+			}), util.HashToken("inviteCode")).Return(nil).Run(func(args mock.Arguments) {
+				args.Get(0).(*common.ClubInvite).ID = "inviteID"
+			})
+		}
+		if email != "" && td.expectedError == nil {
+			mockMailer.On("Send", mock.MatchedBy(func(e common.Email) bool {
+				return e.To == email && strings.Contains(e.Body, "/invites/inviteCode")
+			})).Return(td.sendError)
+		}
+		if td.sendError != nil {
+			mockWarehouse.On("RevokeClubInvite", "clubID", "inviteID").Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		mockMailer.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedHTTPStatus != http.StatusCreated {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			if td.expectedError != nil {
+				assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+			}
+			continue
+		}
+		jsonResp := struct {
+			Code   string            `json:"code"`
+			Link   string            `json:"link"`
+			Invite common.ClubInvite `json:"invite"`
+		}{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		assert.Equal(t, "inviteID", jsonResp.Invite.ID, td.description)
+		if email != "" {
+			// The code is only sent to the email
+			assert.Empty(t, jsonResp.Code, td.description)
+			continue
+		}
+		assert.Equal(t, "inviteCode", jsonResp.Code, td.description)
+		assert.True(t, strings.HasSuffix(jsonResp.Link, "/invites/inviteCode"), td.description)
+		assert.Equal(t, 10, jsonResp.Invite.MaxUses, td.description)
+	}
+}
+
+func TestClubInviteDelete(t *testing.T) {
+	type testData struct {
+		description        string
+		claims             *common.TokenClaims
+		expectedHTTPStatus int
+		revokeError        error
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Owner revokes an invite",
+			claims:             clubClaims(common.ClubRoleOwner),
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description:        "Invite already used or revoked",
+			claims:             clubClaims(common.ClubRoleOwner),
+			expectedHTTPStatus: http.StatusNotFound,
+			revokeError:        common.ErrClubInviteNotFound,
+		},
+		testData{
+			description:        "Moderators can not revoke invites",
+			claims:             clubClaims(common.ClubRoleModerator),
+			expectedHTTPStatus: http.StatusForbidden,
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodDelete, "/clubs/clubID/invites/inviteID", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, td.claims)
+		if td.expectedHTTPStatus != http.StatusForbidden {
+			mockWarehouse.On("RevokeClubInvite", "clubID", "inviteID").Return(td.revokeError)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
+
+func TestInviteGet(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/invites/inviteCode", nil)
+	if err != nil {
+		t.Fatalf("Error creating new request: %v", err)
+	}
+	a, responseRecorder := setupTest(req)
+	mockWarehouse := warehouse.MockWarehouse{}
+	a.warehouse = &mockWarehouse
+	expiresAt := time.Now().Add(time.Hour).Round(time.Second)
+	mockWarehouse.On("GetClubInviteWithCode", util.HashToken("inviteCode")).
+		Return(&common.ClubInvite{ID: "inviteID", ClubID: "clubID", ExpiresAt: expiresAt}, nil)
+	mockWarehouse.On("GetClub", "clubID").Return(validClub(common.ClubVisibilityPrivate), nil)
+
+	a.Router.ServeHTTP(responseRecorder, req)
+	mockWarehouse.AssertExpectations(t)
+	if !assert.Equal(t, http.StatusOK, responseRecorder.Code) {
+		return
+	}
+	jsonResp := struct {
+		Club      common.Club `json:"club"`
+		ExpiresAt time.Time   `json:"expiresAt"`
+	}{}
+	if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+		t.Fatalf("Unable to decode JSON response: %v", err)
+	}
+	assert.Equal(t, validClub(common.ClubVisibilityPrivate).Name, jsonResp.Club.Name)
+	assert.True(t, expiresAt.Equal(jsonResp.ExpiresAt))
+}
+
+func TestInviteAcceptPost(t *testing.T) {
+	type testData struct {
+		description        string
+		acceptError        error
+		expectedHTTPStatus int
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Joins the club",
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description:        "Invite expired, used up or revoked",
+			acceptError:        common.ErrClubInviteNotFound,
+			expectedHTTPStatus: http.StatusNotFound,
+		},
+		testData{
+			description:        "Invite sent to someone else",
+			acceptError:        common.ErrClubInviteEmailMismatch,
+			expectedHTTPStatus: http.StatusForbidden,
+		},
+		testData{
+			description:        "Already a member",
+			acceptError:        common.ErrClubAlreadyMember,
+			expectedHTTPStatus: http.StatusConflict,
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodPost, "/invites/inviteCode/accept", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, memberClaims)
+		mockWarehouse.On("AcceptClubInvite", util.HashToken("inviteCode"), validUserID).Return("clubID", td.acceptError)
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		jsonResp := map[string]string{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		if td.acceptError != nil {
+			assert.Equal(t, td.acceptError.Error(), jsonResp["error"], td.description)
+			continue
+		}
+		assert.Equal(t, "clubID", jsonResp["clubID"], td.description)
+	}
+}
+
+func TestUserPostWithInvite(t *testing.T) {
+	type testData struct {
+		description        string
+		createError        error
+		expectedHTTPStatus int
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Registers and joins the club",
+			expectedHTTPStatus: http.StatusCreated,
+		},
+		testData{
+			description:        "Invite can not be used",
+			createError:        common.ErrClubInviteNotFound,
+			expectedHTTPStatus: http.StatusBadRequest,
+		},
+		testData{
+			description:        "Invite sent to another email",
+			createError:        common.ErrClubInviteEmailMismatch,
+			expectedHTTPStatus: http.StatusBadRequest,
+		},
+	}
+	rr := common.RegisterRequest{
+		DisplayName: "reader",
+		Email:       "reader@example.com",
+		Password:    "readerPass",
+		InviteCode:  "inviteCode",
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(rr)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/user", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder := setupTest(req)
+		mockUtil := util.MockUtil{}
+		mockWarehouse := warehouse.MockWarehouse{}
+		mockMailer := mailer.MockMailer{}
+		a.util = &mockUtil
+		a.warehouse = &mockWarehouse
+		a.mailer = &mockMailer
+		mockUtil.On("CheckPasswordPolicy", rr.Password, &common.User{DisplayName: rr.DisplayName, Email: rr.Email}).Return(nil)
+		mockUtil.On("CreateHashedPassword", rr.Password).Return(rr.Password, nil)
+		user := &common.User{ID: "newUserID", DisplayName: rr.DisplayName, Email: rr.Email,
+			ClubRoles: map[string]string{"clubID": common.ClubRoleMember}}
+		if td.createError != nil {
+			mockWarehouse.On("CreateUserWithInvite", rr, util.HashToken("inviteCode")).Return(nil, td.createError)
+		} else {
+			mockWarehouse.On("CreateUserWithInvite", rr, util.HashToken("inviteCode")).Return(user, nil)
+			mockUtil.On("CreateRandomToken").Return("refreshToken", nil)
+			mockWarehouse.On("CreateEmailVerification", user.ID, user.Email, util.HashToken("refreshToken"),
+				mock.AnythingOfType("time.Time")).Return(nil)
+			mockMailer.On("Send", mock.AnythingOfType("common.Email")).Return(nil)
+			mockWarehouse.On("CreateRefreshToken", user.ID, util.HashToken("refreshToken"), mock.AnythingOfType("time.Time")).
+				Return(&common.RefreshToken{}, nil)
+			// The club role is in the first JSON token
+			mockUtil.On("CreateJSONToken", user).Return("Bearer JWT", nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		mockMailer.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
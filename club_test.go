@@ -0,0 +1,544 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func validClub(visibility string) *common.Club {
+	now := time.Now().Round(time.Second)
+	return &common.Club{
+		ID:          "clubID",
+		Name:        "Sci-fi readers",
+		Description: "A book a month",
+		Visibility:  visibility,
+		MemberCount: 3,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// clubClaims are the claims of a member with the role in clubID
+func clubClaims(role string) *common.TokenClaims {
+	return &common.TokenClaims{UserID: validUserID, EmailVerified: true, Roles: []string{common.RoleMember},
+		ClubRoles: map[string]string{"clubID": role}}
+}
+
+func TestClubsPost(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedClub       *common.Club
+		expectedError      error
+		expectedHTTPStatus int
+		params             map[string]string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Private by default",
+			expectedClub:       &common.Club{Name: "Sci-fi readers", Visibility: common.ClubVisibilityPrivate},
+			expectedHTTPStatus: http.StatusCreated,
+			params:             map[string]string{"name": " Sci-fi readers "},
+		},
+		testData{
+			description:        "Public club",
+			expectedClub:       &common.Club{Name: "Sci-fi readers", Visibility: common.ClubVisibilityPublic},
+			expectedHTTPStatus: http.StatusCreated,
+			params:             map[string]string{"name": "Sci-fi readers", "visibility": common.ClubVisibilityPublic},
+		},
+		testData{
+			description:        "Name not present",
+			expectedError:      common.ErrClubNameNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]string{"name": " "},
+		},
+		testData{
+			description:        "Visibility invalid",
+			expectedError:      common.ErrClubVisibilityInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]string{"name": "Sci-fi readers", "visibility": "secret"},
+		},
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/clubs", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, memberClaims)
+		if td.expectedClub != nil {
+			mockWarehouse.On("CreateClub", td.expectedClub, validUserID).Return(nil).
+				Run(func(args mock.Arguments) {
+					args.Get(0).(*common.Club).ID = "clubID"
+				})
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+			continue
+		}
+		club := common.Club{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&club); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		assert.Equal(t, "clubID", club.ID, td.description)
+		assert.Equal(t, td.expectedClub.Visibility, club.Visibility, td.description)
+	}
+}
+
+func TestClubGet(t *testing.T) {
+	type testData struct {
+		description        string
+		claims             *common.TokenClaims
+		club               *common.Club
+		expectedHTTPStatus int
+		getError           error
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Anyone can see a public club",
+			claims:             memberClaims,
+			club:               validClub(common.ClubVisibilityPublic),
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description:        "Member can see a private club",
+			claims:             clubClaims(common.ClubRoleMember),
+			club:               validClub(common.ClubVisibilityPrivate),
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description:        "Private club is hidden from users who are not members",
+			claims:             memberClaims,
+			club:               validClub(common.ClubVisibilityPrivate),
+			expectedHTTPStatus: http.StatusNotFound,
+		},
+		testData{
+			description:        "Unknown club",
+			claims:             memberClaims,
+			expectedHTTPStatus: http.StatusNotFound,
+			getError:           common.ErrClubNotFound,
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodGet, "/clubs/clubID", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, td.claims)
+		mockWarehouse.On("GetClub", "clubID").Return(td.club, td.getError)
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedHTTPStatus == http.StatusNotFound {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Equal(t, common.ErrClubNotFound.Error(), jsonResp["error"], td.description)
+			continue
+		}
+		club := common.Club{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&club); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		assert.Equal(t, td.club.Name, club.Name, td.description)
+	}
+}
+
+func TestClubPatch(t *testing.T) {
+	type testData struct {
+		description        string
+		claims             *common.TokenClaims
+		expectedHTTPStatus int
+		params             map[string]string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Owner makes the club public",
+			claims:             clubClaims(common.ClubRoleOwner),
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]string{"visibility": common.ClubVisibilityPublic},
+		},
+		testData{
+			description:        "Moderator can not change the club",
+			claims:             clubClaims(common.ClubRoleModerator),
+			expectedHTTPStatus: http.StatusForbidden,
+			params:             map[string]string{"visibility": common.ClubVisibilityPublic},
+		},
+		testData{
+			description:        "Nothing to change",
+			claims:             clubClaims(common.ClubRoleOwner),
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]string{},
+		},
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPatch, "/clubs/clubID", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, td.claims)
+		if td.expectedHTTPStatus == http.StatusOK {
+			mockWarehouse.On("GetClub", "clubID").Return(validClub(common.ClubVisibilityPrivate), nil)
+			mockWarehouse.On("UpdateClub", mock.MatchedBy(func(c *common.Club) bool {
+				return c.Visibility == common.ClubVisibilityPublic
+			})).Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
+
+func TestClubJoinPost(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedHTTPStatus int
+		joinError          error
+		pending            bool
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Joins a public club",
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description:        "Asks to join a private club",
+			expectedHTTPStatus: http.StatusAccepted,
+			pending:            true,
+		},
+		testData{
+			description:        "Already a member",
+			expectedHTTPStatus: http.StatusConflict,
+			joinError:          common.ErrClubAlreadyMember,
+		},
+		testData{
+			description:        "Already asked to join",
+			expectedHTTPStatus: http.StatusConflict,
+			joinError:          common.ErrClubJoinRequestExists,
+		},
+		testData{
+			description:        "Unknown club",
+			expectedHTTPStatus: http.StatusNotFound,
+			joinError:          common.ErrClubNotFound,
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodPost, "/clubs/clubID/join", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, memberClaims)
+		mockWarehouse.On("JoinClub", "clubID", validUserID).Return(td.pending, td.joinError)
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
+
+func TestClubLeavePost(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedHTTPStatus int
+		leaveError         error
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Leaves the club",
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description:        "Last owner",
+			expectedHTTPStatus: http.StatusConflict,
+			leaveError:         common.ErrClubLastOwner,
+		},
+		testData{
+			description:        "Not a member",
+			expectedHTTPStatus: http.StatusNotFound,
+			leaveError:         common.ErrClubNotMember,
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodPost, "/clubs/clubID/leave", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, clubClaims(common.ClubRoleOwner))
+		mockWarehouse.On("LeaveClub", "clubID", validUserID).Return(td.leaveError)
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
+
+func TestClubMembersGet(t *testing.T) {
+	type testData struct {
+		description        string
+		claims             *common.TokenClaims
+		expectedHTTPStatus int
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Member lists the members",
+			claims:             clubClaims(common.ClubRoleMember),
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description:        "Users who are not members can not list them",
+			claims:             memberClaims,
+			expectedHTTPStatus: http.StatusForbidden,
+		},
+	}
+	members := []common.ClubMember{{UserID: validUserID, DisplayName: "gcarr", Role: common.ClubRoleOwner}}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodGet, "/clubs/clubID/members", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, td.claims)
+		if td.expectedHTTPStatus == http.StatusOK {
+			mockWarehouse.On("ListClubMembers", "clubID", common.Pagination{Limit: common.DefaultPageLimit}).
+				Return(members, 1, nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedHTTPStatus != http.StatusOK {
+			continue
+		}
+		jsonResp := struct {
+			Members []common.ClubMember `json:"members"`
+			Total   int                 `json:"total"`
+		}{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		assert.Equal(t, 1, jsonResp.Total, td.description)
+		assert.Equal(t, members, jsonResp.Members, td.description)
+	}
+}
+
+func TestClubMemberPatch(t *testing.T) {
+	type testData struct {
+		description        string
+		changeError        error
+		expectedHTTPStatus int
+		role               string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Makes a member a moderator",
+			expectedHTTPStatus: http.StatusOK,
+			role:               common.ClubRoleModerator,
+		},
+		testData{
+			description:        "Last owner",
+			changeError:        common.ErrClubLastOwner,
+			expectedHTTPStatus: http.StatusConflict,
+			role:               common.ClubRoleMember,
+		},
+		testData{
+			description:        "Role invalid",
+			expectedHTTPStatus: http.StatusBadRequest,
+			role:               common.RoleAdmin,
+		},
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(map[string]string{"role": td.role})
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPatch, "/clubs/clubID/members/memberID", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, clubClaims(common.ClubRoleOwner))
+		if td.expectedHTTPStatus != http.StatusBadRequest {
+			mockWarehouse.On("GetClubMember", "clubID", "memberID").
+				Return(&common.ClubMember{UserID: "memberID", Role: common.ClubRoleMember}, nil)
+			mockWarehouse.On("ChangeClubRole", "clubID", "memberID", td.role).Return(td.changeError)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedHTTPStatus != http.StatusOK {
+			continue
+		}
+		member := common.ClubMember{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&member); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		assert.Equal(t, td.role, member.Role, td.description)
+	}
+}
+
+func TestClubMemberDelete(t *testing.T) {
+	type testData struct {
+		description        string
+		claims             *common.TokenClaims
+		expectedHTTPStatus int
+		removed            bool
+		targetRole         string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Moderator removes a member",
+			claims:             clubClaims(common.ClubRoleModerator),
+			expectedHTTPStatus: http.StatusOK,
+			removed:            true,
+			targetRole:         common.ClubRoleMember,
+		},
+		testData{
+			description:        "Moderator can not remove a moderator",
+			claims:             clubClaims(common.ClubRoleModerator),
+			expectedHTTPStatus: http.StatusForbidden,
+			targetRole:         common.ClubRoleModerator,
+		},
+		testData{
+			description:        "Owner removes a moderator",
+			claims:             clubClaims(common.ClubRoleOwner),
+			expectedHTTPStatus: http.StatusOK,
+			removed:            true,
+			targetRole:         common.ClubRoleModerator,
+		},
+		testData{
+			description:        "Owners have to be given another role first",
+			claims:             clubClaims(common.ClubRoleOwner),
+			expectedHTTPStatus: http.StatusConflict,
+			targetRole:         common.ClubRoleOwner,
+		},
+		testData{
+			description:        "Members can not remove anyone",
+			claims:             clubClaims(common.ClubRoleMember),
+			expectedHTTPStatus: http.StatusForbidden,
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodDelete, "/clubs/clubID/members/memberID", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, td.claims)
+		if td.targetRole != "" {
+			mockWarehouse.On("GetClubMember", "clubID", "memberID").
+				Return(&common.ClubMember{UserID: "memberID", Role: td.targetRole}, nil)
+		}
+		if td.removed {
+			mockWarehouse.On("DeleteClubRole", "clubID", "memberID").Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
+
+func TestClubJoinRequests(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedHTTPStatus int
+		method             string
+		path               string
+		warehouseError     error
+		warehouseMethod    string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Approves a request",
+			expectedHTTPStatus: http.StatusOK,
+			method:             http.MethodPost,
+			path:               "/clubs/clubID/requests/memberID/approve",
+			warehouseMethod:    "ApproveClubJoinRequest",
+		},
+		testData{
+			description:        "No request to approve",
+			expectedHTTPStatus: http.StatusNotFound,
+			method:             http.MethodPost,
+			path:               "/clubs/clubID/requests/memberID/approve",
+			warehouseError:     common.ErrClubJoinRequestNotFound,
+			warehouseMethod:    "ApproveClubJoinRequest",
+		},
+		testData{
+			description:        "Rejects a request",
+			expectedHTTPStatus: http.StatusOK,
+			method:             http.MethodDelete,
+			path:               "/clubs/clubID/requests/memberID",
+			warehouseMethod:    "RejectClubJoinRequest",
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(td.method, td.path, nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, clubClaims(common.ClubRoleModerator))
+		mockWarehouse.On(td.warehouseMethod, "clubID", "memberID").Return(td.warehouseError)
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
@@ -0,0 +1,293 @@
+package common
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits on the fields of a book, lengths are in characters
+const (
+	MaxBookTitleLength       = 500
+	MaxBookAuthors           = 20
+	MaxBookAuthorLength      = 200
+	MaxBookPublisherLength   = 200
+	MaxBookDescriptionLength = 10000
+	MaxBookCoverURLLength    = 2000
+)
+
+var (
+	publishedDateRegexp = regexp.MustCompile(`^\d{4}(-(0[1-9]|1[0-2])(-(0[1-9]|[12]\d|3[01]))?)?$`)
+	languageRegexp      = regexp.MustCompile(`^[a-z]{2,3}$`)
+)
+
+// Book is an entry in the catalog. Every club shares the catalog. Rating is worked out from the
+// reviews of the book
+type Book struct {
+	ID string `json:"id"`
+	BookDetails
+	Rating    BookRating `json:"rating"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// BookDetails are the fields of a book that can be set when it is added or changed. PublishedDate is
+// YYYY, YYYY-MM or YYYY-MM-DD as publishers often only give the year. Language is an ISO 639 code
+type BookDetails struct {
+	Title         string   `json:"title"`
+	Authors       []string `json:"authors"`
+	ISBN10        string   `json:"isbn10"`
+	ISBN13        string   `json:"isbn13"`
+	Publisher     string   `json:"publisher"`
+	PublishedDate string   `json:"publishedDate"`
+	PageCount     int      `json:"pageCount"`
+	Description   string   `json:"description"`
+	CoverURL      string   `json:"coverURL"`
+	Language      string   `json:"language"`
+}
+
+// BookUpdateRequest changes a book, fields left out are not changed
+type BookUpdateRequest struct {
+	Title         *string   `json:"title"`
+	Authors       *[]string `json:"authors"`
+	ISBN10        *string   `json:"isbn10"`
+	ISBN13        *string   `json:"isbn13"`
+	Publisher     *string   `json:"publisher"`
+	PublishedDate *string   `json:"publishedDate"`
+	PageCount     *int      `json:"pageCount"`
+	Description   *string   `json:"description"`
+	CoverURL      *string   `json:"coverURL"`
+	Language      *string   `json:"language"`
+}
+
+// BookImportRequest adds a book to the catalog from the details a metadata provider has for the ISBN
+type BookImportRequest struct {
+	ISBN string `json:"isbn"`
+}
+
+// BookMetadata is what a metadata provider returned for an ISBN-13, it is cached so each ISBN is only
+// looked up once. Details is nil when the provider did not know the book
+type BookMetadata struct {
+	ISBN13    string
+	Details   *BookDetails
+	FetchedAt time.Time
+}
+
+// BookFilter narrows a list of books. Title and Author match part of the title or of any author,
+// ignoring case. ISBN matches either ISBN exactly
+type BookFilter struct {
+	Title  string
+	Author string
+	ISBN   string
+	Pagination
+}
+
+// ValidateRequest checks the details and normalises them. The ISBNs lose any hyphens or spaces and
+// the ISBN-13 is worked out from the ISBN-10 if it is not given
+func (bd *BookDetails) ValidateRequest() error {
+	bd.Title = strings.TrimSpace(bd.Title)
+	if bd.Title == "" {
+		return ErrBookTitleNotPresent
+	}
+	if utf8.RuneCountInString(bd.Title) > MaxBookTitleLength {
+		return ErrBookTitleTooLong
+	}
+	if bd.Authors == nil {
+		bd.Authors = []string{}
+	}
+	if len(bd.Authors) > MaxBookAuthors {
+		return ErrBookTooManyAuthors
+	}
+	for i, author := range bd.Authors {
+		bd.Authors[i] = strings.TrimSpace(author)
+		if bd.Authors[i] == "" || utf8.RuneCountInString(bd.Authors[i]) > MaxBookAuthorLength {
+			return ErrBookAuthorInvalid
+		}
+	}
+	bd.ISBN10 = NormaliseISBN(bd.ISBN10)
+	if bd.ISBN10 != "" && !ValidISBN10(bd.ISBN10) {
+		return ErrBookISBN10Invalid
+	}
+	bd.ISBN13 = NormaliseISBN(bd.ISBN13)
+	if bd.ISBN13 != "" && !ValidISBN13(bd.ISBN13) {
+		return ErrBookISBN13Invalid
+	}
+	if bd.ISBN10 != "" {
+		isbn13 := ISBN10To13(bd.ISBN10)
+		if bd.ISBN13 == "" {
+			bd.ISBN13 = isbn13
+		} else if bd.ISBN13 != isbn13 {
+			return ErrBookISBNMismatch
+		}
+	}
+	if utf8.RuneCountInString(bd.Publisher) > MaxBookPublisherLength {
+		return ErrBookPublisherTooLong
+	}
+	if bd.PublishedDate != "" && !publishedDateRegexp.MatchString(bd.PublishedDate) {
+		return ErrBookPublishedDateInvalid
+	}
+	if bd.PageCount < 0 {
+		return ErrBookPageCountInvalid
+	}
+	if utf8.RuneCountInString(bd.Description) > MaxBookDescriptionLength {
+		return ErrBookDescriptionTooLong
+	}
+	if bd.CoverURL != "" {
+		u, err := url.Parse(bd.CoverURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			len(bd.CoverURL) > MaxBookCoverURLLength {
+			return ErrBookCoverURLInvalid
+		}
+	}
+	bd.Language = strings.ToLower(bd.Language)
+	if bd.Language != "" && !languageRegexp.MatchString(bd.Language) {
+		return ErrBookLanguageInvalid
+	}
+	return nil
+}
+
+// ValidateRequest checks the ISBN and normalises it to an ISBN-13
+func (bir *BookImportRequest) ValidateRequest() error {
+	if bir.ISBN == "" {
+		return ErrBookISBNNotPresent
+	}
+	isbn13, err := ToISBN13(bir.ISBN)
+	if err != nil {
+		return err
+	}
+	bir.ISBN = isbn13
+	return nil
+}
+
+// ValidateRequest only checks something is being changed, the changed book is checked with
+// BookDetails.ValidateRequest
+func (bur BookUpdateRequest) ValidateRequest() error {
+	if bur.Title == nil && bur.Authors == nil && bur.ISBN10 == nil && bur.ISBN13 == nil && bur.Publisher == nil &&
+		bur.PublishedDate == nil && bur.PageCount == nil && bur.Description == nil && bur.CoverURL == nil &&
+		bur.Language == nil {
+		return ErrBookUpdateNoFields
+	}
+	return nil
+}
+
+// Apply sets the fields given in the request on the details
+func (bur BookUpdateRequest) Apply(bd *BookDetails) {
+	if bur.Title != nil {
+		bd.Title = *bur.Title
+	}
+	if bur.Authors != nil {
+		bd.Authors = *bur.Authors
+	}
+	if bur.ISBN10 != nil {
+		bd.ISBN10 = *bur.ISBN10
+	}
+	if bur.ISBN13 != nil {
+		bd.ISBN13 = *bur.ISBN13
+	}
+	if bur.Publisher != nil {
+		bd.Publisher = *bur.Publisher
+	}
+	if bur.PublishedDate != nil {
+		bd.PublishedDate = *bur.PublishedDate
+	}
+	if bur.PageCount != nil {
+		bd.PageCount = *bur.PageCount
+	}
+	if bur.Description != nil {
+		bd.Description = *bur.Description
+	}
+	if bur.CoverURL != nil {
+		bd.CoverURL = *bur.CoverURL
+	}
+	if bur.Language != nil {
+		bd.Language = *bur.Language
+	}
+}
+
+// NormaliseISBN removes the hyphens and spaces ISBNs are often printed with
+func NormaliseISBN(isbn string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(isbn)))
+}
+
+// ValidISBN10 checks a normalised ISBN-10 and its check digit, which can be X for 10
+func ValidISBN10(isbn string) bool {
+	if len(isbn) != 10 {
+		return false
+	}
+	sum := 0
+	for i, c := range isbn {
+		var digit int
+		switch {
+		case c >= '0' && c <= '9':
+			digit = int(c - '0')
+		case c == 'X' && i == 9:
+			digit = 10
+		default:
+			return false
+		}
+		sum += (10 - i) * digit
+	}
+	return sum%11 == 0
+}
+
+// ValidISBN13 checks a normalised ISBN-13 and its check digit
+func ValidISBN13(isbn string) bool {
+	if len(isbn) != 13 {
+		return false
+	}
+	for _, c := range isbn {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return isbn13CheckDigit(isbn[:12]) == isbn[12]
+}
+
+// ToISBN13 normalises an ISBN-10 or ISBN-13 and returns it as an ISBN-13
+func ToISBN13(isbn string) (string, error) {
+	isbn = NormaliseISBN(isbn)
+	switch {
+	case ValidISBN13(isbn):
+		return isbn, nil
+	case ValidISBN10(isbn):
+		return ISBN10To13(isbn), nil
+	}
+	return "", ErrBookISBNInvalid
+}
+
+// ISBN13To10 returns the ISBN-10 of a valid ISBN-13, or nothing for an ISBN-13 with the 979 prefix
+// as those have no ISBN-10
+func ISBN13To10(isbn string) string {
+	if !strings.HasPrefix(isbn, "978") {
+		return ""
+	}
+	sum := 0
+	for i, c := range isbn[3:12] {
+		sum += (10 - i) * int(c-'0')
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return isbn[3:12] + "X"
+	}
+	return isbn[3:12] + string(byte('0'+check))
+}
+
+// ISBN10To13 returns the ISBN-13 of a valid ISBN-10, every ISBN-10 has one with the 978 prefix
+func ISBN10To13(isbn string) string {
+	prefix := "978" + isbn[:9]
+	return prefix + string(isbn13CheckDigit(prefix))
+}
+
+func isbn13CheckDigit(first12 string) byte {
+	sum := 0
+	for i, c := range first12 {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(c-'0')
+	}
+	return byte('0' + (10-sum%10)%10)
+}
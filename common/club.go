@@ -0,0 +1,121 @@
+package common
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Who can see a club and how people join it. Anyone can join a public club, joining a private club
+// needs a moderator to approve the request
+const (
+	ClubVisibilityPublic  = "public"
+	ClubVisibilityPrivate = "private"
+)
+
+// Limits on the fields of a club, lengths are in characters
+const (
+	MaxClubNameLength        = 100
+	MaxClubDescriptionLength = 2000
+)
+
+// Club is a group of members reading together. The members are the users with a role in the club
+type Club struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Visibility  string    `json:"visibility"`
+	MemberCount int       `json:"memberCount"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// ClubMember is a user with a role in a club
+type ClubMember struct {
+	UserID      string    `json:"userID"`
+	DisplayName string    `json:"displayName"`
+	Role        string    `json:"role"`
+	JoinedAt    time.Time `json:"joinedAt"`
+}
+
+// ClubJoinRequest is a user waiting to be let into a private club
+type ClubJoinRequest struct {
+	UserID      string    `json:"userID"`
+	DisplayName string    `json:"displayName"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// ClubRequest creates a club, it is private if the visibility is not given
+type ClubRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Visibility  string `json:"visibility"`
+}
+
+// ClubUpdateRequest changes a club, fields left out are not changed
+type ClubUpdateRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Visibility  *string `json:"visibility"`
+}
+
+// ClubRoleRequest changes the role of a member of a club
+type ClubRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// ValidateRequest ..
+func (cr *ClubRequest) ValidateRequest() error {
+	cr.Name = strings.TrimSpace(cr.Name)
+	if cr.Visibility == "" {
+		cr.Visibility = ClubVisibilityPrivate
+	}
+	return validateClub(cr.Name, cr.Description, cr.Visibility)
+}
+
+// ValidateRequest ..
+func (cur ClubUpdateRequest) ValidateRequest() error {
+	if cur.Name == nil && cur.Description == nil && cur.Visibility == nil {
+		return ErrClubUpdateNoFields
+	}
+	return nil
+}
+
+// Apply sets the fields given in the request on the club and checks the result
+func (cur ClubUpdateRequest) Apply(club *Club) error {
+	if cur.Name != nil {
+		club.Name = *cur.Name
+	}
+	if cur.Description != nil {
+		club.Description = *cur.Description
+	}
+	if cur.Visibility != nil {
+		club.Visibility = *cur.Visibility
+	}
+	club.Name = strings.TrimSpace(club.Name)
+	return validateClub(club.Name, club.Description, club.Visibility)
+}
+
+// ValidateRequest ..
+func (crr ClubRoleRequest) ValidateRequest() error {
+	if !ValidClubRole(crr.Role) {
+		return ErrRoleInvalid
+	}
+	return nil
+}
+
+func validateClub(name, description, visibility string) error {
+	if name == "" {
+		return ErrClubNameNotPresent
+	}
+	if utf8.RuneCountInString(name) > MaxClubNameLength {
+		return ErrClubNameTooLong
+	}
+	if utf8.RuneCountInString(description) > MaxClubDescriptionLength {
+		return ErrClubDescriptionTooLong
+	}
+	if visibility != ClubVisibilityPublic && visibility != ClubVisibilityPrivate {
+		return ErrClubVisibilityInvalid
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package common
+
+import (
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Limits on invites. An invite lasts a week unless it is given an expiry
+const (
+	MaxClubInviteUses           = 1000
+	MaxClubInviteExpirationDays = 30
+	DefaultClubInviteExpiration = 7 * 24 * time.Hour
+)
+
+// ClubInvite lets people into a club without a join request. An invite sent to an email can only be
+// used once, by the user with that email. An invite without an email is a link anyone can use until
+// it runs out of uses or expires. Only the hash of the code is stored
+type ClubInvite struct {
+	ID        string    `json:"id"`
+	ClubID    string    `json:"clubID"`
+	Email     string    `json:"email,omitempty"`
+	MaxUses   int       `json:"maxUses"`
+	Uses      int       `json:"uses"`
+	CreatedBy string    `json:"createdBy"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ClubInviteRequest creates an invite. Without an email it creates a link, MaxUses is 1 if it is
+// not given
+type ClubInviteRequest struct {
+	Email     string     `json:"email"`
+	MaxUses   int        `json:"maxUses"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// ValidateRequest checks the request and fills in the defaults. The email is lower cased so it can
+// be matched against the email of the user accepting it
+func (cir *ClubInviteRequest) ValidateRequest() error {
+	cir.Email = strings.ToLower(strings.TrimSpace(cir.Email))
+	if cir.MaxUses == 0 {
+		cir.MaxUses = 1
+	}
+	if cir.Email != "" {
+		if addr, err := mail.ParseAddress(cir.Email); err != nil || addr.Address != cir.Email || len(cir.Email) > 200 {
+			return ErrClubInviteEmailInvalid
+		}
+		if cir.MaxUses != 1 {
+			return ErrClubInviteEmailMaxUses
+		}
+	}
+	if cir.MaxUses < 1 || cir.MaxUses > MaxClubInviteUses {
+		return ErrClubInviteMaxUsesInvalid
+	}
+	now := time.Now()
+	if cir.ExpiresAt == nil {
+		expiresAt := now.Add(DefaultClubInviteExpiration)
+		cir.ExpiresAt = &expiresAt
+	}
+	if !cir.ExpiresAt.After(now) || cir.ExpiresAt.After(now.AddDate(0, 0, MaxClubInviteExpirationDays)) {
+		return ErrClubInviteExpiryInvalid
+	}
+	return nil
+}
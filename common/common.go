@@ -3,27 +3,217 @@ package common
 import (
 	"fmt"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
+// MaxBioLength is the longest bio a user can have, in characters
+const MaxBioLength = 1000
+
 // LoginRequest is the data needed to make a login
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
-// RegisterRequest is the information needed to register a new user
+// RegisterRequest is the information needed to register a new user. InviteCode is optional, the new
+// user joins the club of the invite
 type RegisterRequest struct {
 	DisplayName string `json:"displayName"`
 	Password    string `json:"password"`
 	Email       string `json:"email"`
+	InviteCode  string `json:"inviteCode"`
+}
+
+// UserUpdateRequest changes the profile of the current user, fields left out are not changed. The
+// current password is needed to change the email
+type UserUpdateRequest struct {
+	DisplayName     *string `json:"displayName"`
+	Email           *string `json:"email"`
+	Bio             *string `json:"bio"`
+	TimeZone        *string `json:"timeZone"`
+	CurrentPassword string  `json:"currentPassword"`
+}
+
+// PasswordChangeRequest sets a new password for a user who knows their current one
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// LogoutRequest optionally carries the refresh token to revoke along with the JSON token
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// LoginMFARequest is the data needed to finish a login for a user with two factor authentication
+type LoginMFARequest struct {
+	MFAToken string `json:"mfaToken"`
+	Code     string `json:"code"`
+}
+
+// TOTPCodeRequest carries a TOTP code, or a recovery code where one is accepted
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// PasswordForgotRequest is the data needed to send a password reset email
+type PasswordForgotRequest struct {
+	Email string `json:"email"`
+}
+
+// PasswordResetRequest is the data needed to set a new password with a reset token
+type PasswordResetRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// RefreshTokenRequest is the data needed to exchange a refresh token for a new JSON token
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
 }
 
 // User ...
 type User struct {
-	Email       string
-	ID          string
-	DisplayName string
-	Password    string
+	Email           string
+	EmailVerifiedAt *time.Time
+	ID              string
+	DisplayName     string
+	Password        string
+	Bio             string
+	// Roles are the site wide roles of the user and ClubRoles are the role of the user in each club
+	// they belong to, keyed by club id. Both are carried in the JSON token claims
+	Roles     []string
+	ClubRoles map[string]string
+	// TOTPSecret is encrypted, it is set during enrollment before TOTPEnabledAt
+	TOTPSecret    string
+	TOTPEnabledAt *time.Time
+	// TimeZone is the IANA time zone times are shown to the user in, empty is DefaultTimeZone
+	TimeZone string
+	// PendingEmail is the email the user is changing to, it replaces Email once it is verified
+	PendingEmail string
+}
+
+// UserProfile is what a user can see about their own account, it never has the password hash
+type UserProfile struct {
+	ID               string            `json:"id"`
+	Email            string            `json:"email"`
+	EmailVerified    bool              `json:"emailVerified"`
+	PendingEmail     string            `json:"pendingEmail,omitempty"`
+	DisplayName      string            `json:"displayName"`
+	Bio              string            `json:"bio"`
+	TwoFactorEnabled bool              `json:"twoFactorEnabled"`
+	Roles            []string          `json:"roles"`
+	ClubRoles        map[string]string `json:"clubRoles"`
+	TimeZone         string            `json:"timeZone"`
+}
+
+// Profile returns the profile of the user
+func (u *User) Profile() UserProfile {
+	return UserProfile{
+		ID:               u.ID,
+		Email:            u.Email,
+		EmailVerified:    u.EmailVerifiedAt != nil,
+		PendingEmail:     u.PendingEmail,
+		DisplayName:      u.DisplayName,
+		Bio:              u.Bio,
+		TwoFactorEnabled: u.TOTPEnabledAt != nil,
+		Roles:            u.Roles,
+		ClubRoles:        u.ClubRoles,
+		TimeZone:         u.Location().String(),
+	}
+}
+
+// Location is the time zone of the user, a time zone that can no longer be loaded falls back to UTC
+func (u *User) Location() *time.Location {
+	if u.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(u.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Email is a message to send to a user
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// PasswordReset is the stored form of a password reset token, only the hash of the token is kept
+type PasswordReset struct {
+	ID        string
+	UserID    string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// EmailVerification is the stored form of an email verification token, only the hash of the
+// token is kept. Email is the address the token was sent to
+type EmailVerification struct {
+	ID        string
+	UserID    string
+	Email     string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// JSONWebKey is the public part of a key JSON tokens are signed with, see RFC 7517
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet is published so other services can verify our JSON tokens
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// FieldError is one rule a field of a request broke
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// TokenClaims are the claims of a JSON token that has passed verification
+type TokenClaims struct {
+	ID            string
+	UserID        string
+	DisplayName   string
+	EmailVerified bool
+	Roles         []string
+	ClubRoles     map[string]string
+	IssuedAt      time.Time
+	ExpiresAt     time.Time
+	// PersonalAccessToken is set when the claims come from a personal access token rather than a JSON
+	// token, ID is then the id of the personal access token
+	PersonalAccessToken bool
+	Scopes              []string
+}
+
+// RefreshToken is the stored form of a refresh token. Only the hash of the token is kept,
+// every rotation of a token stays in the same family
+type RefreshToken struct {
+	ID        string
+	UserID    string
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
 }
 
 // ValidateRequest ..
@@ -40,6 +230,47 @@ func (lr LoginRequest) ValidateRequest() error {
 	return nil
 }
 
+// ValidateRequest ..
+func (uur UserUpdateRequest) ValidateRequest() error {
+	if uur.DisplayName == nil && uur.Email == nil && uur.Bio == nil && uur.TimeZone == nil {
+		return ErrUserUpdateNoFields
+	}
+	if uur.DisplayName != nil && *uur.DisplayName == "" {
+		return ErrUserDisplayNameNotPresent
+	}
+	if uur.Email != nil && *uur.Email == "" {
+		return ErrLoginEmailNotPresent
+	}
+	if uur.Bio != nil && utf8.RuneCountInString(*uur.Bio) > MaxBioLength {
+		return ErrUserBioTooLong
+	}
+	if uur.TimeZone != nil && !ValidTimeZone(*uur.TimeZone) {
+		return ErrTimeZoneInvalid
+	}
+	return nil
+}
+
+// ValidTimeZone checks the name is an IANA time zone such as Europe/London. Local is not accepted as
+// it depends on the server
+func ValidTimeZone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// ValidateRequest ..
+func (pcr PasswordChangeRequest) ValidateRequest() error {
+	if pcr.CurrentPassword == "" {
+		return ErrPasswordCurrentNotPresent
+	}
+	if pcr.NewPassword == "" {
+		return ErrLoginPasswordNotPresent
+	}
+	return nil
+}
+
 // ValidateNewUserRequest ...
 func (rr RegisterRequest) ValidateNewUserRequest() error {
 	var missingFields string
@@ -60,7 +291,53 @@ func (rr RegisterRequest) ValidateNewUserRequest() error {
 	}
 	if missingFields != "" {
 		missingFields = strings.TrimRight(missingFields, ",")
-		return fmt.Errorf(fmt.Sprintf("%s %s", ErrNewUserMissingFields, missingFields))
+		return fmt.Errorf("%s %s", ErrNewUserMissingFields, missingFields)
+	}
+	return nil
+}
+
+// ValidateRequest ..
+func (rtr RefreshTokenRequest) ValidateRequest() error {
+	if rtr.RefreshToken == "" {
+		return ErrRefreshTokenNotPresent
+	}
+	return nil
+}
+
+// ValidateRequest ..
+func (pfr PasswordForgotRequest) ValidateRequest() error {
+	if pfr.Email == "" {
+		return ErrLoginEmailNotPresent
+	}
+	return nil
+}
+
+// ValidateRequest ..
+func (prr PasswordResetRequest) ValidateRequest() error {
+	if prr.Token == "" {
+		return ErrPasswordResetTokenNotPresent
+	}
+	if prr.Password == "" {
+		return ErrLoginPasswordNotPresent
+	}
+	return nil
+}
+
+// ValidateRequest ..
+func (lmr LoginMFARequest) ValidateRequest() error {
+	if lmr.MFAToken == "" {
+		return ErrMFATokenNotPresent
+	}
+	if lmr.Code == "" {
+		return ErrTOTPCodeNotPresent
+	}
+	return nil
+}
+
+// ValidateRequest ..
+func (tcr TOTPCodeRequest) ValidateRequest() error {
+	if tcr.Code == "" {
+		return ErrTOTPCodeNotPresent
 	}
 	return nil
 }
@@ -1,6 +1,9 @@
 package common
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrLoginEmailAndPasswordNotPresent = errors.New("Email and password not present")
@@ -8,8 +11,185 @@ var (
 	ErrLoginPasswordNotPresent         = errors.New("Password not present")
 	ErrLoginUserAlreadyExists          = errors.New("User already exists")
 	ErrLoginUserNotFound               = errors.New("Email and password not found or incorrect")
+	ErrLoginLockedOut                  = errors.New("Too many failed logins, try again later")
+
+	ErrUserNotFound              = errors.New("User not found")
+	ErrUserUpdateNoFields        = errors.New("No fields to update")
+	ErrUserDisplayNameNotPresent = errors.New("Display name not present")
+	ErrUserBioTooLong            = fmt.Errorf("Bio can not be longer than %d characters", MaxBioLength)
+	ErrTimeZoneInvalid           = errors.New("Time zone must be an IANA time zone such as Europe/London")
 
 	ErrNewUserMissingFields = "Missing fields for new user:"
 
-	ErrJSONTokenNoBearer = errors.New("JSON Token does not have Bearer")
+	ErrJSONTokenNoBearer     = errors.New("JSON Token does not have Bearer")
+	ErrJSONTokenRevoked      = errors.New("JSON Token has been revoked")
+	ErrJSONTokenWrongPurpose = errors.New("JSON Token can not be used for this request")
+
+	ErrRefreshTokenNotPresent = errors.New("Refresh token not present")
+	ErrRefreshTokenNotFound   = errors.New("Refresh token not found or expired")
+	ErrRefreshTokenReused     = errors.New("Refresh token has already been used")
+
+	ErrPasswordCurrentNotPresent    = errors.New("Current password not present")
+	ErrPasswordIncorrect            = errors.New("Current password is incorrect")
+	ErrPasswordPolicy               = errors.New("Password does not meet the password policy")
+	ErrPasswordResetTokenNotPresent = errors.New("Reset token not present")
+	ErrPasswordResetNotFound        = errors.New("Reset token not found, used or expired")
+
+	ErrEmailVerificationTokenNotPresent = errors.New("Verification token not present")
+	ErrEmailVerificationNotFound        = errors.New("Verification token not found, used or expired")
+	ErrEmailNotVerified                 = errors.New("Email address has not been verified")
+	ErrEmailAlreadyVerified             = errors.New("Email address has already been verified")
+	ErrEmailVerificationSentRecently    = errors.New("Verification email was sent recently, try again later")
+
+	ErrMFATokenNotPresent = errors.New("MFA token not present")
+	ErrTOTPCodeNotPresent = errors.New("Two factor code not present")
+	ErrTOTPCodeInvalid    = errors.New("Two factor code is invalid")
+	ErrTOTPAlreadyEnabled = errors.New("Two factor authentication is already enabled")
+	ErrTOTPNotEnabled     = errors.New("Two factor authentication is not enabled")
+	ErrTOTPNotEnrolled    = errors.New("Two factor authentication has not been enrolled")
+
+	ErrPersonalAccessTokenNameNotPresent   = errors.New("Token name not present")
+	ErrPersonalAccessTokenNameTooLong      = fmt.Errorf("Token name can not be longer than %d characters", MaxPersonalAccessTokenNameLength)
+	ErrPersonalAccessTokenScopesNotPresent = errors.New("Token scopes not present")
+	ErrPersonalAccessTokenScopeInvalid     = errors.New("Token scope is not valid")
+	ErrPersonalAccessTokenExpiryInPast     = errors.New("Token expiry must be in the future")
+	ErrPersonalAccessTokenNotFound         = errors.New("Personal access token not found, revoked or expired")
+	ErrPersonalAccessTokenNotAllowed       = errors.New("Personal access tokens can not be used for this request, log in instead")
+
+	ErrOIDCProviderNotFound = errors.New("Identity provider not found")
+	ErrOIDCStateInvalid     = errors.New("Login state not found or expired, start the login again")
+	ErrOIDCLoginFailed      = errors.New("Login with the identity provider failed")
+	ErrOIDCEmailNotPresent  = errors.New("Identity provider did not share an email address")
+	ErrOIDCLinkNotAllowed   = errors.New("An account with this email exists, log in with your password and verify your email first")
+
+	ErrExportFormatInvalid = errors.New("Export format must be json or zip")
+
+	ErrPaginationInvalid = fmt.Errorf("Limit must be between 1 and %d and offset can not be negative", MaxPageLimit)
+	ErrCursorInvalid     = errors.New("Cursor is not valid, use the nextCursor of the previous page")
+
+	ErrBookNotFound             = errors.New("Book not found")
+	ErrBookAlreadyExists        = errors.New("A book with this ISBN already exists")
+	ErrBookUpdateNoFields       = errors.New("No fields to update")
+	ErrBookTitleNotPresent      = errors.New("Title not present")
+	ErrBookTitleTooLong         = fmt.Errorf("Title can not be longer than %d characters", MaxBookTitleLength)
+	ErrBookTooManyAuthors       = fmt.Errorf("A book can not have more than %d authors", MaxBookAuthors)
+	ErrBookAuthorInvalid        = fmt.Errorf("Authors can not be empty or longer than %d characters", MaxBookAuthorLength)
+	ErrBookISBN10Invalid        = errors.New("ISBN-10 is not valid")
+	ErrBookISBN13Invalid        = errors.New("ISBN-13 is not valid")
+	ErrBookISBNMismatch         = errors.New("ISBN-10 and ISBN-13 are for different books")
+	ErrBookPublisherTooLong     = fmt.Errorf("Publisher can not be longer than %d characters", MaxBookPublisherLength)
+	ErrBookPublishedDateInvalid = errors.New("Published date must be YYYY, YYYY-MM or YYYY-MM-DD")
+	ErrBookPageCountInvalid     = errors.New("Page count can not be negative")
+	ErrBookDescriptionTooLong   = fmt.Errorf("Description can not be longer than %d characters", MaxBookDescriptionLength)
+	ErrBookCoverURLInvalid      = errors.New("Cover URL must be an http or https URL")
+	ErrBookLanguageInvalid      = errors.New("Language must be an ISO 639 code such as en")
+	ErrBookISBNNotPresent       = errors.New("ISBN not present")
+	ErrBookISBNInvalid          = errors.New("ISBN is not a valid ISBN-10 or ISBN-13")
+	ErrBookMetadataNotFound     = errors.New("No details could be found for this ISBN")
+	ErrBookMetadataNotCached    = errors.New("ISBN has not been looked up")
+	ErrBookMetadataInvalid      = errors.New("The details found for this ISBN are not valid, add the book by hand")
+
+	ErrClubNotFound            = errors.New("Club not found")
+	ErrClubUpdateNoFields      = errors.New("No fields to update")
+	ErrClubNameNotPresent      = errors.New("Club name not present")
+	ErrClubNameTooLong         = fmt.Errorf("Club name can not be longer than %d characters", MaxClubNameLength)
+	ErrClubDescriptionTooLong  = fmt.Errorf("Club description can not be longer than %d characters", MaxClubDescriptionLength)
+	ErrClubVisibilityInvalid   = errors.New("Club visibility must be public or private")
+	ErrClubAlreadyMember       = errors.New("Already a member of this club")
+	ErrClubJoinRequestExists   = errors.New("Already asked to join this club")
+	ErrClubJoinRequestNotFound = errors.New("Join request not found")
+	ErrClubNotMember           = errors.New("Not a member of this club")
+	ErrClubLastOwner           = errors.New("A club needs an owner, make another member an owner first")
+	ErrClubOwnerNotRemovable   = errors.New("Owners can not be removed, change their role first")
+
+	ErrClubInviteNotFound       = errors.New("Invite not found, it may have expired, been used up or been revoked")
+	ErrClubInviteCodeNotPresent = errors.New("Invite code not present")
+	ErrClubInviteEmailInvalid   = errors.New("Invite email is not a valid email address")
+	ErrClubInviteEmailMismatch  = errors.New("Invite was sent to a different email address")
+	ErrClubInviteMaxUsesInvalid = fmt.Errorf("Invite max uses must be between 1 and %d", MaxClubInviteUses)
+	ErrClubInviteEmailMaxUses   = errors.New("Invites sent to an email can only be used once")
+	ErrClubInviteExpiryInvalid  = fmt.Errorf("Invite expiry must be in the future and within %d days", MaxClubInviteExpirationDays)
+
+	ErrMeetingNotFound           = errors.New("Meeting not found")
+	ErrMeetingUpdateNoFields     = errors.New("No fields to update")
+	ErrMeetingTitleNotPresent    = errors.New("Meeting title not present")
+	ErrMeetingTitleTooLong       = fmt.Errorf("Meeting title can not be longer than %d characters", MaxMeetingTitleLength)
+	ErrMeetingDescriptionTooLong = fmt.Errorf("Meeting description can not be longer than %d characters", MaxMeetingDescriptionLength)
+	ErrMeetingTimeNotPresent     = errors.New("Meeting start and end times not present")
+	ErrMeetingTimeInvalid        = errors.New("Meeting times must be RFC 3339 or a local time such as 2026-11-05T19:00")
+	ErrMeetingEndsBeforeStart    = errors.New("Meeting must end after it starts")
+	ErrMeetingPlaceNotPresent    = errors.New("Meeting needs a location or a video link")
+	ErrMeetingLocationTooLong    = fmt.Errorf("Meeting location can not be longer than %d characters", MaxMeetingLocationLength)
+	ErrMeetingVideoURLInvalid    = errors.New("Video link must be an http or https URL")
+	ErrMeetingCapacityInvalid    = errors.New("Meeting capacity can not be negative")
+	ErrMeetingEnded              = errors.New("Meeting has already ended")
+	ErrRSVPResponseInvalid       = errors.New("Response must be yes, no or maybe")
+	ErrRSVPGuestsInvalid         = fmt.Errorf("Guests must be between 0 and %d", MaxMeetingGuests)
+	ErrRSVPNotFound              = errors.New("RSVP not found")
+	ErrRSVPNoRoomForGuests       = errors.New("There is no room for more guests at this meeting")
+
+	ErrReadingPlanNotFound            = errors.New("Reading plan not found")
+	ErrReadingPlanBookNotPresent      = errors.New("Reading plan book not present")
+	ErrReadingPlanUnitInvalid         = errors.New("Reading plan unit must be chapter or page")
+	ErrReadingPlanSectionsInvalid     = fmt.Errorf("Reading plan must have between 1 and %d sections", MaxReadingPlanSections)
+	ErrReadingPlanSectionTitleTooLong = fmt.Errorf("Section title can not be longer than %d characters", MaxReadingPlanSectionTitle)
+	ErrReadingPlanSectionRangeInvalid = errors.New("Section must start at 1 or later and end at or after its start")
+	ErrReadingPlanSectionOverlap      = errors.New("Section must start after the previous section ends")
+	ErrReadingPlanSectionOrder        = errors.New("Section can not be due before the previous section")
+	ErrReadingPlanSectionRepeated     = errors.New("Section id is given more than once")
+	ErrReadingPlanSectionNotFound     = errors.New("Section id is not a section of the reading plan")
+	ErrReadingPlanDateInvalid         = errors.New("Dates must be YYYY-MM-DD")
+	ErrReadingPlanEndBeforeStart      = errors.New("End date can not be before the start date")
+	ErrReadingPlanNoPageCount         = errors.New("The page count of the book is not known, add it to the book or write the plan by hand")
+
+	ErrProgressMeasureInvalid  = errors.New("Give exactly one of page, percent or chapter")
+	ErrProgressNegative        = errors.New("Progress can not be negative")
+	ErrProgressPercentInvalid  = errors.New("Percent must be between 0 and 100")
+	ErrProgressPageInvalid     = errors.New("Page is past the end of the book")
+	ErrProgressShareNotPresent = errors.New("Share not present")
+
+	ErrReviewNotFound       = errors.New("Review not found")
+	ErrReviewAlreadyExists  = errors.New("You have already reviewed this book, change your review instead")
+	ErrReviewUpdateNoFields = errors.New("No fields to update")
+	ErrReviewRatingInvalid  = errors.New("Rating must be from 0.5 to 5 stars in half stars")
+	ErrReviewBodyTooLong    = fmt.Errorf("Review can not be longer than %d characters", MaxReviewBodyLength)
+	ErrReviewSortInvalid    = errors.New("Sort must be newest, helpful or rating")
+	ErrReviewVoteOwn        = errors.New("You can not vote for your own review")
+
+	ErrThreadNotFound        = errors.New("Thread not found")
+	ErrThreadTitleNotPresent = errors.New("Title not present")
+	ErrThreadTitleTooLong    = fmt.Errorf("Title can not be longer than %d characters", MaxThreadTitleLength)
+	ErrThreadSectionInvalid  = errors.New("A thread about a section needs both the planID and the sectionID of the plan")
+	ErrThreadBookMismatch    = errors.New("The book is not the book of the reading plan")
+	ErrThreadSpoiler         = errors.New("Your progress has not reached this section yet, add spoilers=true to see it anyway")
+	ErrPostNotFound          = errors.New("Post not found")
+	ErrPostBodyNotPresent    = errors.New("Body not present")
+	ErrPostBodyTooLong       = fmt.Errorf("Post can not be longer than %d characters", MaxPostBodyLength)
+	ErrPostParentNotFound    = errors.New("The post being replied to is not in this thread")
+	ErrPostTooDeep           = fmt.Errorf("Replies can not be nested more than %d deep", MaxPostDepth)
+
+	ErrNominationNotFound       = errors.New("Nomination not found")
+	ErrNominationAlreadyExists  = errors.New("This book has already been nominated in this club")
+	ErrNominationBookNotPresent = errors.New("Book not present")
+	ErrNominationNoteTooLong    = fmt.Errorf("Note can not be longer than %d characters", MaxNominationNoteLength)
+	ErrPollNotFound             = errors.New("Poll not found")
+	ErrPollTitleNotPresent      = errors.New("Title not present")
+	ErrPollTitleTooLong         = fmt.Errorf("Title can not be longer than %d characters", MaxPollTitleLength)
+	ErrPollMethodInvalid        = errors.New("Method must be single, approval or ranked")
+	ErrPollTimeNotPresent       = errors.New("Close time not present")
+	ErrPollTimeInvalid          = errors.New("Poll times must be RFC 3339")
+	ErrPollClosesBeforeOpen     = errors.New("Poll must close after it opens and in the future")
+	ErrPollOptionsInvalid       = errors.New("Books can not be empty or given twice")
+	ErrPollOptionNotNominated   = errors.New("Every book in a poll has to be nominated in the club")
+	ErrPollTooFewOptions        = fmt.Errorf("A poll needs at least %d books", MinPollOptions)
+	ErrPollNotOpen              = errors.New("Poll is not open")
+	ErrPollResultsHidden        = errors.New("The results are hidden until the poll closes")
+	ErrBallotNotFound           = errors.New("Ballot not found")
+	ErrBallotChoicesNotPresent  = errors.New("Choices not present")
+	ErrBallotSingleChoice       = errors.New("Choose exactly one book in this poll")
+	ErrBallotChoiceInvalid      = errors.New("Every choice has to be a book in the poll")
+	ErrBallotChoiceRepeated     = errors.New("A book can not be chosen twice")
+
+	ErrPermissionDenied = errors.New("You do not have permission to do this")
+	ErrRoleInvalid      = errors.New("Role is not valid")
 )
@@ -0,0 +1,188 @@
+package common
+
+import "time"
+
+// UserExport is the personal data stored about a user, as given to them by the data export. Secrets
+// such as the password hash, TOTP secret and token hashes are never included
+type UserExport struct {
+	ExportedAt         time.Time                 `json:"exportedAt"`
+	Profile            UserProfile               `json:"profile"`
+	CreatedAt          time.Time                 `json:"createdAt"`
+	ClubMemberships    []ExportClubMembership    `json:"clubMemberships"`
+	ClubJoinRequests   []ExportClubJoinRequest   `json:"clubJoinRequests"`
+	ClubInvites        []ExportClubInvite        `json:"clubInvites"`
+	MeetingRSVPs       []ExportMeetingRSVP       `json:"meetingRSVPs"`
+	ReadingProgress    []ExportReadingProgress   `json:"readingProgress"`
+	Reviews            []ExportReview            `json:"reviews"`
+	HelpfulVotes       []ExportHelpfulVote       `json:"helpfulVotes"`
+	Threads            []ExportThread            `json:"threads"`
+	Posts              []ExportPost              `json:"posts"`
+	PostRevisions      []ExportPostRevision      `json:"postRevisions"`
+	Nominations        []ExportNomination        `json:"nominations"`
+	Polls              []ExportPoll              `json:"polls"`
+	Ballots            []ExportBallot            `json:"ballots"`
+	Sessions           []ExportSession           `json:"sessions"`
+	EmailVerifications []ExportEmailVerification `json:"emailVerifications"`
+	PasswordResets     []ExportPasswordReset     `json:"passwordResets"`
+	// PersonalAccessTokens never include the token, only what the user named it
+	PersonalAccessTokens []ExportPersonalAccessToken `json:"personalAccessTokens"`
+	Identities           []ExportIdentity            `json:"identities"`
+}
+
+// ExportClubMembership is the role of the user in a club
+type ExportClubMembership struct {
+	ClubID        string    `json:"clubID"`
+	Role          string    `json:"role"`
+	ShareProgress bool      `json:"shareProgress"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// ExportClubJoinRequest is a request the user made to join a private club
+type ExportClubJoinRequest struct {
+	ClubID    string    `json:"clubID"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ExportClubInvite is an invite to a club the user created, the code is never included
+type ExportClubInvite struct {
+	ClubID    string     `json:"clubID"`
+	Email     string     `json:"email,omitempty"`
+	MaxUses   int        `json:"maxUses"`
+	Uses      int        `json:"uses"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// ExportReadingProgress is how far the user recorded they were through a book
+type ExportReadingProgress struct {
+	BookID     string    `json:"bookID"`
+	Page       *int      `json:"page,omitempty"`
+	Percent    *int      `json:"percent,omitempty"`
+	Chapter    *int      `json:"chapter,omitempty"`
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+// ExportReview is a review the user wrote of a book
+type ExportReview struct {
+	BookID    string    `json:"bookID"`
+	Rating    float64   `json:"rating"`
+	Body      string    `json:"body"`
+	Spoiler   bool      `json:"spoiler"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ExportHelpfulVote is a review the user found helpful
+type ExportHelpfulVote struct {
+	ReviewID  string    `json:"reviewID"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ExportThread is a discussion the user started in a club
+type ExportThread struct {
+	ClubID    string    `json:"clubID"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ExportPost is a post the user wrote, deleted posts are included while their body is kept
+type ExportPost struct {
+	ID        string     `json:"id"`
+	ThreadID  string     `json:"threadID"`
+	ParentID  string     `json:"parentID,omitempty"`
+	Body      string     `json:"body"`
+	CreatedAt time.Time  `json:"createdAt"`
+	EditedAt  *time.Time `json:"editedAt"`
+	DeletedAt *time.Time `json:"deletedAt"`
+}
+
+// ExportPostRevision is the body of a post of the user before they edited it
+type ExportPostRevision struct {
+	PostID     string    `json:"postID"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ReplacedAt time.Time `json:"replacedAt"`
+}
+
+// ExportNomination is a book the user nominated for a club to read
+type ExportNomination struct {
+	ClubID    string    `json:"clubID"`
+	BookID    string    `json:"bookID"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ExportPoll is a poll the user created in a club
+type ExportPoll struct {
+	ClubID    string    `json:"clubID"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ExportBallot is the vote of the user in a poll, the choices are book ids
+type ExportBallot struct {
+	PollID    string    `json:"pollID"`
+	Choices   []string  `json:"choices"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ExportMeetingRSVP is the response of the user to a club meeting
+type ExportMeetingRSVP struct {
+	MeetingID  string    `json:"meetingID"`
+	Response   string    `json:"response"`
+	Guests     int       `json:"guests"`
+	Waitlisted bool      `json:"waitlisted"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// ExportSession is a refresh token the user was given when logging in
+type ExportSession struct {
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	RevokedAt *time.Time `json:"revokedAt"`
+}
+
+// ExportEmailVerification is a verification email sent to the user
+type ExportEmailVerification struct {
+	Email     string     `json:"email"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+}
+
+// ExportPasswordReset is a password reset email sent to the user
+type ExportPasswordReset struct {
+	CreatedAt time.Time  `json:"createdAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+}
+
+// ExportPersonalAccessToken is a personal access token the user created
+type ExportPersonalAccessToken struct {
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+// ExportIdentity is an identity provider account the user logs in with
+type ExportIdentity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// UserErasure is the audit record of a user being erased. It only keeps the ids, never the data
+// that was removed
+type UserErasure struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"userID"`
+	ErasedBy    string    `json:"erasedBy"`
+	RowsRemoved int64     `json:"rowsRemoved"`
+	ErasedAt    time.Time `json:"erasedAt"`
+}
@@ -0,0 +1,242 @@
+package common
+
+import (
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Responses to a meeting
+const (
+	RSVPYes   = "yes"
+	RSVPNo    = "no"
+	RSVPMaybe = "maybe"
+)
+
+// Limits on the fields of a meeting, lengths are in characters
+const (
+	MaxMeetingTitleLength       = 200
+	MaxMeetingDescriptionLength = 2000
+	MaxMeetingLocationLength    = 500
+	MaxMeetingVideoURLLength    = 2000
+	MaxMeetingGuests            = 10
+)
+
+// meetingTimeLayouts are the layouts accepted for a time without an offset, they are read in the time
+// zone of the meeting
+var meetingTimeLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+// Meeting is a club getting together, in person at the location or online at the video link. The
+// times are stored in UTC and TimeZone is where the meeting is held. Capacity counts guests and 0 is
+// no limit. Attending and Waitlisted are worked out from the RSVPs
+type Meeting struct {
+	ID          string    `json:"id"`
+	ClubID      string    `json:"clubID"`
+	BookID      string    `json:"bookID,omitempty"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	StartsAt    time.Time `json:"startsAt"`
+	EndsAt      time.Time `json:"endsAt"`
+	TimeZone    string    `json:"timeZone"`
+	Location    string    `json:"location"`
+	VideoURL    string    `json:"videoURL"`
+	Capacity    int       `json:"capacity"`
+	Attending   int       `json:"attending"`
+	Waitlisted  int       `json:"waitlisted"`
+	CreatedBy   string    `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// MeetingRSVP is the response of a member to a meeting. A yes that did not fit in the capacity is
+// waitlisted and moved up in turn when places free up
+type MeetingRSVP struct {
+	UserID      string    `json:"userID"`
+	DisplayName string    `json:"displayName"`
+	Response    string    `json:"response"`
+	Guests      int       `json:"guests"`
+	Waitlisted  bool      `json:"waitlisted"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// MeetingRequest creates a meeting. The times are RFC 3339, or a local time such as 2026-11-05T19:00
+// in the time zone of the meeting
+type MeetingRequest struct {
+	BookID      string `json:"bookID"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	StartsAt    string `json:"startsAt"`
+	EndsAt      string `json:"endsAt"`
+	TimeZone    string `json:"timeZone"`
+	Location    string `json:"location"`
+	VideoURL    string `json:"videoURL"`
+	Capacity    int    `json:"capacity"`
+}
+
+// MeetingUpdateRequest changes a meeting, fields left out are not changed. Changing only the time zone
+// keeps the meeting at the same instant
+type MeetingUpdateRequest struct {
+	BookID      *string `json:"bookID"`
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	StartsAt    *string `json:"startsAt"`
+	EndsAt      *string `json:"endsAt"`
+	TimeZone    *string `json:"timeZone"`
+	Location    *string `json:"location"`
+	VideoURL    *string `json:"videoURL"`
+	Capacity    *int    `json:"capacity"`
+}
+
+// RSVPRequest answers a meeting, guests are the people the member is bringing along
+type RSVPRequest struct {
+	Response string `json:"response"`
+	Guests   int    `json:"guests"`
+}
+
+// In returns the times of the meeting in the location
+func (m *Meeting) In(loc *time.Location) {
+	m.StartsAt = m.StartsAt.In(loc)
+	m.EndsAt = m.EndsAt.In(loc)
+	m.CreatedAt = m.CreatedAt.In(loc)
+	m.UpdatedAt = m.UpdatedAt.In(loc)
+}
+
+// ValidateRequest only checks the fields every meeting needs are present, the meeting is checked by Apply
+func (mr MeetingRequest) ValidateRequest() error {
+	if strings.TrimSpace(mr.Title) == "" {
+		return ErrMeetingTitleNotPresent
+	}
+	if mr.StartsAt == "" || mr.EndsAt == "" {
+		return ErrMeetingTimeNotPresent
+	}
+	if mr.TimeZone == "" {
+		return ErrTimeZoneInvalid
+	}
+	return nil
+}
+
+// Apply sets the fields of the request on the meeting and checks the result
+func (mr MeetingRequest) Apply(m *Meeting) error {
+	return MeetingUpdateRequest{
+		BookID:      &mr.BookID,
+		Title:       &mr.Title,
+		Description: &mr.Description,
+		StartsAt:    &mr.StartsAt,
+		EndsAt:      &mr.EndsAt,
+		TimeZone:    &mr.TimeZone,
+		Location:    &mr.Location,
+		VideoURL:    &mr.VideoURL,
+		Capacity:    &mr.Capacity,
+	}.Apply(m)
+}
+
+// ValidateRequest only checks something is being changed, the changed meeting is checked by Apply
+func (mur MeetingUpdateRequest) ValidateRequest() error {
+	if mur.BookID == nil && mur.Title == nil && mur.Description == nil && mur.StartsAt == nil && mur.EndsAt == nil &&
+		mur.TimeZone == nil && mur.Location == nil && mur.VideoURL == nil && mur.Capacity == nil {
+		return ErrMeetingUpdateNoFields
+	}
+	return nil
+}
+
+// Apply sets the fields given in the request on the meeting and checks the result. Times without an
+// offset are read in the time zone of the meeting, after any change to it
+func (mur MeetingUpdateRequest) Apply(m *Meeting) error {
+	if mur.BookID != nil {
+		m.BookID = strings.TrimSpace(*mur.BookID)
+	}
+	if mur.Title != nil {
+		m.Title = strings.TrimSpace(*mur.Title)
+	}
+	if mur.Description != nil {
+		m.Description = *mur.Description
+	}
+	if mur.TimeZone != nil {
+		m.TimeZone = *mur.TimeZone
+	}
+	if !ValidTimeZone(m.TimeZone) {
+		return ErrTimeZoneInvalid
+	}
+	loc, _ := time.LoadLocation(m.TimeZone)
+	var err error
+	if mur.StartsAt != nil {
+		if m.StartsAt, err = parseMeetingTime(*mur.StartsAt, loc); err != nil {
+			return err
+		}
+	}
+	if mur.EndsAt != nil {
+		if m.EndsAt, err = parseMeetingTime(*mur.EndsAt, loc); err != nil {
+			return err
+		}
+	}
+	if mur.Location != nil {
+		m.Location = strings.TrimSpace(*mur.Location)
+	}
+	if mur.VideoURL != nil {
+		m.VideoURL = strings.TrimSpace(*mur.VideoURL)
+	}
+	if mur.Capacity != nil {
+		m.Capacity = *mur.Capacity
+	}
+	return validateMeeting(m)
+}
+
+// ValidateRequest checks the response, guests are dropped from a no
+func (rr *RSVPRequest) ValidateRequest() error {
+	if rr.Response != RSVPYes && rr.Response != RSVPNo && rr.Response != RSVPMaybe {
+		return ErrRSVPResponseInvalid
+	}
+	if rr.Guests < 0 || rr.Guests > MaxMeetingGuests {
+		return ErrRSVPGuestsInvalid
+	}
+	if rr.Response == RSVPNo {
+		rr.Guests = 0
+	}
+	return nil
+}
+
+func validateMeeting(m *Meeting) error {
+	if m.Title == "" {
+		return ErrMeetingTitleNotPresent
+	}
+	if utf8.RuneCountInString(m.Title) > MaxMeetingTitleLength {
+		return ErrMeetingTitleTooLong
+	}
+	if utf8.RuneCountInString(m.Description) > MaxMeetingDescriptionLength {
+		return ErrMeetingDescriptionTooLong
+	}
+	if !m.EndsAt.After(m.StartsAt) {
+		return ErrMeetingEndsBeforeStart
+	}
+	if m.Location == "" && m.VideoURL == "" {
+		return ErrMeetingPlaceNotPresent
+	}
+	if utf8.RuneCountInString(m.Location) > MaxMeetingLocationLength {
+		return ErrMeetingLocationTooLong
+	}
+	if m.VideoURL != "" {
+		u, err := url.Parse(m.VideoURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			len(m.VideoURL) > MaxMeetingVideoURLLength {
+			return ErrMeetingVideoURLInvalid
+		}
+	}
+	if m.Capacity < 0 {
+		return ErrMeetingCapacityInvalid
+	}
+	return nil
+}
+
+// parseMeetingTime reads an RFC 3339 time, or a local time in loc, and returns it in UTC
+func parseMeetingTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	for _, layout := range meetingTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, ErrMeetingTimeInvalid
+}
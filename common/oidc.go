@@ -0,0 +1,23 @@
+package common
+
+import "time"
+
+// NoPassword is stored as the password of users who only log in through an identity provider, it
+// never matches a password
+const NoPassword = "!"
+
+// OIDCLogin is a login at an identity provider that has not come back to the callback yet. It is
+// stored under the hash of the state parameter
+type OIDCLogin struct {
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// UserIdentity links a user to their account at an identity provider
+type UserIdentity struct {
+	Provider string
+	Subject  string
+	Email    string
+}
@@ -0,0 +1,75 @@
+package common
+
+import (
+	"encoding/base64"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Page sizes for the list endpoints
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// Pagination is the page of a list to return, Offset rows are skipped
+type Pagination struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// uuidRegexp matches the ids of rows, a cursor with any other id has been tampered with
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Cursor marks the last row of a page, the next page starts after it. Lists paged by cursor are ordered
+// by a time then the id, so rows added while paging are neither skipped nor repeated
+type Cursor struct {
+	Time time.Time
+	ID   string
+}
+
+// CursorPagination is the page of a list to return, the rows after the cursor. After is nil for the
+// first page
+type CursorPagination struct {
+	Limit int
+	After *Cursor
+}
+
+// ValidateRequest ..
+func (p Pagination) ValidateRequest() error {
+	if p.Limit < 1 || p.Limit > MaxPageLimit || p.Offset < 0 {
+		return ErrPaginationInvalid
+	}
+	return nil
+}
+
+// ValidateRequest ..
+func (p CursorPagination) ValidateRequest() error {
+	if p.Limit < 1 || p.Limit > MaxPageLimit {
+		return ErrPaginationInvalid
+	}
+	return nil
+}
+
+// String is the cursor as clients see it, they should treat it as opaque
+func (c Cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Time.UTC().Format(time.RFC3339Nano) + " " + c.ID))
+}
+
+// ParseCursor reads a cursor made by String, ErrCursorInvalid is returned for anything else
+func ParseCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrCursorInvalid
+	}
+	parts := strings.SplitN(string(b), " ", 2)
+	if len(parts) != 2 || !uuidRegexp.MatchString(parts[1]) {
+		return nil, ErrCursorInvalid
+	}
+	t, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, ErrCursorInvalid
+	}
+	return &Cursor{Time: t, ID: parts[1]}, nil
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"time"
+	"unicode/utf8"
+)
+
+// PersonalAccessTokenPrefix starts every personal access token, so they can be told apart from JSON
+// tokens in the Authorization header
+const PersonalAccessTokenPrefix = "pat_"
+
+// MaxPersonalAccessTokenNameLength is the longest name a personal access token can have, in characters
+const MaxPersonalAccessTokenNameLength = 100
+
+// PersonalAccessToken is a long lived token a user creates for scripts. Only the hash of the token is
+// stored. The scopes are the permissions the token can use, on top of the roles of the user
+type PersonalAccessToken struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"-"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// PersonalAccessTokenRequest creates a personal access token, it never expires if ExpiresAt is not given
+type PersonalAccessTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// ValidateRequest ..
+func (patr PersonalAccessTokenRequest) ValidateRequest() error {
+	if patr.Name == "" {
+		return ErrPersonalAccessTokenNameNotPresent
+	}
+	if utf8.RuneCountInString(patr.Name) > MaxPersonalAccessTokenNameLength {
+		return ErrPersonalAccessTokenNameTooLong
+	}
+	if len(patr.Scopes) == 0 {
+		return ErrPersonalAccessTokenScopesNotPresent
+	}
+	for _, scope := range patr.Scopes {
+		if !ValidScope(scope) {
+			return ErrPersonalAccessTokenScopeInvalid
+		}
+	}
+	if patr.ExpiresAt != nil && !patr.ExpiresAt.After(time.Now()) {
+		return ErrPersonalAccessTokenExpiryInPast
+	}
+	return nil
+}
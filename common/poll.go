@@ -0,0 +1,244 @@
+package common
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// How a poll is voted on. A single choice ballot picks one book, an approval ballot picks every book
+// the member would be happy with and a ranked ballot orders books by preference, counted by instant
+// runoff
+const (
+	PollMethodSingle   = "single"
+	PollMethodApproval = "approval"
+	PollMethodRanked   = "ranked"
+)
+
+// Where a poll is in its life, worked out from its times
+const (
+	PollStatusUpcoming = "upcoming"
+	PollStatusOpen     = "open"
+	PollStatusClosed   = "closed"
+)
+
+// Limits on nominations and polls, lengths are in characters
+const (
+	MaxNominationNoteLength = 500
+	MaxPollTitleLength      = 200
+	MinPollOptions          = 2
+)
+
+// Nomination is a book from the catalog a member proposes the club reads next, each book is nominated
+// once per club
+type Nomination struct {
+	ID          string    `json:"id"`
+	ClubID      string    `json:"clubID"`
+	BookID      string    `json:"bookID"`
+	BookTitle   string    `json:"bookTitle"`
+	NominatedBy string    `json:"nominatedBy"`
+	DisplayName string    `json:"displayName"`
+	Note        string    `json:"note"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Poll chooses between nominated books. The options are in the order they were nominated, which is
+// also the order ties are broken in. The times are stored in UTC, a poll closes on its own at
+// ClosesAt. With HideResults nobody sees the results until it has closed
+type Poll struct {
+	ID          string       `json:"id"`
+	ClubID      string       `json:"clubID"`
+	Title       string       `json:"title"`
+	Method      string       `json:"method"`
+	Options     []PollOption `json:"options"`
+	OpensAt     time.Time    `json:"opensAt"`
+	ClosesAt    time.Time    `json:"closesAt"`
+	HideResults bool         `json:"hideResults"`
+	Status      string       `json:"status"`
+	CreatedBy   string       `json:"createdBy"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+}
+
+// PollOption is a book that can be voted for
+type PollOption struct {
+	BookID string `json:"bookID"`
+	Title  string `json:"title"`
+}
+
+// Ballot is the vote of a member in a poll, Choices are book ids. A ranked ballot lists them most
+// preferred first and need not rank every option. The ballots of erased users are kept without a
+// UserID so closed results do not change
+type Ballot struct {
+	PollID    string    `json:"pollID"`
+	UserID    string    `json:"userID,omitempty"`
+	Choices   []string  `json:"choices"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// PollResult is the tally of the ballots of a poll. Counts are the votes of each option, in the final
+// round for a ranked poll, most votes first. Tied is set when the winner was level with another option
+// at the end and won on the tie-break
+type PollResult struct {
+	Method  string      `json:"method"`
+	Ballots int         `json:"ballots"`
+	Counts  []PollCount `json:"counts"`
+	Rounds  []PollRound `json:"rounds,omitempty"`
+	Winner  string      `json:"winner,omitempty"`
+	Tied    bool        `json:"tied"`
+}
+
+// PollCount is the votes for a book
+type PollCount struct {
+	BookID string `json:"bookID"`
+	Votes  int    `json:"votes"`
+}
+
+// PollRound is a round of an instant runoff. Counts only has the options still in the running,
+// Eliminated is the option knocked out at the end of the round and Exhausted the ballots with none of
+// their choices left in the running
+type PollRound struct {
+	Counts     []PollCount `json:"counts"`
+	Eliminated string      `json:"eliminated,omitempty"`
+	Exhausted  int         `json:"exhausted"`
+}
+
+// NominationRequest nominates a book from the catalog
+type NominationRequest struct {
+	BookID string `json:"bookID"`
+	Note   string `json:"note"`
+}
+
+// PollRequest creates a poll. BookIDs picks the nominated books to vote on, in the order given, and
+// every nomination of the club is used when it is left out. The times are RFC 3339, the poll opens
+// straight away without OpensAt
+type PollRequest struct {
+	Title       string   `json:"title"`
+	Method      string   `json:"method"`
+	BookIDs     []string `json:"bookIDs"`
+	OpensAt     string   `json:"opensAt"`
+	ClosesAt    string   `json:"closesAt"`
+	HideResults bool     `json:"hideResults"`
+}
+
+// BallotRequest casts or changes the vote of the current user
+type BallotRequest struct {
+	Choices []string `json:"choices"`
+}
+
+// ValidateRequest trims the book and note and checks them
+func (nr *NominationRequest) ValidateRequest() error {
+	nr.BookID = strings.TrimSpace(nr.BookID)
+	if nr.BookID == "" {
+		return ErrNominationBookNotPresent
+	}
+	nr.Note = strings.TrimSpace(nr.Note)
+	if utf8.RuneCountInString(nr.Note) > MaxNominationNoteLength {
+		return ErrNominationNoteTooLong
+	}
+	return nil
+}
+
+// ValidPollMethod checks the method is one a poll can be voted on with
+func ValidPollMethod(method string) bool {
+	return method == PollMethodSingle || method == PollMethodApproval || method == PollMethodRanked
+}
+
+// ValidateRequest trims the title and checks the fields every poll needs, the times are checked by
+// Apply
+func (pr *PollRequest) ValidateRequest() error {
+	pr.Title = strings.TrimSpace(pr.Title)
+	if pr.Title == "" {
+		return ErrPollTitleNotPresent
+	}
+	if utf8.RuneCountInString(pr.Title) > MaxPollTitleLength {
+		return ErrPollTitleTooLong
+	}
+	if !ValidPollMethod(pr.Method) {
+		return ErrPollMethodInvalid
+	}
+	if pr.ClosesAt == "" {
+		return ErrPollTimeNotPresent
+	}
+	seen := map[string]bool{}
+	for i := range pr.BookIDs {
+		pr.BookIDs[i] = strings.TrimSpace(pr.BookIDs[i])
+		if pr.BookIDs[i] == "" || seen[pr.BookIDs[i]] {
+			return ErrPollOptionsInvalid
+		}
+		seen[pr.BookIDs[i]] = true
+	}
+	if len(pr.BookIDs) > 0 && len(pr.BookIDs) < MinPollOptions {
+		return ErrPollTooFewOptions
+	}
+	return nil
+}
+
+// Apply sets the fields of the request on the poll and checks the times, a poll has to close after it
+// opens and after now
+func (pr PollRequest) Apply(p *Poll, now time.Time) error {
+	p.Title, p.Method, p.HideResults = pr.Title, pr.Method, pr.HideResults
+	p.OpensAt = now.UTC()
+	if pr.OpensAt != "" {
+		opensAt, err := time.Parse(time.RFC3339, pr.OpensAt)
+		if err != nil {
+			return ErrPollTimeInvalid
+		}
+		p.OpensAt = opensAt.UTC()
+	}
+	closesAt, err := time.Parse(time.RFC3339, pr.ClosesAt)
+	if err != nil {
+		return ErrPollTimeInvalid
+	}
+	p.ClosesAt = closesAt.UTC()
+	if !p.ClosesAt.After(p.OpensAt) || !p.ClosesAt.After(now) {
+		return ErrPollClosesBeforeOpen
+	}
+	p.Status = p.StatusAt(now)
+	return nil
+}
+
+// ValidateRequest trims the choices and checks the ballot is one the poll accepts. A single choice
+// ballot has one choice, every ballot has at least one and no choice twice, and every choice has to
+// be an option of the poll
+func (br *BallotRequest) ValidateRequest(p *Poll) error {
+	if len(br.Choices) == 0 {
+		return ErrBallotChoicesNotPresent
+	}
+	if p.Method == PollMethodSingle && len(br.Choices) != 1 {
+		return ErrBallotSingleChoice
+	}
+	options := map[string]bool{}
+	for _, o := range p.Options {
+		options[o.BookID] = true
+	}
+	seen := map[string]bool{}
+	for i := range br.Choices {
+		br.Choices[i] = strings.TrimSpace(br.Choices[i])
+		if !options[br.Choices[i]] {
+			return ErrBallotChoiceInvalid
+		}
+		if seen[br.Choices[i]] {
+			return ErrBallotChoiceRepeated
+		}
+		seen[br.Choices[i]] = true
+	}
+	return nil
+}
+
+// StatusAt returns whether the poll is upcoming, open or closed at the time
+func (p Poll) StatusAt(now time.Time) string {
+	switch {
+	case now.Before(p.OpensAt):
+		return PollStatusUpcoming
+	case now.Before(p.ClosesAt):
+		return PollStatusOpen
+	}
+	return PollStatusClosed
+}
+
+// ResultsVisible is false while a poll that hides its results has not closed
+func (p Poll) ResultsVisible() bool {
+	return !p.HideResults || p.Status == PollStatusClosed
+}
@@ -0,0 +1,194 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// How the sections of a reading plan are measured
+const (
+	ReadingPlanUnitChapter = "chapter"
+	ReadingPlanUnitPage    = "page"
+)
+
+// Limits on reading plans, lengths are in characters
+const (
+	MaxReadingPlanSections     = 100
+	MaxReadingPlanSectionTitle = 200
+)
+
+// ReadingPlanDateLayout is the layout of the due dates of a reading plan
+const ReadingPlanDateLayout = "2006-01-02"
+
+// ReadingPlan splits a book a club is reading into sections that are due in turn. Current is the
+// position of the first section not yet due, it is nil once every section is due
+type ReadingPlan struct {
+	ID        string               `json:"id"`
+	ClubID    string               `json:"clubID"`
+	BookID    string               `json:"bookID"`
+	Unit      string               `json:"unit"`
+	Sections  []ReadingPlanSection `json:"sections"`
+	Current   *int                 `json:"current"`
+	CreatedBy string               `json:"createdBy"`
+	CreatedAt time.Time            `json:"createdAt"`
+	UpdatedAt time.Time            `json:"updatedAt"`
+}
+
+// ReadingPlanSection is a range of chapters or pages, inclusive, to read by the due date. Positions
+// start at 1 and follow the order of the sections, so they change when a section is added or removed
+// before. The ID stays the same while the section is in the plan, threads about the section use it
+type ReadingPlanSection struct {
+	ID       string `json:"id"`
+	Position int    `json:"position"`
+	Title    string `json:"title"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	DueDate  string `json:"dueDate"`
+}
+
+// ReadingPlanRequest creates or replaces a reading plan. When a plan is replaced the sections that
+// give the id of one of its sections keep it, the others are new and the sections left out are removed
+type ReadingPlanRequest struct {
+	BookID   string               `json:"bookID"`
+	Unit     string               `json:"unit"`
+	Sections []ReadingPlanSection `json:"sections"`
+}
+
+// ReadingPlanGenerateRequest creates a reading plan that splits the pages of a book evenly between
+// the dates. Without a number of sections there is one a week, up to MaxReadingPlanSections
+type ReadingPlanGenerateRequest struct {
+	BookID    string `json:"bookID"`
+	StartDate string `json:"startDate"`
+	EndDate   string `json:"endDate"`
+	Sections  int    `json:"sections"`
+}
+
+// SetCurrent works out the section being read on the date, which is YYYY-MM-DD
+func (rp *ReadingPlan) SetCurrent(today string) {
+	rp.Current = nil
+	for _, s := range rp.Sections {
+		// The dates sort as strings
+		if s.DueDate >= today {
+			position := s.Position
+			rp.Current = &position
+			return
+		}
+	}
+}
+
+// ValidateRequest checks the sections follow on from each other and numbers them
+func (rpr *ReadingPlanRequest) ValidateRequest() error {
+	if rpr.BookID == "" {
+		return ErrReadingPlanBookNotPresent
+	}
+	if rpr.Unit != ReadingPlanUnitChapter && rpr.Unit != ReadingPlanUnitPage {
+		return ErrReadingPlanUnitInvalid
+	}
+	if len(rpr.Sections) == 0 || len(rpr.Sections) > MaxReadingPlanSections {
+		return ErrReadingPlanSectionsInvalid
+	}
+	ids := map[string]bool{}
+	for i := range rpr.Sections {
+		s := &rpr.Sections[i]
+		s.Position = i + 1
+		s.ID = strings.TrimSpace(s.ID)
+		if s.ID != "" {
+			if ids[s.ID] {
+				return fmt.Errorf("Section %d: %v", s.Position, ErrReadingPlanSectionRepeated)
+			}
+			ids[s.ID] = true
+		}
+		s.Title = strings.TrimSpace(s.Title)
+		if utf8.RuneCountInString(s.Title) > MaxReadingPlanSectionTitle {
+			return ErrReadingPlanSectionTitleTooLong
+		}
+		if s.Start < 1 || s.End < s.Start {
+			return fmt.Errorf("Section %d: %v", s.Position, ErrReadingPlanSectionRangeInvalid)
+		}
+		if _, err := time.Parse(ReadingPlanDateLayout, s.DueDate); err != nil {
+			return fmt.Errorf("Section %d: %v", s.Position, ErrReadingPlanDateInvalid)
+		}
+		if i > 0 {
+			previous := rpr.Sections[i-1]
+			if s.Start <= previous.End {
+				return fmt.Errorf("Section %d: %v", s.Position, ErrReadingPlanSectionOverlap)
+			}
+			if s.DueDate < previous.DueDate {
+				return fmt.Errorf("Section %d: %v", s.Position, ErrReadingPlanSectionOrder)
+			}
+		}
+		if s.Title == "" {
+			s.Title = defaultSectionTitle(rpr.Unit, s.Start, s.End)
+		}
+	}
+	return nil
+}
+
+// ValidateRequest checks the dates and the number of sections
+func (rpgr ReadingPlanGenerateRequest) ValidateRequest() error {
+	if rpgr.BookID == "" {
+		return ErrReadingPlanBookNotPresent
+	}
+	start, err := time.Parse(ReadingPlanDateLayout, rpgr.StartDate)
+	if err != nil {
+		return ErrReadingPlanDateInvalid
+	}
+	end, err := time.Parse(ReadingPlanDateLayout, rpgr.EndDate)
+	if err != nil {
+		return ErrReadingPlanDateInvalid
+	}
+	if end.Before(start) {
+		return ErrReadingPlanEndBeforeStart
+	}
+	if rpgr.Sections < 0 || rpgr.Sections > MaxReadingPlanSections {
+		return ErrReadingPlanSectionsInvalid
+	}
+	return nil
+}
+
+// Generate splits the pages as evenly as possible between the sections, with the due dates spread
+// evenly from the start date to the end date. The last section is due on the end date. It returns
+// ErrReadingPlanNoPageCount if the page count of the book is not known
+func (rpgr ReadingPlanGenerateRequest) Generate(pageCount int) (*ReadingPlanRequest, error) {
+	if pageCount < 1 {
+		return nil, ErrReadingPlanNoPageCount
+	}
+	start, _ := time.Parse(ReadingPlanDateLayout, rpgr.StartDate)
+	end, _ := time.Parse(ReadingPlanDateLayout, rpgr.EndDate)
+	days := int(end.Sub(start).Hours() / 24)
+	sections := rpgr.Sections
+	if sections == 0 {
+		sections = (days + 7) / 7
+		if sections > MaxReadingPlanSections {
+			sections = MaxReadingPlanSections
+		}
+	}
+	if sections > pageCount {
+		sections = pageCount
+	}
+	rpr := &ReadingPlanRequest{BookID: rpgr.BookID, Unit: ReadingPlanUnitPage}
+	for i := 0; i < sections; i++ {
+		first, last := i*pageCount/sections+1, (i+1)*pageCount/sections
+		rpr.Sections = append(rpr.Sections, ReadingPlanSection{
+			Position: i + 1,
+			Title:    defaultSectionTitle(ReadingPlanUnitPage, first, last),
+			Start:    first,
+			End:      last,
+			DueDate:  start.AddDate(0, 0, (i+1)*days/sections).Format(ReadingPlanDateLayout),
+		})
+	}
+	return rpr, nil
+}
+
+func defaultSectionTitle(unit string, start, end int) string {
+	name := "Pages"
+	if unit == ReadingPlanUnitChapter {
+		name = "Chapters"
+	}
+	if start == end {
+		return fmt.Sprintf("%s %d", strings.TrimSuffix(name, "s"), start)
+	}
+	return fmt.Sprintf("%s %d to %d", name, start, end)
+}
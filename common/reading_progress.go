@@ -0,0 +1,123 @@
+package common
+
+import "time"
+
+// ReadingProgress is how far a user was through a book when they recorded it. Exactly one of page,
+// percent or chapter is set. Every record is kept so there is a history
+type ReadingProgress struct {
+	ID         string    `json:"id"`
+	BookID     string    `json:"bookID"`
+	Page       *int      `json:"page,omitempty"`
+	Percent    *int      `json:"percent,omitempty"`
+	Chapter    *int      `json:"chapter,omitempty"`
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+// ReadingProgressRequest records how far the user is through a book, by one of page, percent or chapter
+type ReadingProgressRequest struct {
+	Page    *int `json:"page"`
+	Percent *int `json:"percent"`
+	Chapter *int `json:"chapter"`
+}
+
+// ProgressSharingRequest turns sharing reading progress with a club on or off
+type ProgressSharingRequest struct {
+	Share *bool `json:"share"`
+}
+
+// MemberProgress is the latest progress of a member of a club through the book of a reading plan.
+// Progress is nil if they have not recorded any. Reached is how far they are in the unit of the plan,
+// it is nil when their progress can not be compared, such as a chapter against a plan in pages
+type MemberProgress struct {
+	UserID      string           `json:"userID"`
+	DisplayName string           `json:"displayName"`
+	Progress    *ReadingProgress `json:"progress"`
+	Reached     *int             `json:"reached"`
+	Behind      bool             `json:"behind"`
+}
+
+// ClubProgress compares the progress of the members of a club who share it against a reading plan.
+// Expected is how far they should be, the end of the last section that is past due. Hidden counts
+// the members who do not share their progress
+type ClubProgress struct {
+	PlanID   string           `json:"planID"`
+	BookID   string           `json:"bookID"`
+	Unit     string           `json:"unit"`
+	Current  *int             `json:"current"`
+	Expected int              `json:"expected"`
+	Members  []MemberProgress `json:"members"`
+	Hidden   int              `json:"hidden"`
+}
+
+// ValidateRequest checks exactly one measure of progress is given and is in range
+func (rpr ReadingProgressRequest) ValidateRequest() error {
+	given := 0
+	for _, v := range []*int{rpr.Page, rpr.Percent, rpr.Chapter} {
+		if v != nil {
+			given++
+			if *v < 0 {
+				return ErrProgressNegative
+			}
+		}
+	}
+	if given != 1 {
+		return ErrProgressMeasureInvalid
+	}
+	if rpr.Percent != nil && *rpr.Percent > 100 {
+		return ErrProgressPercentInvalid
+	}
+	return nil
+}
+
+// ValidateRequest checks the choice is given
+func (psr ProgressSharingRequest) ValidateRequest() error {
+	if psr.Share == nil {
+		return ErrProgressShareNotPresent
+	}
+	return nil
+}
+
+// Expected is how far a member should be on the date, YYYY-MM-DD. It is the end of the last section
+// due before the date, or 0 when nothing is due yet
+func (rp ReadingPlan) Expected(today string) int {
+	expected := 0
+	for _, s := range rp.Sections {
+		if s.DueDate < today {
+			expected = s.End
+		}
+	}
+	return expected
+}
+
+// Reached is how far the progress is in the unit of a reading plan. A percentage is turned into pages
+// when the page count of the book is known, chapters and pages can not be compared
+func (p ReadingProgress) Reached(unit string, pageCount int) (int, bool) {
+	switch unit {
+	case ReadingPlanUnitPage:
+		if p.Page != nil {
+			return *p.Page, true
+		}
+		if p.Percent != nil && pageCount > 0 {
+			return *p.Percent * pageCount / 100, true
+		}
+	case ReadingPlanUnitChapter:
+		if p.Chapter != nil {
+			return *p.Chapter, true
+		}
+	}
+	return 0, false
+}
+
+// Compare works out how far the member has reached in the unit of the plan and whether they are
+// behind. A member who has not recorded any progress has not reached anything
+func (mp *MemberProgress) Compare(unit string, pageCount, expected int) {
+	reached, ok := 0, true
+	if mp.Progress != nil {
+		reached, ok = mp.Progress.Reached(unit, pageCount)
+	}
+	mp.Reached, mp.Behind = nil, false
+	if ok {
+		mp.Reached = &reached
+		mp.Behind = reached < expected
+	}
+}
@@ -0,0 +1,120 @@
+package common
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Orders a list of reviews can be sorted in
+const (
+	ReviewSortNewest  = "newest"
+	ReviewSortHelpful = "helpful"
+	ReviewSortRating  = "rating"
+)
+
+// Limits on a review, ratings are in stars and lengths are in characters
+const (
+	MinRating           = 0.5
+	MaxRating           = 5
+	MaxReviewBodyLength = 10000
+)
+
+// RatingBuckets is how many ratings there are in half stars, the length of a rating histogram
+const RatingBuckets = 10
+
+// Review is what a user thought of a book, each user reviews a book once. Helpful counts the other
+// users who found it helpful. A spoiler gives away the plot, clients hide the body until asked
+type Review struct {
+	ID          string    `json:"id"`
+	BookID      string    `json:"bookID"`
+	UserID      string    `json:"userID"`
+	DisplayName string    `json:"displayName"`
+	Rating      float64   `json:"rating"`
+	Body        string    `json:"body"`
+	Spoiler     bool      `json:"spoiler"`
+	Helpful     int       `json:"helpful"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// BookRating sums up the reviews of a book, it is cached on the book. Histogram counts the ratings by
+// half star, Histogram[0] is half a star and Histogram[9] is five stars
+type BookRating struct {
+	Average   float64 `json:"average"`
+	Count     int     `json:"count"`
+	Histogram []int   `json:"histogram"`
+}
+
+// ReviewRequest reviews a book, the rating is in half stars from 0.5 to 5
+type ReviewRequest struct {
+	Rating  float64 `json:"rating"`
+	Body    string  `json:"body"`
+	Spoiler bool    `json:"spoiler"`
+}
+
+// ReviewUpdateRequest changes a review, fields left out are not changed
+type ReviewUpdateRequest struct {
+	Rating  *float64 `json:"rating"`
+	Body    *string  `json:"body"`
+	Spoiler *bool    `json:"spoiler"`
+}
+
+// ValidateRequest checks the rating and the length of the body
+func (rr ReviewRequest) ValidateRequest() error {
+	return validateReview(rr.Rating, rr.Body)
+}
+
+// Apply sets the fields of the request on the review
+func (rr ReviewRequest) Apply(r *Review) {
+	r.Rating = rr.Rating
+	r.Body = strings.TrimSpace(rr.Body)
+	r.Spoiler = rr.Spoiler
+}
+
+// ValidateRequest only checks something is being changed, the changed review is checked by Apply
+func (rur ReviewUpdateRequest) ValidateRequest() error {
+	if rur.Rating == nil && rur.Body == nil && rur.Spoiler == nil {
+		return ErrReviewUpdateNoFields
+	}
+	return nil
+}
+
+// Apply sets the fields of the request on the review and checks the result
+func (rur ReviewUpdateRequest) Apply(r *Review) error {
+	if rur.Rating != nil {
+		r.Rating = *rur.Rating
+	}
+	if rur.Body != nil {
+		r.Body = strings.TrimSpace(*rur.Body)
+	}
+	if rur.Spoiler != nil {
+		r.Spoiler = *rur.Spoiler
+	}
+	return validateReview(r.Rating, r.Body)
+}
+
+// ValidReviewSort checks the order is one reviews can be sorted in
+func ValidReviewSort(sort string) bool {
+	switch sort {
+	case ReviewSortNewest, ReviewSortHelpful, ReviewSortRating:
+		return true
+	}
+	return false
+}
+
+// RatingBucket is the index of the rating in a histogram
+func RatingBucket(rating float64) int {
+	return int(rating*2) - 1
+}
+
+func validateReview(rating float64, body string) error {
+	if rating < MinRating || rating > MaxRating || rating*2 != math.Trunc(rating*2) {
+		return ErrReviewRatingInvalid
+	}
+	if utf8.RuneCountInString(strings.TrimSpace(body)) > MaxReviewBodyLength {
+		return ErrReviewBodyTooLong
+	}
+	return nil
+}
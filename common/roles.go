@@ -0,0 +1,108 @@
+package common
+
+// Site wide roles
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// Roles within a club
+const (
+	ClubRoleOwner     = "owner"
+	ClubRoleModerator = "moderator"
+	ClubRoleMember    = "member"
+)
+
+// Permissions a route can require. The club permissions are checked against the role of the user
+// in the club the request is for
+const (
+	PermissionUserAdmin    = "user:admin"
+	PermissionClubCreate   = "club:create"
+	PermissionClubRead     = "club:read"
+	PermissionClubModerate = "club:moderate"
+	PermissionClubManage   = "club:manage"
+	PermissionBookCreate   = "book:create"
+	PermissionBookManage   = "book:manage"
+)
+
+// Scopes a personal access token can have that are not permissions. Every user can do these, the
+// scope only limits what the token can be used for
+const (
+	ScopeUserRead      = "user:read"
+	ScopeBookRead      = "book:read"
+	ScopeReviewWrite   = "review:write"
+	ScopeProgressRead  = "progress:read"
+	ScopeProgressWrite = "progress:write"
+)
+
+// permissions are every permission, they are also the scopes a personal access token can have
+var permissions = []string{PermissionUserAdmin, PermissionClubCreate, PermissionClubRead, PermissionClubModerate,
+	PermissionClubManage, PermissionBookCreate, PermissionBookManage}
+
+// scopes are the scopes a personal access token can have besides the permissions
+var scopes = []string{ScopeUserRead, ScopeBookRead, ScopeReviewWrite, ScopeProgressRead, ScopeProgressWrite}
+
+// sitePermissions are granted by a site wide role. Admins are granted every permission
+var sitePermissions = map[string][]string{
+	RoleMember: []string{PermissionClubCreate, PermissionBookCreate},
+}
+
+// clubPermissions are granted by a role in a club, only for that club
+var clubPermissions = map[string][]string{
+	ClubRoleOwner:     []string{PermissionClubRead, PermissionClubModerate, PermissionClubManage},
+	ClubRoleModerator: []string{PermissionClubRead, PermissionClubModerate},
+	ClubRoleMember:    []string{PermissionClubRead},
+}
+
+// IsClubPermission is true for permissions that are granted per club
+func IsClubPermission(permission string) bool {
+	return containsString(clubPermissions[ClubRoleOwner], permission)
+}
+
+// ValidPermission checks the permission exists
+func ValidPermission(permission string) bool {
+	return containsString(permissions, permission)
+}
+
+// ValidScope checks the scope is a permission or one of the other scopes
+func ValidScope(scope string) bool {
+	return ValidPermission(scope) || containsString(scopes, scope)
+}
+
+// ValidClubRole checks the role is one a user can have in a club
+func ValidClubRole(role string) bool {
+	_, ok := clubPermissions[role]
+	return ok
+}
+
+// HasPermission checks the roles in the claims grant the permission. clubID is only used for club
+// permissions. A personal access token also needs the permission in its scopes
+func (tc *TokenClaims) HasPermission(permission, clubID string) bool {
+	if tc.PersonalAccessToken && !containsString(tc.Scopes, permission) {
+		return false
+	}
+	for _, role := range tc.Roles {
+		if role == RoleAdmin || containsString(sitePermissions[role], permission) {
+			return true
+		}
+	}
+	if clubID == "" || !IsClubPermission(permission) {
+		return false
+	}
+	role, ok := tc.ClubRoles[clubID]
+	return ok && containsString(clubPermissions[role], permission)
+}
+
+// HasScope checks a personal access token has the scope, a JSON token has every scope
+func (tc *TokenClaims) HasScope(scope string) bool {
+	return !tc.PersonalAccessToken || containsString(tc.Scopes, scope)
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package common
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits on discussions, lengths are in characters. A post replying to the start of a thread has a
+// depth of 1
+const (
+	MaxThreadTitleLength = 200
+	MaxPostBodyLength    = 10000
+	MaxPostDepth         = 8
+)
+
+// Thread is a discussion in a club. It can be about a book, and about a section of a reading plan, in
+// which case the book is the book of the plan. The first post is the start of the discussion. Hidden
+// is set when the posts are kept from the user as their progress has not reached the section
+type Thread struct {
+	ID         string    `json:"id"`
+	ClubID     string    `json:"clubID"`
+	BookID     string    `json:"bookID,omitempty"`
+	PlanID     string    `json:"planID,omitempty"`
+	SectionID  string    `json:"sectionID,omitempty"`
+	Title      string    `json:"title"`
+	CreatedBy  string    `json:"createdBy"`
+	PostCount  int       `json:"postCount"`
+	LastPostAt time.Time `json:"lastPostAt"`
+	Hidden     bool      `json:"hidden"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// Post is a message in a thread. ParentID is the post it replies to, it is empty for the first post of
+// the thread. The body of a deleted post is not shown but its replies are. Hidden is set when the body
+// is kept from the user as a spoiler
+type Post struct {
+	ID          string     `json:"id"`
+	ThreadID    string     `json:"threadID"`
+	ParentID    string     `json:"parentID,omitempty"`
+	Depth       int        `json:"depth"`
+	AuthorID    string     `json:"authorID"`
+	DisplayName string     `json:"displayName"`
+	Body        string     `json:"body"`
+	Deleted     bool       `json:"deleted"`
+	Hidden      bool       `json:"hidden"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	EditedAt    *time.Time `json:"editedAt"`
+}
+
+// PostRevision is the body of a post before it was edited, and when that body was written
+type PostRevision struct {
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ThreadFilter narrows the threads of a club. SectionID is only used with PlanID
+type ThreadFilter struct {
+	ClubID    string
+	BookID    string
+	PlanID    string
+	SectionID string
+	CursorPagination
+}
+
+// ThreadRequest starts a thread, the body is the first post. A thread about a section gives both the
+// planID and the id of the section
+type ThreadRequest struct {
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	BookID    string `json:"bookID"`
+	PlanID    string `json:"planID"`
+	SectionID string `json:"sectionID"`
+}
+
+// ThreadUpdateRequest renames a thread
+type ThreadUpdateRequest struct {
+	Title string `json:"title"`
+}
+
+// PostRequest adds a post to a thread, replying to the parent post
+type PostRequest struct {
+	Body     string `json:"body"`
+	ParentID string `json:"parentID"`
+}
+
+// PostUpdateRequest edits a post, the body it replaces is kept in the history
+type PostUpdateRequest struct {
+	Body string `json:"body"`
+}
+
+// ValidateRequest trims the title and body and checks them
+func (tr *ThreadRequest) ValidateRequest() error {
+	tr.Title = strings.TrimSpace(tr.Title)
+	if err := validateThreadTitle(tr.Title); err != nil {
+		return err
+	}
+	tr.Body = strings.TrimSpace(tr.Body)
+	if err := validatePostBody(tr.Body); err != nil {
+		return err
+	}
+	tr.BookID = strings.TrimSpace(tr.BookID)
+	tr.PlanID = strings.TrimSpace(tr.PlanID)
+	tr.SectionID = strings.TrimSpace(tr.SectionID)
+	if (tr.PlanID == "") != (tr.SectionID == "") {
+		return ErrThreadSectionInvalid
+	}
+	return nil
+}
+
+// ValidateRequest trims the title and checks it
+func (tur *ThreadUpdateRequest) ValidateRequest() error {
+	tur.Title = strings.TrimSpace(tur.Title)
+	return validateThreadTitle(tur.Title)
+}
+
+// ValidateRequest trims the body and checks it
+func (pr *PostRequest) ValidateRequest() error {
+	pr.Body = strings.TrimSpace(pr.Body)
+	pr.ParentID = strings.TrimSpace(pr.ParentID)
+	return validatePostBody(pr.Body)
+}
+
+// ValidateRequest trims the body and checks it
+func (pur *PostUpdateRequest) ValidateRequest() error {
+	pur.Body = strings.TrimSpace(pur.Body)
+	return validatePostBody(pur.Body)
+}
+
+// Section returns the section of the plan with the id, or nil when the plan no longer has it
+func (rp ReadingPlan) Section(id string) *ReadingPlanSection {
+	for i := range rp.Sections {
+		if rp.Sections[i].ID == id {
+			return &rp.Sections[i]
+		}
+	}
+	return nil
+}
+
+// ReachedBy checks the progress has reached the start of the section. Progress that can not be
+// compared against the plan, or no progress at all, has not reached it
+func (s ReadingPlanSection) ReachedBy(p *ReadingProgress, unit string, pageCount int) bool {
+	if p == nil {
+		return false
+	}
+	reached, ok := p.Reached(unit, pageCount)
+	return ok && reached >= s.Start
+}
+
+// Hide keeps the body of the post from the user
+func (p *Post) Hide() {
+	p.Body = ""
+	p.Hidden = true
+}
+
+func validateThreadTitle(title string) error {
+	if title == "" {
+		return ErrThreadTitleNotPresent
+	}
+	if utf8.RuneCountInString(title) > MaxThreadTitleLength {
+		return ErrThreadTitleTooLong
+	}
+	return nil
+}
+
+func validatePostBody(body string) error {
+	if body == "" {
+		return ErrPostBodyNotPresent
+	}
+	if utf8.RuneCountInString(body) > MaxPostBodyLength {
+		return ErrPostBodyTooLong
+	}
+	return nil
+}
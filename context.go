@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/garycarr/book_club/common"
+)
+
+// contextKey is unexported so no other package can read or overwrite our request context values
+type contextKey int
+
+const claimsContextKey contextKey = iota
+
+// withRequestClaims returns a copy of the request carrying the verified claims of its JSON token
+func withRequestClaims(r *http.Request, claims *common.TokenClaims) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), claimsContextKey, claims))
+}
+
+// requestClaims returns the claims authMiddleware verified for the request. It returns false if
+// the request did not go through authMiddleware
+func requestClaims(r *http.Request) (*common.TokenClaims, bool) {
+	claims, ok := r.Context().Value(claimsContextKey).(*common.TokenClaims)
+	return claims, ok && claims != nil
+}
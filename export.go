@@ -0,0 +1,115 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	exportFormatJSON = "json"
+	exportFormatZIP  = "zip"
+	exportFileName   = "book_club_export"
+)
+
+// userMeExportGet gives the user a copy of the personal data stored about them, as JSON or as a
+// ZIP archive of the JSON when format=zip
+func (a *app) userMeExportGet(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormatJSON
+	}
+	if format != exportFormatJSON && format != exportFormatZIP {
+		a.respondWithError(w, http.StatusBadRequest, common.ErrExportFormatInvalid.Error())
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	export, err := a.warehouse.ExportUser(claims.UserID)
+	if err != nil {
+		if err == common.ErrUserNotFound {
+			a.respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to export user")
+		a.respondWithError(w, http.StatusInternalServerError, "Error exporting the user")
+		return
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to marshal export")
+		a.respondWithError(w, http.StatusInternalServerError, "Error exporting the user")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", exportFileName, format))
+	if format == exportFormatJSON {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.WriteHeader(http.StatusOK)
+	zw := zip.NewWriter(w)
+	f, err := zw.Create(exportFileName + ".json")
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		// The headers have been sent so all that can be done is log it
+		a.logrus.WithError(err).Error("Unable to write export archive")
+	}
+}
+
+// userMeExportOptions returns the allowed options
+func (a *app) userMeExportOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// adminUserErasePost permanently erases the personal data of a user. It is for erasure requests
+// from members, deleting an account through /user/me only soft deletes it
+func (a *app) adminUserErasePost(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	userID := mux.Vars(r)["userID"]
+	erasure, err := a.warehouse.EraseUser(userID, claims.UserID)
+	if err != nil {
+		if err == common.ErrUserNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to erase user")
+		a.respondWithError(w, http.StatusInternalServerError, "Error erasing the user")
+		return
+	}
+	a.logrus.WithFields(logrus.Fields{
+		"event":     "user_erased",
+		"userID":    userID,
+		"erasedBy":  claims.UserID,
+		"erasureID": erasure.ID,
+	}).Warn("User erased")
+	a.respondWithJSON(w, http.StatusOK, erasure)
+}
+
+// adminUserEraseOptions returns the allowed options
+func (a *app) adminUserEraseOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserMeExportGet(t *testing.T) {
+	type testData struct {
+		description         string
+		expectedContentType string
+		expectedHTTPStatus  int
+		format              string
+	}
+
+	testTable := []testData{
+		testData{
+			description:         "JSON by default",
+			expectedContentType: "application/json",
+			expectedHTTPStatus:  http.StatusOK,
+		},
+		testData{
+			description:         "ZIP archive",
+			expectedContentType: "application/zip",
+			expectedHTTPStatus:  http.StatusOK,
+			format:              "zip",
+		},
+		testData{
+			description:         "Unknown format",
+			expectedContentType: "application/json",
+			expectedHTTPStatus:  http.StatusBadRequest,
+			format:              "csv",
+		},
+	}
+	export := &common.UserExport{
+		ExportedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Profile:    common.UserProfile{ID: validUserID, Email: validUserEmail, DisplayName: validUserDisplayName},
+		ClubMemberships: []common.ExportClubMembership{
+			common.ExportClubMembership{ClubID: "clubID", Role: common.ClubRoleMember},
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodGet, "/user/me/export?format="+td.format, nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupTOTPTest(req)
+		if td.expectedHTTPStatus == http.StatusOK {
+			mockWarehouse.On("ExportUser", validUserID).Return(export, nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		assert.Equal(t, td.expectedContentType, responseRecorder.Header().Get("Content-Type"), td.description)
+		if td.expectedHTTPStatus != http.StatusOK {
+			continue
+		}
+		data := responseRecorder.Body.Bytes()
+		if td.format == "zip" {
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Errorf("Unable to read ZIP response for test %q: %v", td.description, err)
+				continue
+			}
+			if !assert.Len(t, zr.File, 1, td.description) {
+				continue
+			}
+			assert.Equal(t, "book_club_export.json", zr.File[0].Name, td.description)
+			f, err := zr.File[0].Open()
+			if err != nil {
+				t.Errorf("Unable to open ZIP file for test %q: %v", td.description, err)
+				continue
+			}
+			data, err = ioutil.ReadAll(f)
+			f.Close()
+			if err != nil {
+				t.Errorf("Unable to read ZIP file for test %q: %v", td.description, err)
+				continue
+			}
+		}
+		got := &common.UserExport{}
+		if err = json.Unmarshal(data, got); err != nil {
+			t.Errorf("Unable to decode export for test %q: %v", td.description, err)
+			continue
+		}
+		assert.Equal(t, export, got, td.description)
+	}
+}
+
+func TestAdminUserErasePost(t *testing.T) {
+	type testData struct {
+		description        string
+		claims             *common.TokenClaims
+		eraseError         error
+		expectedHTTPStatus int
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Admin erases the user",
+			claims:             &common.TokenClaims{UserID: "adminID", EmailVerified: true, Roles: []string{common.RoleAdmin}},
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description:        "Unknown or already erased user",
+			claims:             &common.TokenClaims{UserID: "adminID", EmailVerified: true, Roles: []string{common.RoleAdmin}},
+			eraseError:         common.ErrUserNotFound,
+			expectedHTTPStatus: http.StatusNotFound,
+		},
+		testData{
+			description:        "Members can not erase users",
+			claims:             &common.TokenClaims{UserID: validUserID, EmailVerified: true, Roles: []string{common.RoleMember}},
+			expectedHTTPStatus: http.StatusForbidden,
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodPost, "/admin/users/erasedID/erase", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req, td.claims)
+		if td.expectedHTTPStatus != http.StatusForbidden {
+			erasure := &common.UserErasure{ID: "erasureID", UserID: "erasedID", ErasedBy: "adminID"}
+			if td.eraseError != nil {
+				erasure = nil
+			}
+			mockWarehouse.On("EraseUser", "erasedID", "adminID").Return(erasure, td.eraseError)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
@@ -6,7 +6,8 @@ import (
 
 // homePageGet returns the homepage data
 func (a *app) homePageGet(w http.ResponseWriter, r *http.Request) {
-	a.respondWithJSON(w, http.StatusOK, map[string]string{"salrightman": "boom"})
+	claims, _ := requestClaims(r)
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"salrightman": "boom", "displayName": claims.DisplayName})
 }
 
 // homePageOptions returns the allowed options
@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/garycarr/book_club/common"
 	"github.com/garycarr/book_club/util"
+	"github.com/garycarr/book_club/warehouse"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -36,8 +38,12 @@ func TestHomePageGet(t *testing.T) {
 		req.Header.Add("Authorization", validJWT)
 		a, responseRecorder := setupTest(req)
 		mockUtil := util.MockUtil{}
-		mockUtil.On("CheckJSONToken", validJWT).Return(nil)
+		claims := &common.TokenClaims{ID: "jti", DisplayName: validUserDisplayName}
+		mockUtil.On("CheckJSONToken", validJWT).Return(claims, nil)
 		a.util = &mockUtil
+		mockWarehouse := warehouse.MockWarehouse{}
+		mockWarehouse.On("IsJSONTokenRevoked", claims).Return(false, nil)
+		a.warehouse = &mockWarehouse
 		a.Router.ServeHTTP(responseRecorder, req)
 		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
 
@@ -59,5 +65,8 @@ func TestHomePageGet(t *testing.T) {
 			continue
 		}
 		assert.Equal(t, salrightman, "boom", td.description)
+		// The claims come from the request context, the token is not parsed again
+		assert.Equal(t, validUserDisplayName, jsonResp["displayName"], td.description)
+		mockUtil.AssertNumberOfCalls(t, "CheckJSONToken", 1)
 	}
 }
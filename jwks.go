@@ -0,0 +1,13 @@
+package main
+
+import "net/http"
+
+// jwksGet publishes the public keys JSON tokens are signed with so other services can verify them
+func (a *app) jwksGet(w http.ResponseWriter, r *http.Request) {
+	a.respondWithJSON(w, http.StatusOK, a.util.JSONWebKeySet())
+}
+
+// jwksOptions returns the allowed options
+func (a *app) jwksOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWKSGet(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	if err != nil {
+		t.Fatalf("Error creating new request: %v", err)
+	}
+	a, responseRecorder := setupTest(req)
+	a.Router.ServeHTTP(responseRecorder, req)
+	if !assert.Equal(t, http.StatusOK, responseRecorder.Code) {
+		t.FailNow()
+	}
+	jwks := common.JSONWebKeySet{}
+	if err = json.NewDecoder(responseRecorder.Body).Decode(&jwks); err != nil {
+		t.Fatalf("Unable to decode JSON response: %v", err)
+	}
+	if assert.Len(t, jwks.Keys, 1) {
+		assert.Equal(t, "test", jwks.Keys[0].KeyID)
+		assert.Equal(t, "ES256", jwks.Keys[0].Algorithm)
+	}
+}
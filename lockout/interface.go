@@ -0,0 +1,14 @@
+package lockout
+
+import "time"
+
+// TrackerIn counts failed login attempts for a key, such as an email or a client IP, and locks the
+// key out once there are too many
+type TrackerIn interface {
+	// Check returns how long the key is locked out for, zero if it is not locked out
+	Check(key string) (time.Duration, error)
+	// Fail records a failed attempt and returns how long the key is now locked out for
+	Fail(key string) (time.Duration, error)
+	// Reset forgets the failed attempts of the key
+	Reset(key string) error
+}
@@ -0,0 +1,71 @@
+package lockout
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/garycarr/book_club/warehouse"
+)
+
+const (
+	// TypeMemory keeps the attempts in memory, they are not shared between instances
+	TypeMemory = "memory"
+	// TypePostgres keeps the attempts in the warehouse so every instance sees them
+	TypePostgres = "postgres"
+
+	defaultThreshold  = 5
+	defaultLockout    = time.Duration(1 * time.Minute)
+	defaultMaxLockout = time.Duration(1 * time.Hour)
+	defaultWindow     = time.Duration(15 * time.Minute)
+)
+
+// Config ...
+type Config struct {
+	// Threshold is the number of failed attempts before the key is locked out
+	Threshold int
+	// Lockout is how long the first lockout lasts, it doubles with every failure after that up to
+	// MaxLockout
+	Lockout    time.Duration
+	MaxLockout time.Duration
+	// Window is how long after the last failure or lockout the failures are forgotten
+	Window time.Duration
+}
+
+// NewTracker returns the tracker for the configured type, defaulting to the memory tracker. Zero
+// values in the config are replaced with the defaults
+func NewTracker(trackerType string, conf Config, wh warehouse.WarehouseIn) (TrackerIn, error) {
+	if conf.Threshold <= 0 {
+		conf.Threshold = defaultThreshold
+	}
+	if conf.Lockout <= 0 {
+		conf.Lockout = defaultLockout
+	}
+	if conf.MaxLockout <= 0 {
+		conf.MaxLockout = defaultMaxLockout
+	}
+	if conf.Window <= 0 {
+		conf.Window = defaultWindow
+	}
+	switch trackerType {
+	case TypeMemory, "":
+		return NewMemoryTracker(conf), nil
+	case TypePostgres:
+		return NewPostgresTracker(conf, wh), nil
+	}
+	return nil, fmt.Errorf("Unknown lockout tracker type %q", trackerType)
+}
+
+// lockoutFor returns how long a key with the number of failures is locked out for
+func (c Config) lockoutFor(failures int) time.Duration {
+	if failures < c.Threshold {
+		return 0
+	}
+	lockout := c.Lockout
+	for i := c.Threshold; i < failures && lockout < c.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > c.MaxLockout {
+		return c.MaxLockout
+	}
+	return lockout
+}
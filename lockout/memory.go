@@ -0,0 +1,94 @@
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+// memoryPruneSize is the number of keys after which expired keys are removed
+const memoryPruneSize = 10000
+
+type attempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// expired is true once the failures can be forgotten
+func (at *attempts) expired(now time.Time, window time.Duration) bool {
+	last := at.lastFailure
+	if at.lockedUntil.After(last) {
+		last = at.lockedUntil
+	}
+	return now.Sub(last) > window
+}
+
+// MemoryTracker keeps the attempts in memory, for a single instance deployment
+type MemoryTracker struct {
+	conf     Config
+	mu       sync.Mutex
+	attempts map[string]*attempts
+	now      func() time.Time
+}
+
+// NewMemoryTracker ...
+func NewMemoryTracker(conf Config) *MemoryTracker {
+	return &MemoryTracker{
+		conf:     conf,
+		attempts: map[string]*attempts{},
+		now:      time.Now,
+	}
+}
+
+// Check ...
+func (mt *MemoryTracker) Check(key string) (time.Duration, error) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	at, ok := mt.attempts[key]
+	if !ok {
+		return 0, nil
+	}
+	if remaining := at.lockedUntil.Sub(mt.now()); remaining > 0 {
+		return remaining, nil
+	}
+	return 0, nil
+}
+
+// Fail ...
+func (mt *MemoryTracker) Fail(key string) (time.Duration, error) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	now := mt.now()
+	if len(mt.attempts) >= memoryPruneSize {
+		mt.prune(now)
+	}
+	at, ok := mt.attempts[key]
+	if !ok || at.expired(now, mt.conf.Window) {
+		at = &attempts{}
+		mt.attempts[key] = at
+	}
+	at.failures++
+	at.lastFailure = now
+	lockout := mt.conf.lockoutFor(at.failures)
+	if lockout > 0 {
+		at.lockedUntil = now.Add(lockout)
+	}
+	return lockout, nil
+}
+
+// Reset ...
+func (mt *MemoryTracker) Reset(key string) error {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	delete(mt.attempts, key)
+	return nil
+}
+
+// prune removes the keys whose failures can be forgotten, mu must be held
+func (mt *MemoryTracker) prune(now time.Time) {
+	for key, at := range mt.attempts {
+		if at.expired(now, mt.conf.Window) {
+			delete(mt.attempts, key)
+		}
+	}
+}
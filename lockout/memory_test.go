@@ -0,0 +1,71 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMemoryTracker() (*MemoryTracker, *time.Time) {
+	now := time.Date(2017, 11, 25, 12, 0, 0, 0, time.UTC)
+	mt := NewMemoryTracker(Config{
+		Threshold:  3,
+		Lockout:    time.Minute,
+		MaxLockout: 4 * time.Minute,
+		Window:     10 * time.Minute,
+	})
+	mt.now = func() time.Time { return now }
+	return mt, &now
+}
+
+func TestMemoryTrackerBackoff(t *testing.T) {
+	mt, now := newTestMemoryTracker()
+	// Every failure from the threshold on doubles the lockout up to the maximum
+	expected := []time.Duration{0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute}
+	for i, lockout := range expected {
+		got, err := mt.Fail("email:bob@example.com")
+		assert.Nil(t, err)
+		assert.Equal(t, lockout, got, "failure %d", i+1)
+		remaining, err := mt.Check("email:bob@example.com")
+		assert.Nil(t, err)
+		assert.Equal(t, lockout, remaining, "failure %d", i+1)
+	}
+	// Other keys are not affected
+	remaining, _ := mt.Check("email:alice@example.com")
+	assert.Equal(t, time.Duration(0), remaining)
+
+	*now = now.Add(3 * time.Minute)
+	remaining, _ = mt.Check("email:bob@example.com")
+	assert.Equal(t, time.Minute, remaining)
+	*now = now.Add(time.Minute)
+	remaining, _ = mt.Check("email:bob@example.com")
+	assert.Equal(t, time.Duration(0), remaining)
+}
+
+func TestMemoryTrackerWindow(t *testing.T) {
+	mt, now := newTestMemoryTracker()
+	mt.Fail("ip:127.0.0.1")
+	mt.Fail("ip:127.0.0.1")
+	// The failures are forgotten after the window
+	*now = now.Add(11 * time.Minute)
+	lockout, _ := mt.Fail("ip:127.0.0.1")
+	assert.Equal(t, time.Duration(0), lockout)
+
+	// The window starts again from the end of a lockout
+	mt.Fail("ip:127.0.0.1")
+	lockout, _ = mt.Fail("ip:127.0.0.1")
+	assert.Equal(t, time.Minute, lockout)
+	*now = now.Add(time.Minute + 9*time.Minute)
+	lockout, _ = mt.Fail("ip:127.0.0.1")
+	assert.Equal(t, 2*time.Minute, lockout)
+}
+
+func TestMemoryTrackerReset(t *testing.T) {
+	mt, _ := newTestMemoryTracker()
+	mt.Fail("email:bob@example.com")
+	mt.Fail("email:bob@example.com")
+	assert.Nil(t, mt.Reset("email:bob@example.com"))
+	lockout, _ := mt.Fail("email:bob@example.com")
+	assert.Equal(t, time.Duration(0), lockout)
+}
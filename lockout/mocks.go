@@ -0,0 +1,30 @@
+package lockout
+
+import (
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockTracker implements the TrackerIn interface for the purpose of testing
+type MockTracker struct {
+	mock.Mock
+}
+
+// Check is used to assert the method is called
+func (mt *MockTracker) Check(key string) (time.Duration, error) {
+	args := mt.Called(key)
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+// Fail is used to assert the method is called
+func (mt *MockTracker) Fail(key string) (time.Duration, error) {
+	args := mt.Called(key)
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+// Reset is used to assert the method is called
+func (mt *MockTracker) Reset(key string) error {
+	args := mt.Called(key)
+	return args.Error(0)
+}
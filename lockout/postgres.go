@@ -0,0 +1,55 @@
+package lockout
+
+import (
+	"time"
+
+	"github.com/garycarr/book_club/warehouse"
+)
+
+// PostgresTracker keeps the attempts in the warehouse so the lockout holds across instances
+type PostgresTracker struct {
+	conf      Config
+	warehouse warehouse.WarehouseIn
+}
+
+// NewPostgresTracker ...
+func NewPostgresTracker(conf Config, wh warehouse.WarehouseIn) *PostgresTracker {
+	return &PostgresTracker{
+		conf:      conf,
+		warehouse: wh,
+	}
+}
+
+// Check ...
+func (pt *PostgresTracker) Check(key string) (time.Duration, error) {
+	lockedUntil, err := pt.warehouse.GetLoginLockedUntil(key)
+	if err != nil || lockedUntil == nil {
+		return 0, err
+	}
+	if remaining := time.Until(*lockedUntil); remaining > 0 {
+		return remaining, nil
+	}
+	return 0, nil
+}
+
+// Fail ...
+func (pt *PostgresTracker) Fail(key string) (time.Duration, error) {
+	now := time.Now()
+	failures, err := pt.warehouse.RecordLoginFailure(key, now.Add(-pt.conf.Window))
+	if err != nil {
+		return 0, err
+	}
+	lockout := pt.conf.lockoutFor(failures)
+	if lockout == 0 {
+		return 0, nil
+	}
+	if err = pt.warehouse.LockLogin(key, now.Add(lockout)); err != nil {
+		return 0, err
+	}
+	return lockout, nil
+}
+
+// Reset ...
+func (pt *PostgresTracker) Reset(key string) error {
+	return pt.warehouse.ResetLoginFailures(key)
+}
@@ -0,0 +1,68 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/warehouse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPostgresTrackerFail(t *testing.T) {
+	type testData struct {
+		description     string
+		failures        int
+		expectedLockout time.Duration
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Under the threshold",
+			failures:    2,
+		},
+		testData{
+			description:     "At the threshold",
+			failures:        3,
+			expectedLockout: time.Minute,
+		},
+		testData{
+			description:     "Over the threshold",
+			failures:        4,
+			expectedLockout: 2 * time.Minute,
+		},
+	}
+	conf := Config{Threshold: 3, Lockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour}
+	for _, td := range testTable {
+		mockWarehouse := warehouse.MockWarehouse{}
+		mockWarehouse.On("RecordLoginFailure", "email:bob@example.com", mock.AnythingOfType("time.Time")).Return(td.failures, nil)
+		if td.expectedLockout > 0 {
+			mockWarehouse.On("LockLogin", "email:bob@example.com", mock.AnythingOfType("time.Time")).Return(nil)
+		}
+		pt := NewPostgresTracker(conf, &mockWarehouse)
+		lockout, err := pt.Fail("email:bob@example.com")
+		assert.Nil(t, err, td.description)
+		assert.Equal(t, td.expectedLockout, lockout, td.description)
+		mockWarehouse.AssertExpectations(t)
+	}
+}
+
+func TestPostgresTrackerCheck(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	mockWarehouse := warehouse.MockWarehouse{}
+	mockWarehouse.On("GetLoginLockedUntil", "never").Return(nil, nil)
+	mockWarehouse.On("GetLoginLockedUntil", "expired").Return(&past, nil)
+	mockWarehouse.On("GetLoginLockedUntil", "locked").Return(&future, nil)
+	pt := NewPostgresTracker(Config{}, &mockWarehouse)
+
+	remaining, err := pt.Check("never")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), remaining)
+	remaining, err = pt.Check("expired")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), remaining)
+	remaining, err = pt.Check("locked")
+	assert.Nil(t, err)
+	assert.True(t, remaining > 59*time.Minute)
+}
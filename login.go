@@ -3,10 +3,17 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/garycarr/book_club/common"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/garycarr/book_club/lockout"
+	"github.com/garycarr/book_club/util"
+	"github.com/sirupsen/logrus"
 )
 
 // loginPost returns a JSON token if the login was successful
@@ -22,10 +29,23 @@ func (a *app) loginPost(w http.ResponseWriter, r *http.Request) {
 		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
 		return
 	}
+	keys := a.loginLockoutKeys(r, login.Email)
+	retryAfter, err := checkLoginLockout(keys)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to check login lockout")
+		a.respondWithError(w, http.StatusInternalServerError, "Error checking user credentials")
+		return
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		a.respondWithError(w, http.StatusTooManyRequests, common.ErrLoginLockedOut.Error())
+		return
+	}
 	user, err := a.validateCredentials(login)
 	if err != nil {
 		if err == common.ErrLoginUserNotFound {
 			a.logrus.Debug("Incorrect password given")
+			a.recordLoginFailure(keys)
 			a.respondWithError(w, http.StatusUnauthorized, err.Error())
 			return
 		}
@@ -33,14 +53,35 @@ func (a *app) loginPost(w http.ResponseWriter, r *http.Request) {
 		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error checking user credentials"))
 		return
 	}
+	// Only the email is reset, otherwise an attacker could clear the IP lockout with their own account
+	if err = a.emailLockout.Reset(emailLockoutKey(login.Email)); err != nil {
+		a.logrus.WithError(err).Error("Unable to reset login failures")
+	}
+	a.respondWithLogin(w, user)
+}
+
+// respondWithLogin responds with the tokens for the user, or a token for /login/mfa if the user has
+// two factor authentication turned on
+func (a *app) respondWithLogin(w http.ResponseWriter, user *common.User) {
+	if user.TOTPEnabledAt != nil {
+		// The first factor was right, the user still has to give a TOTP code to /login/mfa
+		mfaToken, err := a.util.CreateMFAToken(user)
+		if err != nil {
+			a.logrus.WithError(err).Error("Unable to create MFA token")
+			a.respondWithError(w, http.StatusInternalServerError, "Unable to create JSON token")
+			return
+		}
+		a.respondWithJSON(w, http.StatusOK, map[string]string{"mfaToken": mfaToken})
+		return
+	}
 	// Create the JSON token as the login is valid
-	jsonToken, err := a.util.CreateJSONToken(user)
+	tokens, err := a.createTokens(user, nil)
 	if err != nil {
-		a.logrus.WithError(err).Error("Unable to create JSON token")
+		a.logrus.WithError(err).Error("Unable to create tokens")
 		a.respondWithError(w, http.StatusInternalServerError, "Unable to create JSON token")
 		return
 	}
-	a.respondWithJSON(w, http.StatusOK, map[string]string{"token": jsonToken})
+	a.respondWithJSON(w, http.StatusOK, tokens)
 }
 
 // loginOptions returns the allowed options
@@ -48,16 +89,213 @@ func (a *app) loginOptions(w http.ResponseWriter, r *http.Request) {
 	a.optionsHeaders(w)
 }
 
+// loginMFAPost exchanges the token from loginPost and a TOTP or recovery code for a JSON token. Wrong
+// codes are counted against the user, once they are locked out the token is revoked so guessing goes
+// back through the password. The token is also revoked once it has been used
+func (a *app) loginMFAPost(w http.ResponseWriter, r *http.Request) {
+	lmr := common.LoginMFARequest{}
+	if err := json.NewDecoder(r.Body).Decode(&lmr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := lmr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	claims, err := a.util.CheckMFAToken(lmr.MFAToken)
+	if err != nil {
+		a.logrus.WithError(err).Debug("Invalid MFA token")
+		a.respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	keys, ok := a.checkMFALockout(w, claims.UserID)
+	if !ok {
+		return
+	}
+	revoked, err := a.warehouse.IsJSONTokenRevoked(claims)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to check if MFA token is revoked")
+		a.respondWithError(w, http.StatusInternalServerError, "Error checking user credentials")
+		return
+	}
+	if revoked {
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenRevoked.Error())
+		return
+	}
+	user, err := a.warehouse.GetUserWithID(claims.UserID)
+	if err != nil {
+		if err == common.ErrUserNotFound {
+			a.respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to get user")
+		a.respondWithError(w, http.StatusInternalServerError, "Error checking user credentials")
+		return
+	}
+	if user.TOTPEnabledAt == nil {
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrTOTPNotEnabled.Error())
+		return
+	}
+	if err = a.checkSecondFactor(user, lmr.Code); err != nil {
+		if err == common.ErrTOTPCodeInvalid && a.recordLoginFailure(keys) {
+			if err := a.warehouse.RevokeJSONToken(claims.ID, claims.ExpiresAt); err != nil {
+				a.logrus.WithError(err).Error("Unable to revoke MFA token")
+			}
+		}
+		a.respondWithTOTPError(w, err)
+		return
+	}
+	a.resetMFALockout(claims.UserID)
+	if err = a.warehouse.RevokeJSONToken(claims.ID, claims.ExpiresAt); err != nil {
+		a.logrus.WithError(err).Error("Unable to revoke MFA token")
+		a.respondWithError(w, http.StatusInternalServerError, "Error checking user credentials")
+		return
+	}
+	tokens, err := a.createTokens(user, nil)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to create tokens")
+		a.respondWithError(w, http.StatusInternalServerError, "Unable to create JSON token")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, tokens)
+}
+
+// loginMFAOptions returns the allowed options
+func (a *app) loginMFAOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// loginLockoutKey is a key failed logins are counted under, with the tracker counting them
+type loginLockoutKey struct {
+	tracker lockout.TrackerIn
+	key     string
+}
+
+// loginLockoutKeys returns the email key followed by the client IP key for a login request
+func (a *app) loginLockoutKeys(r *http.Request, email string) []loginLockoutKey {
+	return []loginLockoutKey{
+		loginLockoutKey{tracker: a.emailLockout, key: emailLockoutKey(email)},
+		loginLockoutKey{tracker: a.ipLockout, key: "ip:" + a.clientIP(r)},
+	}
+}
+
+func emailLockoutKey(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+// mfaLockoutKey counts the wrong two factor codes of the user, whichever client sends them
+func mfaLockoutKey(userID string) string {
+	return "mfa:" + userID
+}
+
+// checkMFALockout returns the keys wrong two factor codes of the user are counted under. If it
+// returns false the user is locked out or the check failed, and the error response has been written
+func (a *app) checkMFALockout(w http.ResponseWriter, userID string) ([]loginLockoutKey, bool) {
+	keys := []loginLockoutKey{loginLockoutKey{tracker: a.emailLockout, key: mfaLockoutKey(userID)}}
+	retryAfter, err := checkLoginLockout(keys)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to check login lockout")
+		a.respondWithError(w, http.StatusInternalServerError, "Error checking user credentials")
+		return nil, false
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		a.respondWithError(w, http.StatusTooManyRequests, common.ErrLoginLockedOut.Error())
+		return nil, false
+	}
+	return keys, true
+}
+
+// resetMFALockout forgets the wrong two factor codes of the user once they give a valid one
+func (a *app) resetMFALockout(userID string) {
+	if err := a.emailLockout.Reset(mfaLockoutKey(userID)); err != nil {
+		a.logrus.WithError(err).Error("Unable to reset login failures")
+	}
+}
+
+// checkLoginLockout returns the longest lockout of the keys, zero if none are locked out
+func checkLoginLockout(keys []loginLockoutKey) (time.Duration, error) {
+	var longest time.Duration
+	for _, k := range keys {
+		retryAfter, err := k.tracker.Check(k.key)
+		if err != nil {
+			return 0, err
+		}
+		if retryAfter > longest {
+			longest = retryAfter
+		}
+	}
+	return longest, nil
+}
+
+// recordLoginFailure counts the failure against every key, a lockout is logged as a security event. It
+// returns true if any key is now locked out
+func (a *app) recordLoginFailure(keys []loginLockoutKey) bool {
+	locked := false
+	for _, k := range keys {
+		lockedFor, err := k.tracker.Fail(k.key)
+		if err != nil {
+			a.logrus.WithError(err).Error("Unable to record login failure")
+			continue
+		}
+		if lockedFor > 0 {
+			locked = true
+			a.logrus.WithFields(logrus.Fields{
+				"event":     "login_lockout",
+				"key":       k.key,
+				"lockedFor": lockedFor.String(),
+			}).Warn("Too many failed logins, locking out")
+		}
+	}
+	return locked
+}
+
+// clientIP returns the IP address of the client that sent the request
+func (a *app) clientIP(r *http.Request) string {
+	if a.conf.Lockout.TrustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			// The load balancer appends the address it saw, anything before it can be forged
+			addresses := strings.Split(forwarded, ",")
+			return strings.TrimSpace(addresses[len(addresses)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func (a *app) validateCredentials(lr common.LoginRequest) (*common.User, error) {
 	user, err := a.warehouse.GetUserWithEmail(lr.Email)
 	if err != nil {
 		return nil, err
 	}
 	if err = a.util.CheckHashedPassword(user.Password, lr.Password); err != nil {
-		if err != bcrypt.ErrMismatchedHashAndPassword {
+		if err != util.ErrPasswordMismatch {
 			return nil, fmt.Errorf("An error occurred checking the password: %s", err.Error())
 		}
 		return nil, common.ErrLoginUserNotFound
 	}
+	if a.util.PasswordNeedsRehash(user.Password) {
+		a.rehashPassword(user, lr.Password)
+	}
 	return user, nil
 }
+
+// rehashPassword upgrades the stored hash to the configured algorithm and cost while the password is
+// known. The login carries on if it fails, the next login will try again
+func (a *app) rehashPassword(user *common.User, password string) {
+	hashedPassword, err := a.util.CreateHashedPassword(password)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to rehash password")
+		return
+	}
+	if err = a.warehouse.UpdatePassword(user.ID, hashedPassword); err != nil {
+		a.logrus.WithError(err).Error("Unable to store rehashed password")
+		return
+	}
+	user.Password = hashedPassword
+}
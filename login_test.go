@@ -3,13 +3,18 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/lockout"
 	"github.com/garycarr/book_club/util"
 	"github.com/garycarr/book_club/warehouse"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 const (
@@ -77,6 +82,7 @@ func TestLoginPost(t *testing.T) {
 		},
 	}
 	jwt := "Bearer JWT"
+	refreshToken := "refreshToken"
 	for _, td := range testTable {
 		params, err := json.Marshal(td.params)
 		if err != nil {
@@ -100,6 +106,10 @@ func TestLoginPost(t *testing.T) {
 			mockWarehouse.On("GetUserWithEmail", td.params["email"]).
 				Return(user, nil)
 			mockUtil.On("CheckHashedPassword", user.Password, td.params["password"]).Return(nil)
+			mockUtil.On("PasswordNeedsRehash", user.Password).Return(false)
+			mockUtil.On("CreateRandomToken").Return(refreshToken, nil)
+			mockWarehouse.On("CreateRefreshToken", user.ID, util.HashToken(refreshToken), mock.AnythingOfType("time.Time")).
+				Return(&common.RefreshToken{}, nil)
 			mockUtil.On("CreateJSONToken", user).Return(jwt, nil)
 		} else if td.expectedHTTPStatus == http.StatusUnauthorized {
 			mockWarehouse.On("GetUserWithEmail", td.params["email"]).
@@ -135,5 +145,402 @@ func TestLoginPost(t *testing.T) {
 			continue
 		}
 		assert.Equal(t, jwt, tokenString, td.description)
+		assert.Equal(t, refreshToken, jsonResp["refreshToken"], td.description)
+	}
+}
+
+func TestLoginPostMFARequired(t *testing.T) {
+	params, err := json.Marshal(map[string]string{
+		"email":    validUserEmail,
+		"password": validUserPassword,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewReader(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, responseRecorder := setupTest(req)
+	enabledAt := time.Now()
+	user := &common.User{
+		ID:            validUserID,
+		Email:         validUserEmail,
+		Password:      validUserPassword,
+		TOTPEnabledAt: &enabledAt,
+	}
+	mockWarehouse := warehouse.MockWarehouse{}
+	mockWarehouse.On("GetUserWithEmail", validUserEmail).Return(user, nil)
+	mockUtil := util.MockUtil{}
+	mockUtil.On("CheckHashedPassword", user.Password, validUserPassword).Return(nil)
+	mockUtil.On("PasswordNeedsRehash", user.Password).Return(false)
+	mockUtil.On("CreateMFAToken", user).Return("mfaToken", nil)
+	a.warehouse = &mockWarehouse
+	a.util = &mockUtil
+
+	a.Router.ServeHTTP(responseRecorder, req)
+	mockWarehouse.AssertExpectations(t)
+	mockUtil.AssertExpectations(t)
+	// No JSON or refresh token until the TOTP code is given
+	mockUtil.AssertNotCalled(t, "CreateJSONToken", user)
+	if !assert.Equal(t, http.StatusOK, responseRecorder.Code) {
+		t.FailNow()
+	}
+	jsonResp := map[string]string{}
+	if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "mfaToken", jsonResp["mfaToken"])
+	assert.Empty(t, jsonResp["token"])
+}
+
+func TestLoginMFAPost(t *testing.T) {
+	type testData struct {
+		description        string
+		codeValid          bool
+		expectedError      error
+		expectedHTTPStatus int
+		mfaTokenRevoked    bool
+		mfaTokenValid      bool
+		params             map[string]string
+		secretUnreadable   bool
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Valid MFA token and code",
+			codeValid:          true,
+			expectedHTTPStatus: http.StatusOK,
+			mfaTokenValid:      true,
+			params:             map[string]string{"mfaToken": "mfaToken", "code": "123456"},
+		},
+		testData{
+			description:        "Secret can not be decrypted and a valid recovery code",
+			codeValid:          true,
+			expectedHTTPStatus: http.StatusOK,
+			mfaTokenValid:      true,
+			params:             map[string]string{"mfaToken": "mfaToken", "code": "ABCD-EFGH"},
+			secretUnreadable:   true,
+		},
+		testData{
+			description:        "Invalid code",
+			expectedError:      common.ErrTOTPCodeInvalid,
+			expectedHTTPStatus: http.StatusUnauthorized,
+			mfaTokenValid:      true,
+			params:             map[string]string{"mfaToken": "mfaToken", "code": "654321"},
+		},
+		testData{
+			description:        "MFA token already used or revoked",
+			expectedError:      common.ErrJSONTokenRevoked,
+			expectedHTTPStatus: http.StatusUnauthorized,
+			mfaTokenRevoked:    true,
+			params:             map[string]string{"mfaToken": "mfaToken", "code": "123456"},
+		},
+		testData{
+			description:        "Invalid MFA token",
+			expectedError:      common.ErrJSONTokenWrongPurpose,
+			expectedHTTPStatus: http.StatusUnauthorized,
+			params:             map[string]string{"mfaToken": "fullToken", "code": "123456"},
+		},
+		testData{
+			description:        "Code not present",
+			expectedError:      common.ErrTOTPCodeNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]string{"mfaToken": "mfaToken"},
+		},
+	}
+	jwt := "Bearer JWT"
+	refreshToken := "refreshToken"
+	enabledAt := time.Now()
+	user := &common.User{
+		ID:            validUserID,
+		Email:         validUserEmail,
+		TOTPSecret:    "encrypted",
+		TOTPEnabledAt: &enabledAt,
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/login/mfa", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder := setupTest(req)
+		mockWarehouse := warehouse.MockWarehouse{}
+		mockUtil := util.MockUtil{}
+		claims := &common.TokenClaims{ID: "mfaJTI", UserID: validUserID}
+		if td.params["code"] != "" {
+			if td.mfaTokenRevoked {
+				mockUtil.On("CheckMFAToken", td.params["mfaToken"]).Return(claims, nil)
+				mockWarehouse.On("IsJSONTokenRevoked", claims).Return(true, nil)
+			} else if td.mfaTokenValid {
+				mockUtil.On("CheckMFAToken", td.params["mfaToken"]).Return(claims, nil)
+				mockWarehouse.On("IsJSONTokenRevoked", claims).Return(false, nil)
+				mockWarehouse.On("GetUserWithID", validUserID).Return(user, nil)
+				if td.secretUnreadable {
+					mockUtil.On("DecryptSecret", user.TOTPSecret).Return("", errors.New("cipher: message authentication failed"))
+				} else {
+					mockUtil.On("DecryptSecret", user.TOTPSecret).Return("JBSWY3DPEHPK3PXP", nil)
+					mockUtil.On("CheckTOTPCode", "JBSWY3DPEHPK3PXP", td.params["code"]).Return(int64(100), td.codeValid)
+				}
+			} else {
+				mockUtil.On("CheckMFAToken", td.params["mfaToken"]).Return(nil, common.ErrJSONTokenWrongPurpose)
+			}
+		}
+		if td.codeValid && td.secretUnreadable {
+			mockWarehouse.On("UseRecoveryCode", validUserID, util.HashToken("abcdefgh")).Return(nil)
+		} else if td.codeValid {
+			mockWarehouse.On("UseTOTPStep", validUserID, int64(100)).Return(nil)
+		}
+		if td.codeValid {
+			mockWarehouse.On("RevokeJSONToken", "mfaJTI", claims.ExpiresAt).Return(nil)
+			mockUtil.On("CreateRandomToken").Return(refreshToken, nil)
+			mockWarehouse.On("CreateRefreshToken", user.ID, util.HashToken(refreshToken), mock.AnythingOfType("time.Time")).
+				Return(&common.RefreshToken{}, nil)
+			mockUtil.On("CreateJSONToken", user).Return(jwt, nil)
+		} else if td.mfaTokenValid {
+			mockWarehouse.On("UseRecoveryCode", validUserID, util.HashToken(td.params["code"])).Return(common.ErrTOTPCodeInvalid)
+		}
+		a.warehouse = &mockWarehouse
+		a.util = &mockUtil
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		mockUtil.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		jsonResp := map[string]string{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		if td.expectedHTTPStatus != http.StatusOK {
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+			continue
+		}
+		assert.Equal(t, jwt, jsonResp["token"], td.description)
+		assert.Equal(t, refreshToken, jsonResp["refreshToken"], td.description)
+	}
+}
+
+func TestLoginMFAPostLockout(t *testing.T) {
+	params, err := json.Marshal(map[string]string{"mfaToken": "mfaToken", "code": "654321"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "/login/mfa", bytes.NewReader(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := setupTest(req)
+	enabledAt := time.Now()
+	user := &common.User{ID: validUserID, TOTPSecret: "encrypted", TOTPEnabledAt: &enabledAt}
+	claims := &common.TokenClaims{ID: "mfaJTI", UserID: validUserID, ExpiresAt: enabledAt.Add(5 * time.Minute)}
+	mockUtil := util.MockUtil{}
+	mockUtil.On("CheckMFAToken", "mfaToken").Return(claims, nil)
+	mockUtil.On("DecryptSecret", user.TOTPSecret).Return("JBSWY3DPEHPK3PXP", nil)
+	mockUtil.On("CheckTOTPCode", "JBSWY3DPEHPK3PXP", "654321").Return(int64(0), false)
+	mockWarehouse := warehouse.MockWarehouse{}
+	mockWarehouse.On("IsJSONTokenRevoked", claims).Return(false, nil)
+	mockWarehouse.On("GetUserWithID", validUserID).Return(user, nil)
+	mockWarehouse.On("UseRecoveryCode", validUserID, util.HashToken("654321")).Return(common.ErrTOTPCodeInvalid)
+	// The token is revoked once, when the failure that locks the user out is recorded
+	mockWarehouse.On("RevokeJSONToken", "mfaJTI", claims.ExpiresAt).Return(nil).Once()
+	a.util = &mockUtil
+	a.warehouse = &mockWarehouse
+	// The memory tracker from the test config locks the user out after email_threshold wrong codes
+	for i := 1; i <= a.conf.Lockout.EmailThreshold+1; i++ {
+		req, err := http.NewRequest(http.MethodPost, "/login/mfa", bytes.NewReader(params))
+		if err != nil {
+			t.Fatal(err)
+		}
+		responseRecorder := httptest.NewRecorder()
+		a.Router.ServeHTTP(responseRecorder, req)
+		if i <= a.conf.Lockout.EmailThreshold {
+			assert.Equal(t, http.StatusUnauthorized, responseRecorder.Code, "attempt %d", i)
+			continue
+		}
+		assert.Equal(t, http.StatusTooManyRequests, responseRecorder.Code, "attempt %d", i)
+		assert.Equal(t, "60", responseRecorder.Header().Get("Retry-After"))
+	}
+	mockWarehouse.AssertExpectations(t)
+}
+
+func TestLoginPostLockout(t *testing.T) {
+	type testData struct {
+		description        string
+		emailLockout       time.Duration
+		ipLockout          time.Duration
+		expectedHTTPStatus int
+		expectedRetryAfter string
+		remoteAddr         string
+		forwardedFor       string
+		trustForwardedFor  bool
+		expectedIPKey      string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Email locked out",
+			emailLockout:       90*time.Second + time.Millisecond,
+			expectedHTTPStatus: http.StatusTooManyRequests,
+			expectedRetryAfter: "91",
+			remoteAddr:         "10.0.0.1:1234",
+			expectedIPKey:      "ip:10.0.0.1",
+		},
+		testData{
+			description:        "IP locked out",
+			ipLockout:          time.Hour,
+			expectedHTTPStatus: http.StatusTooManyRequests,
+			expectedRetryAfter: "3600",
+			remoteAddr:         "10.0.0.1:1234",
+			expectedIPKey:      "ip:10.0.0.1",
+		},
+		testData{
+			description:        "Forwarded for is ignored unless trusted",
+			ipLockout:          time.Hour,
+			expectedHTTPStatus: http.StatusTooManyRequests,
+			expectedRetryAfter: "3600",
+			remoteAddr:         "10.0.0.1:1234",
+			forwardedFor:       "1.1.1.1",
+			expectedIPKey:      "ip:10.0.0.1",
+		},
+		testData{
+			description:        "Last forwarded for address is used when trusted",
+			ipLockout:          time.Minute,
+			expectedHTTPStatus: http.StatusTooManyRequests,
+			expectedRetryAfter: "60",
+			remoteAddr:         "10.0.0.1:1234",
+			forwardedFor:       "1.1.1.1, 2.2.2.2",
+			trustForwardedFor:  true,
+			expectedIPKey:      "ip:2.2.2.2",
+		},
+		testData{
+			description:        "Wrong password is counted against the email and IP",
+			expectedHTTPStatus: http.StatusUnauthorized,
+			remoteAddr:         "10.0.0.1:1234",
+			expectedIPKey:      "ip:10.0.0.1",
+		},
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(map[string]string{"email": "GCarr@example.com", "password": "wrong"})
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		req.RemoteAddr = td.remoteAddr
+		if td.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", td.forwardedFor)
+		}
+		a, responseRecorder := setupTest(req)
+		a.conf.Lockout.TrustForwardedFor = td.trustForwardedFor
+		emailLockout := lockout.MockTracker{}
+		emailLockout.On("Check", "email:gcarr@example.com").Return(td.emailLockout, nil)
+		ipLockout := lockout.MockTracker{}
+		ipLockout.On("Check", td.expectedIPKey).Return(td.ipLockout, nil)
+		mockWarehouse := warehouse.MockWarehouse{}
+		if td.expectedHTTPStatus == http.StatusUnauthorized {
+			mockWarehouse.On("GetUserWithEmail", "GCarr@example.com").Return(nil, common.ErrLoginUserNotFound)
+			emailLockout.On("Fail", "email:gcarr@example.com").Return(time.Duration(0), nil)
+			ipLockout.On("Fail", td.expectedIPKey).Return(time.Minute, nil)
+		}
+		a.emailLockout = &emailLockout
+		a.ipLockout = &ipLockout
+		a.warehouse = &mockWarehouse
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		emailLockout.AssertExpectations(t)
+		ipLockout.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+		assert.Equal(t, td.expectedRetryAfter, responseRecorder.Header().Get("Retry-After"), td.description)
+	}
+}
+
+func TestLoginPostLockoutThreshold(t *testing.T) {
+	params, err := json.Marshal(map[string]string{"email": validUserEmail, "password": "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewReader(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := setupTest(req)
+	mockWarehouse := warehouse.MockWarehouse{}
+	mockWarehouse.On("GetUserWithEmail", validUserEmail).Return(nil, common.ErrLoginUserNotFound)
+	a.warehouse = &mockWarehouse
+	// The memory tracker from the test config locks the email out after email_threshold failures
+	for i := 1; i <= a.conf.Lockout.EmailThreshold+1; i++ {
+		req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewReader(params))
+		if err != nil {
+			t.Fatal(err)
+		}
+		responseRecorder := httptest.NewRecorder()
+		a.Router.ServeHTTP(responseRecorder, req)
+		if i <= a.conf.Lockout.EmailThreshold {
+			assert.Equal(t, http.StatusUnauthorized, responseRecorder.Code, "attempt %d", i)
+			continue
+		}
+		assert.Equal(t, http.StatusTooManyRequests, responseRecorder.Code, "attempt %d", i)
+		assert.Equal(t, "60", responseRecorder.Header().Get("Retry-After"))
+	}
+}
+
+func TestLoginPostRehash(t *testing.T) {
+	type testData struct {
+		description      string
+		expectedPassword string
+		updateErr        error
+	}
+
+	testTable := []testData{
+		testData{
+			description:      "Outdated hash is replaced",
+			expectedPassword: "newHash",
+		},
+		testData{
+			description:      "Login carries on if the new hash can not be stored",
+			expectedPassword: "oldHash",
+			updateErr:        errors.New("DB down"),
+		},
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(map[string]string{"email": validUserEmail, "password": validUserPassword})
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder := setupTest(req)
+		user := &common.User{ID: validUserID, Email: validUserEmail, Password: "oldHash"}
+		mockWarehouse := warehouse.MockWarehouse{}
+		mockWarehouse.On("GetUserWithEmail", validUserEmail).Return(user, nil)
+		mockWarehouse.On("UpdatePassword", validUserID, "newHash").Return(td.updateErr)
+		mockWarehouse.On("CreateRefreshToken", validUserID, util.HashToken("refreshToken"), mock.AnythingOfType("time.Time")).
+			Return(&common.RefreshToken{}, nil)
+		mockUtil := util.MockUtil{}
+		mockUtil.On("CheckHashedPassword", "oldHash", validUserPassword).Return(nil)
+		mockUtil.On("PasswordNeedsRehash", "oldHash").Return(true)
+		mockUtil.On("CreateHashedPassword", validUserPassword).Return("newHash", nil)
+		mockUtil.On("CreateRandomToken").Return("refreshToken", nil)
+		mockUtil.On("CreateJSONToken", user).Return("JWT", nil)
+		a.warehouse = &mockWarehouse
+		a.util = &mockUtil
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		mockUtil.AssertExpectations(t)
+		assert.Equal(t, http.StatusOK, responseRecorder.Code, td.description)
+		assert.Equal(t, td.expectedPassword, user.Password, td.description)
 	}
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/util"
+)
+
+const revokedTokenSweepInterval = time.Duration(10 * time.Minute)
+
+// logoutPost revokes the JSON token used for the request, and the refresh token if one is given
+func (a *app) logoutPost(w http.ResponseWriter, r *http.Request) {
+	lr := common.LogoutRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&lr); err != nil && err != io.EOF {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	if err := a.warehouse.RevokeJSONToken(claims.ID, claims.ExpiresAt); err != nil {
+		a.logrus.WithError(err).Error("Unable to revoke JSON token")
+		a.respondWithError(w, http.StatusInternalServerError, "Error logging out")
+		return
+	}
+	if lr.RefreshToken != "" {
+		if err := a.revokeRefreshToken(claims.UserID, lr.RefreshToken); err != nil {
+			a.logrus.WithError(err).Error("Unable to revoke refresh token")
+			a.respondWithError(w, http.StatusInternalServerError, "Error logging out")
+			return
+		}
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Logged out"})
+}
+
+// logoutOptions returns the allowed options
+func (a *app) logoutOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// revokeRefreshToken revokes the family of the refresh token, as long as it belongs to the user
+func (a *app) revokeRefreshToken(userID, refreshToken string) error {
+	rt, err := a.warehouse.GetRefreshToken(util.HashToken(refreshToken))
+	if err != nil {
+		if err == common.ErrRefreshTokenNotFound {
+			return nil
+		}
+		return err
+	}
+	if rt.UserID != userID {
+		return nil
+	}
+	return a.warehouse.RevokeRefreshTokenFamily(rt.FamilyID)
+}
+
+// sweepRevokedTokens periodically removes revocations of tokens that have since expired
+func (a *app) sweepRevokedTokens(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		deleted, err := a.warehouse.DeleteExpiredRevokedTokens()
+		if err != nil {
+			a.logrus.WithError(err).Error("Unable to sweep revoked tokens")
+			continue
+		}
+		a.logrus.WithField("deleted", deleted).Debug("Swept expired revoked tokens")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/util"
+	"github.com/garycarr/book_club/warehouse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLogoutPostJWTTests(t *testing.T) {
+	for _, td := range authJWTTestTable(t) {
+		if td.validJWT && !td.revoked {
+			// A valid token would be revoked, that is covered below
+			continue
+		}
+		req, err := http.NewRequest(http.MethodPost, "/logout", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		req.Header.Add("Authorization", td.jwToken)
+		a, responseRecorder := setupTest(req)
+		mockWarehouse := warehouse.MockWarehouse{}
+		mockWarehouse.On("IsJSONTokenRevoked", mock.AnythingOfType("*common.TokenClaims")).Return(td.revoked, nil)
+		a.warehouse = &mockWarehouse
+		a.Router.ServeHTTP(responseRecorder, req)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
+
+func TestLogoutPost(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedHTTPStatus int
+		params             map[string]string
+		refreshToken       *common.RefreshToken
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Logout without a refresh token",
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description:        "Logout with a refresh token",
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]string{"refreshToken": "refreshToken"},
+			refreshToken: &common.RefreshToken{
+				UserID:   validUserID,
+				FamilyID: "familyID",
+			},
+		},
+		testData{
+			description:        "Logout with a refresh token belonging to someone else",
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]string{"refreshToken": "refreshToken"},
+			refreshToken: &common.RefreshToken{
+				UserID:   "someoneElse",
+				FamilyID: "familyID",
+			},
+		},
+	}
+	validJWT := "JWT"
+	claims := &common.TokenClaims{
+		ID:        "jti",
+		UserID:    validUserID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	for _, td := range testTable {
+		var body []byte
+		if td.params != nil {
+			var err error
+			if body, err = json.Marshal(td.params); err != nil {
+				t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+			}
+		}
+		req, err := http.NewRequest(http.MethodPost, "/logout", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		req.Header.Add("Authorization", validJWT)
+		a, responseRecorder := setupTest(req)
+		mockUtil := util.MockUtil{}
+		mockUtil.On("CheckJSONToken", validJWT).Return(claims, nil)
+		mockWarehouse := warehouse.MockWarehouse{}
+		mockWarehouse.On("IsJSONTokenRevoked", claims).Return(false, nil)
+		mockWarehouse.On("RevokeJSONToken", claims.ID, claims.ExpiresAt).Return(nil)
+		if td.refreshToken != nil {
+			mockWarehouse.On("GetRefreshToken", util.HashToken(td.params["refreshToken"])).Return(td.refreshToken, nil)
+			if td.refreshToken.UserID == claims.UserID {
+				mockWarehouse.On("RevokeRefreshTokenFamily", td.refreshToken.FamilyID).Return(nil)
+			}
+		}
+		a.util = &mockUtil
+		a.warehouse = &mockWarehouse
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		if td.refreshToken != nil && td.refreshToken.UserID != claims.UserID {
+			mockWarehouse.AssertNotCalled(t, "RevokeRefreshTokenFamily", td.refreshToken.FamilyID)
+		}
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
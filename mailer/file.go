@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+)
+
+// FileMailer drops every email into a directory as an .eml file, for local development
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer creates the directory if it does not already exist
+func NewFileMailer(from, dir string) (*FileMailer, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("A directory is needed for the file mailer")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileMailer{
+		dir:  dir,
+		from: from,
+	}, nil
+}
+
+// Send ...
+func (fm *FileMailer) Send(email common.Email) error {
+	now := time.Now()
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s\r\n",
+		fm.from, email.To, email.Subject, now.Format(time.RFC1123Z), email.Body)
+	// The recipient is only in the name to make the files easier to find
+	name := fmt.Sprintf("%d-%s.eml", now.UnixNano(), strings.Map(func(r rune) rune {
+		if r == '/' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, email.To))
+	return ioutil.WriteFile(filepath.Join(fm.dir, name), []byte(message), 0600)
+}
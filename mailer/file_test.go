@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileMailerSend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mailer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fm, err := NewFileMailer("club@example.com", filepath.Join(dir, "outbox"))
+	if !assert.Nil(t, err) {
+		t.Fatal(err)
+	}
+	email := common.Email{
+		To:      "gcarr@example.com",
+		Subject: "Hello",
+		Body:    "Welcome to the club",
+	}
+	if !assert.Nil(t, fm.Send(email)) {
+		t.FailNow()
+	}
+	files, err := ioutil.ReadDir(filepath.Join(dir, "outbox"))
+	if !assert.Nil(t, err) || !assert.Len(t, files, 1) {
+		t.FailNow()
+	}
+	message, err := ioutil.ReadFile(filepath.Join(dir, "outbox", files[0].Name()))
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.Contains(t, string(message), "From: club@example.com")
+	assert.Contains(t, string(message), "To: gcarr@example.com")
+	assert.Contains(t, string(message), "Subject: Hello")
+	assert.Contains(t, string(message), "Welcome to the club")
+}
+
+func TestNewFileMailerNoDirectory(t *testing.T) {
+	_, err := NewFileMailer("club@example.com", "")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,8 @@
+package mailer
+
+import "github.com/garycarr/book_club/common"
+
+// MailerIn sends emails to users
+type MailerIn interface {
+	Send(common.Email) error
+}
@@ -0,0 +1,31 @@
+package mailer
+
+import (
+	"github.com/garycarr/book_club/common"
+	"github.com/sirupsen/logrus"
+)
+
+// LogMailer writes emails to the log instead of sending them, for local development
+type LogMailer struct {
+	from   string
+	logrus *logrus.Logger
+}
+
+// NewLogMailer ...
+func NewLogMailer(from string, logger *logrus.Logger) *LogMailer {
+	return &LogMailer{
+		from:   from,
+		logrus: logger,
+	}
+}
+
+// Send ...
+func (lm *LogMailer) Send(email common.Email) error {
+	lm.logrus.WithFields(logrus.Fields{
+		"from":    lm.from,
+		"to":      email.To,
+		"subject": email.Subject,
+		"body":    email.Body,
+	}).Info("Sending email")
+	return nil
+}
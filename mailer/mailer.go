@@ -0,0 +1,25 @@
+package mailer
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// TypeLog only writes emails to the log
+	TypeLog = "log"
+	// TypeFile drops every email into a directory
+	TypeFile = "file"
+)
+
+// NewMailer returns the mailer for the configured type, defaulting to the log mailer
+func NewMailer(mailerType, from, dir string, logger *logrus.Logger) (MailerIn, error) {
+	switch mailerType {
+	case TypeLog, "":
+		return NewLogMailer(from, logger), nil
+	case TypeFile:
+		return NewFileMailer(from, dir)
+	}
+	return nil, fmt.Errorf("Unknown mailer type %q", mailerType)
+}
@@ -0,0 +1,17 @@
+package mailer
+
+import (
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockMailer implements the Mailer interface for the purpose of testing
+type MockMailer struct {
+	mock.Mock
+}
+
+// Send is used to assert the method is called
+func (mm *MockMailer) Send(email common.Email) error {
+	args := mm.Called(email)
+	return args.Error(0)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/gorilla/mux"
+)
+
+// clubMeetingsPost schedules a meeting of a club
+func (a *app) clubMeetingsPost(w http.ResponseWriter, r *http.Request) {
+	mr := common.MeetingRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&mr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := mr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	loc, ok := a.requestLocation(w, r)
+	if !ok {
+		return
+	}
+	meeting := &common.Meeting{ClubID: mux.Vars(r)["clubID"], CreatedBy: claims.UserID}
+	if err := mr.Apply(meeting); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	if !a.checkMeetingBook(w, meeting.BookID) {
+		return
+	}
+	if err := a.warehouse.CreateMeeting(meeting); err != nil {
+		if err == common.ErrBookNotFound {
+			a.respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to create meeting")
+		a.respondWithError(w, http.StatusInternalServerError, "Error creating the meeting")
+		return
+	}
+	meeting.In(loc)
+	a.respondWithJSON(w, http.StatusCreated, meeting)
+}
+
+// clubMeetingsGet lists the upcoming meetings of a club a page at a time, or the past meetings with
+// ?past=true
+func (a *app) clubMeetingsGet(w http.ResponseWriter, r *http.Request) {
+	pagination, ok := a.requestPagination(w, r)
+	if !ok {
+		return
+	}
+	loc, ok := a.requestLocation(w, r)
+	if !ok {
+		return
+	}
+	past := r.URL.Query().Get("past") == "true"
+	meetings, total, err := a.warehouse.ListMeetings(mux.Vars(r)["clubID"], past, pagination)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to list meetings")
+		a.respondWithError(w, http.StatusInternalServerError, "Error listing the meetings")
+		return
+	}
+	for i := range meetings {
+		meetings[i].In(loc)
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"meetings": meetings,
+		"total":    total,
+		"limit":    pagination.Limit,
+		"offset":   pagination.Offset,
+	})
+}
+
+// clubMeetingsOptions returns the allowed options
+func (a *app) clubMeetingsOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubMeetingGet returns a meeting of a club
+func (a *app) clubMeetingGet(w http.ResponseWriter, r *http.Request) {
+	meeting, ok := a.requestMeeting(w, r)
+	if !ok {
+		return
+	}
+	loc, ok := a.requestLocation(w, r)
+	if !ok {
+		return
+	}
+	meeting.In(loc)
+	a.respondWithJSON(w, http.StatusOK, meeting)
+}
+
+// clubMeetingPatch changes a meeting of a club. Raising the capacity moves people up from the waitlist
+func (a *app) clubMeetingPatch(w http.ResponseWriter, r *http.Request) {
+	mur := common.MeetingUpdateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&mur); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := mur.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	meeting, ok := a.requestMeeting(w, r)
+	if !ok {
+		return
+	}
+	loc, ok := a.requestLocation(w, r)
+	if !ok {
+		return
+	}
+	bookID := meeting.BookID
+	if err := mur.Apply(meeting); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	if meeting.BookID != bookID && !a.checkMeetingBook(w, meeting.BookID) {
+		return
+	}
+	if err := a.warehouse.UpdateMeeting(meeting); err != nil {
+		switch err {
+		case common.ErrMeetingNotFound:
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+		case common.ErrBookNotFound:
+			a.respondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			a.logrus.WithError(err).Error("Unable to update meeting")
+			a.respondWithError(w, http.StatusInternalServerError, "Error updating the meeting")
+		}
+		return
+	}
+	meeting.In(loc)
+	a.respondWithJSON(w, http.StatusOK, meeting)
+}
+
+// clubMeetingDelete cancels a meeting of a club
+func (a *app) clubMeetingDelete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := a.warehouse.DeleteMeeting(vars["clubID"], vars["meetingID"]); err != nil {
+		if err == common.ErrMeetingNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to delete meeting")
+		a.respondWithError(w, http.StatusInternalServerError, "Error deleting the meeting")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Meeting deleted"})
+}
+
+// clubMeetingOptions returns the allowed options
+func (a *app) clubMeetingOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubMeetingRSVPsGet lists the responses to a meeting, confirmed places first then the waitlist
+func (a *app) clubMeetingRSVPsGet(w http.ResponseWriter, r *http.Request) {
+	meeting, ok := a.requestMeeting(w, r)
+	if !ok {
+		return
+	}
+	loc, ok := a.requestLocation(w, r)
+	if !ok {
+		return
+	}
+	rsvps, err := a.warehouse.ListRSVPs(meeting.ID)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to list RSVPs")
+		a.respondWithError(w, http.StatusInternalServerError, "Error listing the RSVPs")
+		return
+	}
+	for i := range rsvps {
+		rsvps[i].UpdatedAt = rsvps[i].UpdatedAt.In(loc)
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]interface{}{"rsvps": rsvps})
+}
+
+// clubMeetingRSVPPut answers a meeting for the current user. A yes that does not fit is waitlisted
+// and moved up when a place frees up
+func (a *app) clubMeetingRSVPPut(w http.ResponseWriter, r *http.Request) {
+	rr := common.RSVPRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&rr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := rr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	meeting, ok := a.requestMeeting(w, r)
+	if !ok {
+		return
+	}
+	loc, ok := a.requestLocation(w, r)
+	if !ok {
+		return
+	}
+	if meeting.EndsAt.Before(time.Now()) {
+		a.respondWithError(w, http.StatusConflict, common.ErrMeetingEnded.Error())
+		return
+	}
+	rsvp, err := a.warehouse.SetRSVP(meeting.ID, claims.UserID, rr.Response, rr.Guests)
+	if err != nil {
+		switch err {
+		case common.ErrMeetingNotFound:
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+		case common.ErrRSVPNoRoomForGuests:
+			a.respondWithError(w, http.StatusConflict, err.Error())
+		default:
+			a.logrus.WithError(err).Error("Unable to save RSVP")
+			a.respondWithError(w, http.StatusInternalServerError, "Error saving the RSVP")
+		}
+		return
+	}
+	rsvp.UpdatedAt = rsvp.UpdatedAt.In(loc)
+	a.respondWithJSON(w, http.StatusOK, rsvp)
+}
+
+// clubMeetingRSVPDelete withdraws the response of the current user to a meeting, a confirmed place
+// goes to the waitlist
+func (a *app) clubMeetingRSVPDelete(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	meeting, ok := a.requestMeeting(w, r)
+	if !ok {
+		return
+	}
+	if err := a.warehouse.DeleteRSVP(meeting.ID, claims.UserID); err != nil {
+		switch err {
+		case common.ErrMeetingNotFound, common.ErrRSVPNotFound:
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+		default:
+			a.logrus.WithError(err).Error("Unable to delete RSVP")
+			a.respondWithError(w, http.StatusInternalServerError, "Error deleting the RSVP")
+		}
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "RSVP withdrawn"})
+}
+
+// clubMeetingRSVPOptions returns the allowed options
+func (a *app) clubMeetingRSVPOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// requestMeeting loads the meeting in the meetingID route variable of the club in the clubID route
+// variable. If it returns false the error response has already been written
+func (a *app) requestMeeting(w http.ResponseWriter, r *http.Request) (*common.Meeting, bool) {
+	vars := mux.Vars(r)
+	meeting, err := a.warehouse.GetMeeting(vars["clubID"], vars["meetingID"])
+	if err != nil {
+		if err == common.ErrMeetingNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return nil, false
+		}
+		a.logrus.WithError(err).Error("Unable to get meeting")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the meeting")
+		return nil, false
+	}
+	return meeting, true
+}
+
+// requestLocation returns the time zone to show times in, the tz query parameter or else the time
+// zone of the current user. If it returns false the error response has already been written
+func (a *app) requestLocation(w http.ResponseWriter, r *http.Request) (*time.Location, bool) {
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		if !common.ValidTimeZone(tz) {
+			a.respondWithError(w, http.StatusBadRequest, common.ErrTimeZoneInvalid.Error())
+			return nil, false
+		}
+		loc, _ := time.LoadLocation(tz)
+		return loc, true
+	}
+	user, ok := a.requestUser(w, r)
+	if !ok {
+		return nil, false
+	}
+	return user.Location(), true
+}
+
+// checkMeetingBook checks the book a meeting is about is in the catalog, a meeting does not have to
+// be about a book. If it returns false the error response has already been written
+func (a *app) checkMeetingBook(w http.ResponseWriter, bookID string) bool {
+	if bookID == "" {
+		return true
+	}
+	_, ok := a.lookupBook(w, bookID)
+	return ok
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// validMeeting is a meeting of clubID from 19:00 to 21:00 London time on 5 November 2030
+func validMeeting() *common.Meeting {
+	return &common.Meeting{
+		ID:        "meetingID",
+		ClubID:    "clubID",
+		Title:     "Dune, part one",
+		StartsAt:  time.Date(2030, 11, 5, 19, 0, 0, 0, time.UTC),
+		EndsAt:    time.Date(2030, 11, 5, 21, 0, 0, 0, time.UTC),
+		TimeZone:  "Europe/London",
+		Location:  "The Crown, upstairs",
+		Capacity:  8,
+		CreatedBy: validUserID,
+	}
+}
+
+func TestClubMeetingsPost(t *testing.T) {
+	type testData struct {
+		description        string
+		bookFound          bool
+		expectedError      error
+		expectedHTTPStatus int
+		expectedStartsAt   time.Time
+		params             map[string]interface{}
+		role               string
+		url                string
+		userTimeZone       string
+	}
+
+	params := func(changes map[string]interface{}) map[string]interface{} {
+		p := map[string]interface{}{
+			"title":    "Dune, part one",
+			"startsAt": "2030-07-05T19:00",
+			"endsAt":   "2030-07-05T21:00",
+			"timeZone": "Europe/London",
+			"location": "The Crown, upstairs",
+		}
+		for k, v := range changes {
+			p[k] = v
+		}
+		return p
+	}
+	testTable := []testData{
+		testData{
+			description:        "Local times are read in the time zone of the meeting and shown in the time zone of the user",
+			expectedHTTPStatus: http.StatusCreated,
+			expectedStartsAt:   time.Date(2030, 7, 5, 18, 0, 0, 0, time.UTC),
+			params:             params(nil),
+			role:               common.ClubRoleModerator,
+			url:                "/clubs/clubID/meetings",
+			userTimeZone:       "America/New_York",
+		},
+		testData{
+			description:        "RFC 3339 times keep their offset and the tz parameter picks the time zone shown",
+			expectedHTTPStatus: http.StatusCreated,
+			expectedStartsAt:   time.Date(2030, 7, 5, 18, 0, 0, 0, time.UTC),
+			params:             params(map[string]interface{}{"startsAt": "2030-07-05T20:00:00+02:00", "videoURL": "https://meet.example.com/dune"}),
+			role:               common.ClubRoleOwner,
+			url:                "/clubs/clubID/meetings?tz=UTC",
+		},
+		testData{
+			description:        "About a book in the catalog",
+			bookFound:          true,
+			expectedHTTPStatus: http.StatusCreated,
+			expectedStartsAt:   time.Date(2030, 7, 5, 18, 0, 0, 0, time.UTC),
+			params:             params(map[string]interface{}{"bookID": "bookID"}),
+			role:               common.ClubRoleOwner,
+			url:                "/clubs/clubID/meetings?tz=UTC",
+		},
+		testData{
+			description:        "Book not in the catalog",
+			expectedError:      common.ErrBookNotFound,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             params(map[string]interface{}{"bookID": "missingBookID"}),
+			role:               common.ClubRoleOwner,
+			url:                "/clubs/clubID/meetings?tz=UTC",
+		},
+		testData{
+			description:        "Ends before it starts",
+			expectedError:      common.ErrMeetingEndsBeforeStart,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             params(map[string]interface{}{"endsAt": "2030-07-05T18:00"}),
+			role:               common.ClubRoleOwner,
+			url:                "/clubs/clubID/meetings?tz=UTC",
+		},
+		testData{
+			description:        "Nowhere to meet",
+			expectedError:      common.ErrMeetingPlaceNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             params(map[string]interface{}{"location": " "}),
+			role:               common.ClubRoleOwner,
+			url:                "/clubs/clubID/meetings?tz=UTC",
+		},
+		testData{
+			description:        "Time zone of the meeting invalid",
+			expectedError:      common.ErrTimeZoneInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             params(map[string]interface{}{"timeZone": "Mars/Olympus_Mons"}),
+			role:               common.ClubRoleOwner,
+			url:                "/clubs/clubID/meetings?tz=UTC",
+		},
+		testData{
+			description:        "Time invalid",
+			expectedError:      common.ErrMeetingTimeInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             params(map[string]interface{}{"startsAt": "next Tuesday"}),
+			role:               common.ClubRoleOwner,
+			url:                "/clubs/clubID/meetings?tz=UTC",
+		},
+		testData{
+			description:        "Shown time zone invalid",
+			expectedError:      common.ErrTimeZoneInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             params(nil),
+			role:               common.ClubRoleOwner,
+			url:                "/clubs/clubID/meetings?tz=Local",
+		},
+		testData{
+			description:        "Members can not schedule meetings",
+			expectedHTTPStatus: http.StatusForbidden,
+			params:             params(nil),
+			role:               common.ClubRoleMember,
+			url:                "/clubs/clubID/meetings?tz=UTC",
+		},
+	}
+	for _, td := range testTable {
+		body, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, td.url, bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(td.role))
+		if td.userTimeZone != "" {
+			mockWarehouse.On("GetUserWithID", validUserID).Return(&common.User{ID: validUserID, TimeZone: td.userTimeZone}, nil)
+		}
+		if bookID, ok := td.params["bookID"].(string); ok {
+			if td.bookFound {
+				mockWarehouse.On("GetBook", bookID).Return(&common.Book{ID: bookID}, nil)
+			} else {
+				mockWarehouse.On("GetBook", bookID).Return(nil, common.ErrBookNotFound)
+			}
+		}
+		if td.expectedHTTPStatus == http.StatusCreated {
+			mockWarehouse.On("CreateMeeting", mock.MatchedBy(func(m *common.Meeting) bool {
+				return m.ClubID == "clubID" && m.CreatedBy == validUserID && m.StartsAt.Equal(td.expectedStartsAt) &&
+					m.StartsAt.Location() == time.UTC
+			})).Return(nil).Run(func(args mock.Arguments) {
+				args.Get(0).(*common.Meeting).ID = "meetingID"
+			})
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedHTTPStatus != http.StatusCreated {
+			if td.expectedError != nil {
+				jsonResp := map[string]string{}
+				if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+					t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+					continue
+				}
+				assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+			}
+			continue
+		}
+		jsonResp := map[string]interface{}{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		shownIn := time.UTC
+		if td.userTimeZone != "" {
+			shownIn, _ = time.LoadLocation(td.userTimeZone)
+		}
+		assert.Equal(t, "meetingID", jsonResp["id"], td.description)
+		assert.Equal(t, td.expectedStartsAt.In(shownIn).Format(time.RFC3339), jsonResp["startsAt"], td.description)
+	}
+}
+
+func TestClubMeetingGet(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedHTTPStatus int
+		expectedStartsAt   string
+		getError           error
+		role               string
+		url                string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Shown in the time zone asked for",
+			expectedHTTPStatus: http.StatusOK,
+			expectedStartsAt:   "2030-11-06T04:00:00+09:00",
+			role:               common.ClubRoleMember,
+			url:                "/clubs/clubID/meetings/meetingID?tz=Asia/Tokyo",
+		},
+		testData{
+			description:        "Meeting of another club",
+			expectedHTTPStatus: http.StatusNotFound,
+			getError:           common.ErrMeetingNotFound,
+			role:               common.ClubRoleMember,
+			url:                "/clubs/clubID/meetings/meetingID?tz=UTC",
+		},
+		testData{
+			description:        "Not a member",
+			expectedHTTPStatus: http.StatusForbidden,
+			url:                "/clubs/clubID/meetings/meetingID?tz=UTC",
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodGet, td.url, nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		claims := clubClaims(td.role)
+		if td.role == "" {
+			claims.ClubRoles = map[string]string{}
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, claims)
+		if td.role != "" {
+			if td.getError != nil {
+				mockWarehouse.On("GetMeeting", "clubID", "meetingID").Return(nil, td.getError)
+			} else {
+				mockWarehouse.On("GetMeeting", "clubID", "meetingID").Return(validMeeting(), nil)
+			}
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedHTTPStatus != http.StatusOK {
+			continue
+		}
+		jsonResp := map[string]interface{}{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		assert.Equal(t, td.expectedStartsAt, jsonResp["startsAt"], td.description)
+		assert.Equal(t, "Europe/London", jsonResp["timeZone"], td.description)
+	}
+}
+
+func TestClubMeetingPatch(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPatch, "/clubs/clubID/meetings/meetingID?tz=UTC",
+		bytes.NewReader([]byte(`{"timeZone": "America/New_York", "capacity": 12}`)))
+	if err != nil {
+		t.Fatalf("Error creating new request: %v", err)
+	}
+	a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(common.ClubRoleModerator))
+	mockWarehouse.On("GetMeeting", "clubID", "meetingID").Return(validMeeting(), nil)
+	// Changing only the time zone keeps the meeting at the same instant
+	mockWarehouse.On("UpdateMeeting", mock.MatchedBy(func(m *common.Meeting) bool {
+		return m.TimeZone == "America/New_York" && m.Capacity == 12 && m.StartsAt.Equal(validMeeting().StartsAt)
+	})).Return(nil)
+
+	a.Router.ServeHTTP(responseRecorder, req)
+	mockWarehouse.AssertExpectations(t)
+	assert.Equal(t, http.StatusOK, responseRecorder.Code)
+}
+
+func TestClubMeetingRSVPPut(t *testing.T) {
+	type testData struct {
+		description        string
+		ended              bool
+		expectedError      error
+		expectedHTTPStatus int
+		params             map[string]interface{}
+		setError           error
+		waitlisted         bool
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Yes with a guest",
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]interface{}{"response": common.RSVPYes, "guests": 1},
+		},
+		testData{
+			description:        "Yes when the meeting is full is waitlisted",
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]interface{}{"response": common.RSVPYes},
+			waitlisted:         true,
+		},
+		testData{
+			description:        "No drops the guests",
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]interface{}{"response": common.RSVPNo, "guests": 3},
+		},
+		testData{
+			description:        "No room for more guests",
+			expectedError:      common.ErrRSVPNoRoomForGuests,
+			expectedHTTPStatus: http.StatusConflict,
+			params:             map[string]interface{}{"response": common.RSVPYes, "guests": 4},
+			setError:           common.ErrRSVPNoRoomForGuests,
+		},
+		testData{
+			description:        "Meeting has ended",
+			ended:              true,
+			expectedError:      common.ErrMeetingEnded,
+			expectedHTTPStatus: http.StatusConflict,
+			params:             map[string]interface{}{"response": common.RSVPYes},
+		},
+		testData{
+			description:        "Response invalid",
+			expectedError:      common.ErrRSVPResponseInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"response": "perhaps"},
+		},
+		testData{
+			description:        "Too many guests",
+			expectedError:      common.ErrRSVPGuestsInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"response": common.RSVPYes, "guests": common.MaxMeetingGuests + 1},
+		},
+	}
+	for _, td := range testTable {
+		body, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPut, "/clubs/clubID/meetings/meetingID/rsvp?tz=UTC", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(common.ClubRoleMember))
+		if td.expectedHTTPStatus != http.StatusBadRequest {
+			meeting := validMeeting()
+			if td.ended {
+				meeting.StartsAt = time.Now().Add(-3 * time.Hour)
+				meeting.EndsAt = time.Now().Add(-time.Hour)
+			}
+			mockWarehouse.On("GetMeeting", "clubID", "meetingID").Return(meeting, nil)
+		}
+		if !td.ended && td.expectedHTTPStatus != http.StatusBadRequest {
+			response := td.params["response"].(string)
+			guests, _ := td.params["guests"].(int)
+			if response == common.RSVPNo {
+				guests = 0
+			}
+			if td.setError != nil {
+				mockWarehouse.On("SetRSVP", "meetingID", validUserID, response, guests).Return(nil, td.setError)
+			} else {
+				mockWarehouse.On("SetRSVP", "meetingID", validUserID, response, guests).Return(&common.MeetingRSVP{
+					UserID: validUserID, Response: response, Guests: guests, Waitlisted: td.waitlisted}, nil)
+			}
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedHTTPStatus != http.StatusOK {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+			continue
+		}
+		rsvp := common.MeetingRSVP{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&rsvp); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		assert.Equal(t, td.waitlisted, rsvp.Waitlisted, td.description)
+	}
+}
+
+func TestClubMeetingRSVPDelete(t *testing.T) {
+	type testData struct {
+		description        string
+		deleteError        error
+		expectedHTTPStatus int
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Withdraws the RSVP",
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description:        "Never answered",
+			deleteError:        common.ErrRSVPNotFound,
+			expectedHTTPStatus: http.StatusNotFound,
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodDelete, "/clubs/clubID/meetings/meetingID/rsvp", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(common.ClubRoleMember))
+		mockWarehouse.On("GetMeeting", "clubID", "meetingID").Return(validMeeting(), nil)
+		mockWarehouse.On("DeleteRSVP", "meetingID", validUserID).Return(td.deleteError)
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
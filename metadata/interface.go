@@ -0,0 +1,11 @@
+package metadata
+
+import "github.com/garycarr/book_club/common"
+
+// ProviderIn looks up the details of a book from its ISBN, each metadata source such as Open Library
+// or a static file implements it
+type ProviderIn interface {
+	// Lookup takes a normalised ISBN-13. It returns common.ErrBookMetadataNotFound if the provider
+	// does not know the book
+	Lookup(isbn13 string) (*common.BookDetails, error)
+}
@@ -0,0 +1,67 @@
+package metadata
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// TypeOpenLibrary looks books up with the Open Library books API
+	TypeOpenLibrary = "openlibrary"
+	// TypeStatic looks books up in a JSON file, for offline use
+	TypeStatic = "static"
+)
+
+// Config ...
+type Config struct {
+	Type string `json:"type"`
+	// URL is the base URL of the Open Library API, defaulting to https://openlibrary.org
+	URL string `json:"url"`
+	// File is the JSON file the static provider reads
+	File           string `json:"file"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// NewProvider returns the provider for the configured type, defaulting to Open Library
+func NewProvider(conf Config) (ProviderIn, error) {
+	switch conf.Type {
+	case TypeOpenLibrary, "":
+		return NewOpenLibraryProvider(conf.URL, time.Duration(conf.TimeoutSeconds)*time.Second), nil
+	case TypeStatic:
+		return NewStaticProvider(conf.File)
+	}
+	return nil, fmt.Errorf("Unknown metadata provider type %q", conf.Type)
+}
+
+var (
+	yearRegexp         = regexp.MustCompile(`\b(\d{4})\b`)
+	publishedDateForms = []struct {
+		layout string
+		format string
+	}{
+		{"2006-01-02", "2006-01-02"},
+		{"2006-01", "2006-01"},
+		{"January 2, 2006", "2006-01-02"},
+		{"Jan 2, 2006", "2006-01-02"},
+		{"2 January 2006", "2006-01-02"},
+		{"January 2006", "2006-01"},
+		{"Jan 2006", "2006-01"},
+	}
+)
+
+// normalisePublishedDate turns the free text dates providers give into YYYY, YYYY-MM or YYYY-MM-DD.
+// The year is used if the rest can not be read, and nothing if there is no year
+func normalisePublishedDate(date string) string {
+	date = strings.TrimSpace(date)
+	for _, form := range publishedDateForms {
+		if t, err := time.Parse(form.layout, date); err == nil {
+			return t.Format(form.format)
+		}
+	}
+	if match := yearRegexp.FindStringSubmatch(date); match != nil {
+		return match[1]
+	}
+	return ""
+}
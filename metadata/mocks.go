@@ -0,0 +1,20 @@
+package metadata
+
+import (
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockProvider implements the Provider interface for the purpose of testing
+type MockProvider struct {
+	mock.Mock
+}
+
+// Lookup is used to assert the method is called
+func (mp *MockProvider) Lookup(isbn13 string) (*common.BookDetails, error) {
+	args := mp.Called(isbn13)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.BookDetails), args.Error(1)
+}
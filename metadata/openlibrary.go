@@ -0,0 +1,106 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+)
+
+const (
+	defaultOpenLibraryURL = "https://openlibrary.org"
+	defaultTimeout        = time.Duration(10 * time.Second)
+	maxResponseLength     = 1 << 20
+)
+
+// OpenLibraryProvider looks books up with the Open Library books API, or any service that answers
+// /api/books in the same way
+type OpenLibraryProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+// openLibraryBook is the part of a jscmd=data book the import uses
+type openLibraryBook struct {
+	Title   string `json:"title"`
+	Authors []struct {
+		Name string `json:"name"`
+	} `json:"authors"`
+	NumberOfPages int `json:"number_of_pages"`
+	Publishers    []struct {
+		Name string `json:"name"`
+	} `json:"publishers"`
+	PublishDate string `json:"publish_date"`
+	Cover       struct {
+		Medium string `json:"medium"`
+		Large  string `json:"large"`
+	} `json:"cover"`
+}
+
+// NewOpenLibraryProvider uses the defaults for an empty baseURL or a zero timeout
+func NewOpenLibraryProvider(baseURL string, timeout time.Duration) *OpenLibraryProvider {
+	if baseURL == "" {
+		baseURL = defaultOpenLibraryURL
+	}
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &OpenLibraryProvider{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// Lookup ...
+func (olp *OpenLibraryProvider) Lookup(isbn13 string) (*common.BookDetails, error) {
+	bibkey := "ISBN:" + isbn13
+	q := url.Values{}
+	q.Set("bibkeys", bibkey)
+	q.Set("format", "json")
+	q.Set("jscmd", "data")
+	resp, err := olp.client.Get(olp.baseURL + "/api/books?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Open Library lookup failed with status %d", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseLength))
+	if err != nil {
+		return nil, err
+	}
+	// Unknown ISBNs are left out of the response rather than being an error
+	books := map[string]openLibraryBook{}
+	if err = json.Unmarshal(body, &books); err != nil {
+		return nil, fmt.Errorf("Unable to decode Open Library response: %v", err)
+	}
+	olb, ok := books[bibkey]
+	if !ok {
+		return nil, common.ErrBookMetadataNotFound
+	}
+	bd := &common.BookDetails{
+		Title:         olb.Title,
+		Authors:       []string{},
+		ISBN13:        isbn13,
+		PublishedDate: normalisePublishedDate(olb.PublishDate),
+		PageCount:     olb.NumberOfPages,
+		CoverURL:      olb.Cover.Large,
+	}
+	for _, author := range olb.Authors {
+		bd.Authors = append(bd.Authors, author.Name)
+	}
+	if len(olb.Publishers) > 0 {
+		bd.Publisher = olb.Publishers[0].Name
+	}
+	if bd.CoverURL == "" {
+		bd.CoverURL = olb.Cover.Medium
+	}
+	return bd, nil
+}
@@ -0,0 +1,121 @@
+package metadata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// openLibraryStandIn answers /api/books like Open Library does for the one book it knows
+func openLibraryStandIn(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/books" {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		assert.Equal(t, "json", q.Get("format"))
+		assert.Equal(t, "data", q.Get("jscmd"))
+		w.Header().Set("Content-Type", "application/json")
+		switch q.Get("bibkeys") {
+		case "ISBN:9780441478125":
+			w.Write([]byte(`{"ISBN:9780441478125": {
+				"title": "The Left Hand of Darkness",
+				"authors": [{"url": "https://openlibrary.org/authors/OL31353A", "name": "Ursula K. Le Guin"}],
+				"number_of_pages": 286,
+				"publishers": [{"name": "Ace Books"}, {"name": "Walker"}],
+				"publish_date": "March 1969",
+				"cover": {"small": "https://covers.example.com/S.jpg", "medium": "https://covers.example.com/M.jpg",
+					"large": "https://covers.example.com/L.jpg"}
+			}}`))
+		case "ISBN:9780000000002":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+}
+
+func TestOpenLibraryProviderLookup(t *testing.T) {
+	type testData struct {
+		description     string
+		expectedDetails *common.BookDetails
+		expectError     bool
+		isbn13          string
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Known book",
+			expectedDetails: &common.BookDetails{
+				Title:         "The Left Hand of Darkness",
+				Authors:       []string{"Ursula K. Le Guin"},
+				ISBN13:        "9780441478125",
+				Publisher:     "Ace Books",
+				PublishedDate: "1969-03",
+				PageCount:     286,
+				CoverURL:      "https://covers.example.com/L.jpg",
+			},
+			isbn13: "9780441478125",
+		},
+		testData{
+			description: "Unknown book",
+			isbn13:      "9780306406157",
+		},
+		testData{
+			description: "Server error",
+			expectError: true,
+			isbn13:      "9780000000002",
+		},
+	}
+	server := openLibraryStandIn(t)
+	defer server.Close()
+	olp := NewOpenLibraryProvider(server.URL+"/", time.Second)
+	for _, td := range testTable {
+		details, err := olp.Lookup(td.isbn13)
+		switch {
+		case td.expectError:
+			assert.NotNil(t, err, td.description)
+			assert.NotEqual(t, common.ErrBookMetadataNotFound, err, td.description)
+		case td.expectedDetails == nil:
+			assert.Equal(t, common.ErrBookMetadataNotFound, err, td.description)
+		default:
+			assert.Nil(t, err, td.description)
+			assert.Equal(t, td.expectedDetails, details, td.description)
+		}
+	}
+}
+
+func TestNormalisePublishedDate(t *testing.T) {
+	testTable := map[string]string{
+		"1969":           "1969",
+		"1969-03-01":     "1969-03-01",
+		"March 1, 1969":  "1969-03-01",
+		"Mar 1, 1969":    "1969-03-01",
+		"1 March 1969":   "1969-03-01",
+		"March 1969":     "1969-03",
+		"Spring 1969":    "1969",
+		"n.d.":           "",
+		" 1990-09 ":      "1990-09",
+		"1st ed. (1969)": "1969",
+		"":               "",
+	}
+	for date, expected := range testTable {
+		assert.Equal(t, expected, normalisePublishedDate(date), date)
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	p, err := NewProvider(Config{})
+	if assert.Nil(t, err) {
+		assert.IsType(t, &OpenLibraryProvider{}, p)
+	}
+	_, err = NewProvider(Config{Type: TypeStatic})
+	assert.NotNil(t, err)
+	_, err = NewProvider(Config{Type: "unknown"})
+	assert.NotNil(t, err)
+}
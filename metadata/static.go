@@ -0,0 +1,52 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/garycarr/book_club/common"
+)
+
+// StaticProvider looks books up in a JSON file of ISBN to book details, for offline use. The file is
+// read once when the provider is created
+type StaticProvider struct {
+	books map[string]common.BookDetails
+}
+
+// NewStaticProvider reads the file. The ISBNs in it can be ISBN-10s or ISBN-13s, with or without
+// hyphens
+func NewStaticProvider(file string) (*StaticProvider, error) {
+	if file == "" {
+		return nil, fmt.Errorf("A file is needed for the static metadata provider")
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]common.BookDetails{}
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("Unable to decode %s: %v", file, err)
+	}
+	books := make(map[string]common.BookDetails, len(raw))
+	for isbn, bd := range raw {
+		isbn13, err := common.ToISBN13(isbn)
+		if err != nil {
+			return nil, fmt.Errorf("%s in %s: %v", isbn, file, err)
+		}
+		books[isbn13] = bd
+	}
+	return &StaticProvider{books: books}, nil
+}
+
+// Lookup ...
+func (sp *StaticProvider) Lookup(isbn13 string) (*common.BookDetails, error) {
+	bd, ok := sp.books[isbn13]
+	if !ok {
+		return nil, common.ErrBookMetadataNotFound
+	}
+	// The caller may change the details, so it gets a copy
+	bd.Authors = append([]string{}, bd.Authors...)
+	bd.ISBN13 = isbn13
+	return &bd, nil
+}
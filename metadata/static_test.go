@@ -0,0 +1,70 @@
+package metadata
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeStaticFile(t *testing.T, dir, contents string) string {
+	file := filepath.Join(dir, "books.json")
+	if err := ioutil.WriteFile(file, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestStaticProviderLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := writeStaticFile(t, dir, `{
+		"0-441-17271-7": {"title": "Dune", "authors": ["Frank Herbert"], "pageCount": 535},
+		"9780441478125": {"title": "The Left Hand of Darkness", "authors": ["Ursula K. Le Guin"]}
+	}`)
+
+	sp, err := NewStaticProvider(file)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	details, err := sp.Lookup("9780441172719")
+	if assert.Nil(t, err) {
+		assert.Equal(t, &common.BookDetails{Title: "Dune", Authors: []string{"Frank Herbert"}, ISBN13: "9780441172719",
+			PageCount: 535}, details)
+		// Changing the returned details must not change the provider
+		details.Authors[0] = "Someone else"
+	}
+	details, err = sp.Lookup("9780441172719")
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{"Frank Herbert"}, details.Authors)
+	}
+	details, err = sp.Lookup("9780441478125")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "The Left Hand of Darkness", details.Title)
+	}
+	_, err = sp.Lookup("9780306406157")
+	assert.Equal(t, common.ErrBookMetadataNotFound, err)
+}
+
+func TestNewStaticProviderInvalidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = NewStaticProvider("")
+	assert.NotNil(t, err)
+	_, err = NewStaticProvider(filepath.Join(dir, "missing.json"))
+	assert.NotNil(t, err)
+	_, err = NewStaticProvider(writeStaticFile(t, dir, `{"1234": {"title": "Bad ISBN"}}`))
+	assert.NotNil(t, err)
+	_, err = NewStaticProvider(writeStaticFile(t, dir, `not json`))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/oidc"
+	"github.com/garycarr/book_club/util"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// oidcLoginExpiration is how long the user has to log in at the identity provider
+const oidcLoginExpiration = time.Duration(10 * time.Minute)
+
+// oidcLoginGet sends the user to log in at the identity provider
+func (a *app) oidcLoginGet(w http.ResponseWriter, r *http.Request) {
+	providerName := mux.Vars(r)["provider"]
+	provider, ok := a.oidcProviders[providerName]
+	if !ok {
+		a.respondWithError(w, http.StatusNotFound, common.ErrOIDCProviderNotFound.Error())
+		return
+	}
+	// The state ties the callback to this login, the nonce ties the ID token to it and the code
+	// verifier proves the code is redeemed by whoever started it
+	values := make([]string, 3)
+	for i := range values {
+		v, err := a.util.CreateRandomToken()
+		if err != nil {
+			a.logrus.WithError(err).Error("Unable to create OIDC login state")
+			a.respondWithError(w, http.StatusInternalServerError, "Error starting the login")
+			return
+		}
+		values[i] = v
+	}
+	state, nonce, codeVerifier := values[0], values[1], values[2]
+	err := a.warehouse.CreateOIDCLogin(util.HashToken(state), common.OIDCLogin{
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(oidcLoginExpiration),
+	})
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to store OIDC login")
+		a.respondWithError(w, http.StatusInternalServerError, "Error starting the login")
+		return
+	}
+	authURL, err := provider.AuthCodeURL(state, nonce, oidc.PKCEChallenge(codeVerifier))
+	if err != nil {
+		a.logrus.WithError(err).WithField("provider", providerName).Error("Unable to reach identity provider")
+		a.respondWithError(w, http.StatusBadGateway, "Error reaching the identity provider")
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallbackGet finishes a login at the identity provider. The user is found by their identity at
+// the provider, then by a verified email, and otherwise a new user is created
+func (a *app) oidcCallbackGet(w http.ResponseWriter, r *http.Request) {
+	providerName := mux.Vars(r)["provider"]
+	provider, ok := a.oidcProviders[providerName]
+	if !ok {
+		a.respondWithError(w, http.StatusNotFound, common.ErrOIDCProviderNotFound.Error())
+		return
+	}
+	q := r.URL.Query()
+	if providerError := q.Get("error"); providerError != "" {
+		a.logrus.WithFields(logrus.Fields{"provider": providerName, "error": providerError}).Debug("Identity provider refused the login")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrOIDCLoginFailed.Error())
+		return
+	}
+	login, err := a.warehouse.UseOIDCLogin(util.HashToken(q.Get("state")))
+	if err != nil {
+		if err == common.ErrOIDCStateInvalid {
+			a.respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to get OIDC login")
+		a.respondWithError(w, http.StatusInternalServerError, "Error finishing the login")
+		return
+	}
+	if login.Provider != providerName {
+		a.respondWithError(w, http.StatusBadRequest, common.ErrOIDCStateInvalid.Error())
+		return
+	}
+	idToken, err := provider.Exchange(q.Get("code"), login.CodeVerifier, login.Nonce)
+	if err != nil {
+		a.logrus.WithError(err).WithField("provider", providerName).Warn("Unable to exchange OIDC code")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrOIDCLoginFailed.Error())
+		return
+	}
+	user, status, err := a.oidcUser(providerName, idToken)
+	if err != nil {
+		if status == http.StatusInternalServerError {
+			a.logrus.WithError(err).Error("Unable to get user for OIDC login")
+			a.respondWithError(w, status, "Error finishing the login")
+			return
+		}
+		a.respondWithError(w, status, err.Error())
+		return
+	}
+	a.respondWithLogin(w, user)
+}
+
+// oidcLoginOptions returns the allowed options
+func (a *app) oidcLoginOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// oidcUser returns the user for the identity, linking or creating one as needed. The status is the
+// response to give with the error
+func (a *app) oidcUser(providerName string, idToken *oidc.IDToken) (*common.User, int, error) {
+	user, err := a.warehouse.GetUserWithIdentity(providerName, idToken.Subject)
+	if err == nil {
+		return user, http.StatusOK, nil
+	}
+	if err != common.ErrUserNotFound {
+		return nil, http.StatusInternalServerError, err
+	}
+	if idToken.Email == "" {
+		return nil, http.StatusBadRequest, common.ErrOIDCEmailNotPresent
+	}
+	identity := common.UserIdentity{Provider: providerName, Subject: idToken.Subject, Email: idToken.Email}
+	user, err = a.warehouse.GetUserWithEmail(idToken.Email)
+	if err == nil {
+		// Both sides have to have verified the email, otherwise whoever registered the email first
+		// could take over the account
+		if !idToken.EmailVerified || user.EmailVerifiedAt == nil {
+			return nil, http.StatusConflict, common.ErrOIDCLinkNotAllowed
+		}
+		if err = a.warehouse.LinkUserIdentity(user.ID, identity); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		return user, http.StatusOK, nil
+	}
+	if err != common.ErrLoginUserNotFound {
+		return nil, http.StatusInternalServerError, err
+	}
+	user, err = a.warehouse.CreateUserWithIdentity(oidcDisplayName(idToken), idToken.EmailVerified, identity)
+	if err != nil {
+		if err == common.ErrLoginUserAlreadyExists {
+			return nil, http.StatusConflict, common.ErrOIDCLinkNotAllowed
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	if user.EmailVerifiedAt == nil {
+		if err = a.sendEmailVerification(user, user.Email); err != nil {
+			// The user can ask for the email again
+			a.logrus.WithError(err).Error("Unable to send verification email")
+		}
+	}
+	return user, http.StatusOK, nil
+}
+
+// oidcDisplayName is the name from the provider, or the start of the email if it did not share one
+func oidcDisplayName(idToken *oidc.IDToken) string {
+	if name := strings.TrimSpace(idToken.Name); name != "" {
+		return name
+	}
+	return strings.SplitN(idToken.Email, "@", 2)[0]
+}
@@ -0,0 +1,246 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// clockSkew is how far the clock of the provider can be from ours
+const clockSkew = time.Duration(1 * time.Minute)
+
+var (
+	errIDTokenExpired     = errors.New("ID token has expired")
+	errIDTokenIssuedLater = errors.New("ID token was issued in the future")
+	errIDTokenSubject     = errors.New("ID token has no subject")
+)
+
+// IDToken is the verified identity of a user from their provider
+type IDToken struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// idTokenClaims are the claims of an ID token, see OpenID Connect Core section 2
+type idTokenClaims struct {
+	Issuer          string       `json:"iss"`
+	Subject         string       `json:"sub"`
+	Audience        audience     `json:"aud"`
+	AuthorizedParty string       `json:"azp"`
+	ExpiresAt       int64        `json:"exp"`
+	IssuedAt        int64        `json:"iat"`
+	Nonce           string       `json:"nonce"`
+	Email           string       `json:"email"`
+	EmailVerified   flexibleBool `json:"email_verified"`
+	Name            string       `json:"name"`
+}
+
+// Valid is called by the parser, the claims that need the provider are checked in verifyIDToken
+func (c *idTokenClaims) Valid() error {
+	now := time.Now()
+	if now.After(time.Unix(c.ExpiresAt, 0).Add(clockSkew)) {
+		return errIDTokenExpired
+	}
+	if time.Unix(c.IssuedAt, 0).After(now.Add(clockSkew)) {
+		return errIDTokenIssuedLater
+	}
+	if c.Subject == "" {
+		return errIDTokenSubject
+	}
+	return nil
+}
+
+// audience is a single audience or a list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = audience(list)
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// flexibleBool accepts "true" as well as true, as some providers send email_verified as a string
+type flexibleBool bool
+
+func (fb *flexibleBool) UnmarshalJSON(b []byte) error {
+	switch string(b) {
+	case "true", `"true"`:
+		*fb = true
+	default:
+		*fb = false
+	}
+	return nil
+}
+
+// jsonWebKey is a signing key of the provider, see RFC 7517
+type jsonWebKey struct {
+	KeyID     string `json:"kid"`
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+
+	method    jwt.SigningMethod
+	publicKey interface{}
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce of the ID token
+func (p *Provider) verifyIDToken(rawIDToken, nonce string) (*IDToken, error) {
+	claims := idTokenClaims{}
+	if _, err := jwt.ParseWithClaims(rawIDToken, &claims, p.verificationKey); err != nil {
+		return nil, err
+	}
+	if claims.Issuer != p.discovery.Issuer {
+		return nil, fmt.Errorf("ID token issuer %q is not %q", claims.Issuer, p.discovery.Issuer)
+	}
+	if !claims.Audience.contains(p.conf.ClientID) {
+		return nil, fmt.Errorf("ID token is not for client %q", p.conf.ClientID)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.conf.ClientID {
+		return nil, fmt.Errorf("ID token was not issued to client %q", p.conf.ClientID)
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("ID token nonce does not match the login")
+	}
+	return &IDToken{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+// verificationKey finds the key of the provider from the kid header. The keys are fetched again for
+// an unknown kid as the provider may have rotated them
+func (p *Provider) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	p.mu.Unlock()
+	if !ok {
+		if err := p.fetchKeys(); err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		key, ok = p.keys[kid]
+		p.mu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("Unknown key id: %q", kid)
+		}
+	}
+	// The algorithm has to be the one of the key, never one the token picks
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.publicKey, nil
+}
+
+// fetchKeys replaces the keys with the current JWKS of the provider. Keys that are not RSA or P-256
+// signing keys are skipped
+func (p *Provider) fetchKeys() error {
+	req, err := http.NewRequest(http.MethodGet, p.discovery.JWKSURI, nil)
+	if err != nil {
+		return err
+	}
+	jwks := struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}{}
+	status, err := p.doJSON(req, &jwks)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("JWKS request failed with status %d", status)
+	}
+	keys := map[string]*jsonWebKey{}
+	for _, key := range jwks.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if err := key.parse(); err != nil {
+			continue
+		}
+		keys[key.KeyID] = key
+	}
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+	return nil
+}
+
+// parse sets the public key and signing method from the JWK fields
+func (k *jsonWebKey) parse() error {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return err
+		}
+		k.publicKey = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		k.method = jwt.SigningMethodRS256
+	case "EC":
+		if k.Curve != "P-256" {
+			return fmt.Errorf("Unsupported curve %q", k.Curve)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return err
+		}
+		k.publicKey = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		k.method = jwt.SigningMethodES256
+	default:
+		return fmt.Errorf("Unsupported key type %q", k.KeyType)
+	}
+	if k.Algorithm != "" && k.Algorithm != k.method.Alg() {
+		return fmt.Errorf("Unsupported algorithm %q", k.Algorithm)
+	}
+	return nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,9 @@
+package oidc
+
+// ProviderIn is an OpenID Connect provider users can log in with
+type ProviderIn interface {
+	// AuthCodeURL is where the user is sent to log in at the provider
+	AuthCodeURL(state, nonce, codeChallenge string) (string, error)
+	// Exchange swaps the code from the callback for the verified ID token of the user
+	Exchange(code, codeVerifier, nonce string) (*IDToken, error)
+}
@@ -0,0 +1,190 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	httpTimeout       = time.Duration(10 * time.Second)
+	discoveryPath     = "/.well-known/openid-configuration"
+	maxResponseLength = 1 << 20
+)
+
+var (
+	errProviderNameMissing   = errors.New("OIDC provider needs a name")
+	errProviderIssuerMissing = errors.New("OIDC provider needs an issuer")
+	errProviderClientMissing = errors.New("OIDC provider needs a client id")
+	errIDTokenMissing        = errors.New("Token response has no ID token")
+)
+
+var defaultScopes = []string{"openid", "email", "profile"}
+
+// ProviderConfig is an OpenID Connect provider as set in the config
+type ProviderConfig struct {
+	// Name is used in the login and callback routes, /login/oidc/{name}
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+}
+
+// Provider logs users in with the authorization code flow and PKCE. The discovery document and keys
+// of the provider are fetched the first time they are needed
+type Provider struct {
+	conf        ProviderConfig
+	redirectURL string
+	client      *http.Client
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+	keys      map[string]*jsonWebKey
+}
+
+// discoveryDocument is the part of the provider metadata the login flow needs
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// tokenResponse is the response of the token endpoint
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// NewProvider returns a provider that redirects users back to redirectURL after logging in
+func NewProvider(conf ProviderConfig, redirectURL string) (*Provider, error) {
+	if conf.Name == "" {
+		return nil, errProviderNameMissing
+	}
+	if conf.Issuer == "" {
+		return nil, errProviderIssuerMissing
+	}
+	if conf.ClientID == "" {
+		return nil, errProviderClientMissing
+	}
+	if len(conf.Scopes) == 0 {
+		conf.Scopes = defaultScopes
+	}
+	return &Provider{
+		conf:        conf,
+		redirectURL: redirectURL,
+		client:      &http.Client{Timeout: httpTimeout},
+	}, nil
+}
+
+// AuthCodeURL returns the authorization endpoint URL for a login. codeChallenge is from PKCEChallenge
+func (p *Provider) AuthCodeURL(state, nonce, codeChallenge string) (string, error) {
+	doc, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(doc.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.conf.ClientID)
+	q.Set("redirect_uri", p.redirectURL)
+	q.Set("scope", strings.Join(p.conf.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange swaps the authorization code for tokens and returns the verified ID token. The nonce
+// must be the one given to AuthCodeURL for the login
+func (p *Provider) Exchange(code, codeVerifier, nonce string) (*IDToken, error) {
+	doc, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURL)
+	form.Set("code_verifier", codeVerifier)
+	req, err := http.NewRequest(http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.conf.ClientID), url.QueryEscape(p.conf.ClientSecret))
+	tr := tokenResponse{}
+	status, err := p.doJSON(req, &tr)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK || tr.Error != "" {
+		return nil, fmt.Errorf("Token request failed with status %d: %s %s", status, tr.Error, tr.ErrorDescription)
+	}
+	if tr.IDToken == "" {
+		return nil, errIDTokenMissing
+	}
+	return p.verifyIDToken(tr.IDToken, nonce)
+}
+
+// discover fetches the discovery document, it is kept once it has been fetched
+func (p *Provider) discover() (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(p.conf.Issuer, "/")+discoveryPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	doc := discoveryDocument{}
+	status, err := p.doJSON(req, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("Discovery for %s failed with status %d", p.conf.Issuer, status)
+	}
+	// The issuer has to match exactly, otherwise ID tokens from another issuer could be accepted
+	if doc.Issuer != p.conf.Issuer {
+		return nil, fmt.Errorf("Discovery issuer %q does not match %q", doc.Issuer, p.conf.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("Discovery for %s is missing an endpoint", p.conf.Issuer)
+	}
+	p.discovery = &doc
+	return p.discovery, nil
+}
+
+// doJSON sends the request and decodes the JSON response into v, whatever the status
+func (p *Provider) doJSON(req *http.Request, v interface{}) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseLength))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if err = json.Unmarshal(body, v); err != nil {
+		return resp.StatusCode, fmt.Errorf("Unable to decode response from %s: %v", req.URL.Host, err)
+	}
+	return resp.StatusCode, nil
+}
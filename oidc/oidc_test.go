@@ -0,0 +1,167 @@
+package oidc
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/garycarr/book_club/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testClientID     = "client"
+	testClientSecret = "secret"
+	testRedirectURL  = "http://localhost:8080/login/oidc/test/callback"
+	testVerifier     = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+func TestPKCEChallenge(t *testing.T) {
+	// The example from RFC 7636 appendix B
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", PKCEChallenge(testVerifier))
+}
+
+func TestNewProviderConfig(t *testing.T) {
+	_, err := NewProvider(ProviderConfig{Issuer: "https://example.com", ClientID: "client"}, testRedirectURL)
+	assert.Equal(t, errProviderNameMissing, err)
+	_, err = NewProvider(ProviderConfig{Name: "test", ClientID: "client"}, testRedirectURL)
+	assert.Equal(t, errProviderIssuerMissing, err)
+	_, err = NewProvider(ProviderConfig{Name: "test", Issuer: "https://example.com"}, testRedirectURL)
+	assert.Equal(t, errProviderClientMissing, err)
+	p, err := NewProvider(ProviderConfig{Name: "test", Issuer: "https://example.com", ClientID: "client"}, testRedirectURL)
+	if assert.Nil(t, err) {
+		assert.Equal(t, defaultScopes, p.conf.Scopes)
+	}
+}
+
+func TestProviderLogin(t *testing.T) {
+	type testData struct {
+		description   string
+		claims        func(jwt.MapClaims)
+		clientSecret  string
+		expectedError string
+		nonce         string
+		verifier      string
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Valid login",
+		},
+		testData{
+			description: "Audience list with this client as the authorized party",
+			claims: func(c jwt.MapClaims) {
+				c["aud"] = []string{"other", testClientID}
+				c["azp"] = testClientID
+			},
+		},
+		testData{
+			description:   "Nonce does not match",
+			expectedError: "nonce",
+			nonce:         "another-nonce",
+		},
+		testData{
+			description:   "Wrong PKCE verifier",
+			expectedError: "invalid_grant",
+			verifier:      strings.Repeat("a", 43),
+		},
+		testData{
+			description:   "Wrong client secret",
+			clientSecret:  "wrong",
+			expectedError: "invalid_client",
+		},
+		testData{
+			description:   "Token for another client",
+			claims:        func(c jwt.MapClaims) { c["aud"] = "other" },
+			expectedError: "not for client",
+		},
+		testData{
+			description:   "Token from another issuer",
+			claims:        func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+			expectedError: "issuer",
+		},
+		testData{
+			description:   "Expired token",
+			claims:        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+			expectedError: errIDTokenExpired.Error(),
+		},
+	}
+	fake, err := oidctest.NewProvider(testClientID, testClientSecret)
+	if err != nil {
+		t.Fatalf("Unable to start fake provider: %v", err)
+	}
+	defer fake.Close()
+	user := oidctest.User{Subject: "subject", Email: "gcarr@example.com", EmailVerified: true, Name: "Gary"}
+	for _, td := range testTable {
+		fake.Claims = td.claims
+		clientSecret := testClientSecret
+		if td.clientSecret != "" {
+			clientSecret = td.clientSecret
+		}
+		p, err := NewProvider(ProviderConfig{Name: "test", Issuer: fake.Issuer(), ClientID: testClientID,
+			ClientSecret: clientSecret}, testRedirectURL)
+		if err != nil {
+			t.Fatalf("Unable to create provider for test %q: %v", td.description, err)
+		}
+		authURL, err := p.AuthCodeURL("state", "nonce", PKCEChallenge(testVerifier))
+		if err != nil {
+			t.Errorf("Unable to get auth code URL for test %q: %v", td.description, err)
+			continue
+		}
+		callback, err := fake.Authorize(authURL, user)
+		if err != nil {
+			t.Errorf("Unable to authorize for test %q: %v", td.description, err)
+			continue
+		}
+		cu, err := url.Parse(callback)
+		if err != nil {
+			t.Errorf("Unable to parse callback for test %q: %v", td.description, err)
+			continue
+		}
+		assert.Equal(t, "state", cu.Query().Get("state"), td.description)
+		nonce, verifier := "nonce", testVerifier
+		if td.nonce != "" {
+			nonce = td.nonce
+		}
+		if td.verifier != "" {
+			verifier = td.verifier
+		}
+		idToken, err := p.Exchange(cu.Query().Get("code"), verifier, nonce)
+		if td.expectedError != "" {
+			if assert.NotNil(t, err, td.description) {
+				assert.Contains(t, err.Error(), td.expectedError, td.description)
+			}
+			continue
+		}
+		if assert.Nil(t, err, td.description) {
+			assert.Equal(t, &IDToken{Subject: "subject", Email: "gcarr@example.com", EmailVerified: true, Name: "Gary"},
+				idToken, td.description)
+		}
+	}
+}
+
+func TestProviderDiscoveryIssuerMismatch(t *testing.T) {
+	fake, err := oidctest.NewProvider(testClientID, testClientSecret)
+	if err != nil {
+		t.Fatalf("Unable to start fake provider: %v", err)
+	}
+	defer fake.Close()
+	p, err := NewProvider(ProviderConfig{Name: "test", Issuer: fake.Issuer() + "/", ClientID: testClientID}, testRedirectURL)
+	if err != nil {
+		t.Fatalf("Unable to create provider: %v", err)
+	}
+	_, err = p.AuthCodeURL("state", "nonce", "challenge")
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "does not match")
+	}
+}
+
+func TestFlexibleBool(t *testing.T) {
+	for input, expected := range map[string]bool{`true`: true, `"true"`: true, `false`: false, `"false"`: false, `null`: false} {
+		var fb flexibleBool
+		assert.Nil(t, fb.UnmarshalJSON([]byte(input)), input)
+		assert.Equal(t, expected, bool(fb), input)
+	}
+}
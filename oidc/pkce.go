@@ -0,0 +1,13 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// PKCEChallenge returns the S256 code challenge for the code verifier, see RFC 7636. The verifier
+// must be 43 to 128 URL safe characters
+func PKCEChallenge(codeVerifier string) string {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/mailer"
+	"github.com/garycarr/book_club/oidc"
+	"github.com/garycarr/book_club/oidc/oidctest"
+	"github.com/garycarr/book_club/util"
+	"github.com/garycarr/book_club/warehouse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// oidcRandomToken is returned for the state, nonce and code verifier of every login. It is long
+// enough to be a PKCE code verifier
+const oidcRandomToken = "randomTokenRandomTokenRandomTokenRandomToken"
+
+// setupOIDCTest returns an app with the fake provider configured as "test"
+func setupOIDCTest(t *testing.T, fake *oidctest.Provider, req *http.Request) (*app, *httptest.ResponseRecorder, *util.MockUtil,
+	*warehouse.MockWarehouse) {
+	a, responseRecorder := setupTest(req)
+	provider, err := oidc.NewProvider(oidc.ProviderConfig{
+		Name:         "test",
+		Issuer:       fake.Issuer(),
+		ClientID:     fake.ClientID,
+		ClientSecret: fake.ClientSecret,
+	}, a.conf.BaseURL+"/login/oidc/test/callback")
+	if err != nil {
+		t.Fatalf("Unable to create provider: %v", err)
+	}
+	a.oidcProviders["test"] = provider
+	mockUtil := util.MockUtil{}
+	mockWarehouse := warehouse.MockWarehouse{}
+	a.util = &mockUtil
+	a.warehouse = &mockWarehouse
+	return a, responseRecorder, &mockUtil, &mockWarehouse
+}
+
+func TestOIDCLoginGet(t *testing.T) {
+	fake, err := oidctest.NewProvider("client", "secret")
+	if err != nil {
+		t.Fatalf("Unable to start fake provider: %v", err)
+	}
+	defer fake.Close()
+
+	req, err := http.NewRequest(http.MethodGet, "/login/oidc/test", nil)
+	if err != nil {
+		t.Fatalf("Error creating new request: %v", err)
+	}
+	a, responseRecorder, mockUtil, mockWarehouse := setupOIDCTest(t, fake, req)
+	mockUtil.On("CreateRandomToken").Return(oidcRandomToken, nil)
+	mockWarehouse.On("CreateOIDCLogin", util.HashToken(oidcRandomToken), mock.MatchedBy(func(login common.OIDCLogin) bool {
+		return login.Provider == "test" && login.Nonce == oidcRandomToken && login.CodeVerifier == oidcRandomToken
+	})).Return(nil)
+
+	a.Router.ServeHTTP(responseRecorder, req)
+	mockUtil.AssertExpectations(t)
+	mockWarehouse.AssertExpectations(t)
+	if !assert.Equal(t, http.StatusFound, responseRecorder.Code) {
+		return
+	}
+	location, err := url.Parse(responseRecorder.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Unable to parse redirect: %v", err)
+	}
+	assert.Equal(t, fake.Issuer()+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+	assert.Equal(t, oidc.PKCEChallenge(oidcRandomToken), location.Query().Get("code_challenge"))
+	assert.Equal(t, oidcRandomToken, location.Query().Get("state"))
+
+	req, err = http.NewRequest(http.MethodGet, "/login/oidc/unknown", nil)
+	if err != nil {
+		t.Fatalf("Error creating new request: %v", err)
+	}
+	a, responseRecorder, _, _ = setupOIDCTest(t, fake, req)
+	a.Router.ServeHTTP(responseRecorder, req)
+	assert.Equal(t, http.StatusNotFound, responseRecorder.Code)
+}
+
+func TestOIDCCallbackGet(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedError      error
+		expectedHTTPStatus int
+		// setup adds the warehouse calls after the login state has been used
+		setup    func(*warehouse.MockWarehouse, *util.MockUtil, *mailer.MockMailer)
+		state    string
+		provider oidctest.User
+	}
+
+	verifiedAt := time.Now()
+	identity := common.UserIdentity{Provider: "test", Subject: "subject", Email: validUserEmail}
+	verifiedUser := &common.User{ID: validUserID, Email: validUserEmail, EmailVerifiedAt: &verifiedAt}
+	verifiedProviderUser := oidctest.User{Subject: "subject", Email: validUserEmail, EmailVerified: true, Name: validUserDisplayName}
+	loggedIn := func(mw *warehouse.MockWarehouse, mu *util.MockUtil, user *common.User) {
+		mw.On("CreateRefreshToken", user.ID, util.HashToken(oidcRandomToken), mock.AnythingOfType("time.Time")).
+			Return(&common.RefreshToken{}, nil)
+		mu.On("CreateJSONToken", user).Return("JWT", nil)
+	}
+	testTable := []testData{
+		testData{
+			description:        "Linked identity",
+			expectedHTTPStatus: http.StatusOK,
+			provider:           verifiedProviderUser,
+			setup: func(mw *warehouse.MockWarehouse, mu *util.MockUtil, mm *mailer.MockMailer) {
+				mw.On("GetUserWithIdentity", "test", "subject").Return(verifiedUser, nil)
+				loggedIn(mw, mu, verifiedUser)
+			},
+		},
+		testData{
+			description:        "Links to the user with the verified email",
+			expectedHTTPStatus: http.StatusOK,
+			provider:           verifiedProviderUser,
+			setup: func(mw *warehouse.MockWarehouse, mu *util.MockUtil, mm *mailer.MockMailer) {
+				mw.On("GetUserWithIdentity", "test", "subject").Return(nil, common.ErrUserNotFound)
+				mw.On("GetUserWithEmail", validUserEmail).Return(verifiedUser, nil)
+				mw.On("LinkUserIdentity", validUserID, identity).Return(nil)
+				loggedIn(mw, mu, verifiedUser)
+			},
+		},
+		testData{
+			description:        "Does not link to a user who has not verified the email",
+			expectedError:      common.ErrOIDCLinkNotAllowed,
+			expectedHTTPStatus: http.StatusConflict,
+			provider:           verifiedProviderUser,
+			setup: func(mw *warehouse.MockWarehouse, mu *util.MockUtil, mm *mailer.MockMailer) {
+				mw.On("GetUserWithIdentity", "test", "subject").Return(nil, common.ErrUserNotFound)
+				mw.On("GetUserWithEmail", validUserEmail).Return(&common.User{ID: validUserID, Email: validUserEmail}, nil)
+			},
+		},
+		testData{
+			description:        "Does not link when the provider has not verified the email",
+			expectedError:      common.ErrOIDCLinkNotAllowed,
+			expectedHTTPStatus: http.StatusConflict,
+			provider:           oidctest.User{Subject: "subject", Email: validUserEmail},
+			setup: func(mw *warehouse.MockWarehouse, mu *util.MockUtil, mm *mailer.MockMailer) {
+				mw.On("GetUserWithIdentity", "test", "subject").Return(nil, common.ErrUserNotFound)
+				mw.On("GetUserWithEmail", validUserEmail).Return(verifiedUser, nil)
+			},
+		},
+		testData{
+			description:        "Creates a new user",
+			expectedHTTPStatus: http.StatusOK,
+			provider:           verifiedProviderUser,
+			setup: func(mw *warehouse.MockWarehouse, mu *util.MockUtil, mm *mailer.MockMailer) {
+				mw.On("GetUserWithIdentity", "test", "subject").Return(nil, common.ErrUserNotFound)
+				mw.On("GetUserWithEmail", validUserEmail).Return(nil, common.ErrLoginUserNotFound)
+				mw.On("CreateUserWithIdentity", validUserDisplayName, true, identity).Return(verifiedUser, nil)
+				loggedIn(mw, mu, verifiedUser)
+			},
+		},
+		testData{
+			description:        "Creates a new user who has to verify their email",
+			expectedHTTPStatus: http.StatusOK,
+			provider:           oidctest.User{Subject: "subject", Email: validUserEmail},
+			setup: func(mw *warehouse.MockWarehouse, mu *util.MockUtil, mm *mailer.MockMailer) {
+				user := &common.User{ID: validUserID, Email: validUserEmail, DisplayName: "gcarr"}
+				mw.On("GetUserWithIdentity", "test", "subject").Return(nil, common.ErrUserNotFound)
+				mw.On("GetUserWithEmail", validUserEmail).Return(nil, common.ErrLoginUserNotFound)
+				mw.On("CreateUserWithIdentity", "gcarr", false, identity).Return(user, nil)
+				mw.On("CreateEmailVerification", validUserID, validUserEmail, util.HashToken(oidcRandomToken),
+					mock.AnythingOfType("time.Time")).Return(nil)
+				mm.On("Send", mock.AnythingOfType("common.Email")).Return(nil)
+				loggedIn(mw, mu, user)
+			},
+		},
+		testData{
+			description:        "Unknown state",
+			expectedError:      common.ErrOIDCStateInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			provider:           verifiedProviderUser,
+			state:              "unknown",
+		},
+	}
+	fake, err := oidctest.NewProvider("client", "secret")
+	if err != nil {
+		t.Fatalf("Unable to start fake provider: %v", err)
+	}
+	defer fake.Close()
+	for _, td := range testTable {
+		// Start the login to get the URL of the provider
+		req, err := http.NewRequest(http.MethodGet, "/login/oidc/test", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupOIDCTest(t, fake, req)
+		mockUtil.On("CreateRandomToken").Return(oidcRandomToken, nil)
+		mockWarehouse.On("CreateOIDCLogin", util.HashToken(oidcRandomToken), mock.AnythingOfType("common.OIDCLogin")).Return(nil)
+		a.Router.ServeHTTP(responseRecorder, req)
+		callback, err := fake.Authorize(responseRecorder.Header().Get("Location"), td.provider)
+		if err != nil {
+			t.Fatalf("Unable to authorize for test %q: %v", td.description, err)
+		}
+		callbackURL, err := url.Parse(callback)
+		if err != nil {
+			t.Fatalf("Unable to parse callback for test %q: %v", td.description, err)
+		}
+		if td.state != "" {
+			q := callbackURL.Query()
+			q.Set("state", td.state)
+			callbackURL.RawQuery = q.Encode()
+		}
+
+		req, err = http.NewRequest(http.MethodGet, callbackURL.RequestURI(), nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		responseRecorder = httptest.NewRecorder()
+		mockMailer := mailer.MockMailer{}
+		a.mailer = &mockMailer
+		if td.state != "" {
+			mockWarehouse.On("UseOIDCLogin", util.HashToken(td.state)).Return(nil, common.ErrOIDCStateInvalid)
+		} else {
+			mockWarehouse.On("UseOIDCLogin", util.HashToken(oidcRandomToken)).Return(&common.OIDCLogin{
+				Provider:     "test",
+				Nonce:        oidcRandomToken,
+				CodeVerifier: oidcRandomToken,
+				ExpiresAt:    time.Now().Add(time.Minute),
+			}, nil)
+		}
+		if td.setup != nil {
+			td.setup(mockWarehouse, mockUtil, &mockMailer)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		mockMailer.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		jsonResp := map[string]string{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		if td.expectedError != nil {
+			assert.Equal(t, td.expectedError.Error(), jsonResp["error"], td.description)
+			continue
+		}
+		assert.Equal(t, "JWT", jsonResp["token"], td.description)
+		assert.Equal(t, oidcRandomToken, jsonResp["refreshToken"], td.description)
+	}
+}
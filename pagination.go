@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/garycarr/book_club/common"
+)
+
+// requestPagination reads the limit and offset query parameters, the first page of
+// common.DefaultPageLimit rows is used when they are left out. If it returns false the error
+// response has already been written
+func (a *app) requestPagination(w http.ResponseWriter, r *http.Request) (common.Pagination, bool) {
+	p := common.Pagination{Limit: common.DefaultPageLimit}
+	query := r.URL.Query()
+	var err error
+	if limit := query.Get("limit"); limit != "" {
+		if p.Limit, err = strconv.Atoi(limit); err != nil {
+			p.Limit = -1
+		}
+	}
+	if offset := query.Get("offset"); offset != "" {
+		if p.Offset, err = strconv.Atoi(offset); err != nil {
+			p.Offset = -1
+		}
+	}
+	if err := p.ValidateRequest(); err != nil {
+		a.respondWithError(w, http.StatusBadRequest, err.Error())
+		return p, false
+	}
+	return p, true
+}
+
+// requestCursorPagination reads the limit and cursor query parameters, the first page of
+// common.DefaultPageLimit rows is used when they are left out. If it returns false the error
+// response has already been written
+func (a *app) requestCursorPagination(w http.ResponseWriter, r *http.Request) (common.CursorPagination, bool) {
+	p := common.CursorPagination{Limit: common.DefaultPageLimit}
+	query := r.URL.Query()
+	var err error
+	if limit := query.Get("limit"); limit != "" {
+		if p.Limit, err = strconv.Atoi(limit); err != nil {
+			p.Limit = -1
+		}
+	}
+	if err := p.ValidateRequest(); err != nil {
+		a.respondWithError(w, http.StatusBadRequest, err.Error())
+		return p, false
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		if p.After, err = common.ParseCursor(cursor); err != nil {
+			a.respondWithError(w, http.StatusBadRequest, err.Error())
+			return p, false
+		}
+	}
+	return p, true
+}
+
+// cursorPage is the response for a page of a list paged by cursor, nextCursor is left out on the
+// last page
+func cursorPage(key string, items interface{}, next *common.Cursor) map[string]interface{} {
+	page := map[string]interface{}{key: items}
+	if next != nil {
+		page["nextCursor"] = next.String()
+	}
+	return page
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/util"
+)
+
+const passwordResetExpiration = time.Duration(1 * time.Hour)
+
+// passwordForgotPost emails a single use password reset link. It responds the same way whether or
+// not the email is registered so it can not be used to find out who is a member
+func (a *app) passwordForgotPost(w http.ResponseWriter, r *http.Request) {
+	pfr := common.PasswordForgotRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&pfr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := pfr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	response := map[string]string{"message": "If the email is registered a reset link has been sent"}
+	user, err := a.warehouse.GetUserWithEmail(pfr.Email)
+	if err != nil {
+		if err == common.ErrLoginUserNotFound {
+			a.logrus.Debug("Password reset requested for an unknown email")
+			a.respondWithJSON(w, http.StatusOK, response)
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to get user")
+		a.respondWithError(w, http.StatusInternalServerError, "Error creating the reset token")
+		return
+	}
+	token, err := a.util.CreateRandomToken()
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to create reset token")
+		a.respondWithError(w, http.StatusInternalServerError, "Error creating the reset token")
+		return
+	}
+	if err = a.warehouse.CreatePasswordReset(user.ID, util.HashToken(token), time.Now().Add(passwordResetExpiration)); err != nil {
+		a.logrus.WithError(err).Error("Unable to store reset token")
+		a.respondWithError(w, http.StatusInternalServerError, "Error creating the reset token")
+		return
+	}
+	err = a.mailer.Send(common.Email{
+		To:      user.Email,
+		Subject: "Reset your book club password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to reset your password, it expires in %s.\n\n%s/password/reset?token=%s\n",
+			user.DisplayName, passwordResetExpiration, a.conf.BaseURL, token),
+	})
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to send reset email")
+		a.respondWithError(w, http.StatusInternalServerError, "Error sending the reset email")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, response)
+}
+
+// passwordForgotOptions returns the allowed options
+func (a *app) passwordForgotOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// passwordResetPost sets a new password using a reset token, every existing session is ended
+func (a *app) passwordResetPost(w http.ResponseWriter, r *http.Request) {
+	prr := common.PasswordResetRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&prr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := prr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	pr, err := a.warehouse.GetPasswordReset(util.HashToken(prr.Token))
+	if err != nil {
+		if err == common.ErrPasswordResetNotFound {
+			a.respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to get reset token")
+		a.respondWithError(w, http.StatusInternalServerError, "Error resetting the password")
+		return
+	}
+	if pr.UsedAt != nil || pr.ExpiresAt.Before(time.Now()) {
+		a.respondWithError(w, http.StatusBadRequest, common.ErrPasswordResetNotFound.Error())
+		return
+	}
+	user, err := a.warehouse.GetUserWithID(pr.UserID)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to get user")
+		a.respondWithError(w, http.StatusInternalServerError, "Error resetting the password")
+		return
+	}
+	if !a.checkPasswordPolicy(w, prr.Password, user) {
+		return
+	}
+	hashedPassword, err := a.util.CreateHashedPassword(prr.Password)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to hash password")
+		a.respondWithError(w, http.StatusInternalServerError, "Unable to hash password")
+		return
+	}
+	if err = a.warehouse.ResetPassword(pr, hashedPassword); err != nil {
+		if err == common.ErrPasswordResetNotFound {
+			a.respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to reset password")
+		a.respondWithError(w, http.StatusInternalServerError, "Error resetting the password")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Password has been reset"})
+}
+
+// passwordResetOptions returns the allowed options
+func (a *app) passwordResetOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// checkPasswordPolicy responds with a field error for each rule the new password breaks. If it
+// returns false the error response has already been written
+func (a *app) checkPasswordPolicy(w http.ResponseWriter, password string, user *common.User) bool {
+	fieldErrors := a.util.CheckPasswordPolicy(password, user)
+	if len(fieldErrors) == 0 {
+		return true
+	}
+	a.respondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
+		"error":  common.ErrPasswordPolicy.Error(),
+		"fields": fieldErrors,
+	})
+	return false
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/mailer"
+	"github.com/garycarr/book_club/util"
+	"github.com/garycarr/book_club/warehouse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPasswordForgotPost(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedError      error
+		expectedHTTPStatus int
+		params             map[string]string
+		registered         bool
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Registered email",
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]string{"email": validUserEmail},
+			registered:         true,
+		},
+		testData{
+			description:        "Unknown email gets the same response",
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]string{"email": "unknown@example.com"},
+		},
+		testData{
+			description:        "Email not present",
+			expectedError:      common.ErrLoginEmailNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+		},
+	}
+	resetToken := "resetToken"
+	user := &common.User{
+		ID:          validUserID,
+		Email:       validUserEmail,
+		DisplayName: validUserDisplayName,
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/password/forgot", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder := setupTest(req)
+		mockWarehouse := warehouse.MockWarehouse{}
+		mockUtil := util.MockUtil{}
+		mockMailer := mailer.MockMailer{}
+		if td.registered {
+			mockWarehouse.On("GetUserWithEmail", td.params["email"]).Return(user, nil)
+			mockUtil.On("CreateRandomToken").Return(resetToken, nil)
+			mockWarehouse.On("CreatePasswordReset", user.ID, util.HashToken(resetToken), mock.AnythingOfType("time.Time")).
+				Return(nil)
+			mockMailer.On("Send", mock.MatchedBy(func(email common.Email) bool {
+				return email.To == user.Email && bytes.Contains([]byte(email.Body), []byte(resetToken))
+			})).Return(nil)
+		} else if td.expectedError == nil {
+			mockWarehouse.On("GetUserWithEmail", td.params["email"]).Return(nil, common.ErrLoginUserNotFound)
+		}
+		a.warehouse = &mockWarehouse
+		a.util = &mockUtil
+		a.mailer = &mockMailer
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		mockUtil.AssertExpectations(t)
+		mockMailer.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+		}
+	}
+}
+
+func TestPasswordResetPost(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedError      error
+		expectedHTTPStatus int
+		params             map[string]string
+		storedReset        *common.PasswordReset
+	}
+
+	usedAt := time.Now().Add(-time.Minute)
+	testTable := []testData{
+		testData{
+			description:        "Valid reset token",
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]string{"token": "resetToken", "password": "newPassword"},
+			storedReset: &common.PasswordReset{
+				ID:        "resetID",
+				UserID:    validUserID,
+				ExpiresAt: time.Now().Add(time.Hour),
+			},
+		},
+		testData{
+			description:        "Unknown reset token",
+			expectedError:      common.ErrPasswordResetNotFound,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]string{"token": "resetToken", "password": "newPassword"},
+		},
+		testData{
+			description:        "Expired reset token",
+			expectedError:      common.ErrPasswordResetNotFound,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]string{"token": "resetToken", "password": "newPassword"},
+			storedReset: &common.PasswordReset{
+				ID:        "resetID",
+				UserID:    validUserID,
+				ExpiresAt: time.Now().Add(-time.Hour),
+			},
+		},
+		testData{
+			description:        "Used reset token",
+			expectedError:      common.ErrPasswordResetNotFound,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]string{"token": "resetToken", "password": "newPassword"},
+			storedReset: &common.PasswordReset{
+				ID:        "resetID",
+				UserID:    validUserID,
+				ExpiresAt: time.Now().Add(time.Hour),
+				UsedAt:    &usedAt,
+			},
+		},
+		testData{
+			description:        "Token not present",
+			expectedError:      common.ErrPasswordResetTokenNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]string{"password": "newPassword"},
+		},
+		testData{
+			description:        "Password not present",
+			expectedError:      common.ErrLoginPasswordNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]string{"token": "resetToken"},
+		},
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/password/reset", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder := setupTest(req)
+		mockWarehouse := warehouse.MockWarehouse{}
+		mockUtil := util.MockUtil{}
+		if td.params["token"] != "" && td.params["password"] != "" {
+			tokenHash := util.HashToken(td.params["token"])
+			if td.storedReset == nil {
+				mockWarehouse.On("GetPasswordReset", tokenHash).Return(nil, common.ErrPasswordResetNotFound)
+			} else {
+				mockWarehouse.On("GetPasswordReset", tokenHash).Return(td.storedReset, nil)
+			}
+		}
+		if td.expectedError == nil {
+			user := &common.User{ID: validUserID, Email: validUserEmail}
+			mockWarehouse.On("GetUserWithID", validUserID).Return(user, nil)
+			mockUtil.On("CheckPasswordPolicy", td.params["password"], user).Return(nil)
+			// The bcrypt does not matter here as everything is mocked
+			mockUtil.On("CreateHashedPassword", td.params["password"]).Return("hashedPassword", nil)
+			mockWarehouse.On("ResetPassword", td.storedReset, "hashedPassword").Return(nil)
+		}
+		a.warehouse = &mockWarehouse
+		a.util = &mockUtil
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		mockUtil.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+		}
+	}
+}
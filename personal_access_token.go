@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/util"
+	"github.com/gorilla/mux"
+)
+
+// userMeTokensPost creates a personal access token. The token is only ever shown in this response
+func (a *app) userMeTokensPost(w http.ResponseWriter, r *http.Request) {
+	patr := common.PersonalAccessTokenRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&patr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := patr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	randomToken, err := a.util.CreateRandomToken()
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to create personal access token")
+		a.respondWithError(w, http.StatusInternalServerError, "Error creating the personal access token")
+		return
+	}
+	token := common.PersonalAccessTokenPrefix + randomToken
+	pat := &common.PersonalAccessToken{
+		UserID:    claims.UserID,
+		Name:      patr.Name,
+		Scopes:    patr.Scopes,
+		ExpiresAt: patr.ExpiresAt,
+	}
+	if err = a.warehouse.CreatePersonalAccessToken(pat, util.HashToken(token)); err != nil {
+		a.logrus.WithError(err).Error("Unable to store personal access token")
+		a.respondWithError(w, http.StatusInternalServerError, "Error creating the personal access token")
+		return
+	}
+	a.respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"token":               token,
+		"personalAccessToken": pat,
+	})
+}
+
+// userMeTokensGet lists the personal access tokens of the user that have not been revoked
+func (a *app) userMeTokensGet(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	pats, err := a.warehouse.ListPersonalAccessTokens(claims.UserID)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to list personal access tokens")
+		a.respondWithError(w, http.StatusInternalServerError, "Error listing the personal access tokens")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string][]common.PersonalAccessToken{"personalAccessTokens": pats})
+}
+
+// userMeTokenDelete revokes a personal access token of the user
+func (a *app) userMeTokenDelete(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	if err := a.warehouse.RevokePersonalAccessToken(claims.UserID, mux.Vars(r)["tokenID"]); err != nil {
+		if err == common.ErrPersonalAccessTokenNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to revoke personal access token")
+		a.respondWithError(w, http.StatusInternalServerError, "Error revoking the personal access token")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Personal access token revoked"})
+}
+
+// userMeTokensOptions returns the allowed options
+func (a *app) userMeTokensOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// personalAccessTokenClaims checks the personal access token and builds claims from the current
+// roles of its user, as the token outlives any role change. If it returns false the response has
+// already been written
+func (a *app) personalAccessTokenClaims(w http.ResponseWriter, r *http.Request, token string) (*common.TokenClaims, bool) {
+	pat, err := a.warehouse.UsePersonalAccessToken(util.HashToken(token))
+	var user *common.User
+	if err == nil {
+		user, err = a.warehouse.GetUserWithID(pat.UserID)
+	}
+	if err != nil {
+		if err == common.ErrPersonalAccessTokenNotFound || err == common.ErrUserNotFound {
+			a.logrus.WithError(err).Debug("Invalid personal access token. Redirecting user to homepage")
+			http.Redirect(w, r, "/login", http.StatusUnauthorized)
+			return nil, false
+		}
+		a.logrus.WithError(err).Error("Unable to check personal access token")
+		a.respondWithError(w, http.StatusInternalServerError, "Error checking personal access token")
+		return nil, false
+	}
+	claims := &common.TokenClaims{
+		ID:                  pat.ID,
+		UserID:              user.ID,
+		DisplayName:         user.DisplayName,
+		EmailVerified:       user.EmailVerifiedAt != nil,
+		Roles:               user.Roles,
+		ClubRoles:           user.ClubRoles,
+		IssuedAt:            pat.CreatedAt,
+		PersonalAccessToken: true,
+		Scopes:              pat.Scopes,
+	}
+	if pat.ExpiresAt != nil {
+		claims.ExpiresAt = *pat.ExpiresAt
+	}
+	return claims, true
+}
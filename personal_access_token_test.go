@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/util"
+	"github.com/garycarr/book_club/warehouse"
+	"github.com/justinas/alice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestUserMeTokensPost(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedError      error
+		expectedHTTPStatus int
+		params             map[string]interface{}
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Creates a token",
+			expectedHTTPStatus: http.StatusCreated,
+			params:             map[string]interface{}{"name": "deploy script", "scopes": []string{common.PermissionClubRead}},
+		},
+		testData{
+			description:        "Creates a token that expires",
+			expectedHTTPStatus: http.StatusCreated,
+			params: map[string]interface{}{"name": "deploy script", "scopes": []string{common.PermissionClubRead},
+				"expiresAt": time.Now().Add(time.Hour)},
+		},
+		testData{
+			description:        "Creates a token with a scope that is not a permission",
+			expectedHTTPStatus: http.StatusCreated,
+			params:             map[string]interface{}{"name": "reading log", "scopes": []string{common.ScopeUserRead}},
+		},
+		testData{
+			description:        "Name not present",
+			expectedError:      common.ErrPersonalAccessTokenNameNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"scopes": []string{common.PermissionClubRead}},
+		},
+		testData{
+			description:        "Scopes not present",
+			expectedError:      common.ErrPersonalAccessTokenScopesNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"name": "deploy script"},
+		},
+		testData{
+			description:        "Unknown scope",
+			expectedError:      common.ErrPersonalAccessTokenScopeInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"name": "deploy script", "scopes": []string{"everything"}},
+		},
+		testData{
+			description:        "Expiry in the past",
+			expectedError:      common.ErrPersonalAccessTokenExpiryInPast,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params: map[string]interface{}{"name": "deploy script", "scopes": []string{common.PermissionClubRead},
+				"expiresAt": time.Now().Add(-time.Hour)},
+		},
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/user/me/tokens", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupTOTPTest(req)
+		if td.expectedError == nil {
+			mockUtil.On("CreateRandomToken").Return("randomToken", nil)
+			mockWarehouse.On("CreatePersonalAccessToken", mock.MatchedBy(func(pat *common.PersonalAccessToken) bool {
+				return pat.UserID == validUserID && pat.Name == td.params["name"]
+			}), util.HashToken("pat_randomToken")).Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		jsonResp := map[string]interface{}{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		if td.expectedError != nil {
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+			continue
+		}
+		assert.Equal(t, "pat_randomToken", jsonResp["token"], td.description)
+	}
+}
+
+func TestUserMeTokensGet(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/user/me/tokens", nil)
+	if err != nil {
+		t.Fatalf("Error creating new request: %v", err)
+	}
+	a, responseRecorder, mockUtil, mockWarehouse := setupTOTPTest(req)
+	pats := []common.PersonalAccessToken{
+		common.PersonalAccessToken{ID: "patID", Name: "deploy script", Scopes: []string{common.PermissionClubRead}},
+	}
+	mockWarehouse.On("ListPersonalAccessTokens", validUserID).Return(pats, nil)
+
+	a.Router.ServeHTTP(responseRecorder, req)
+	mockUtil.AssertExpectations(t)
+	mockWarehouse.AssertExpectations(t)
+	if !assert.Equal(t, http.StatusOK, responseRecorder.Code) {
+		return
+	}
+	jsonResp := map[string][]common.PersonalAccessToken{}
+	if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+		t.Fatalf("Unable to decode JSON response: %v", err)
+	}
+	assert.Equal(t, pats, jsonResp["personalAccessTokens"])
+}
+
+func TestUserMeTokenDelete(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedHTTPStatus int
+		revokeError        error
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Revokes the token",
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description:        "Unknown token",
+			expectedHTTPStatus: http.StatusNotFound,
+			revokeError:        common.ErrPersonalAccessTokenNotFound,
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodDelete, "/user/me/tokens/patID", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupTOTPTest(req)
+		mockWarehouse.On("RevokePersonalAccessToken", validUserID, "patID").Return(td.revokeError)
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
+
+func TestPersonalAccessTokenAuth(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedError      error
+		expectedHTTPStatus int
+		method             string
+		path               string
+		patError           error
+		scopes             []string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Valid token",
+			expectedHTTPStatus: http.StatusOK,
+			method:             http.MethodGet,
+			path:               "/user/me",
+			scopes:             []string{common.ScopeUserRead},
+		},
+		testData{
+			description:        "Token without the scope",
+			expectedError:      common.ErrPermissionDenied,
+			expectedHTTPStatus: http.StatusForbidden,
+			method:             http.MethodGet,
+			path:               "/user/me",
+			scopes:             []string{common.PermissionClubRead},
+		},
+		testData{
+			description:        "Revoked or expired token",
+			expectedHTTPStatus: http.StatusUnauthorized,
+			method:             http.MethodGet,
+			path:               "/user/me",
+			patError:           common.ErrPersonalAccessTokenNotFound,
+		},
+		testData{
+			description:        "Tokens can not create tokens",
+			expectedHTTPStatus: http.StatusForbidden,
+			method:             http.MethodPost,
+			path:               "/user/me/tokens",
+		},
+		testData{
+			description:        "Tokens can not change the password",
+			expectedHTTPStatus: http.StatusForbidden,
+			method:             http.MethodPut,
+			path:               "/user/me/password",
+		},
+		testData{
+			description:        "Tokens can not export the account",
+			expectedHTTPStatus: http.StatusForbidden,
+			method:             http.MethodGet,
+			path:               "/user/me/export",
+			scopes:             []string{common.ScopeUserRead},
+		},
+		testData{
+			description:        "Tokens can not be used on a route without a scope",
+			expectedHTTPStatus: http.StatusForbidden,
+			method:             http.MethodGet,
+			path:               "/test/unscoped",
+			scopes:             []string{common.PermissionClubRead, common.ScopeUserRead},
+		},
+	}
+	verifiedAt := time.Now()
+	user := &common.User{ID: validUserID, Email: validUserEmail, EmailVerifiedAt: &verifiedAt}
+	for _, td := range testTable {
+		req, err := http.NewRequest(td.method, td.path, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		req.Header.Add("Authorization", "Bearer pat_randomToken")
+		a, responseRecorder := setupTest(req)
+		mockWarehouse := warehouse.MockWarehouse{}
+		if td.patError != nil {
+			mockWarehouse.On("UsePersonalAccessToken", util.HashToken("pat_randomToken")).Return(nil, td.patError)
+		} else {
+			pat := &common.PersonalAccessToken{ID: "patID", UserID: validUserID, Scopes: td.scopes}
+			mockWarehouse.On("UsePersonalAccessToken", util.HashToken("pat_randomToken")).Return(pat, nil)
+			mockWarehouse.On("GetUserWithID", validUserID).Return(user, nil)
+		}
+		mockUtil := util.MockUtil{}
+		a.warehouse = &mockWarehouse
+		a.util = &mockUtil
+		a.Router.Handle("/test/unscoped", alice.New(a.authMiddleware).ThenFunc(a.homePageGet))
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			continue
+		}
+		if td.expectedHTTPStatus == http.StatusForbidden {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			expectedError := common.ErrPersonalAccessTokenNotAllowed
+			if td.expectedError != nil {
+				expectedError = td.expectedError
+			}
+			assert.Equal(t, expectedError.Error(), jsonResp["error"], td.description)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/tally"
+	"github.com/gorilla/mux"
+)
+
+// clubNominationsGet lists the books nominated in a club a page at a time, in the order they were
+// nominated
+func (a *app) clubNominationsGet(w http.ResponseWriter, r *http.Request) {
+	pagination, ok := a.requestPagination(w, r)
+	if !ok {
+		return
+	}
+	nominations, total, err := a.warehouse.ListNominations(mux.Vars(r)["clubID"], pagination)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to list nominations")
+		a.respondWithError(w, http.StatusInternalServerError, "Error listing the nominations")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"nominations": nominations,
+		"total":       total,
+		"limit":       pagination.Limit,
+		"offset":      pagination.Offset,
+	})
+}
+
+// clubNominationsPost nominates a book from the catalog for the club to read, each book is nominated
+// once per club
+func (a *app) clubNominationsPost(w http.ResponseWriter, r *http.Request) {
+	nr := common.NominationRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&nr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := nr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	book, ok := a.lookupBook(w, nr.BookID)
+	if !ok {
+		return
+	}
+	nomination := &common.Nomination{ClubID: mux.Vars(r)["clubID"], BookID: book.ID, BookTitle: book.Title,
+		NominatedBy: claims.UserID, DisplayName: claims.DisplayName, Note: nr.Note}
+	if err := a.warehouse.CreateNomination(nomination); err != nil {
+		switch err {
+		case common.ErrNominationAlreadyExists:
+			a.respondWithError(w, http.StatusConflict, err.Error())
+		case common.ErrBookNotFound:
+			a.respondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			a.logrus.WithError(err).Error("Unable to create nomination")
+			a.respondWithError(w, http.StatusInternalServerError, "Error creating the nomination")
+		}
+		return
+	}
+	a.respondWithJSON(w, http.StatusCreated, nomination)
+}
+
+// clubNominationsOptions returns the allowed options
+func (a *app) clubNominationsOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubNominationDelete withdraws a nomination, only the member who made it or a moderator can. Polls
+// the book is already in keep it
+func (a *app) clubNominationDelete(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	vars := mux.Vars(r)
+	nomination, err := a.warehouse.GetNomination(vars["clubID"], vars["nominationID"])
+	if err == nil && !authorOrModerator(claims, nomination.ClubID, nomination.NominatedBy) {
+		a.respondWithPermissionDenied(w, common.PermissionClubModerate)
+		return
+	}
+	if err == nil {
+		err = a.warehouse.DeleteNomination(nomination.ClubID, nomination.ID)
+	}
+	if err != nil {
+		if err == common.ErrNominationNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to delete nomination")
+		a.respondWithError(w, http.StatusInternalServerError, "Error deleting the nomination")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Nomination withdrawn"})
+}
+
+// clubNominationOptions returns the allowed options
+func (a *app) clubNominationOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubPollsGet lists the polls of a club a page at a time, the latest to close first
+func (a *app) clubPollsGet(w http.ResponseWriter, r *http.Request) {
+	pagination, ok := a.requestPagination(w, r)
+	if !ok {
+		return
+	}
+	polls, total, err := a.warehouse.ListPolls(mux.Vars(r)["clubID"], pagination)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to list polls")
+		a.respondWithError(w, http.StatusInternalServerError, "Error listing the polls")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"polls":  polls,
+		"total":  total,
+		"limit":  pagination.Limit,
+		"offset": pagination.Offset,
+	})
+}
+
+// clubPollsPost creates a poll between nominated books of a club
+func (a *app) clubPollsPost(w http.ResponseWriter, r *http.Request) {
+	pr := common.PollRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := pr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	poll := &common.Poll{ClubID: mux.Vars(r)["clubID"], CreatedBy: claims.UserID}
+	if err := pr.Apply(poll, time.Now()); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	if err := a.warehouse.CreatePoll(poll, pr.BookIDs); err != nil {
+		switch err {
+		case common.ErrPollOptionNotNominated, common.ErrPollTooFewOptions:
+			a.respondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			a.logrus.WithError(err).Error("Unable to create poll")
+			a.respondWithError(w, http.StatusInternalServerError, "Error creating the poll")
+		}
+		return
+	}
+	a.respondWithJSON(w, http.StatusCreated, poll)
+}
+
+// clubPollsOptions returns the allowed options
+func (a *app) clubPollsOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubPollGet returns a poll with its options
+func (a *app) clubPollGet(w http.ResponseWriter, r *http.Request) {
+	poll, ok := a.requestPoll(w, r)
+	if !ok {
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, poll)
+}
+
+// clubPollDelete removes a poll and its ballots
+func (a *app) clubPollDelete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := a.warehouse.DeletePoll(vars["clubID"], vars["pollID"]); err != nil {
+		if err == common.ErrPollNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to delete poll")
+		a.respondWithError(w, http.StatusInternalServerError, "Error deleting the poll")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Poll deleted"})
+}
+
+// clubPollOptions returns the allowed options
+func (a *app) clubPollOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubPollClosePost closes an open poll before its close time
+func (a *app) clubPollClosePost(w http.ResponseWriter, r *http.Request) {
+	poll, ok := a.requestPoll(w, r)
+	if !ok {
+		return
+	}
+	if err := a.warehouse.ClosePoll(poll); err != nil {
+		if err == common.ErrPollNotOpen {
+			a.respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to close poll")
+		a.respondWithError(w, http.StatusInternalServerError, "Error closing the poll")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, poll)
+}
+
+// clubPollCloseOptions returns the allowed options
+func (a *app) clubPollCloseOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubPollBallotGet returns the ballot the current user cast in a poll
+func (a *app) clubPollBallotGet(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	poll, ok := a.requestPoll(w, r)
+	if !ok {
+		return
+	}
+	ballot, err := a.warehouse.GetBallot(poll.ID, claims.UserID)
+	if err != nil {
+		if err == common.ErrBallotNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to get ballot")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the ballot")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, ballot)
+}
+
+// clubPollBallotPut casts the ballot of the current user in an open poll, or replaces the one they
+// cast
+func (a *app) clubPollBallotPut(w http.ResponseWriter, r *http.Request) {
+	br := common.BallotRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&br); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	poll, ok := a.requestPoll(w, r)
+	if !ok {
+		return
+	}
+	if poll.Status != common.PollStatusOpen {
+		a.respondWithError(w, http.StatusConflict, common.ErrPollNotOpen.Error())
+		return
+	}
+	if err := br.ValidateRequest(poll); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	ballot := &common.Ballot{PollID: poll.ID, UserID: claims.UserID, Choices: br.Choices}
+	if err := a.warehouse.SetBallot(ballot); err != nil {
+		if err == common.ErrPollNotOpen {
+			a.respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to save ballot")
+		a.respondWithError(w, http.StatusInternalServerError, "Error saving the ballot")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, ballot)
+}
+
+// clubPollBallotDelete takes back the ballot of the current user while the poll is open
+func (a *app) clubPollBallotDelete(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	poll, ok := a.requestPoll(w, r)
+	if !ok {
+		return
+	}
+	if poll.Status != common.PollStatusOpen {
+		a.respondWithError(w, http.StatusConflict, common.ErrPollNotOpen.Error())
+		return
+	}
+	if err := a.warehouse.DeleteBallot(poll.ID, claims.UserID); err != nil {
+		if err == common.ErrBallotNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to delete ballot")
+		a.respondWithError(w, http.StatusInternalServerError, "Error deleting the ballot")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Ballot withdrawn"})
+}
+
+// clubPollBallotOptions returns the allowed options
+func (a *app) clubPollBallotOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubPollResultsGet tallies the ballots of a poll. While a poll is open the results so far are
+// shown, unless the poll hides them until it closes
+func (a *app) clubPollResultsGet(w http.ResponseWriter, r *http.Request) {
+	poll, ok := a.requestPoll(w, r)
+	if !ok {
+		return
+	}
+	if !poll.ResultsVisible() {
+		a.respondWithError(w, http.StatusForbidden, common.ErrPollResultsHidden.Error())
+		return
+	}
+	ballots, err := a.warehouse.ListBallots(poll.ID)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to list ballots")
+		a.respondWithError(w, http.StatusInternalServerError, "Error listing the ballots")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  poll.Status,
+		"options": poll.Options,
+		"result":  tally.Count(poll, ballots),
+	})
+}
+
+// clubPollResultsOptions returns the allowed options
+func (a *app) clubPollResultsOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// requestPoll loads the poll of the club in the route. If it returns false the error response has
+// already been written
+func (a *app) requestPoll(w http.ResponseWriter, r *http.Request) (*common.Poll, bool) {
+	vars := mux.Vars(r)
+	poll, err := a.warehouse.GetPoll(vars["clubID"], vars["pollID"])
+	if err != nil {
+		if err == common.ErrPollNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return nil, false
+		}
+		a.logrus.WithError(err).Error("Unable to get poll")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the poll")
+		return nil, false
+	}
+	return poll, true
+}
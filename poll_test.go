@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// validPoll is an open poll between two books
+func validPoll(method string) *common.Poll {
+	return &common.Poll{ID: "pollID", ClubID: "clubID", Title: "Next book", Method: method,
+		Options:  []common.PollOption{{BookID: "bookID", Title: "Dune"}, {BookID: "otherBookID", Title: "Emma"}},
+		OpensAt:  time.Now().Add(-time.Hour).UTC(),
+		ClosesAt: time.Now().Add(time.Hour).UTC(),
+		Status:   common.PollStatusOpen}
+}
+
+func TestClubPollsPost(t *testing.T) {
+	type testData struct {
+		description        string
+		createError        error
+		expectedError      error
+		expectedHTTPStatus int
+		params             map[string]interface{}
+		role               string
+	}
+
+	closesAt := time.Now().Add(48 * time.Hour).UTC().Format(time.RFC3339)
+	testTable := []testData{
+		testData{
+			description:        "Every nomination",
+			expectedHTTPStatus: http.StatusCreated,
+			params:             map[string]interface{}{"title": "Next book", "method": "ranked", "closesAt": closesAt},
+			role:               common.ClubRoleModerator,
+		},
+		testData{
+			description:        "Chosen books",
+			expectedHTTPStatus: http.StatusCreated,
+			params: map[string]interface{}{"title": "Next book", "method": "approval", "closesAt": closesAt,
+				"bookIDs": []string{"otherBookID", "bookID"}, "hideResults": true},
+			role: common.ClubRoleOwner,
+		},
+		testData{
+			description:        "Members can not create polls",
+			expectedHTTPStatus: http.StatusForbidden,
+			params:             map[string]interface{}{"title": "Next book", "method": "single", "closesAt": closesAt},
+			role:               common.ClubRoleMember,
+		},
+		testData{
+			description:        "Unknown method",
+			expectedError:      common.ErrPollMethodInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"title": "Next book", "method": "borda", "closesAt": closesAt},
+			role:               common.ClubRoleModerator,
+		},
+		testData{
+			description:        "Closes in the past",
+			expectedError:      common.ErrPollClosesBeforeOpen,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"title": "Next book", "method": "single", "closesAt": "2020-01-01T00:00:00Z"},
+			role:               common.ClubRoleModerator,
+		},
+		testData{
+			description:        "Book not nominated",
+			createError:        common.ErrPollOptionNotNominated,
+			expectedError:      common.ErrPollOptionNotNominated,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params: map[string]interface{}{"title": "Next book", "method": "single", "closesAt": closesAt,
+				"bookIDs": []string{"otherBookID", "bookID"}},
+			role: common.ClubRoleModerator,
+		},
+		testData{
+			description:        "One book",
+			expectedError:      common.ErrPollTooFewOptions,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params: map[string]interface{}{"title": "Next book", "method": "single", "closesAt": closesAt,
+				"bookIDs": []string{"bookID"}},
+			role: common.ClubRoleModerator,
+		},
+	}
+	for _, td := range testTable {
+		body, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/clubs/clubID/polls", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(td.role))
+		if td.expectedHTTPStatus == http.StatusCreated || td.createError != nil {
+			var bookIDs []string
+			if ids, ok := td.params["bookIDs"]; ok {
+				bookIDs = ids.([]string)
+			}
+			mockWarehouse.On("CreatePoll", mock.MatchedBy(func(p *common.Poll) bool {
+				return p.ClubID == "clubID" && p.CreatedBy == validUserID && p.Method == td.params["method"] &&
+					p.Status == common.PollStatusOpen && p.ClosesAt.Format(time.RFC3339) == closesAt &&
+					p.HideResults == (td.params["hideResults"] == true)
+			}), bookIDs).Return(td.createError)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+		}
+	}
+}
+
+func TestClubPollBallotPut(t *testing.T) {
+	type testData struct {
+		description        string
+		choices            []string
+		expectedError      error
+		expectedHTTPStatus int
+		method             string
+		setError           error
+		status             string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Single choice",
+			choices:            []string{"otherBookID"},
+			expectedHTTPStatus: http.StatusOK,
+			method:             common.PollMethodSingle,
+			status:             common.PollStatusOpen,
+		},
+		testData{
+			description:        "Ranked",
+			choices:            []string{"otherBookID", "bookID"},
+			expectedHTTPStatus: http.StatusOK,
+			method:             common.PollMethodRanked,
+			status:             common.PollStatusOpen,
+		},
+		testData{
+			description:        "Two books in a single choice poll",
+			choices:            []string{"otherBookID", "bookID"},
+			expectedError:      common.ErrBallotSingleChoice,
+			expectedHTTPStatus: http.StatusBadRequest,
+			method:             common.PollMethodSingle,
+			status:             common.PollStatusOpen,
+		},
+		testData{
+			description:        "Book not in the poll",
+			choices:            []string{"bookID", "thirdBookID"},
+			expectedError:      common.ErrBallotChoiceInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			method:             common.PollMethodApproval,
+			status:             common.PollStatusOpen,
+		},
+		testData{
+			description:        "Book ranked twice",
+			choices:            []string{"bookID", "bookID"},
+			expectedError:      common.ErrBallotChoiceRepeated,
+			expectedHTTPStatus: http.StatusBadRequest,
+			method:             common.PollMethodRanked,
+			status:             common.PollStatusOpen,
+		},
+		testData{
+			description:        "Not open yet",
+			choices:            []string{"bookID"},
+			expectedError:      common.ErrPollNotOpen,
+			expectedHTTPStatus: http.StatusConflict,
+			method:             common.PollMethodSingle,
+			status:             common.PollStatusUpcoming,
+		},
+		testData{
+			description:        "Closed while voting",
+			choices:            []string{"bookID"},
+			expectedError:      common.ErrPollNotOpen,
+			expectedHTTPStatus: http.StatusConflict,
+			method:             common.PollMethodSingle,
+			setError:           common.ErrPollNotOpen,
+			status:             common.PollStatusOpen,
+		},
+	}
+	for _, td := range testTable {
+		body, err := json.Marshal(map[string][]string{"choices": td.choices})
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPut, "/clubs/clubID/polls/pollID/ballot", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(common.ClubRoleMember))
+		poll := validPoll(td.method)
+		poll.Status = td.status
+		mockWarehouse.On("GetPoll", "clubID", "pollID").Return(poll, nil)
+		if td.expectedHTTPStatus == http.StatusOK || td.setError != nil {
+			mockWarehouse.On("SetBallot", &common.Ballot{PollID: "pollID", UserID: validUserID, Choices: td.choices}).
+				Return(td.setError)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+		}
+	}
+}
+
+func TestClubPollResultsGet(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedHTTPStatus int
+		hideResults        bool
+		status             string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Results so far",
+			expectedHTTPStatus: http.StatusOK,
+			status:             common.PollStatusOpen,
+		},
+		testData{
+			description:        "Hidden until the poll closes",
+			expectedHTTPStatus: http.StatusForbidden,
+			hideResults:        true,
+			status:             common.PollStatusOpen,
+		},
+		testData{
+			description:        "Shown once closed",
+			expectedHTTPStatus: http.StatusOK,
+			hideResults:        true,
+			status:             common.PollStatusClosed,
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodGet, "/clubs/clubID/polls/pollID/results", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(common.ClubRoleMember))
+		poll := validPoll(common.PollMethodRanked)
+		poll.HideResults, poll.Status = td.hideResults, td.status
+		mockWarehouse.On("GetPoll", "clubID", "pollID").Return(poll, nil)
+		if td.expectedHTTPStatus == http.StatusOK {
+			mockWarehouse.On("ListBallots", "pollID").Return([]common.Ballot{
+				{Choices: []string{"bookID"}},
+				{Choices: []string{"otherBookID", "bookID"}},
+				{Choices: []string{"otherBookID"}},
+			}, nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedHTTPStatus != http.StatusOK {
+			continue
+		}
+		jsonResp := struct {
+			Status string            `json:"status"`
+			Result common.PollResult `json:"result"`
+		}{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		assert.Equal(t, td.status, jsonResp.Status, td.description)
+		assert.Equal(t, 3, jsonResp.Result.Ballots, td.description)
+		assert.Equal(t, "otherBookID", jsonResp.Result.Winner, td.description)
+	}
+}
+
+func TestClubNominationDelete(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedHTTPStatus int
+		nominatedBy        string
+		role               string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Own nomination",
+			expectedHTTPStatus: http.StatusOK,
+			nominatedBy:        validUserID,
+			role:               common.ClubRoleMember,
+		},
+		testData{
+			description:        "Moderators can withdraw any nomination",
+			expectedHTTPStatus: http.StatusOK,
+			nominatedBy:        "otherUserID",
+			role:               common.ClubRoleModerator,
+		},
+		testData{
+			description:        "Members can not withdraw the nominations of others",
+			expectedHTTPStatus: http.StatusForbidden,
+			nominatedBy:        "otherUserID",
+			role:               common.ClubRoleMember,
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodDelete, "/clubs/clubID/nominations/nominationID", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(td.role))
+		mockWarehouse.On("GetNomination", "clubID", "nominationID").Return(&common.Nomination{ID: "nominationID",
+			ClubID: "clubID", BookID: "bookID", NominatedBy: td.nominatedBy}, nil)
+		if td.expectedHTTPStatus == http.StatusOK {
+			mockWarehouse.On("DeleteNomination", "clubID", "nominationID").Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/util"
+)
+
+// userMeGet returns the profile of the current user
+func (a *app) userMeGet(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.requestUser(w, r)
+	if !ok {
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, user.Profile())
+}
+
+// userMePatch changes the display name, email, bio or time zone of the current user. A new email needs the
+// current password and stays pending until it is verified, the user keeps the old email until then.
+// Sending the current email again cancels a pending change
+func (a *app) userMePatch(w http.ResponseWriter, r *http.Request) {
+	uur := common.UserUpdateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&uur); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := uur.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	user, ok := a.requestUser(w, r)
+	if !ok {
+		return
+	}
+	emailChanged := uur.Email != nil && *uur.Email != user.Email && *uur.Email != user.PendingEmail
+	if emailChanged {
+		if uur.CurrentPassword == "" {
+			a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", common.ErrPasswordCurrentNotPresent))
+			return
+		}
+		if !a.checkCurrentPassword(w, user, uur.CurrentPassword, "Error updating the user") {
+			return
+		}
+	}
+	if uur.DisplayName != nil {
+		user.DisplayName = *uur.DisplayName
+	}
+	if uur.Email != nil {
+		user.PendingEmail = *uur.Email
+		if *uur.Email == user.Email {
+			user.PendingEmail = ""
+		}
+	}
+	if uur.Bio != nil {
+		user.Bio = *uur.Bio
+	}
+	if uur.TimeZone != nil {
+		user.TimeZone = *uur.TimeZone
+	}
+	if err := a.warehouse.UpdateUser(user, emailChanged); err != nil {
+		if err == common.ErrLoginUserAlreadyExists {
+			a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Email %s is already registered", user.PendingEmail))
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to update user")
+		a.respondWithError(w, http.StatusInternalServerError, "Error updating the user")
+		return
+	}
+	if emailChanged {
+		if err := a.sendEmailVerification(user, user.PendingEmail); err != nil {
+			// The change is saved, the user can ask for the email again
+			a.logrus.WithError(err).Error("Unable to send verification email")
+		}
+		if err := a.sendEmailChangeNotice(user); err != nil {
+			a.logrus.WithError(err).Error("Unable to send email change notice")
+		}
+	}
+	a.respondWithJSON(w, http.StatusOK, user.Profile())
+}
+
+// userMeDelete soft deletes the current user and ends all of their sessions
+func (a *app) userMeDelete(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	if err := a.warehouse.DeleteUser(claims.UserID); err != nil {
+		if err == common.ErrUserNotFound {
+			a.respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to delete user")
+		a.respondWithError(w, http.StatusInternalServerError, "Error deleting the user")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Account deleted"})
+}
+
+// userMeOptions returns the allowed options
+func (a *app) userMeOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// userMePasswordPut changes the password of the current user once the current password is checked.
+// Every session is ended, including this one, so the user has to log in again
+func (a *app) userMePasswordPut(w http.ResponseWriter, r *http.Request) {
+	pcr := common.PasswordChangeRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&pcr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := pcr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	user, ok := a.requestUser(w, r)
+	if !ok {
+		return
+	}
+	if !a.checkCurrentPassword(w, user, pcr.CurrentPassword, "Error changing the password") {
+		return
+	}
+	if !a.checkPasswordPolicy(w, pcr.NewPassword, user) {
+		return
+	}
+	hashedPassword, err := a.util.CreateHashedPassword(pcr.NewPassword)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to hash password")
+		a.respondWithError(w, http.StatusInternalServerError, "Unable to hash password")
+		return
+	}
+	if err = a.warehouse.ChangePassword(user.ID, hashedPassword); err != nil {
+		a.logrus.WithError(err).Error("Unable to change password")
+		a.respondWithError(w, http.StatusInternalServerError, "Error changing the password")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Password has been changed, log in again"})
+}
+
+// userMePasswordOptions returns the allowed options
+func (a *app) userMePasswordOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// checkCurrentPassword checks the password the user gave before a sensitive change. If it returns false
+// the error response has already been written, errMessage is used when the check itself fails
+func (a *app) checkCurrentPassword(w http.ResponseWriter, user *common.User, password, errMessage string) bool {
+	if err := a.util.CheckHashedPassword(user.Password, password); err != nil {
+		if err == util.ErrPasswordMismatch {
+			a.respondWithError(w, http.StatusUnauthorized, common.ErrPasswordIncorrect.Error())
+			return false
+		}
+		a.logrus.WithError(err).Error("Unable to check password")
+		a.respondWithError(w, http.StatusInternalServerError, errMessage)
+		return false
+	}
+	return true
+}
+
+// sendEmailChangeNotice tells the user at their current email that a change to the pending email was
+// asked for, so they can stop it if it was not them
+func (a *app) sendEmailChangeNotice(user *common.User) error {
+	return a.mailer.Send(common.Email{
+		To:      user.Email,
+		Subject: "Your book club email is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nA change of your email to %s was asked for, it takes effect once the new email is verified.\n\n"+
+			"If this was not you, change your password and set your email back to %s to cancel the change.\n",
+			user.DisplayName, user.PendingEmail, user.Email),
+	})
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/mailer"
+	"github.com/garycarr/book_club/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestUserMeGet(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/user/me", nil)
+	if err != nil {
+		t.Fatalf("Error creating new request: %v", err)
+	}
+	a, responseRecorder, mockUtil, mockWarehouse := setupTOTPTest(req)
+	user := &common.User{
+		ID:          validUserID,
+		Email:       validUserEmail,
+		Password:    "hashedPassword",
+		DisplayName: validUserDisplayName,
+		Bio:         "Reads a lot",
+		TOTPSecret:  "encrypted",
+		Roles:       []string{common.RoleMember},
+	}
+	mockWarehouse.On("GetUserWithID", validUserID).Return(user, nil)
+
+	a.Router.ServeHTTP(responseRecorder, req)
+	mockUtil.AssertExpectations(t)
+	mockWarehouse.AssertExpectations(t)
+	if !assert.Equal(t, http.StatusOK, responseRecorder.Code) {
+		return
+	}
+	assert.NotContains(t, responseRecorder.Body.String(), "hashedPassword")
+	assert.NotContains(t, responseRecorder.Body.String(), "encrypted")
+	profile := common.UserProfile{}
+	if err = json.NewDecoder(responseRecorder.Body).Decode(&profile); err != nil {
+		t.Fatalf("Unable to decode JSON response: %v", err)
+	}
+	assert.Equal(t, user.Profile(), profile)
+}
+
+func TestUserMePatch(t *testing.T) {
+	type testData struct {
+		description          string
+		emailChanged         bool
+		expectedError        error
+		expectedHTTPStatus   int
+		expectedPendingEmail string
+		params               map[string]string
+		passwordError        error
+		pendingEmail         string
+		updateError          error
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Changes the display name and bio",
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]string{"displayName": "Gary C", "bio": "Reads a lot"},
+		},
+		testData{
+			description:          "Changes the email once it is verified",
+			emailChanged:         true,
+			expectedHTTPStatus:   http.StatusOK,
+			expectedPendingEmail: "new@example.com",
+			params:               map[string]string{"email": "new@example.com", "currentPassword": validUserPassword},
+		},
+		testData{
+			description:        "Email change without the current password",
+			expectedError:      common.ErrPasswordCurrentNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]string{"email": "new@example.com"},
+		},
+		testData{
+			description:        "Email change with the wrong current password",
+			expectedError:      common.ErrPasswordIncorrect,
+			expectedHTTPStatus: http.StatusUnauthorized,
+			params:             map[string]string{"email": "new@example.com", "currentPassword": "wrong"},
+			passwordError:      util.ErrPasswordMismatch,
+		},
+		testData{
+			description:        "Same email is not a change",
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]string{"email": validUserEmail},
+		},
+		testData{
+			description:          "Pending email again is not a change",
+			expectedHTTPStatus:   http.StatusOK,
+			expectedPendingEmail: "new@example.com",
+			params:               map[string]string{"email": "new@example.com"},
+			pendingEmail:         "new@example.com",
+		},
+		testData{
+			description:        "Same email cancels the pending change",
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]string{"email": validUserEmail},
+			pendingEmail:       "new@example.com",
+		},
+		testData{
+			description:        "Email already registered",
+			emailChanged:       true,
+			expectedError:      common.ErrLoginUserAlreadyExists,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]string{"email": "taken@example.com", "currentPassword": validUserPassword},
+			updateError:        common.ErrLoginUserAlreadyExists,
+		},
+		testData{
+			description:        "Empty display name",
+			expectedError:      common.ErrUserDisplayNameNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]string{"displayName": ""},
+		},
+		testData{
+			description:        "No fields",
+			expectedError:      common.ErrUserUpdateNoFields,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]string{},
+		},
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPatch, "/user/me", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupTOTPTest(req)
+		mockMailer := mailer.MockMailer{}
+		a.mailer = &mockMailer
+		user := &common.User{ID: validUserID, Email: validUserEmail, DisplayName: validUserDisplayName,
+			Password: "hashedPassword", PendingEmail: td.pendingEmail}
+		if _, ok := td.params["email"]; ok || td.expectedHTTPStatus == http.StatusOK {
+			mockWarehouse.On("GetUserWithID", validUserID).Return(user, nil)
+		}
+		if td.params["currentPassword"] != "" {
+			mockUtil.On("CheckHashedPassword", user.Password, td.params["currentPassword"]).Return(td.passwordError)
+		}
+		if td.expectedHTTPStatus == http.StatusOK || td.updateError != nil {
+			mockWarehouse.On("UpdateUser", mock.MatchedBy(func(u *common.User) bool {
+				return u.Email == validUserEmail && u.PendingEmail == td.expectedPendingEmail ||
+					td.updateError != nil
+			}), td.emailChanged).Return(td.updateError)
+		}
+		if td.emailChanged && td.updateError == nil {
+			mockUtil.On("CreateRandomToken").Return("verifyToken", nil)
+			mockWarehouse.On("CreateEmailVerification", validUserID, td.params["email"], util.HashToken("verifyToken"),
+				mock.AnythingOfType("time.Time")).Return(nil)
+			mockMailer.On("Send", mock.MatchedBy(func(email common.Email) bool {
+				return email.To == td.params["email"] && strings.Contains(email.Body, "verifyToken")
+			})).Return(nil)
+			// The old email is told about the change
+			mockMailer.On("Send", mock.MatchedBy(func(email common.Email) bool {
+				return email.To == validUserEmail && strings.Contains(email.Body, td.params["email"])
+			})).Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		mockMailer.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			if td.expectedError == common.ErrLoginUserAlreadyExists {
+				assert.Contains(t, jsonResp["error"], "is already registered", td.description)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+			continue
+		}
+		profile := common.UserProfile{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&profile); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		if displayName, ok := td.params["displayName"]; ok {
+			assert.Equal(t, displayName, profile.DisplayName, td.description)
+		}
+		assert.Equal(t, validUserEmail, profile.Email, td.description)
+		assert.Equal(t, td.expectedPendingEmail, profile.PendingEmail, td.description)
+	}
+}
+
+func TestUserMePasswordPut(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedError      error
+		expectedHTTPStatus int
+		params             map[string]string
+		passwordError      error
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Changes the password",
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]string{"currentPassword": validUserPassword, "newPassword": "newPassword"},
+		},
+		testData{
+			description:        "Wrong current password",
+			expectedError:      common.ErrPasswordIncorrect,
+			expectedHTTPStatus: http.StatusUnauthorized,
+			params:             map[string]string{"currentPassword": "wrong", "newPassword": "newPassword"},
+			passwordError:      util.ErrPasswordMismatch,
+		},
+		testData{
+			description:        "Current password not present",
+			expectedError:      common.ErrPasswordCurrentNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]string{"newPassword": "newPassword"},
+		},
+		testData{
+			description:        "New password not present",
+			expectedError:      common.ErrLoginPasswordNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]string{"currentPassword": validUserPassword},
+		},
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPut, "/user/me/password", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupTOTPTest(req)
+		user := &common.User{ID: validUserID, Email: validUserEmail, Password: "hashedPassword"}
+		if td.params["currentPassword"] != "" && td.params["newPassword"] != "" {
+			mockWarehouse.On("GetUserWithID", validUserID).Return(user, nil)
+			mockUtil.On("CheckHashedPassword", user.Password, td.params["currentPassword"]).Return(td.passwordError)
+		}
+		if td.expectedError == nil {
+			mockUtil.On("CheckPasswordPolicy", td.params["newPassword"], user).Return(nil)
+			mockUtil.On("CreateHashedPassword", td.params["newPassword"]).Return("newHashedPassword", nil)
+			mockWarehouse.On("ChangePassword", validUserID, "newHashedPassword").Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+		}
+	}
+}
+
+func TestUserMeDelete(t *testing.T) {
+	type testData struct {
+		description        string
+		deleteError        error
+		expectedHTTPStatus int
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Deletes the user",
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description:        "User already deleted",
+			deleteError:        common.ErrUserNotFound,
+			expectedHTTPStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodDelete, "/user/me", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupTOTPTest(req)
+		mockWarehouse.On("DeleteUser", validUserID).Return(td.deleteError)
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/gorilla/mux"
+)
+
+// clubPlansPost adds a reading plan to a club from sections written by hand
+func (a *app) clubPlansPost(w http.ResponseWriter, r *http.Request) {
+	rpr := common.ReadingPlanRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&rpr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := rpr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	if _, ok := a.lookupBook(w, rpr.BookID); !ok {
+		return
+	}
+	a.createReadingPlan(w, r, rpr)
+}
+
+// clubPlansGeneratePost adds a reading plan to a club that splits the pages of the book evenly
+// between the start and end dates
+func (a *app) clubPlansGeneratePost(w http.ResponseWriter, r *http.Request) {
+	rpgr := common.ReadingPlanGenerateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&rpgr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := rpgr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	book, ok := a.lookupBook(w, rpgr.BookID)
+	if !ok {
+		return
+	}
+	rpr, err := rpgr.Generate(book.PageCount)
+	if err != nil {
+		a.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	a.createReadingPlan(w, r, *rpr)
+}
+
+// clubPlansGet lists the reading plans of a club with the section being read in each
+func (a *app) clubPlansGet(w http.ResponseWriter, r *http.Request) {
+	today, ok := a.requestToday(w, r)
+	if !ok {
+		return
+	}
+	plans, err := a.warehouse.ListReadingPlans(mux.Vars(r)["clubID"])
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to list reading plans")
+		a.respondWithError(w, http.StatusInternalServerError, "Error listing the reading plans")
+		return
+	}
+	for i := range plans {
+		plans[i].SetCurrent(today)
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]interface{}{"plans": plans})
+}
+
+// clubPlansOptions returns the allowed options
+func (a *app) clubPlansOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubPlanGet returns a reading plan of a club with the section being read
+func (a *app) clubPlanGet(w http.ResponseWriter, r *http.Request) {
+	plan, ok := a.requestReadingPlan(w, r)
+	if !ok {
+		return
+	}
+	today, ok := a.requestToday(w, r)
+	if !ok {
+		return
+	}
+	plan.SetCurrent(today)
+	a.respondWithJSON(w, http.StatusOK, plan)
+}
+
+// clubPlanPut replaces the book, unit and sections of a reading plan. Sections sent with their id keep
+// it, so discussions of a section stay with it when sections are added or removed around it
+func (a *app) clubPlanPut(w http.ResponseWriter, r *http.Request) {
+	rpr := common.ReadingPlanRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&rpr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := rpr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	plan, ok := a.requestReadingPlan(w, r)
+	if !ok {
+		return
+	}
+	today, ok := a.requestToday(w, r)
+	if !ok {
+		return
+	}
+	if rpr.BookID != plan.BookID {
+		if _, ok := a.lookupBook(w, rpr.BookID); !ok {
+			return
+		}
+	}
+	plan.BookID, plan.Unit, plan.Sections = rpr.BookID, rpr.Unit, rpr.Sections
+	if err := a.warehouse.UpdateReadingPlan(plan); err != nil {
+		switch err {
+		case common.ErrReadingPlanNotFound:
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+		case common.ErrBookNotFound:
+			a.respondWithError(w, http.StatusBadRequest, err.Error())
+		case common.ErrReadingPlanSectionNotFound:
+			a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		default:
+			a.logrus.WithError(err).Error("Unable to update reading plan")
+			a.respondWithError(w, http.StatusInternalServerError, "Error updating the reading plan")
+		}
+		return
+	}
+	plan.SetCurrent(today)
+	a.respondWithJSON(w, http.StatusOK, plan)
+}
+
+// clubPlanDelete removes a reading plan from a club
+func (a *app) clubPlanDelete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := a.warehouse.DeleteReadingPlan(vars["clubID"], vars["planID"]); err != nil {
+		if err == common.ErrReadingPlanNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to delete reading plan")
+		a.respondWithError(w, http.StatusInternalServerError, "Error deleting the reading plan")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Reading plan deleted"})
+}
+
+// clubPlanOptions returns the allowed options
+func (a *app) clubPlanOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// createReadingPlan saves a checked plan for the club in the clubID route variable and writes the response
+func (a *app) createReadingPlan(w http.ResponseWriter, r *http.Request, rpr common.ReadingPlanRequest) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	today, ok := a.requestToday(w, r)
+	if !ok {
+		return
+	}
+	plan := &common.ReadingPlan{
+		ClubID:    mux.Vars(r)["clubID"],
+		BookID:    rpr.BookID,
+		Unit:      rpr.Unit,
+		Sections:  rpr.Sections,
+		CreatedBy: claims.UserID,
+	}
+	if err := a.warehouse.CreateReadingPlan(plan); err != nil {
+		if err == common.ErrBookNotFound {
+			a.respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to create reading plan")
+		a.respondWithError(w, http.StatusInternalServerError, "Error creating the reading plan")
+		return
+	}
+	plan.SetCurrent(today)
+	a.respondWithJSON(w, http.StatusCreated, plan)
+}
+
+// requestReadingPlan loads the plan in the planID route variable of the club in the clubID route
+// variable. If it returns false the error response has already been written
+func (a *app) requestReadingPlan(w http.ResponseWriter, r *http.Request) (*common.ReadingPlan, bool) {
+	vars := mux.Vars(r)
+	plan, err := a.warehouse.GetReadingPlan(vars["clubID"], vars["planID"])
+	if err != nil {
+		if err == common.ErrReadingPlanNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return nil, false
+		}
+		a.logrus.WithError(err).Error("Unable to get reading plan")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the reading plan")
+		return nil, false
+	}
+	return plan, true
+}
+
+// requestToday returns the date, YYYY-MM-DD, in the time zone of the request. If it returns false
+// the error response has already been written
+func (a *app) requestToday(w http.ResponseWriter, r *http.Request) (string, bool) {
+	loc, ok := a.requestLocation(w, r)
+	if !ok {
+		return "", false
+	}
+	return time.Now().In(loc).Format(common.ReadingPlanDateLayout), true
+}
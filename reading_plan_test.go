@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestClubPlansGeneratePost(t *testing.T) {
+	type testData struct {
+		description          string
+		expectedError        error
+		expectedHTTPStatus   int
+		expectedSectionCount int
+		expectedSections     []common.ReadingPlanSection
+		pageCount            int
+		params               map[string]interface{}
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "One section a week by default",
+			expectedHTTPStatus: http.StatusCreated,
+			expectedSections: []common.ReadingPlanSection{
+				{Position: 1, Title: "Pages 1 to 100", Start: 1, End: 100, DueDate: "2030-03-07"},
+				{Position: 2, Title: "Pages 101 to 200", Start: 101, End: 200, DueDate: "2030-03-14"},
+				{Position: 3, Title: "Pages 201 to 301", Start: 201, End: 301, DueDate: "2030-03-21"},
+			},
+			pageCount: 301,
+			params:    map[string]interface{}{"bookID": "bookID", "startDate": "2030-03-01", "endDate": "2030-03-21"},
+		},
+		testData{
+			description:        "Number of sections given",
+			expectedHTTPStatus: http.StatusCreated,
+			expectedSections: []common.ReadingPlanSection{
+				{Position: 1, Title: "Pages 1 to 5", Start: 1, End: 5, DueDate: "2030-03-02"},
+				{Position: 2, Title: "Pages 6 to 10", Start: 6, End: 10, DueDate: "2030-03-03"},
+			},
+			pageCount: 10,
+			params:    map[string]interface{}{"bookID": "bookID", "startDate": "2030-03-01", "endDate": "2030-03-03", "sections": 2},
+		},
+		testData{
+			description:        "Never more sections than pages",
+			expectedHTTPStatus: http.StatusCreated,
+			expectedSections: []common.ReadingPlanSection{
+				{Position: 1, Title: "Page 1", Start: 1, End: 1, DueDate: "2030-03-01"},
+				{Position: 2, Title: "Page 2", Start: 2, End: 2, DueDate: "2030-03-01"},
+			},
+			pageCount: 2,
+			params:    map[string]interface{}{"bookID": "bookID", "startDate": "2030-03-01", "endDate": "2030-03-01", "sections": 5},
+		},
+		testData{
+			description:          "Weekly sections over years are capped",
+			expectedHTTPStatus:   http.StatusCreated,
+			expectedSectionCount: common.MaxReadingPlanSections,
+			pageCount:            1000,
+			params:               map[string]interface{}{"bookID": "bookID", "startDate": "2030-03-01", "endDate": "2034-03-01"},
+		},
+		testData{
+			description:        "Page count of the book not known",
+			expectedError:      common.ErrReadingPlanNoPageCount,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"bookID": "bookID", "startDate": "2030-03-01", "endDate": "2030-03-21"},
+		},
+		testData{
+			description:        "Ends before it starts",
+			expectedError:      common.ErrReadingPlanEndBeforeStart,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"bookID": "bookID", "startDate": "2030-03-21", "endDate": "2030-03-01"},
+		},
+		testData{
+			description:        "Date invalid",
+			expectedError:      common.ErrReadingPlanDateInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"bookID": "bookID", "startDate": "1 March", "endDate": "2030-03-21"},
+		},
+	}
+	for _, td := range testTable {
+		body, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/clubs/clubID/plans/generate?tz=UTC", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(common.ClubRoleModerator))
+		if td.expectedError == nil || td.expectedError == common.ErrReadingPlanNoPageCount {
+			book := &common.Book{ID: "bookID"}
+			book.PageCount = td.pageCount
+			mockWarehouse.On("GetBook", "bookID").Return(book, nil)
+		}
+		if td.expectedError == nil {
+			mockWarehouse.On("CreateReadingPlan", mock.MatchedBy(func(p *common.ReadingPlan) bool {
+				return p.ClubID == "clubID" && p.BookID == "bookID" && p.Unit == common.ReadingPlanUnitPage &&
+					p.CreatedBy == validUserID
+			})).Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+			continue
+		}
+		plan := common.ReadingPlan{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&plan); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		if td.expectedSectionCount > 0 {
+			// No more sections than a plan can have, and the last is due on the end date
+			if assert.Len(t, plan.Sections, td.expectedSectionCount, td.description) {
+				assert.Equal(t, td.params["endDate"], plan.Sections[len(plan.Sections)-1].DueDate, td.description)
+			}
+		} else {
+			assert.Equal(t, td.expectedSections, plan.Sections, td.description)
+		}
+		// Every section is due in the future, so the first is being read
+		if assert.NotNil(t, plan.Current, td.description) {
+			assert.Equal(t, 1, *plan.Current, td.description)
+		}
+	}
+}
+
+func TestClubPlansPost(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedError      error
+		expectedHTTPStatus int
+		role               string
+		sections           []map[string]interface{}
+		unit               string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Chapters written by hand",
+			expectedHTTPStatus: http.StatusCreated,
+			role:               common.ClubRoleModerator,
+			sections: []map[string]interface{}{
+				{"start": 1, "end": 8, "dueDate": "2030-03-12"},
+				{"title": "The long middle", "start": 9, "end": 20, "dueDate": "2030-03-26"},
+			},
+			unit: common.ReadingPlanUnitChapter,
+		},
+		testData{
+			description:        "Sections overlap",
+			expectedError:      common.ErrReadingPlanSectionOverlap,
+			expectedHTTPStatus: http.StatusBadRequest,
+			role:               common.ClubRoleModerator,
+			sections: []map[string]interface{}{
+				{"start": 1, "end": 8, "dueDate": "2030-03-12"},
+				{"start": 8, "end": 20, "dueDate": "2030-03-26"},
+			},
+			unit: common.ReadingPlanUnitChapter,
+		},
+		testData{
+			description:        "Sections out of order",
+			expectedError:      common.ErrReadingPlanSectionOrder,
+			expectedHTTPStatus: http.StatusBadRequest,
+			role:               common.ClubRoleModerator,
+			sections: []map[string]interface{}{
+				{"start": 1, "end": 8, "dueDate": "2030-03-26"},
+				{"start": 9, "end": 20, "dueDate": "2030-03-12"},
+			},
+			unit: common.ReadingPlanUnitChapter,
+		},
+		testData{
+			description:        "Section id repeated",
+			expectedError:      common.ErrReadingPlanSectionRepeated,
+			expectedHTTPStatus: http.StatusBadRequest,
+			role:               common.ClubRoleModerator,
+			sections: []map[string]interface{}{
+				{"id": "sectionID", "start": 1, "end": 8, "dueDate": "2030-03-12"},
+				{"id": "sectionID", "start": 9, "end": 20, "dueDate": "2030-03-26"},
+			},
+			unit: common.ReadingPlanUnitChapter,
+		},
+		testData{
+			description:        "Range backwards",
+			expectedError:      common.ErrReadingPlanSectionRangeInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			role:               common.ClubRoleModerator,
+			sections:           []map[string]interface{}{{"start": 8, "end": 1, "dueDate": "2030-03-12"}},
+			unit:               common.ReadingPlanUnitPage,
+		},
+		testData{
+			description:        "Unit invalid",
+			expectedError:      common.ErrReadingPlanUnitInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			role:               common.ClubRoleModerator,
+			sections:           []map[string]interface{}{{"start": 1, "end": 8, "dueDate": "2030-03-12"}},
+			unit:               "verse",
+		},
+		testData{
+			description:        "No sections",
+			expectedError:      common.ErrReadingPlanSectionsInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			role:               common.ClubRoleModerator,
+			unit:               common.ReadingPlanUnitPage,
+		},
+		testData{
+			description:        "Members can not add plans",
+			expectedHTTPStatus: http.StatusForbidden,
+			role:               common.ClubRoleMember,
+			sections:           []map[string]interface{}{{"start": 1, "end": 8, "dueDate": "2030-03-12"}},
+			unit:               common.ReadingPlanUnitPage,
+		},
+	}
+	for _, td := range testTable {
+		body, err := json.Marshal(map[string]interface{}{"bookID": "bookID", "unit": td.unit, "sections": td.sections})
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/clubs/clubID/plans?tz=UTC", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(td.role))
+		if td.expectedHTTPStatus == http.StatusCreated {
+			mockWarehouse.On("GetBook", "bookID").Return(&common.Book{ID: "bookID"}, nil)
+			mockWarehouse.On("CreateReadingPlan", mock.MatchedBy(func(p *common.ReadingPlan) bool {
+				return len(p.Sections) == 2 && p.Sections[0].Title == "Chapters 1 to 8" && p.Sections[1].Position == 2 &&
+					p.Sections[1].Title == "The long middle"
+			})).Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+		}
+	}
+}
+
+func TestClubPlanGetCurrentSection(t *testing.T) {
+	today := time.Now().UTC()
+	date := func(days int) string {
+		return today.AddDate(0, 0, days).Format(common.ReadingPlanDateLayout)
+	}
+	type testData struct {
+		description     string
+		dueDates        []string
+		expectedCurrent *int
+	}
+
+	first, second := 1, 2
+	testTable := []testData{
+		testData{
+			description:     "Nothing due yet",
+			dueDates:        []string{date(3), date(10)},
+			expectedCurrent: &first,
+		},
+		testData{
+			description:     "The section due today is still being read",
+			dueDates:        []string{date(-7), date(0)},
+			expectedCurrent: &second,
+		},
+		testData{
+			description: "Every section is due",
+			dueDates:    []string{date(-7), date(-1)},
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodGet, "/clubs/clubID/plans/planID?tz=UTC", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(common.ClubRoleMember))
+		plan := &common.ReadingPlan{ID: "planID", ClubID: "clubID", BookID: "bookID", Unit: common.ReadingPlanUnitChapter}
+		for i, dueDate := range td.dueDates {
+			plan.Sections = append(plan.Sections, common.ReadingPlanSection{Position: i + 1, Start: i*5 + 1, End: i*5 + 5,
+				DueDate: dueDate})
+		}
+		mockWarehouse.On("GetReadingPlan", "clubID", "planID").Return(plan, nil)
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, http.StatusOK, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		got := common.ReadingPlan{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&got); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		assert.Equal(t, td.expectedCurrent, got.Current, td.description)
+	}
+}
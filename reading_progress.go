@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/gorilla/mux"
+)
+
+// bookProgressPut records how far the current user is through a book, by page, percent or chapter
+func (a *app) bookProgressPut(w http.ResponseWriter, r *http.Request) {
+	rpr := common.ReadingProgressRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&rpr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := rpr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	book, ok := a.requestBook(w, r)
+	if !ok {
+		return
+	}
+	if rpr.Page != nil && book.PageCount > 0 && *rpr.Page > book.PageCount {
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", common.ErrProgressPageInvalid))
+		return
+	}
+	progress := &common.ReadingProgress{BookID: book.ID, Page: rpr.Page, Percent: rpr.Percent, Chapter: rpr.Chapter}
+	if err := a.warehouse.RecordProgress(claims.UserID, progress); err != nil {
+		if err == common.ErrBookNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to record progress")
+		a.respondWithError(w, http.StatusInternalServerError, "Error recording the progress")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, progress)
+}
+
+// bookProgressGet returns how far the current user is through a book and the history of their progress
+func (a *app) bookProgressGet(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	book, ok := a.requestBook(w, r)
+	if !ok {
+		return
+	}
+	history, err := a.warehouse.ListProgress(claims.UserID, book.ID)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to list progress")
+		a.respondWithError(w, http.StatusInternalServerError, "Error listing the progress")
+		return
+	}
+	var latest *common.ReadingProgress
+	if len(history) > 0 {
+		latest = &history[0]
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]interface{}{"progress": latest, "history": history})
+}
+
+// bookProgressOptions returns the allowed options
+func (a *app) bookProgressOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubProgressSharingPut chooses whether a club can see the reading progress of the current user.
+// Progress is private until it is shared
+func (a *app) clubProgressSharingPut(w http.ResponseWriter, r *http.Request) {
+	psr := common.ProgressSharingRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&psr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := psr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	if err := a.warehouse.SetProgressSharing(mux.Vars(r)["clubID"], claims.UserID, *psr.Share); err != nil {
+		if err == common.ErrClubNotMember {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to set progress sharing")
+		a.respondWithError(w, http.StatusInternalServerError, "Error saving the progress sharing")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]bool{"share": *psr.Share})
+}
+
+// clubProgressSharingOptions returns the allowed options
+func (a *app) clubProgressSharingOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubPlanProgressGet compares the progress of the members of a club through the book of a reading
+// plan against the plan. Only members who share their progress are shown, along with the current user
+func (a *app) clubPlanProgressGet(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	plan, ok := a.requestReadingPlan(w, r)
+	if !ok {
+		return
+	}
+	today, ok := a.requestToday(w, r)
+	if !ok {
+		return
+	}
+	// Without the book a percentage can not be turned into pages, those members are not compared
+	pageCount := 0
+	book, err := a.warehouse.GetBook(plan.BookID)
+	switch err {
+	case nil:
+		pageCount = book.PageCount
+	case common.ErrBookNotFound:
+	default:
+		a.logrus.WithError(err).Error("Unable to get book")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the book")
+		return
+	}
+	members, hidden, err := a.warehouse.ClubProgress(plan.ClubID, plan.BookID, claims.UserID)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to get club progress")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the club progress")
+		return
+	}
+	plan.SetCurrent(today)
+	progress := common.ClubProgress{
+		PlanID:   plan.ID,
+		BookID:   plan.BookID,
+		Unit:     plan.Unit,
+		Current:  plan.Current,
+		Expected: plan.Expected(today),
+		Members:  members,
+		Hidden:   hidden,
+	}
+	for i := range progress.Members {
+		progress.Members[i].Compare(plan.Unit, pageCount, progress.Expected)
+	}
+	a.respondWithJSON(w, http.StatusOK, progress)
+}
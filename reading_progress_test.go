@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBookProgressPut(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedError      error
+		expectedHTTPStatus int
+		params             map[string]interface{}
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Page",
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]interface{}{"page": 120},
+		},
+		testData{
+			description:        "Percent",
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]interface{}{"percent": 40},
+		},
+		testData{
+			description:        "Page past the end of the book",
+			expectedError:      common.ErrProgressPageInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"page": 301},
+		},
+		testData{
+			description:        "More than one measure",
+			expectedError:      common.ErrProgressMeasureInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"page": 120, "chapter": 4},
+		},
+		testData{
+			description:        "No measure",
+			expectedError:      common.ErrProgressMeasureInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{},
+		},
+		testData{
+			description:        "Percent over 100",
+			expectedError:      common.ErrProgressPercentInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"percent": 101},
+		},
+		testData{
+			description:        "Negative",
+			expectedError:      common.ErrProgressNegative,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"chapter": -1},
+		},
+	}
+	for _, td := range testTable {
+		body, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPut, "/books/bookID/progress", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, memberClaims)
+		if td.expectedHTTPStatus == http.StatusOK || td.expectedError == common.ErrProgressPageInvalid {
+			book := &common.Book{ID: "bookID"}
+			book.PageCount = 300
+			mockWarehouse.On("GetBook", "bookID").Return(book, nil)
+		}
+		if td.expectedHTTPStatus == http.StatusOK {
+			mockWarehouse.On("RecordProgress", validUserID, mock.MatchedBy(func(p *common.ReadingProgress) bool {
+				return p.BookID == "bookID"
+			})).Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+		}
+	}
+}
+
+func TestClubPlanProgressGet(t *testing.T) {
+	today := time.Now().UTC()
+	date := func(days int) string {
+		return today.AddDate(0, 0, days).Format(common.ReadingPlanDateLayout)
+	}
+	intPtr := func(i int) *int {
+		return &i
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/clubs/clubID/plans/planID/progress?tz=UTC", nil)
+	if err != nil {
+		t.Fatalf("Error creating new request: %v", err)
+	}
+	a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(common.ClubRoleMember))
+	plan := &common.ReadingPlan{ID: "planID", ClubID: "clubID", BookID: "bookID", Unit: common.ReadingPlanUnitPage,
+		Sections: []common.ReadingPlanSection{
+			{Position: 1, Start: 1, End: 100, DueDate: date(-7)},
+			{Position: 2, Start: 101, End: 200, DueDate: date(7)},
+		}}
+	mockWarehouse.On("GetReadingPlan", "clubID", "planID").Return(plan, nil)
+	book := &common.Book{ID: "bookID"}
+	book.PageCount = 200
+	mockWarehouse.On("GetBook", "bookID").Return(book, nil)
+	mockWarehouse.On("ClubProgress", "clubID", "bookID", validUserID).Return([]common.MemberProgress{
+		{UserID: "ahead", Progress: &common.ReadingProgress{Page: intPtr(150)}},
+		{UserID: "behindByPercent", Progress: &common.ReadingProgress{Percent: intPtr(25)}},
+		{UserID: "byChapter", Progress: &common.ReadingProgress{Chapter: intPtr(3)}},
+		{UserID: validUserID},
+	}, 2, nil)
+
+	a.Router.ServeHTTP(responseRecorder, req)
+	mockWarehouse.AssertExpectations(t)
+	if !assert.Equal(t, http.StatusOK, responseRecorder.Code) {
+		return
+	}
+	got := common.ClubProgress{}
+	if err = json.NewDecoder(responseRecorder.Body).Decode(&got); err != nil {
+		t.Fatalf("Unable to decode JSON response: %v", err)
+	}
+	assert.Equal(t, 100, got.Expected)
+	assert.Equal(t, intPtr(2), got.Current)
+	assert.Equal(t, 2, got.Hidden)
+	if assert.Len(t, got.Members, 4) {
+		assert.Equal(t, intPtr(150), got.Members[0].Reached)
+		assert.False(t, got.Members[0].Behind)
+		assert.Equal(t, intPtr(50), got.Members[1].Reached)
+		assert.True(t, got.Members[1].Behind)
+		// Chapters can not be compared against a plan in pages
+		assert.Nil(t, got.Members[2].Reached)
+		assert.False(t, got.Members[2].Behind)
+		assert.Equal(t, intPtr(0), got.Members[3].Reached)
+		assert.True(t, got.Members[3].Behind)
+	}
+}
+
+func TestClubProgressSharingPut(t *testing.T) {
+	body, err := json.Marshal(map[string]interface{}{"share": true})
+	if err != nil {
+		t.Fatalf("Error marshalling: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPut, "/clubs/clubID/progress-sharing", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Error creating new request: %v", err)
+	}
+	a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(common.ClubRoleMember))
+	mockWarehouse.On("SetProgressSharing", "clubID", validUserID, true).Return(nil)
+
+	a.Router.ServeHTTP(responseRecorder, req)
+	mockWarehouse.AssertExpectations(t)
+	assert.Equal(t, http.StatusOK, responseRecorder.Code)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/gorilla/mux"
+)
+
+// bookReviewsGet lists the reviews of a book a page at a time. The sort query parameter orders them
+// by newest, helpful or rating, newest first by default
+func (a *app) bookReviewsGet(w http.ResponseWriter, r *http.Request) {
+	sort := r.URL.Query().Get("sort")
+	if sort == "" {
+		sort = common.ReviewSortNewest
+	}
+	if !common.ValidReviewSort(sort) {
+		a.respondWithError(w, http.StatusBadRequest, common.ErrReviewSortInvalid.Error())
+		return
+	}
+	pagination, ok := a.requestPagination(w, r)
+	if !ok {
+		return
+	}
+	book, ok := a.requestBook(w, r)
+	if !ok {
+		return
+	}
+	reviews, total, err := a.warehouse.ListReviews(book.ID, sort, pagination)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to list reviews")
+		a.respondWithError(w, http.StatusInternalServerError, "Error listing the reviews")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"reviews": reviews,
+		"rating":  book.Rating,
+		"sort":    sort,
+		"total":   total,
+		"limit":   pagination.Limit,
+		"offset":  pagination.Offset,
+	})
+}
+
+// bookReviewsPost reviews a book as the current user, each user reviews a book once
+func (a *app) bookReviewsPost(w http.ResponseWriter, r *http.Request) {
+	rr := common.ReviewRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&rr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := rr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	book, ok := a.requestBook(w, r)
+	if !ok {
+		return
+	}
+	review := &common.Review{BookID: book.ID, UserID: claims.UserID}
+	rr.Apply(review)
+	if err := a.warehouse.CreateReview(review); err != nil {
+		switch err {
+		case common.ErrReviewAlreadyExists:
+			a.respondWithError(w, http.StatusConflict, err.Error())
+		case common.ErrBookNotFound:
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+		default:
+			a.logrus.WithError(err).Error("Unable to create review")
+			a.respondWithError(w, http.StatusInternalServerError, "Error creating the review")
+		}
+		return
+	}
+	a.respondWithJSON(w, http.StatusCreated, review)
+}
+
+// bookReviewsPatch changes the review the current user wrote of a book
+func (a *app) bookReviewsPatch(w http.ResponseWriter, r *http.Request) {
+	rur := common.ReviewUpdateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&rur); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := rur.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	review, err := a.warehouse.GetReview(mux.Vars(r)["bookID"], claims.UserID)
+	if err != nil {
+		if err == common.ErrReviewNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to get review")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the review")
+		return
+	}
+	if err = rur.Apply(review); err != nil {
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	if err = a.warehouse.UpdateReview(review); err != nil {
+		if err == common.ErrReviewNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to update review")
+		a.respondWithError(w, http.StatusInternalServerError, "Error updating the review")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, review)
+}
+
+// bookReviewsDelete removes the review the current user wrote of a book
+func (a *app) bookReviewsDelete(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	if err := a.warehouse.DeleteReview(mux.Vars(r)["bookID"], claims.UserID); err != nil {
+		if err == common.ErrReviewNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to delete review")
+		a.respondWithError(w, http.StatusInternalServerError, "Error deleting the review")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Review deleted"})
+}
+
+// bookReviewsOptions returns the allowed options
+func (a *app) bookReviewsOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// bookReviewHelpfulPut records that the current user found a review helpful
+func (a *app) bookReviewHelpfulPut(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	vars := mux.Vars(r)
+	if err := a.warehouse.AddHelpfulVote(vars["bookID"], vars["reviewID"], claims.UserID); err != nil {
+		switch err {
+		case common.ErrReviewNotFound:
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+		case common.ErrReviewVoteOwn:
+			a.respondWithError(w, http.StatusForbidden, err.Error())
+		default:
+			a.logrus.WithError(err).Error("Unable to add helpful vote")
+			a.respondWithError(w, http.StatusInternalServerError, "Error saving the vote")
+		}
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Marked as helpful"})
+}
+
+// bookReviewHelpfulDelete takes back the helpful vote of the current user for a review
+func (a *app) bookReviewHelpfulDelete(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	vars := mux.Vars(r)
+	if err := a.warehouse.RemoveHelpfulVote(vars["bookID"], vars["reviewID"], claims.UserID); err != nil {
+		if err == common.ErrReviewNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to remove helpful vote")
+		a.respondWithError(w, http.StatusInternalServerError, "Error removing the vote")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "No longer marked as helpful"})
+}
+
+// bookReviewHelpfulOptions returns the allowed options
+func (a *app) bookReviewHelpfulOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
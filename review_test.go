@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBookReviewsPost(t *testing.T) {
+	type testData struct {
+		description        string
+		createError        error
+		expectedError      error
+		expectedHTTPStatus int
+		params             map[string]interface{}
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Half stars",
+			expectedHTTPStatus: http.StatusCreated,
+			params:             map[string]interface{}{"rating": 3.5, "body": "  Slow start  ", "spoiler": true},
+		},
+		testData{
+			description:        "Already reviewed",
+			createError:        common.ErrReviewAlreadyExists,
+			expectedError:      common.ErrReviewAlreadyExists,
+			expectedHTTPStatus: http.StatusConflict,
+			params:             map[string]interface{}{"rating": 4},
+		},
+		testData{
+			description:        "No rating",
+			expectedError:      common.ErrReviewRatingInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"body": "Loved it"},
+		},
+		testData{
+			description:        "More than five stars",
+			expectedError:      common.ErrReviewRatingInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"rating": 5.5},
+		},
+		testData{
+			description:        "Not a half star",
+			expectedError:      common.ErrReviewRatingInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"rating": 3.3},
+		},
+	}
+	for _, td := range testTable {
+		body, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/books/bookID/reviews", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, memberClaims)
+		if td.expectedHTTPStatus != http.StatusBadRequest {
+			mockWarehouse.On("GetBook", "bookID").Return(validBook(), nil)
+			mockWarehouse.On("CreateReview", mock.MatchedBy(func(r *common.Review) bool {
+				return r.BookID == "bookID" && r.UserID == validUserID
+			})).Return(td.createError)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+			continue
+		}
+		review := common.Review{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&review); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		assert.Equal(t, 3.5, review.Rating, td.description)
+		assert.Equal(t, "Slow start", review.Body, td.description)
+		assert.True(t, review.Spoiler, td.description)
+	}
+}
+
+func TestBookReviewsPatch(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedError      error
+		expectedHTTPStatus int
+		getError           error
+		params             map[string]interface{}
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Change the rating only",
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]interface{}{"rating": 2},
+		},
+		testData{
+			description:        "Not reviewed yet",
+			expectedError:      common.ErrReviewNotFound,
+			expectedHTTPStatus: http.StatusNotFound,
+			getError:           common.ErrReviewNotFound,
+			params:             map[string]interface{}{"rating": 2},
+		},
+		testData{
+			description:        "Rating invalid",
+			expectedError:      common.ErrReviewRatingInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"rating": 0},
+		},
+		testData{
+			description:        "No fields",
+			expectedError:      common.ErrReviewUpdateNoFields,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{},
+		},
+	}
+	for _, td := range testTable {
+		body, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPatch, "/books/bookID/reviews", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, memberClaims)
+		if td.expectedError != common.ErrReviewUpdateNoFields {
+			existing := &common.Review{ID: "reviewID", BookID: "bookID", UserID: validUserID, Rating: 4, Body: "Loved it"}
+			if td.getError != nil {
+				existing = nil
+			}
+			mockWarehouse.On("GetReview", "bookID", validUserID).Return(existing, td.getError)
+		}
+		if td.expectedHTTPStatus == http.StatusOK {
+			mockWarehouse.On("UpdateReview", mock.MatchedBy(func(r *common.Review) bool {
+				return r.ID == "reviewID" && r.Rating == 2 && r.Body == "Loved it"
+			})).Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+		}
+	}
+}
+
+func TestBookReviewsGet(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedHTTPStatus int
+		expectedSort       string
+		query              string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Newest by default",
+			expectedHTTPStatus: http.StatusOK,
+			expectedSort:       common.ReviewSortNewest,
+		},
+		testData{
+			description:        "Most helpful",
+			expectedHTTPStatus: http.StatusOK,
+			expectedSort:       common.ReviewSortHelpful,
+			query:              "?sort=helpful",
+		},
+		testData{
+			description:        "Sort invalid",
+			expectedHTTPStatus: http.StatusBadRequest,
+			query:              "?sort=oldest",
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodGet, "/books/bookID/reviews"+td.query, nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, memberClaims)
+		if td.expectedHTTPStatus == http.StatusOK {
+			mockWarehouse.On("GetBook", "bookID").Return(validBook(), nil)
+			mockWarehouse.On("ListReviews", "bookID", td.expectedSort,
+				common.Pagination{Limit: common.DefaultPageLimit}).Return([]common.Review{}, 0, nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
+
+func TestBookReviewHelpfulPutOwnReview(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPut, "/books/bookID/reviews/reviewID/helpful", nil)
+	if err != nil {
+		t.Fatalf("Error creating new request: %v", err)
+	}
+	a, responseRecorder, _, mockWarehouse := setupAuthTest(req, memberClaims)
+	mockWarehouse.On("AddHelpfulVote", "bookID", "reviewID", validUserID).Return(common.ErrReviewVoteOwn)
+
+	a.Router.ServeHTTP(responseRecorder, req)
+	mockWarehouse.AssertExpectations(t)
+	assert.Equal(t, http.StatusForbidden, responseRecorder.Code)
+}
@@ -0,0 +1,11 @@
+CREATE TABLE refresh_token (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	user_id uuid NOT NULL REFERENCES user_data (id),
+	family_id uuid NOT NULL DEFAULT uuid_generate_v1(),
+	token_hash character(64) UNIQUE NOT NULL,
+	expires_at timestamp NOT NULL,
+	used_at timestamp,
+	revoked_at timestamp,
+	created_at timestamp DEFAULT NOW() NOT NULL
+);
+CREATE INDEX refresh_token_family_id ON refresh_token (family_id);
@@ -0,0 +1,6 @@
+CREATE TABLE revoked_token (
+	jti character varying(64) NOT NULL PRIMARY KEY,
+	expires_at timestamp NOT NULL,
+	created_at timestamp DEFAULT NOW() NOT NULL
+);
+CREATE INDEX revoked_token_expires_at ON revoked_token (expires_at);
@@ -0,0 +1,2 @@
+DROP TABLE password_reset;
+ALTER TABLE user_data DROP COLUMN sessions_revoked_at;
@@ -0,0 +1,9 @@
+ALTER TABLE user_data ADD COLUMN sessions_revoked_at timestamp;
+CREATE TABLE password_reset (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	user_id uuid NOT NULL REFERENCES user_data (id),
+	token_hash character(64) UNIQUE NOT NULL,
+	expires_at timestamp NOT NULL,
+	used_at timestamp,
+	created_at timestamp DEFAULT NOW() NOT NULL
+);
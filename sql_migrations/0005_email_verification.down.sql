@@ -0,0 +1,2 @@
+DROP TABLE email_verification;
+ALTER TABLE user_data DROP COLUMN email_verified_at;
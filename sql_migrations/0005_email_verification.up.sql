@@ -0,0 +1,10 @@
+ALTER TABLE user_data ADD COLUMN email_verified_at timestamp;
+CREATE TABLE email_verification (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	user_id uuid NOT NULL REFERENCES user_data (id),
+	email character varying(200) NOT NULL,
+	token_hash character(64) UNIQUE NOT NULL,
+	expires_at timestamp NOT NULL,
+	used_at timestamp,
+	created_at timestamp DEFAULT NOW() NOT NULL
+);
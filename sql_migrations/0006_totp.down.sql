@@ -0,0 +1,4 @@
+ALTER TABLE user_data DROP COLUMN totp_recovery_codes;
+ALTER TABLE user_data DROP COLUMN totp_last_step;
+ALTER TABLE user_data DROP COLUMN totp_enabled_at;
+ALTER TABLE user_data DROP COLUMN totp_secret;
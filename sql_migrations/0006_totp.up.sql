@@ -0,0 +1,4 @@
+ALTER TABLE user_data ADD COLUMN totp_secret character varying(200);
+ALTER TABLE user_data ADD COLUMN totp_enabled_at timestamp;
+ALTER TABLE user_data ADD COLUMN totp_last_step bigint;
+ALTER TABLE user_data ADD COLUMN totp_recovery_codes character(64)[];
@@ -0,0 +1,2 @@
+DROP TABLE club_role;
+ALTER TABLE user_data DROP COLUMN roles;
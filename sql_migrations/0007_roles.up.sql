@@ -0,0 +1,10 @@
+ALTER TABLE user_data ADD COLUMN roles character varying(20)[] NOT NULL DEFAULT '{member}';
+CREATE TABLE club_role (
+	club_id uuid NOT NULL,
+	user_id uuid NOT NULL REFERENCES user_data (id),
+	role character varying(20) NOT NULL CONSTRAINT clubRoleValid CHECK (role IN ('owner', 'moderator', 'member')),
+	created_at timestamp DEFAULT NOW() NOT NULL,
+	updated_at timestamp DEFAULT NOW() NOT NULL,
+	PRIMARY KEY (club_id, user_id)
+);
+CREATE INDEX club_role_user_id ON club_role (user_id);
@@ -0,0 +1,6 @@
+CREATE TABLE login_attempt (
+	key character varying(300) NOT NULL PRIMARY KEY,
+	failures integer NOT NULL,
+	last_failure_at timestamp NOT NULL,
+	locked_until timestamp
+);
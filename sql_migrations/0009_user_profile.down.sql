@@ -0,0 +1,4 @@
+DROP INDEX user_data_email_active;
+ALTER TABLE user_data ADD CONSTRAINT user_data_email_key UNIQUE (email);
+ALTER TABLE user_data DROP COLUMN pending_email;
+ALTER TABLE user_data DROP COLUMN bio;
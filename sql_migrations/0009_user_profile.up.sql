@@ -0,0 +1,6 @@
+ALTER TABLE user_data ADD COLUMN bio character varying(1000) NOT NULL DEFAULT '';
+-- A new email waits here until it is verified, the user keeps logging in with the old one
+ALTER TABLE user_data ADD COLUMN pending_email character varying(200);
+-- A soft deleted user keeps their row, so the email can be registered again
+ALTER TABLE user_data DROP CONSTRAINT user_data_email_key;
+CREATE UNIQUE INDEX user_data_email_active ON user_data (email) WHERE deleted_at IS NULL;
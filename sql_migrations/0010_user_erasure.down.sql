@@ -0,0 +1,2 @@
+DROP TABLE user_erasure;
+ALTER TABLE user_data DROP COLUMN erased_at;
@@ -0,0 +1,9 @@
+ALTER TABLE user_data ADD COLUMN erased_at timestamp;
+-- The audit log of erasures only keeps ids, never the data that was removed
+CREATE TABLE user_erasure (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	user_id uuid NOT NULL REFERENCES user_data (id),
+	erased_by uuid NOT NULL REFERENCES user_data (id),
+	rows_removed integer NOT NULL,
+	created_at timestamp DEFAULT NOW() NOT NULL
+);
@@ -0,0 +1,12 @@
+CREATE TABLE personal_access_token (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	user_id uuid NOT NULL REFERENCES user_data (id),
+	name character varying(100) NOT NULL CONSTRAINT nameLength CHECK (char_length(name) > 0),
+	scopes character varying(20)[] NOT NULL,
+	token_hash character(64) UNIQUE NOT NULL,
+	expires_at timestamp,
+	last_used_at timestamp,
+	revoked_at timestamp,
+	created_at timestamp DEFAULT NOW() NOT NULL
+);
+CREATE INDEX personal_access_token_user_id ON personal_access_token (user_id);
@@ -0,0 +1,17 @@
+CREATE TABLE oidc_login (
+	state_hash character(64) NOT NULL PRIMARY KEY,
+	provider character varying(50) NOT NULL,
+	nonce character varying(100) NOT NULL,
+	code_verifier character varying(128) NOT NULL,
+	expires_at timestamp NOT NULL,
+	created_at timestamp DEFAULT NOW() NOT NULL
+);
+CREATE TABLE user_identity (
+	provider character varying(50) NOT NULL,
+	subject character varying(255) NOT NULL,
+	user_id uuid NOT NULL REFERENCES user_data (id),
+	email character varying(200) NOT NULL,
+	created_at timestamp DEFAULT NOW() NOT NULL,
+	PRIMARY KEY (provider, subject)
+);
+CREATE INDEX user_identity_user_id ON user_identity (user_id);
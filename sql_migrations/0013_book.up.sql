@@ -0,0 +1,20 @@
+CREATE TABLE book (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	title character varying(500) NOT NULL CONSTRAINT titleLength CHECK (char_length(title) > 0),
+	authors character varying(200)[] NOT NULL DEFAULT '{}',
+	isbn_10 character(10),
+	isbn_13 character(13),
+	publisher character varying(200) NOT NULL DEFAULT '',
+	published_date character varying(10) NOT NULL DEFAULT '',
+	page_count integer CONSTRAINT pageCountPositive CHECK (page_count > 0),
+	description character varying(10000) NOT NULL DEFAULT '',
+	cover_url character varying(2000) NOT NULL DEFAULT '',
+	language character varying(3) NOT NULL DEFAULT '',
+	created_at timestamp DEFAULT NOW() NOT NULL,
+	updated_at timestamp DEFAULT NOW() NOT NULL,
+	deleted_at timestamp
+);
+-- A deleted book keeps its row for anything that refers to it, so the ISBN can be added again
+CREATE UNIQUE INDEX book_isbn_10_active ON book (isbn_10) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX book_isbn_13_active ON book (isbn_13) WHERE deleted_at IS NULL;
+CREATE INDEX book_title ON book (lower(title));
@@ -0,0 +1,6 @@
+-- What the metadata provider returned for each ISBN-13, details is NULL when it did not know the book
+CREATE TABLE book_metadata (
+	isbn_13 character(13) NOT NULL PRIMARY KEY,
+	details jsonb,
+	fetched_at timestamp DEFAULT NOW() NOT NULL
+);
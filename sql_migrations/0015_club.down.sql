@@ -0,0 +1,3 @@
+DROP TABLE club_join_request;
+ALTER TABLE club_role DROP CONSTRAINT club_role_club_id_fkey;
+DROP TABLE club;
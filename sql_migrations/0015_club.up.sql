@@ -0,0 +1,20 @@
+CREATE TABLE club (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	name character varying(100) NOT NULL CONSTRAINT nameLength CHECK (char_length(name) > 0),
+	description character varying(2000) NOT NULL DEFAULT '',
+	visibility character varying(10) NOT NULL CONSTRAINT clubVisibilityValid CHECK (visibility IN ('public', 'private')),
+	created_at timestamp DEFAULT NOW() NOT NULL,
+	updated_at timestamp DEFAULT NOW() NOT NULL
+);
+-- The members of each club are kept in club_role rather than a separate club_memberships table. It was
+-- added with the roles, before there were clubs, and a row per club and user with the role of the user
+-- is already a membership. The club roles in the JSON token are read from it, so a second table would
+-- only have to be kept in step with it. Here it gets the foreign key to club it could not have before
+ALTER TABLE club_role ADD CONSTRAINT club_role_club_id_fkey FOREIGN KEY (club_id) REFERENCES club (id) ON DELETE CASCADE;
+CREATE TABLE club_join_request (
+	club_id uuid NOT NULL REFERENCES club (id) ON DELETE CASCADE,
+	user_id uuid NOT NULL REFERENCES user_data (id),
+	created_at timestamp DEFAULT NOW() NOT NULL,
+	PRIMARY KEY (club_id, user_id)
+);
+CREATE INDEX club_join_request_user_id ON club_join_request (user_id);
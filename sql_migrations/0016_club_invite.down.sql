@@ -0,0 +1 @@
+DROP TABLE club_invite;
@@ -0,0 +1,15 @@
+CREATE TABLE club_invite (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	club_id uuid NOT NULL REFERENCES club (id) ON DELETE CASCADE,
+	code_hash character(64) UNIQUE NOT NULL,
+	email character varying(200),
+	max_uses integer NOT NULL CONSTRAINT maxUsesPositive CHECK (max_uses > 0),
+	uses integer NOT NULL DEFAULT 0,
+	created_by uuid NOT NULL REFERENCES user_data (id),
+	expires_at timestamp NOT NULL,
+	revoked_at timestamp,
+	created_at timestamp DEFAULT NOW() NOT NULL
+);
+CREATE INDEX club_invite_club_id ON club_invite (club_id);
+CREATE INDEX club_invite_created_by ON club_invite (created_by);
+CREATE INDEX club_invite_email ON club_invite (email);
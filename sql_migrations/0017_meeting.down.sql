@@ -0,0 +1,3 @@
+DROP TABLE meeting_rsvp;
+DROP TABLE meeting;
+ALTER TABLE user_data DROP COLUMN time_zone;
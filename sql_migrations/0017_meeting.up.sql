@@ -0,0 +1,36 @@
+-- time_zone is the IANA time zone meeting times are shown in for the user
+ALTER TABLE user_data ADD COLUMN time_zone character varying(64) NOT NULL DEFAULT 'UTC';
+CREATE TABLE meeting (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	club_id uuid NOT NULL REFERENCES club (id) ON DELETE CASCADE,
+	book_id uuid REFERENCES book (id) ON DELETE SET NULL,
+	title character varying(200) NOT NULL CONSTRAINT meetingTitleLength CHECK (char_length(title) > 0),
+	description character varying(2000) NOT NULL DEFAULT '',
+	-- starts_at and ends_at are in UTC, time_zone is where the meeting is held
+	starts_at timestamp NOT NULL,
+	ends_at timestamp NOT NULL,
+	time_zone character varying(64) NOT NULL,
+	location character varying(500) NOT NULL DEFAULT '',
+	video_url character varying(2000) NOT NULL DEFAULT '',
+	-- capacity counts guests, NULL is no limit
+	capacity integer CONSTRAINT meetingCapacityPositive CHECK (capacity > 0),
+	created_by uuid NOT NULL REFERENCES user_data (id),
+	created_at timestamp DEFAULT NOW() NOT NULL,
+	updated_at timestamp DEFAULT NOW() NOT NULL,
+	CONSTRAINT meetingEndsAfterStart CHECK (ends_at > starts_at)
+);
+CREATE INDEX meeting_club_id_starts_at ON meeting (club_id, starts_at);
+CREATE INDEX meeting_created_by ON meeting (created_by);
+CREATE TABLE meeting_rsvp (
+	meeting_id uuid NOT NULL REFERENCES meeting (id) ON DELETE CASCADE,
+	user_id uuid NOT NULL REFERENCES user_data (id),
+	response character varying(5) NOT NULL CONSTRAINT rsvpResponseValid CHECK (response IN ('yes', 'no', 'maybe')),
+	guests integer NOT NULL DEFAULT 0 CONSTRAINT rsvpGuestsPositive CHECK (guests >= 0),
+	-- waitlisted_at orders the waitlist, it is set while waitlisted is true
+	waitlisted boolean NOT NULL DEFAULT false,
+	waitlisted_at timestamp,
+	created_at timestamp DEFAULT NOW() NOT NULL,
+	updated_at timestamp DEFAULT NOW() NOT NULL,
+	PRIMARY KEY (meeting_id, user_id)
+);
+CREATE INDEX meeting_rsvp_user_id ON meeting_rsvp (user_id);
@@ -0,0 +1,2 @@
+DROP TABLE reading_plan_section;
+DROP TABLE reading_plan;
@@ -0,0 +1,25 @@
+CREATE TABLE reading_plan (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	club_id uuid NOT NULL REFERENCES club (id) ON DELETE CASCADE,
+	book_id uuid NOT NULL REFERENCES book (id),
+	unit character varying(10) NOT NULL CONSTRAINT readingPlanUnitValid CHECK (unit IN ('chapter', 'page')),
+	created_by uuid NOT NULL REFERENCES user_data (id),
+	created_at timestamp DEFAULT NOW() NOT NULL,
+	updated_at timestamp DEFAULT NOW() NOT NULL
+);
+CREATE INDEX reading_plan_club_id ON reading_plan (club_id);
+CREATE INDEX reading_plan_created_by ON reading_plan (created_by);
+-- Sections are numbered from 1. A section keeps its id while it is in the plan, so a thread about it
+-- stays with it when sections are added or removed before it
+CREATE TABLE reading_plan_section (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	plan_id uuid NOT NULL REFERENCES reading_plan (id) ON DELETE CASCADE,
+	position integer NOT NULL CONSTRAINT sectionPositionPositive CHECK (position > 0),
+	title character varying(200) NOT NULL,
+	range_start integer NOT NULL CONSTRAINT sectionStartPositive CHECK (range_start > 0),
+	range_end integer NOT NULL,
+	due_date date NOT NULL,
+	-- Checked at commit so a replaced plan can move sections past each other
+	CONSTRAINT sectionPositionUnique UNIQUE (plan_id, position) DEFERRABLE INITIALLY DEFERRED,
+	CONSTRAINT sectionRangeValid CHECK (range_end >= range_start)
+);
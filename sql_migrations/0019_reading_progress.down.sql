@@ -0,0 +1,2 @@
+DROP TABLE reading_progress;
+ALTER TABLE club_role DROP COLUMN share_progress;
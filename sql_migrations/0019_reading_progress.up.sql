@@ -0,0 +1,14 @@
+-- Members choose, per club, whether the club can see their reading progress
+ALTER TABLE club_role ADD COLUMN share_progress boolean NOT NULL DEFAULT false;
+CREATE TABLE reading_progress (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	user_id uuid NOT NULL REFERENCES user_data (id),
+	book_id uuid NOT NULL REFERENCES book (id),
+	page integer CONSTRAINT progressPagePositive CHECK (page >= 0),
+	percent integer CONSTRAINT progressPercentValid CHECK (percent BETWEEN 0 AND 100),
+	chapter integer CONSTRAINT progressChapterPositive CHECK (chapter >= 0),
+	recorded_at timestamp DEFAULT NOW() NOT NULL,
+	CONSTRAINT progressOneMeasure CHECK (num_nonnulls(page, percent, chapter) = 1)
+);
+CREATE INDEX reading_progress_user_id_book_id ON reading_progress (user_id, book_id, recorded_at);
+CREATE INDEX reading_progress_book_id ON reading_progress (book_id);
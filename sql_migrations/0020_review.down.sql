@@ -0,0 +1,3 @@
+DROP TABLE review_vote;
+DROP TABLE review;
+ALTER TABLE book DROP COLUMN rating_histogram, DROP COLUMN rating_sum, DROP COLUMN rating_count;
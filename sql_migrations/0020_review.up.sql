@@ -0,0 +1,26 @@
+-- The rating of a book is cached on it and kept in step with its reviews. rating_histogram counts the
+-- ratings by half star, the first element is half a star and the last is five stars
+ALTER TABLE book ADD COLUMN rating_count integer NOT NULL DEFAULT 0,
+	ADD COLUMN rating_sum numeric(12,1) NOT NULL DEFAULT 0,
+	ADD COLUMN rating_histogram integer[] NOT NULL DEFAULT '{0,0,0,0,0,0,0,0,0,0}';
+CREATE TABLE review (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	book_id uuid NOT NULL REFERENCES book (id),
+	user_id uuid NOT NULL REFERENCES user_data (id),
+	rating numeric(2,1) NOT NULL CONSTRAINT reviewRatingValid CHECK (rating BETWEEN 0.5 AND 5 AND rating * 2 = trunc(rating * 2)),
+	body character varying(10000) NOT NULL DEFAULT '',
+	spoiler boolean NOT NULL DEFAULT false,
+	created_at timestamp DEFAULT NOW() NOT NULL,
+	updated_at timestamp DEFAULT NOW() NOT NULL,
+	CONSTRAINT reviewOnePerUser UNIQUE (book_id, user_id)
+);
+CREATE INDEX review_book_id_created_at ON review (book_id, created_at);
+CREATE INDEX review_book_id_rating ON review (book_id, rating);
+CREATE INDEX review_user_id ON review (user_id);
+CREATE TABLE review_vote (
+	review_id uuid NOT NULL REFERENCES review (id) ON DELETE CASCADE,
+	user_id uuid NOT NULL REFERENCES user_data (id),
+	created_at timestamp DEFAULT NOW() NOT NULL,
+	PRIMARY KEY (review_id, user_id)
+);
+CREATE INDEX review_vote_user_id ON review_vote (user_id);
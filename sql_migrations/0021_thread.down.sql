@@ -0,0 +1,3 @@
+DROP TABLE thread_post_revision;
+DROP TABLE thread_post;
+DROP TABLE thread;
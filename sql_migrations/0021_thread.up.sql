@@ -0,0 +1,44 @@
+CREATE TABLE thread (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	club_id uuid NOT NULL REFERENCES club (id) ON DELETE CASCADE,
+	book_id uuid REFERENCES book (id),
+	-- When the plan or the section is removed the thread is kept and is no longer hidden from anyone
+	plan_id uuid REFERENCES reading_plan (id) ON DELETE SET NULL,
+	section_id uuid REFERENCES reading_plan_section (id) ON DELETE SET NULL,
+	title character varying(200) NOT NULL CONSTRAINT threadTitleLength CHECK (char_length(title) > 0),
+	created_by uuid NOT NULL REFERENCES user_data (id),
+	post_count integer NOT NULL DEFAULT 0,
+	last_post_at timestamp DEFAULT NOW() NOT NULL,
+	created_at timestamp DEFAULT NOW() NOT NULL,
+	updated_at timestamp DEFAULT NOW() NOT NULL,
+	deleted_at timestamp
+);
+CREATE INDEX thread_club_id_last_post_at ON thread (club_id, last_post_at, id);
+CREATE INDEX thread_book_id ON thread (book_id);
+CREATE INDEX thread_plan_id ON thread (plan_id);
+CREATE INDEX thread_section_id ON thread (section_id);
+CREATE INDEX thread_created_by ON thread (created_by);
+CREATE TABLE thread_post (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	thread_id uuid NOT NULL REFERENCES thread (id) ON DELETE CASCADE,
+	parent_id uuid REFERENCES thread_post (id),
+	depth integer NOT NULL DEFAULT 0,
+	author_id uuid NOT NULL REFERENCES user_data (id),
+	body character varying(10000) NOT NULL,
+	created_at timestamp DEFAULT NOW() NOT NULL,
+	edited_at timestamp,
+	deleted_at timestamp,
+	deleted_by uuid REFERENCES user_data (id)
+);
+CREATE INDEX thread_post_thread_id_created_at ON thread_post (thread_id, created_at, id);
+CREATE INDEX thread_post_parent_id ON thread_post (parent_id);
+CREATE INDEX thread_post_author_id ON thread_post (author_id);
+-- A revision is the body of a post before an edit replaced it
+CREATE TABLE thread_post_revision (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	post_id uuid NOT NULL REFERENCES thread_post (id) ON DELETE CASCADE,
+	body character varying(10000) NOT NULL,
+	created_at timestamp NOT NULL,
+	replaced_at timestamp DEFAULT NOW() NOT NULL
+);
+CREATE INDEX thread_post_revision_post_id ON thread_post_revision (post_id, replaced_at);
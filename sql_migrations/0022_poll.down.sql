@@ -0,0 +1,4 @@
+DROP TABLE poll_ballot;
+DROP TABLE poll_option;
+DROP TABLE poll;
+DROP TABLE nomination;
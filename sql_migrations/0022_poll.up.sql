@@ -0,0 +1,48 @@
+CREATE TABLE nomination (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	club_id uuid NOT NULL REFERENCES club (id) ON DELETE CASCADE,
+	book_id uuid NOT NULL REFERENCES book (id),
+	nominated_by uuid NOT NULL REFERENCES user_data (id),
+	note character varying(500) NOT NULL DEFAULT '',
+	created_at timestamp DEFAULT NOW() NOT NULL,
+	CONSTRAINT nominationOncePerClub UNIQUE (club_id, book_id)
+);
+CREATE INDEX nomination_club_id_created_at ON nomination (club_id, created_at, id);
+CREATE INDEX nomination_nominated_by ON nomination (nominated_by);
+-- opens_at and closes_at are in UTC, a poll is open between them. Closing a poll early moves closes_at
+CREATE TABLE poll (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	club_id uuid NOT NULL REFERENCES club (id) ON DELETE CASCADE,
+	title character varying(200) NOT NULL CONSTRAINT pollTitleLength CHECK (char_length(title) > 0),
+	method character varying(8) NOT NULL CONSTRAINT pollMethodValid CHECK (method IN ('single', 'approval', 'ranked')),
+	opens_at timestamp NOT NULL,
+	closes_at timestamp NOT NULL,
+	hide_results boolean NOT NULL DEFAULT false,
+	created_by uuid NOT NULL REFERENCES user_data (id),
+	created_at timestamp DEFAULT NOW() NOT NULL,
+	updated_at timestamp DEFAULT NOW() NOT NULL,
+	CONSTRAINT pollClosesAfterOpen CHECK (closes_at > opens_at)
+);
+CREATE INDEX poll_club_id_closes_at ON poll (club_id, closes_at);
+CREATE INDEX poll_created_by ON poll (created_by);
+-- The options are the books of the poll, they are kept when a nomination is withdrawn. position is
+-- the order they were nominated in and breaks ties
+CREATE TABLE poll_option (
+	poll_id uuid NOT NULL REFERENCES poll (id) ON DELETE CASCADE,
+	book_id uuid NOT NULL REFERENCES book (id),
+	position integer NOT NULL,
+	PRIMARY KEY (poll_id, book_id),
+	CONSTRAINT pollOptionPosition UNIQUE (poll_id, position)
+);
+-- choices are book ids, most preferred first for a ranked poll. user_id is cleared when the user is
+-- erased so the ballot still counts
+CREATE TABLE poll_ballot (
+	id uuid NOT NULL PRIMARY KEY DEFAULT uuid_generate_v1(),
+	poll_id uuid NOT NULL REFERENCES poll (id) ON DELETE CASCADE,
+	user_id uuid REFERENCES user_data (id),
+	choices uuid[] NOT NULL CONSTRAINT ballotChoicesPresent CHECK (cardinality(choices) > 0),
+	created_at timestamp DEFAULT NOW() NOT NULL,
+	updated_at timestamp DEFAULT NOW() NOT NULL,
+	CONSTRAINT ballotOnePerUser UNIQUE (poll_id, user_id)
+);
+CREATE INDEX poll_ballot_user_id ON poll_ballot (user_id);
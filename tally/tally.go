@@ -0,0 +1,143 @@
+package tally
+
+import (
+	"sort"
+
+	"github.com/garycarr/book_club/common"
+)
+
+// Count tallies the ballots of the poll by its method. The result only depends on the options and the
+// ballots, not the order the ballots are in. Choices that are not options of the poll are skipped and
+// ballots left without a choice are not counted
+func Count(poll *common.Poll, ballots []common.Ballot) common.PollResult {
+	position := map[string]int{}
+	for i, o := range poll.Options {
+		position[o.BookID] = i
+	}
+	// Each ballot becomes the positions of its choices, in the order they were made
+	choices := [][]int{}
+	for _, b := range ballots {
+		c := []int{}
+		for _, bookID := range b.Choices {
+			if i, ok := position[bookID]; ok {
+				c = append(c, i)
+			}
+		}
+		if len(c) > 0 {
+			choices = append(choices, c)
+		}
+	}
+	result := common.PollResult{Method: poll.Method, Ballots: len(choices)}
+	if poll.Method == common.PollMethodRanked && len(choices) > 0 {
+		instantRunoff(&result, poll.Options, choices)
+		return result
+	}
+	votes := make([]int, len(poll.Options))
+	for _, c := range choices {
+		if poll.Method == common.PollMethodSingle {
+			c = c[:1]
+		}
+		for _, i := range c {
+			votes[i]++
+		}
+	}
+	result.Counts = rank(poll.Options, votes, nil)
+	if len(result.Counts) > 0 && result.Counts[0].Votes > 0 {
+		result.Winner = result.Counts[0].BookID
+		result.Tied = len(result.Counts) > 1 && result.Counts[1].Votes == result.Counts[0].Votes
+	}
+	return result
+}
+
+// instantRunoff counts each ballot for its most preferred option still in the running. An option with
+// more than half of the ballots still being counted wins, otherwise the option with the fewest votes
+// is eliminated and the ballots for it move on to their next choice
+func instantRunoff(result *common.PollResult, options []common.PollOption, choices [][]int) {
+	running := make([]bool, len(options))
+	for i := range running {
+		running[i] = true
+	}
+	remaining := len(options)
+	history := [][]int{}
+	for {
+		votes := make([]int, len(options))
+		round := common.PollRound{}
+		for _, c := range choices {
+			top := -1
+			for _, i := range c {
+				if running[i] {
+					top = i
+					break
+				}
+			}
+			if top < 0 {
+				round.Exhausted++
+				continue
+			}
+			votes[top]++
+		}
+		history = append(history, votes)
+		round.Counts = rank(options, votes, running)
+		leader := round.Counts[0]
+		if remaining == 1 || leader.Votes*2 > len(choices)-round.Exhausted {
+			result.Rounds = append(result.Rounds, round)
+			result.Counts = round.Counts
+			if leader.Votes > 0 {
+				result.Winner = leader.BookID
+			}
+			return
+		}
+		loser, tied := eliminate(running, history)
+		running[loser] = false
+		remaining--
+		round.Eliminated = options[loser].BookID
+		result.Rounds = append(result.Rounds, round)
+		result.Tied = remaining == 1 && tied
+	}
+}
+
+// eliminate picks the option in the running with the fewest votes in the latest round. A tie goes to
+// the option with fewer votes in the round before, and so on back to the first round, then to the
+// option nominated last. tied is set when more than one option had the fewest votes
+func eliminate(running []bool, history [][]int) (loser int, tied bool) {
+	candidates := []int{}
+	for i := range running {
+		if running[i] {
+			candidates = append(candidates, i)
+		}
+	}
+	for r := len(history) - 1; r >= 0 && len(candidates) > 1; r-- {
+		fewest := history[r][candidates[0]]
+		for _, i := range candidates {
+			if history[r][i] < fewest {
+				fewest = history[r][i]
+			}
+		}
+		level := []int{}
+		for _, i := range candidates {
+			if history[r][i] == fewest {
+				level = append(level, i)
+			}
+		}
+		if r == len(history)-1 {
+			tied = len(level) > 1
+		}
+		candidates = level
+	}
+	return candidates[len(candidates)-1], tied
+}
+
+// rank returns the votes of the options, most votes first and in the order the options were nominated
+// when level. When running is given only the options still in the running are included
+func rank(options []common.PollOption, votes []int, running []bool) []common.PollCount {
+	counts := []common.PollCount{}
+	for i, o := range options {
+		if running == nil || running[i] {
+			counts = append(counts, common.PollCount{BookID: o.BookID, Votes: votes[i]})
+		}
+	}
+	sort.SliceStable(counts, func(i, j int) bool {
+		return counts[i].Votes > counts[j].Votes
+	})
+	return counts
+}
@@ -0,0 +1,183 @@
+package tally
+
+import (
+	"testing"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// ballots repeats the choices as many ballots
+func ballots(n int, choices ...string) []common.Ballot {
+	b := []common.Ballot{}
+	for i := 0; i < n; i++ {
+		b = append(b, common.Ballot{Choices: choices})
+	}
+	return b
+}
+
+// vote is the votes for a book
+func vote(bookID string, votes int) common.PollCount {
+	return common.PollCount{BookID: bookID, Votes: votes}
+}
+
+// join puts the groups of ballots together
+func join(groups ...[]common.Ballot) []common.Ballot {
+	all := []common.Ballot{}
+	for _, g := range groups {
+		all = append(all, g...)
+	}
+	return all
+}
+
+func TestCount(t *testing.T) {
+	type testData struct {
+		description    string
+		ballots        []common.Ballot
+		expectedBallot int
+		expectedCounts []common.PollCount
+		expectedRounds []common.PollRound
+		expectedTied   bool
+		expectedWinner string
+		method         string
+		options        []string
+	}
+
+	testTable := []testData{
+		testData{
+			description:    "No ballots",
+			expectedCounts: []common.PollCount{vote("a", 0), vote("b", 0)},
+			method:         common.PollMethodSingle,
+			options:        []string{"a", "b"},
+		},
+		testData{
+			description:    "Single choice",
+			ballots:        join(ballots(2, "b"), ballots(3, "c"), ballots(1, "a")),
+			expectedBallot: 6,
+			expectedCounts: []common.PollCount{vote("c", 3), vote("b", 2), vote("a", 1)},
+			expectedWinner: "c",
+			method:         common.PollMethodSingle,
+			options:        []string{"a", "b", "c"},
+		},
+		testData{
+			description:    "Single choice tie goes to the book nominated first",
+			ballots:        join(ballots(2, "b"), ballots(2, "a")),
+			expectedBallot: 4,
+			expectedCounts: []common.PollCount{vote("a", 2), vote("b", 2), vote("c", 0)},
+			expectedTied:   true,
+			expectedWinner: "a",
+			method:         common.PollMethodSingle,
+			options:        []string{"a", "b", "c"},
+		},
+		testData{
+			description:    "Approval counts every choice",
+			ballots:        join(ballots(3, "a"), ballots(2, "b", "c"), ballots(2, "c", "a"), ballots(1, "c")),
+			expectedBallot: 8,
+			expectedCounts: []common.PollCount{vote("c", 5), vote("a", 5), vote("b", 2)},
+			expectedTied:   true,
+			expectedWinner: "c",
+			method:         common.PollMethodApproval,
+			options:        []string{"c", "a", "b"},
+		},
+		testData{
+			description:    "Choices that are not options are skipped",
+			ballots:        join(ballots(2, "gone"), ballots(1, "gone", "b"), ballots(1, "a")),
+			expectedBallot: 2,
+			expectedCounts: []common.PollCount{vote("a", 1), vote("b", 1)},
+			expectedTied:   true,
+			expectedWinner: "a",
+			method:         common.PollMethodApproval,
+			options:        []string{"a", "b"},
+		},
+		testData{
+			description:    "Ranked majority in the first round",
+			ballots:        join(ballots(3, "a", "b"), ballots(2, "b", "a")),
+			expectedBallot: 5,
+			expectedCounts: []common.PollCount{vote("a", 3), vote("b", 2)},
+			expectedRounds: []common.PollRound{
+				{Counts: []common.PollCount{vote("a", 3), vote("b", 2)}},
+			},
+			expectedWinner: "a",
+			method:         common.PollMethodRanked,
+			options:        []string{"a", "b"},
+		},
+		testData{
+			description:    "Ranked votes move on from the eliminated book",
+			ballots:        join(ballots(4, "a"), ballots(3, "b", "c"), ballots(2, "c", "b")),
+			expectedBallot: 9,
+			expectedCounts: []common.PollCount{vote("b", 5), vote("a", 4)},
+			expectedRounds: []common.PollRound{
+				{Counts: []common.PollCount{vote("a", 4), vote("b", 3), vote("c", 2)}, Eliminated: "c"},
+				{Counts: []common.PollCount{vote("b", 5), vote("a", 4)}},
+			},
+			expectedWinner: "b",
+			method:         common.PollMethodRanked,
+			options:        []string{"a", "b", "c"},
+		},
+		testData{
+			description: "Ranked exhausted ballots are not counted towards the majority",
+			ballots: join(ballots(3, "a"), ballots(2, "b"), ballots(2, "c"), ballots(1, "d", "b"),
+				ballots(1, "d")),
+			expectedBallot: 9,
+			expectedCounts: []common.PollCount{vote("a", 3)},
+			expectedRounds: []common.PollRound{
+				{Counts: []common.PollCount{vote("a", 3), vote("b", 2), vote("c", 2), vote("d", 2)}, Eliminated: "d"},
+				{Counts: []common.PollCount{vote("a", 3), vote("b", 3), vote("c", 2)}, Eliminated: "c", Exhausted: 1},
+				{Counts: []common.PollCount{vote("a", 3), vote("b", 3)}, Eliminated: "b", Exhausted: 3},
+				{Counts: []common.PollCount{vote("a", 3)}, Exhausted: 6},
+			},
+			expectedTied:   true,
+			expectedWinner: "a",
+			method:         common.PollMethodRanked,
+			options:        []string{"a", "b", "c", "d"},
+		},
+		testData{
+			description:    "Ranked tie to eliminate goes to the earlier round",
+			ballots:        join(ballots(5, "a"), ballots(2, "b"), ballots(3, "c"), ballots(1, "d", "b")),
+			expectedBallot: 11,
+			expectedCounts: []common.PollCount{vote("a", 5), vote("c", 3)},
+			expectedRounds: []common.PollRound{
+				{Counts: []common.PollCount{vote("a", 5), vote("c", 3), vote("b", 2), vote("d", 1)}, Eliminated: "d"},
+				{Counts: []common.PollCount{vote("a", 5), vote("b", 3), vote("c", 3)}, Eliminated: "b"},
+				{Counts: []common.PollCount{vote("a", 5), vote("c", 3)}, Exhausted: 3},
+			},
+			expectedWinner: "a",
+			method:         common.PollMethodRanked,
+			options:        []string{"a", "b", "c", "d"},
+		},
+		testData{
+			description:    "Ranked tie in every round goes to the book nominated first",
+			ballots:        join(ballots(2, "a"), ballots(2, "b", "a")),
+			expectedBallot: 4,
+			expectedCounts: []common.PollCount{vote("a", 4)},
+			expectedRounds: []common.PollRound{
+				{Counts: []common.PollCount{vote("a", 2), vote("b", 2)}, Eliminated: "b"},
+				{Counts: []common.PollCount{vote("a", 4)}},
+			},
+			expectedTied:   true,
+			expectedWinner: "a",
+			method:         common.PollMethodRanked,
+			options:        []string{"a", "b"},
+		},
+	}
+	for _, td := range testTable {
+		poll := &common.Poll{Method: td.method}
+		for _, o := range td.options {
+			poll.Options = append(poll.Options, common.PollOption{BookID: o})
+		}
+		result := Count(poll, td.ballots)
+		assert.Equal(t, td.method, result.Method, td.description)
+		assert.Equal(t, td.expectedBallot, result.Ballots, td.description)
+		assert.Equal(t, td.expectedCounts, result.Counts, td.description)
+		assert.Equal(t, td.expectedRounds, result.Rounds, td.description)
+		assert.Equal(t, td.expectedTied, result.Tied, td.description)
+		assert.Equal(t, td.expectedWinner, result.Winner, td.description)
+
+		// Reversing the ballots does not change the result
+		reversed := make([]common.Ballot, len(td.ballots))
+		for i, b := range td.ballots {
+			reversed[len(td.ballots)-1-i] = b
+		}
+		assert.Equal(t, result, Count(poll, reversed), td.description)
+	}
+}
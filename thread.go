@@ -0,0 +1,492 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/gorilla/mux"
+)
+
+// clubThreadsPost starts a discussion in a club. It can be about a book, or about a section of a
+// reading plan of the club in which case the book is the book of the plan
+func (a *app) clubThreadsPost(w http.ResponseWriter, r *http.Request) {
+	tr := common.ThreadRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&tr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := tr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	thread := &common.Thread{ClubID: mux.Vars(r)["clubID"], BookID: tr.BookID, PlanID: tr.PlanID,
+		SectionID: tr.SectionID, Title: tr.Title, CreatedBy: claims.UserID}
+	if thread.PlanID != "" {
+		plan, err := a.warehouse.GetReadingPlan(thread.ClubID, thread.PlanID)
+		if err != nil {
+			if err == common.ErrReadingPlanNotFound {
+				a.respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			a.logrus.WithError(err).Error("Unable to get reading plan")
+			a.respondWithError(w, http.StatusInternalServerError, "Error getting the reading plan")
+			return
+		}
+		if plan.Section(thread.SectionID) == nil {
+			a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", common.ErrThreadSectionInvalid))
+			return
+		}
+		if thread.BookID != "" && thread.BookID != plan.BookID {
+			a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", common.ErrThreadBookMismatch))
+			return
+		}
+		thread.BookID = plan.BookID
+	} else if thread.BookID != "" {
+		if _, ok := a.lookupBook(w, thread.BookID); !ok {
+			return
+		}
+	}
+	post := &common.Post{AuthorID: claims.UserID, Body: tr.Body}
+	if err := a.warehouse.CreateThread(thread, post); err != nil {
+		if err == common.ErrBookNotFound {
+			a.respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to create thread")
+		a.respondWithError(w, http.StatusInternalServerError, "Error creating the thread")
+		return
+	}
+	a.respondWithJSON(w, http.StatusCreated, thread)
+}
+
+// clubThreadsGet lists the threads of a club a page at a time, the most recently posted in first. The
+// bookID, planID and sectionID query parameters filter the list
+func (a *app) clubThreadsGet(w http.ResponseWriter, r *http.Request) {
+	pagination, ok := a.requestCursorPagination(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	filter := common.ThreadFilter{
+		ClubID:           mux.Vars(r)["clubID"],
+		BookID:           query.Get("bookID"),
+		PlanID:           query.Get("planID"),
+		SectionID:        query.Get("sectionID"),
+		CursorPagination: pagination,
+	}
+	if filter.SectionID != "" && filter.PlanID == "" {
+		a.respondWithError(w, http.StatusBadRequest, common.ErrThreadSectionInvalid.Error())
+		return
+	}
+	threads, next, err := a.warehouse.ListThreads(filter)
+	if err != nil {
+		if err == common.ErrThreadNotFound {
+			// An id in the filter that is not a uuid matches nothing
+			a.respondWithJSON(w, http.StatusOK, cursorPage("threads", []common.Thread{}, nil))
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to list threads")
+		a.respondWithError(w, http.StatusInternalServerError, "Error listing the threads")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, cursorPage("threads", threads, next))
+}
+
+// clubThreadsOptions returns the allowed options
+func (a *app) clubThreadsOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubThreadGet returns a thread, hidden is set when its posts are kept from the current user
+func (a *app) clubThreadGet(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	thread, ok := a.requestThread(w, r)
+	if !ok {
+		return
+	}
+	if thread.Hidden, ok = a.threadHidden(w, r, claims, thread); !ok {
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, thread)
+}
+
+// clubThreadPatch renames a thread, only the member who started it or a moderator can
+func (a *app) clubThreadPatch(w http.ResponseWriter, r *http.Request) {
+	tur := common.ThreadUpdateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&tur); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := tur.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	thread, ok := a.requestThread(w, r)
+	if !ok {
+		return
+	}
+	if !authorOrModerator(claims, thread.ClubID, thread.CreatedBy) {
+		a.respondWithPermissionDenied(w, common.PermissionClubModerate)
+		return
+	}
+	thread.Title = tur.Title
+	if err := a.warehouse.UpdateThread(thread); err != nil {
+		if err == common.ErrThreadNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to update thread")
+		a.respondWithError(w, http.StatusInternalServerError, "Error updating the thread")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, thread)
+}
+
+// clubThreadDelete removes a thread and its posts, only the member who started it or a moderator can
+func (a *app) clubThreadDelete(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	thread, ok := a.requestThread(w, r)
+	if !ok {
+		return
+	}
+	if !authorOrModerator(claims, thread.ClubID, thread.CreatedBy) {
+		a.respondWithPermissionDenied(w, common.PermissionClubModerate)
+		return
+	}
+	if err := a.warehouse.DeleteThread(thread.ClubID, thread.ID); err != nil {
+		if err == common.ErrThreadNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to delete thread")
+		a.respondWithError(w, http.StatusInternalServerError, "Error deleting the thread")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Thread deleted"})
+}
+
+// clubThreadOptions returns the allowed options
+func (a *app) clubThreadOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubThreadPostsGet lists the posts of a thread a page at a time, oldest first. In a section thread
+// the bodies are hidden until the progress of the current user reaches the section, other than their
+// own posts. The spoilers=true query parameter shows them anyway
+func (a *app) clubThreadPostsGet(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	pagination, ok := a.requestCursorPagination(w, r)
+	if !ok {
+		return
+	}
+	thread, ok := a.requestThread(w, r)
+	if !ok {
+		return
+	}
+	hidden, ok := a.threadHidden(w, r, claims, thread)
+	if !ok {
+		return
+	}
+	posts, next, err := a.warehouse.ListPosts(thread.ID, pagination)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to list posts")
+		a.respondWithError(w, http.StatusInternalServerError, "Error listing the posts")
+		return
+	}
+	if hidden {
+		for i := range posts {
+			if posts[i].AuthorID != claims.UserID {
+				posts[i].Hide()
+			}
+		}
+	}
+	a.respondWithJSON(w, http.StatusOK, cursorPage("posts", posts, next))
+}
+
+// clubThreadPostsPost adds a post to a thread, replying to parentID when it is given
+func (a *app) clubThreadPostsPost(w http.ResponseWriter, r *http.Request) {
+	pr := common.PostRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := pr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	thread, ok := a.requestThread(w, r)
+	if !ok {
+		return
+	}
+	post := &common.Post{ThreadID: thread.ID, ParentID: pr.ParentID, AuthorID: claims.UserID, Body: pr.Body}
+	if err := a.warehouse.CreatePost(post); err != nil {
+		switch err {
+		case common.ErrPostParentNotFound, common.ErrPostTooDeep:
+			a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		default:
+			a.logrus.WithError(err).Error("Unable to create post")
+			a.respondWithError(w, http.StatusInternalServerError, "Error creating the post")
+		}
+		return
+	}
+	a.respondWithJSON(w, http.StatusCreated, post)
+}
+
+// clubThreadPostsOptions returns the allowed options
+func (a *app) clubThreadPostsOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubThreadPostPatch edits a post, only its author can. The body it replaces is kept in the history
+func (a *app) clubThreadPostPatch(w http.ResponseWriter, r *http.Request) {
+	pur := common.PostUpdateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&pur); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := pur.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	thread, ok := a.requestThread(w, r)
+	if !ok {
+		return
+	}
+	post, ok := a.requestPost(w, r, thread)
+	if !ok {
+		return
+	}
+	if post.AuthorID != claims.UserID {
+		a.respondWithError(w, http.StatusForbidden, common.ErrPermissionDenied.Error())
+		return
+	}
+	if post.Body == pur.Body {
+		a.respondWithJSON(w, http.StatusOK, post)
+		return
+	}
+	post.Body = pur.Body
+	if err := a.warehouse.UpdatePost(post); err != nil {
+		if err == common.ErrPostNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to update post")
+		a.respondWithError(w, http.StatusInternalServerError, "Error updating the post")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, post)
+}
+
+// clubThreadPostDelete removes a post, its replies are kept. Only its author or a moderator can
+func (a *app) clubThreadPostDelete(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	thread, ok := a.requestThread(w, r)
+	if !ok {
+		return
+	}
+	post, ok := a.requestPost(w, r, thread)
+	if !ok {
+		return
+	}
+	if !authorOrModerator(claims, thread.ClubID, post.AuthorID) {
+		a.respondWithPermissionDenied(w, common.PermissionClubModerate)
+		return
+	}
+	if err := a.warehouse.DeletePost(thread.ID, post.ID, claims.UserID); err != nil {
+		if err == common.ErrPostNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to delete post")
+		a.respondWithError(w, http.StatusInternalServerError, "Error deleting the post")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Post deleted"})
+}
+
+// clubThreadPostOptions returns the allowed options
+func (a *app) clubThreadPostOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// clubThreadPostHistoryGet lists the bodies edits to a post replaced, the most recent first. It is
+// kept from the current user like the post is
+func (a *app) clubThreadPostHistoryGet(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return
+	}
+	thread, ok := a.requestThread(w, r)
+	if !ok {
+		return
+	}
+	post, ok := a.requestPost(w, r, thread)
+	if !ok {
+		return
+	}
+	if post.AuthorID != claims.UserID {
+		hidden, ok := a.threadHidden(w, r, claims, thread)
+		if !ok {
+			return
+		}
+		if hidden {
+			a.respondWithError(w, http.StatusForbidden, common.ErrThreadSpoiler.Error())
+			return
+		}
+	}
+	revisions, err := a.warehouse.ListPostRevisions(post.ID)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to list post revisions")
+		a.respondWithError(w, http.StatusInternalServerError, "Error listing the history of the post")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]interface{}{"revisions": revisions})
+}
+
+// clubThreadPostHistoryOptions returns the allowed options
+func (a *app) clubThreadPostHistoryOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// requestThread loads the thread of the club in the route. If it returns false the error response has
+// already been written
+func (a *app) requestThread(w http.ResponseWriter, r *http.Request) (*common.Thread, bool) {
+	vars := mux.Vars(r)
+	thread, err := a.warehouse.GetThread(vars["clubID"], vars["threadID"])
+	if err != nil {
+		if err == common.ErrThreadNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return nil, false
+		}
+		a.logrus.WithError(err).Error("Unable to get thread")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the thread")
+		return nil, false
+	}
+	return thread, true
+}
+
+// requestPost loads the post of the thread in the route, deleted posts are not found. If it returns
+// false the error response has already been written
+func (a *app) requestPost(w http.ResponseWriter, r *http.Request, thread *common.Thread) (*common.Post, bool) {
+	post, err := a.warehouse.GetPost(thread.ID, mux.Vars(r)["postID"])
+	if err == nil && post.Deleted {
+		err = common.ErrPostNotFound
+	}
+	if err != nil {
+		if err == common.ErrPostNotFound {
+			a.respondWithError(w, http.StatusNotFound, err.Error())
+			return nil, false
+		}
+		a.logrus.WithError(err).Error("Unable to get post")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the post")
+		return nil, false
+	}
+	return post, true
+}
+
+// threadHidden checks whether the posts of a section thread are kept from the user, as their latest
+// progress through the book has not reached the start of the section. Threads whose plan or section
+// has gone are not hidden, and the spoilers=true query parameter shows them anyway. If it returns
+// false for ok the error response has already been written
+func (a *app) threadHidden(w http.ResponseWriter, r *http.Request, claims *common.TokenClaims,
+	thread *common.Thread) (hidden bool, ok bool) {
+	if thread.PlanID == "" || thread.SectionID == "" || r.URL.Query().Get("spoilers") == "true" {
+		return false, true
+	}
+	plan, err := a.warehouse.GetReadingPlan(thread.ClubID, thread.PlanID)
+	if err == common.ErrReadingPlanNotFound {
+		return false, true
+	}
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to get reading plan")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the reading plan")
+		return false, false
+	}
+	section := plan.Section(thread.SectionID)
+	if section == nil {
+		return false, true
+	}
+	pageCount := 0
+	book, err := a.warehouse.GetBook(plan.BookID)
+	switch err {
+	case nil:
+		pageCount = book.PageCount
+	case common.ErrBookNotFound:
+	default:
+		a.logrus.WithError(err).Error("Unable to get book")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the book")
+		return false, false
+	}
+	history, err := a.warehouse.ListProgress(claims.UserID, plan.BookID)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to list progress")
+		a.respondWithError(w, http.StatusInternalServerError, "Error listing the progress")
+		return false, false
+	}
+	var latest *common.ReadingProgress
+	if len(history) > 0 {
+		latest = &history[0]
+	}
+	return !section.ReachedBy(latest, plan.Unit, pageCount), true
+}
+
+// authorOrModerator checks the user wrote something in the club or can moderate the club
+func authorOrModerator(claims *common.TokenClaims, clubID, authorID string) bool {
+	return claims.UserID == authorID || claims.HasPermission(common.PermissionClubModerate, clubID)
+}
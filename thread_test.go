@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// validSectionPlan is a plan in pages with a second section, sectionID2, starting at page 101
+func validSectionPlan() *common.ReadingPlan {
+	return &common.ReadingPlan{ID: "planID", ClubID: "clubID", BookID: "bookID", Unit: common.ReadingPlanUnitPage,
+		Sections: []common.ReadingPlanSection{
+			{ID: "sectionID1", Position: 1, Start: 1, End: 100, DueDate: "2030-03-07"},
+			{ID: "sectionID2", Position: 2, Start: 101, End: 200, DueDate: "2030-03-14"},
+		}}
+}
+
+func TestClubThreadsPost(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedBookID     string
+		expectedError      error
+		expectedHTTPStatus int
+		params             map[string]interface{}
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Club wide",
+			expectedHTTPStatus: http.StatusCreated,
+			params:             map[string]interface{}{"title": "Next month", "body": "What shall we read?"},
+		},
+		testData{
+			description:        "Section of a plan takes the book of the plan",
+			expectedBookID:     "bookID",
+			expectedHTTPStatus: http.StatusCreated,
+			params:             map[string]interface{}{"title": "Pages 101 to 200", "body": "That twist", "planID": "planID", "sectionID": "sectionID2"},
+		},
+		testData{
+			description:        "Section not in the plan",
+			expectedError:      common.ErrThreadSectionInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"title": "Epilogue", "body": "Well", "planID": "planID", "sectionID": "sectionID3"},
+		},
+		testData{
+			description:        "Book is not the book of the plan",
+			expectedError:      common.ErrThreadBookMismatch,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params: map[string]interface{}{"title": "Pages 1 to 100", "body": "Slow", "planID": "planID", "sectionID": "sectionID1",
+				"bookID": "otherBookID"},
+		},
+		testData{
+			description:        "Plan without a section",
+			expectedError:      common.ErrThreadSectionInvalid,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"title": "The plan", "body": "Too fast", "planID": "planID"},
+		},
+		testData{
+			description:        "No body",
+			expectedError:      common.ErrPostBodyNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+			params:             map[string]interface{}{"title": "Next month", "body": "  "},
+		},
+	}
+	for _, td := range testTable {
+		body, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/clubs/clubID/threads", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(common.ClubRoleMember))
+		if _, ok := td.params["sectionID"]; ok {
+			mockWarehouse.On("GetReadingPlan", "clubID", "planID").Return(validSectionPlan(), nil)
+		}
+		if td.expectedHTTPStatus == http.StatusCreated {
+			mockWarehouse.On("CreateThread", mock.MatchedBy(func(thread *common.Thread) bool {
+				return thread.ClubID == "clubID" && thread.BookID == td.expectedBookID && thread.CreatedBy == validUserID
+			}), mock.MatchedBy(func(post *common.Post) bool {
+				return post.AuthorID == validUserID && post.Body == td.params["body"]
+			})).Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+		}
+	}
+}
+
+func TestClubThreadsGetCursor(t *testing.T) {
+	lastPostAt := time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC)
+	after := &common.Cursor{Time: lastPostAt, ID: "6f1c2b8e-3d4a-4e5f-9a6b-7c8d9e0f1a2b"}
+	next := &common.Cursor{Time: lastPostAt.Add(-time.Hour), ID: "0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"}
+
+	req, err := http.NewRequest(http.MethodGet, "/clubs/clubID/threads?limit=1&bookID=bookID&cursor="+after.String(), nil)
+	if err != nil {
+		t.Fatalf("Error creating new request: %v", err)
+	}
+	a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(common.ClubRoleMember))
+	mockWarehouse.On("ListThreads", common.ThreadFilter{ClubID: "clubID", BookID: "bookID",
+		CursorPagination: common.CursorPagination{Limit: 1, After: after}}).
+		Return([]common.Thread{{ID: next.ID, LastPostAt: next.Time}}, next, nil)
+
+	a.Router.ServeHTTP(responseRecorder, req)
+	mockWarehouse.AssertExpectations(t)
+	if !assert.Equal(t, http.StatusOK, responseRecorder.Code) {
+		return
+	}
+	jsonResp := map[string]interface{}{}
+	if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+		t.Fatalf("Unable to decode JSON response: %v", err)
+	}
+	cursor, err := common.ParseCursor(jsonResp["nextCursor"].(string))
+	if assert.Nil(t, err) {
+		assert.Equal(t, next, cursor)
+	}
+
+	// Neither a cursor that is not one, nor one with an id that is not a uuid, reach the warehouse
+	tampered := common.Cursor{Time: lastPostAt, ID: "threadID"}
+	for _, c := range []string{"notacursor", tampered.String()} {
+		req, err = http.NewRequest(http.MethodGet, "/clubs/clubID/threads?cursor="+c, nil)
+		if err != nil {
+			t.Fatalf("Error creating new request: %v", err)
+		}
+		a, responseRecorder, _, mockWarehouse = setupAuthTest(req, clubClaims(common.ClubRoleMember))
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, http.StatusBadRequest, responseRecorder.Code, c)
+	}
+}
+
+func TestClubThreadPostsGetSpoilers(t *testing.T) {
+	type testData struct {
+		description    string
+		expectedHidden bool
+		planError      error
+		progress       []common.ReadingProgress
+		query          string
+		sections       []common.ReadingPlanSection
+	}
+
+	page := func(p int) []common.ReadingProgress {
+		return []common.ReadingProgress{{BookID: "bookID", Page: &p}}
+	}
+	chapter := 12
+	testTable := []testData{
+		testData{
+			description:    "No progress recorded",
+			expectedHidden: true,
+			progress:       []common.ReadingProgress{},
+		},
+		testData{
+			description:    "Progress before the section",
+			expectedHidden: true,
+			progress:       page(100),
+		},
+		testData{
+			description: "Progress at the start of the section",
+			progress:    page(101),
+		},
+		testData{
+			description:    "Progress in chapters can not be compared",
+			expectedHidden: true,
+			progress:       []common.ReadingProgress{{BookID: "bookID", Chapter: &chapter}},
+		},
+		testData{
+			description: "Asked for spoilers",
+			query:       "?spoilers=true",
+		},
+		testData{
+			description:    "Section moved by a section added before it",
+			expectedHidden: true,
+			progress:       page(120),
+			sections: []common.ReadingPlanSection{
+				{ID: "sectionID1", Position: 1, Start: 1, End: 100, DueDate: "2030-03-07"},
+				{ID: "sectionID3", Position: 2, Start: 101, End: 150, DueDate: "2030-03-10"},
+				{ID: "sectionID2", Position: 3, Start: 151, End: 200, DueDate: "2030-03-14"},
+			},
+		},
+		testData{
+			description: "Section removed from the plan",
+			sections: []common.ReadingPlanSection{
+				{ID: "sectionID1", Position: 1, Start: 1, End: 200, DueDate: "2030-03-14"},
+			},
+		},
+		testData{
+			description: "Plan removed",
+			planError:   common.ErrReadingPlanNotFound,
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodGet, "/clubs/clubID/threads/threadID/posts"+td.query, nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(common.ClubRoleMember))
+		mockWarehouse.On("GetThread", "clubID", "threadID").Return(&common.Thread{ID: "threadID", ClubID: "clubID",
+			BookID: "bookID", PlanID: "planID", SectionID: "sectionID2"}, nil)
+		if td.query == "" {
+			plan := validSectionPlan()
+			if td.sections != nil {
+				plan.Sections = td.sections
+			}
+			switch {
+			case td.planError != nil:
+				mockWarehouse.On("GetReadingPlan", "clubID", "planID").Return(nil, td.planError)
+			case plan.Section("sectionID2") == nil:
+				mockWarehouse.On("GetReadingPlan", "clubID", "planID").Return(plan, nil)
+			default:
+				mockWarehouse.On("GetReadingPlan", "clubID", "planID").Return(plan, nil)
+				mockWarehouse.On("GetBook", "bookID").Return(validBook(), nil)
+				mockWarehouse.On("ListProgress", validUserID, "bookID").Return(td.progress, nil)
+			}
+		}
+		mockWarehouse.On("ListPosts", "threadID", common.CursorPagination{Limit: common.DefaultPageLimit}).
+			Return([]common.Post{
+				{ID: "postID", AuthorID: "otherUserID", Body: "The butler did it"},
+				{ID: "replyID", ParentID: "postID", Depth: 1, AuthorID: validUserID, Body: "No way"},
+			}, nil, nil)
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, http.StatusOK, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		jsonResp := struct {
+			Posts      []common.Post `json:"posts"`
+			NextCursor *string       `json:"nextCursor"`
+		}{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		assert.Nil(t, jsonResp.NextCursor, td.description)
+		if !assert.Len(t, jsonResp.Posts, 2, td.description) {
+			continue
+		}
+		assert.Equal(t, td.expectedHidden, jsonResp.Posts[0].Hidden, td.description)
+		if td.expectedHidden {
+			assert.Empty(t, jsonResp.Posts[0].Body, td.description)
+		} else {
+			assert.Equal(t, "The butler did it", jsonResp.Posts[0].Body, td.description)
+		}
+		// Posts by the user are never hidden from them
+		assert.Equal(t, "No way", jsonResp.Posts[1].Body, td.description)
+	}
+}
+
+func TestClubThreadPostPatch(t *testing.T) {
+	type testData struct {
+		description        string
+		authorID           string
+		expectedHTTPStatus int
+		role               string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Author",
+			authorID:           validUserID,
+			expectedHTTPStatus: http.StatusOK,
+			role:               common.ClubRoleMember,
+		},
+		testData{
+			description:        "Moderators can not edit the posts of others",
+			authorID:           "otherUserID",
+			expectedHTTPStatus: http.StatusForbidden,
+			role:               common.ClubRoleModerator,
+		},
+	}
+	for _, td := range testTable {
+		body, err := json.Marshal(map[string]string{"body": "What a start"})
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPatch, "/clubs/clubID/threads/threadID/posts/postID", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(td.role))
+		mockWarehouse.On("GetThread", "clubID", "threadID").Return(&common.Thread{ID: "threadID", ClubID: "clubID"}, nil)
+		mockWarehouse.On("GetPost", "threadID", "postID").Return(&common.Post{ID: "postID", ThreadID: "threadID",
+			AuthorID: td.authorID, Body: "What a strat"}, nil)
+		if td.expectedHTTPStatus == http.StatusOK {
+			mockWarehouse.On("UpdatePost", mock.MatchedBy(func(p *common.Post) bool {
+				return p.ID == "postID" && p.Body == "What a start"
+			})).Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
+
+func TestClubThreadPostDelete(t *testing.T) {
+	type testData struct {
+		description        string
+		deleted            bool
+		expectedHTTPStatus int
+		role               string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Moderators can delete the posts of others",
+			expectedHTTPStatus: http.StatusOK,
+			role:               common.ClubRoleModerator,
+		},
+		testData{
+			description:        "Members can not",
+			expectedHTTPStatus: http.StatusForbidden,
+			role:               common.ClubRoleMember,
+		},
+		testData{
+			description:        "Already deleted",
+			deleted:            true,
+			expectedHTTPStatus: http.StatusNotFound,
+			role:               common.ClubRoleModerator,
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodDelete, "/clubs/clubID/threads/threadID/posts/postID", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, _, mockWarehouse := setupAuthTest(req, clubClaims(td.role))
+		mockWarehouse.On("GetThread", "clubID", "threadID").Return(&common.Thread{ID: "threadID", ClubID: "clubID"}, nil)
+		mockWarehouse.On("GetPost", "threadID", "postID").Return(&common.Post{ID: "postID", ThreadID: "threadID",
+			AuthorID: "otherUserID", Deleted: td.deleted}, nil)
+		if td.expectedHTTPStatus == http.StatusOK {
+			mockWarehouse.On("DeletePost", "threadID", "postID", validUserID).Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
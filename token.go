@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/util"
+	"github.com/sirupsen/logrus"
+)
+
+const refreshTokenExpiration = time.Duration(30 * 24 * time.Hour)
+
+// tokenRefreshPost exchanges a refresh token for a new JSON token and a rotated refresh token
+func (a *app) tokenRefreshPost(w http.ResponseWriter, r *http.Request) {
+	rtr := common.RefreshTokenRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&rtr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return
+	}
+	if err := rtr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return
+	}
+	rt, err := a.warehouse.GetRefreshToken(util.HashToken(rtr.RefreshToken))
+	if err != nil {
+		if err == common.ErrRefreshTokenNotFound {
+			a.respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to get refresh token")
+		a.respondWithError(w, http.StatusInternalServerError, "Error checking refresh token")
+		return
+	}
+	if rt.RevokedAt != nil || rt.ExpiresAt.Before(time.Now()) {
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrRefreshTokenNotFound.Error())
+		return
+	}
+	if rt.UsedAt != nil {
+		a.refreshTokenReused(w, rt)
+		return
+	}
+	user, err := a.warehouse.GetUserWithID(rt.UserID)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to get user for refresh token")
+		a.respondWithError(w, http.StatusInternalServerError, "Error checking refresh token")
+		return
+	}
+	tokens, err := a.createTokens(user, rt)
+	if err != nil {
+		if err == common.ErrRefreshTokenReused {
+			a.refreshTokenReused(w, rt)
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to create tokens")
+		a.respondWithError(w, http.StatusInternalServerError, "Unable to create tokens")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, tokens)
+}
+
+// tokenRefreshOptions returns the allowed options
+func (a *app) tokenRefreshOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// refreshTokenReused revokes the whole family of a refresh token that was presented after it
+// had already been rotated, one of the holders of the token is not who they say they are
+func (a *app) refreshTokenReused(w http.ResponseWriter, rt *common.RefreshToken) {
+	a.logrus.WithFields(logrus.Fields{
+		"userID":   rt.UserID,
+		"familyID": rt.FamilyID,
+	}).Warn("Refresh token reused, revoking the token family")
+	if err := a.warehouse.RevokeRefreshTokenFamily(rt.FamilyID); err != nil {
+		a.logrus.WithError(err).Error("Unable to revoke refresh token family")
+		a.respondWithError(w, http.StatusInternalServerError, "Error checking refresh token")
+		return
+	}
+	a.respondWithError(w, http.StatusUnauthorized, common.ErrRefreshTokenReused.Error())
+}
+
+// createTokens creates a JSON token and a refresh token for the user. When previous is nil the
+// refresh token starts a new family, otherwise previous is rotated
+func (a *app) createTokens(user *common.User, previous *common.RefreshToken) (map[string]string, error) {
+	refreshToken, err := a.util.CreateRandomToken()
+	if err != nil {
+		return nil, err
+	}
+	tokenHash := util.HashToken(refreshToken)
+	expiresAt := time.Now().Add(refreshTokenExpiration)
+	if previous == nil {
+		_, err = a.warehouse.CreateRefreshToken(user.ID, tokenHash, expiresAt)
+	} else {
+		_, err = a.warehouse.RotateRefreshToken(previous, tokenHash, expiresAt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	jsonToken, err := a.util.CreateJSONToken(user)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"token":        jsonToken,
+		"refreshToken": refreshToken,
+	}, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/util"
+	"github.com/garycarr/book_club/warehouse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestTokenRefreshPost(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedError      error
+		expectedHTTPStatus int
+		params             map[string]string
+		storedToken        *common.RefreshToken
+		rotateError        error
+	}
+
+	usedAt := time.Now().Add(-time.Minute)
+	validToken := func() *common.RefreshToken {
+		return &common.RefreshToken{
+			ID:        "tokenID",
+			UserID:    validUserID,
+			FamilyID:  "familyID",
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+	}
+	expiredToken := validToken()
+	expiredToken.ExpiresAt = time.Now().Add(-time.Hour)
+	revokedToken := validToken()
+	revokedToken.RevokedAt = &usedAt
+	usedToken := validToken()
+	usedToken.UsedAt = &usedAt
+
+	testTable := []testData{
+		testData{
+			description:        "Valid refresh token",
+			expectedHTTPStatus: http.StatusOK,
+			params:             map[string]string{"refreshToken": "oldRefreshToken"},
+			storedToken:        validToken(),
+		},
+		testData{
+			description:        "Refresh token not present",
+			expectedError:      common.ErrRefreshTokenNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+		},
+		testData{
+			description:        "Refresh token not found",
+			expectedError:      common.ErrRefreshTokenNotFound,
+			expectedHTTPStatus: http.StatusUnauthorized,
+			params:             map[string]string{"refreshToken": "oldRefreshToken"},
+		},
+		testData{
+			description:        "Refresh token expired",
+			expectedError:      common.ErrRefreshTokenNotFound,
+			expectedHTTPStatus: http.StatusUnauthorized,
+			params:             map[string]string{"refreshToken": "oldRefreshToken"},
+			storedToken:        expiredToken,
+		},
+		testData{
+			description:        "Refresh token revoked",
+			expectedError:      common.ErrRefreshTokenNotFound,
+			expectedHTTPStatus: http.StatusUnauthorized,
+			params:             map[string]string{"refreshToken": "oldRefreshToken"},
+			storedToken:        revokedToken,
+		},
+		testData{
+			description:        "Refresh token already rotated",
+			expectedError:      common.ErrRefreshTokenReused,
+			expectedHTTPStatus: http.StatusUnauthorized,
+			params:             map[string]string{"refreshToken": "oldRefreshToken"},
+			storedToken:        usedToken,
+		},
+		testData{
+			description:        "Refresh token rotated by a concurrent request",
+			expectedError:      common.ErrRefreshTokenReused,
+			expectedHTTPStatus: http.StatusUnauthorized,
+			params:             map[string]string{"refreshToken": "oldRefreshToken"},
+			storedToken:        validToken(),
+			rotateError:        common.ErrRefreshTokenReused,
+		},
+	}
+	jwt := "Bearer JWT"
+	refreshToken := "newRefreshToken"
+	user := &common.User{
+		ID:          validUserID,
+		Email:       validUserEmail,
+		DisplayName: validUserDisplayName,
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(td.params)
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/token/refresh", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder := setupTest(req)
+		mockWarehouse := warehouse.MockWarehouse{}
+		mockUtil := util.MockUtil{}
+		if td.params["refreshToken"] != "" {
+			oldHash := util.HashToken(td.params["refreshToken"])
+			if td.storedToken == nil {
+				mockWarehouse.On("GetRefreshToken", oldHash).Return(nil, common.ErrRefreshTokenNotFound)
+			} else {
+				mockWarehouse.On("GetRefreshToken", oldHash).Return(td.storedToken, nil)
+			}
+		}
+		if td.storedToken != nil && td.storedToken.UsedAt == nil && td.expectedError != common.ErrRefreshTokenNotFound {
+			mockWarehouse.On("GetUserWithID", validUserID).Return(user, nil)
+			mockUtil.On("CreateRandomToken").Return(refreshToken, nil)
+			if td.rotateError == nil {
+				mockWarehouse.On("RotateRefreshToken", td.storedToken, util.HashToken(refreshToken), mock.AnythingOfType("time.Time")).
+					Return(&common.RefreshToken{}, nil)
+				mockUtil.On("CreateJSONToken", user).Return(jwt, nil)
+			} else {
+				mockWarehouse.On("RotateRefreshToken", td.storedToken, util.HashToken(refreshToken), mock.AnythingOfType("time.Time")).
+					Return(nil, td.rotateError)
+			}
+		}
+		if td.expectedError == common.ErrRefreshTokenReused {
+			mockWarehouse.On("RevokeRefreshTokenFamily", td.storedToken.FamilyID).Return(nil)
+		}
+		a.warehouse = &mockWarehouse
+		a.util = &mockUtil
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		mockUtil.AssertExpectations(t)
+
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+
+		jsonResp := map[string]string{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		if td.expectedHTTPStatus != http.StatusOK {
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+			// We we were expecting an error there is nothing else to check
+			continue
+		}
+		assert.Equal(t, jwt, jsonResp["token"], td.description)
+		assert.Equal(t, refreshToken, jsonResp["refreshToken"], td.description)
+	}
+}
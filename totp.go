@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/util"
+)
+
+const totpIssuer = "Book Club"
+
+// userTOTPEnrollPost creates a new TOTP secret for the user. Two factor authentication is not
+// turned on until the user confirms they can create codes from the secret
+func (a *app) userTOTPEnrollPost(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.requestUser(w, r)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		a.respondWithError(w, http.StatusConflict, common.ErrTOTPAlreadyEnabled.Error())
+		return
+	}
+	secret, err := a.util.CreateTOTPSecret()
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to create TOTP secret")
+		a.respondWithError(w, http.StatusInternalServerError, "Error enrolling two factor authentication")
+		return
+	}
+	encryptedSecret, err := a.util.EncryptSecret(secret)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to encrypt TOTP secret")
+		a.respondWithError(w, http.StatusInternalServerError, "Error enrolling two factor authentication")
+		return
+	}
+	if err = a.warehouse.SetTOTPSecret(user.ID, encryptedSecret); err != nil {
+		if err == common.ErrTOTPAlreadyEnabled {
+			a.respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to store TOTP secret")
+		a.respondWithError(w, http.StatusInternalServerError, "Error enrolling two factor authentication")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{
+		"secret": secret,
+		"uri":    util.TOTPURI(secret, user.Email, totpIssuer),
+	})
+}
+
+// userTOTPConfirmPost turns on two factor authentication once the user gives a valid code for the
+// enrolled secret. The recovery codes are only ever shown in this response
+func (a *app) userTOTPConfirmPost(w http.ResponseWriter, r *http.Request) {
+	tcr, ok := a.decodeTOTPCodeRequest(w, r)
+	if !ok {
+		return
+	}
+	user, ok := a.requestUser(w, r)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		a.respondWithError(w, http.StatusConflict, common.ErrTOTPAlreadyEnabled.Error())
+		return
+	}
+	if user.TOTPSecret == "" {
+		a.respondWithError(w, http.StatusBadRequest, common.ErrTOTPNotEnrolled.Error())
+		return
+	}
+	keys, ok := a.checkMFALockout(w, user.ID)
+	if !ok {
+		return
+	}
+	if err := a.checkTOTPCode(user, tcr.Code); err != nil {
+		if err == common.ErrTOTPCodeInvalid {
+			a.recordLoginFailure(keys)
+		}
+		a.respondWithTOTPError(w, err)
+		return
+	}
+	a.resetMFALockout(user.ID)
+	recoveryCodes, err := a.util.CreateRecoveryCodes()
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to create recovery codes")
+		a.respondWithError(w, http.StatusInternalServerError, "Error enabling two factor authentication")
+		return
+	}
+	hashes := make([]string, len(recoveryCodes))
+	for i, code := range recoveryCodes {
+		hashes[i] = util.HashToken(util.NormaliseRecoveryCode(code))
+	}
+	if err = a.warehouse.EnableTOTP(user.ID, hashes); err != nil {
+		if err == common.ErrTOTPAlreadyEnabled {
+			a.respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to enable TOTP")
+		a.respondWithError(w, http.StatusInternalServerError, "Error enabling two factor authentication")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string][]string{"recoveryCodes": recoveryCodes})
+}
+
+// userTOTPDisablePost turns off two factor authentication, it needs a TOTP or recovery code
+func (a *app) userTOTPDisablePost(w http.ResponseWriter, r *http.Request) {
+	tcr, ok := a.decodeTOTPCodeRequest(w, r)
+	if !ok {
+		return
+	}
+	user, ok := a.requestUser(w, r)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt == nil {
+		a.respondWithError(w, http.StatusBadRequest, common.ErrTOTPNotEnabled.Error())
+		return
+	}
+	keys, ok := a.checkMFALockout(w, user.ID)
+	if !ok {
+		return
+	}
+	if err := a.checkSecondFactor(user, tcr.Code); err != nil {
+		if err == common.ErrTOTPCodeInvalid {
+			a.recordLoginFailure(keys)
+		}
+		a.respondWithTOTPError(w, err)
+		return
+	}
+	a.resetMFALockout(user.ID)
+	if err := a.warehouse.DisableTOTP(user.ID); err != nil {
+		a.logrus.WithError(err).Error("Unable to disable TOTP")
+		a.respondWithError(w, http.StatusInternalServerError, "Error disabling two factor authentication")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Two factor authentication disabled"})
+}
+
+// userTOTPOptions returns the allowed options
+func (a *app) userTOTPOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// requestUser loads the user the JSON token on the request belongs to. If it returns false the
+// error response has already been written
+func (a *app) requestUser(w http.ResponseWriter, r *http.Request) (*common.User, bool) {
+	claims, ok := requestClaims(r)
+	if !ok {
+		a.logrus.Error("No JSON token claims on the request")
+		a.respondWithError(w, http.StatusUnauthorized, common.ErrJSONTokenNoBearer.Error())
+		return nil, false
+	}
+	user, err := a.warehouse.GetUserWithID(claims.UserID)
+	if err != nil {
+		if err == common.ErrUserNotFound {
+			a.respondWithError(w, http.StatusUnauthorized, err.Error())
+			return nil, false
+		}
+		a.logrus.WithError(err).Error("Unable to get user")
+		a.respondWithError(w, http.StatusInternalServerError, "Error getting the user")
+		return nil, false
+	}
+	return user, true
+}
+
+func (a *app) decodeTOTPCodeRequest(w http.ResponseWriter, r *http.Request) (common.TOTPCodeRequest, bool) {
+	tcr := common.TOTPCodeRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&tcr); err != nil {
+		a.logrus.WithError(err).Error("Unable to decode body")
+		a.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to decode request: %v", err))
+		return tcr, false
+	}
+	if err := tcr.ValidateRequest(); err != nil {
+		a.logrus.WithError(err).Error("Missing validation parameters")
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
+		return tcr, false
+	}
+	return tcr, true
+}
+
+// checkSecondFactor accepts either a TOTP code or one of the recovery codes of the user. A secret
+// that can not be decrypted, such as after the secret key was lost, still lets the recovery codes in
+func (a *app) checkSecondFactor(user *common.User, code string) error {
+	secret, err := a.util.DecryptSecret(user.TOTPSecret)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to decrypt TOTP secret, only recovery codes can be used")
+	} else if err = a.useTOTPCode(user, secret, code); err != common.ErrTOTPCodeInvalid {
+		return err
+	}
+	return a.warehouse.UseRecoveryCode(user.ID, util.HashToken(util.NormaliseRecoveryCode(code)))
+}
+
+// checkTOTPCode checks the code against the secret of the user, each code can only be used once
+func (a *app) checkTOTPCode(user *common.User, code string) error {
+	secret, err := a.util.DecryptSecret(user.TOTPSecret)
+	if err != nil {
+		return err
+	}
+	return a.useTOTPCode(user, secret, code)
+}
+
+// useTOTPCode checks the code against the decrypted secret and records its time step as used
+func (a *app) useTOTPCode(user *common.User, secret, code string) error {
+	step, ok := a.util.CheckTOTPCode(secret, code)
+	if !ok {
+		return common.ErrTOTPCodeInvalid
+	}
+	return a.warehouse.UseTOTPStep(user.ID, step)
+}
+
+func (a *app) respondWithTOTPError(w http.ResponseWriter, err error) {
+	if err == common.ErrTOTPCodeInvalid {
+		a.respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	a.logrus.WithError(err).Error("Unable to check two factor code")
+	a.respondWithError(w, http.StatusInternalServerError, "Error checking two factor code")
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/lockout"
+	"github.com/garycarr/book_club/util"
+	"github.com/garycarr/book_club/warehouse"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupTOTPTest returns an app with mocks that accept validJWT for validUserID
+func setupTOTPTest(req *http.Request) (*app, *httptest.ResponseRecorder, *util.MockUtil, *warehouse.MockWarehouse) {
+	return setupAuthTest(req, &common.TokenClaims{ID: "jti", UserID: validUserID, EmailVerified: true})
+}
+
+// setupAuthTest returns an app with mocks that accept validJWT for the claims
+func setupAuthTest(req *http.Request, claims *common.TokenClaims) (*app, *httptest.ResponseRecorder, *util.MockUtil,
+	*warehouse.MockWarehouse) {
+	validJWT := "JWT"
+	req.Header.Add("Authorization", validJWT)
+	a, responseRecorder := setupTest(req)
+	mockUtil := util.MockUtil{}
+	mockUtil.On("CheckJSONToken", validJWT).Return(claims, nil)
+	mockWarehouse := warehouse.MockWarehouse{}
+	mockWarehouse.On("IsJSONTokenRevoked", claims).Return(false, nil)
+	a.util = &mockUtil
+	a.warehouse = &mockWarehouse
+	return a, responseRecorder, &mockUtil, &mockWarehouse
+}
+
+func TestUserTOTPEnrollPost(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedError      error
+		expectedHTTPStatus int
+		user               *common.User
+	}
+
+	enabledAt := time.Now()
+	testTable := []testData{
+		testData{
+			description:        "Enrolls a new secret",
+			expectedHTTPStatus: http.StatusOK,
+			user:               &common.User{ID: validUserID, Email: validUserEmail},
+		},
+		testData{
+			description:        "Already enabled",
+			expectedError:      common.ErrTOTPAlreadyEnabled,
+			expectedHTTPStatus: http.StatusConflict,
+			user:               &common.User{ID: validUserID, Email: validUserEmail, TOTPEnabledAt: &enabledAt},
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodPost, "/user/totp/enroll", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupTOTPTest(req)
+		mockWarehouse.On("GetUserWithID", validUserID).Return(td.user, nil)
+		if td.expectedError == nil {
+			mockUtil.On("CreateTOTPSecret").Return("JBSWY3DPEHPK3PXP", nil)
+			mockUtil.On("EncryptSecret", "JBSWY3DPEHPK3PXP").Return("encrypted", nil)
+			mockWarehouse.On("SetTOTPSecret", validUserID, "encrypted").Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		jsonResp := map[string]string{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		if td.expectedError != nil {
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+			continue
+		}
+		assert.Equal(t, "JBSWY3DPEHPK3PXP", jsonResp["secret"], td.description)
+		assert.Contains(t, jsonResp["uri"], "otpauth://totp/", td.description)
+	}
+}
+
+func TestUserTOTPConfirmPost(t *testing.T) {
+	type testData struct {
+		description        string
+		code               string
+		codeValid          bool
+		expectedError      error
+		expectedHTTPStatus int
+		user               *common.User
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Valid code",
+			code:               "123456",
+			codeValid:          true,
+			expectedHTTPStatus: http.StatusOK,
+			user:               &common.User{ID: validUserID, TOTPSecret: "encrypted"},
+		},
+		testData{
+			description:        "Invalid code",
+			code:               "654321",
+			expectedError:      common.ErrTOTPCodeInvalid,
+			expectedHTTPStatus: http.StatusUnauthorized,
+			user:               &common.User{ID: validUserID, TOTPSecret: "encrypted"},
+		},
+		testData{
+			description:        "Not enrolled",
+			code:               "123456",
+			expectedError:      common.ErrTOTPNotEnrolled,
+			expectedHTTPStatus: http.StatusBadRequest,
+			user:               &common.User{ID: validUserID},
+		},
+		testData{
+			description:        "Code not present",
+			expectedError:      common.ErrTOTPCodeNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+		},
+	}
+	recoveryCodes := []string{"abcd-efgh"}
+	for _, td := range testTable {
+		params, err := json.Marshal(map[string]string{"code": td.code})
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/user/totp/confirm", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupTOTPTest(req)
+		if td.user != nil {
+			mockWarehouse.On("GetUserWithID", validUserID).Return(td.user, nil)
+		}
+		if td.user != nil && td.user.TOTPSecret != "" {
+			mockUtil.On("DecryptSecret", td.user.TOTPSecret).Return("JBSWY3DPEHPK3PXP", nil)
+			mockUtil.On("CheckTOTPCode", "JBSWY3DPEHPK3PXP", td.code).Return(int64(100), td.codeValid)
+		}
+		if td.codeValid {
+			mockWarehouse.On("UseTOTPStep", validUserID, int64(100)).Return(nil)
+			mockUtil.On("CreateRecoveryCodes").Return(recoveryCodes, nil)
+			mockWarehouse.On("EnableTOTP", validUserID, []string{util.HashToken("abcdefgh")}).Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+			continue
+		}
+		jsonResp := map[string][]string{}
+		if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+			t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+			continue
+		}
+		assert.Equal(t, recoveryCodes, jsonResp["recoveryCodes"], td.description)
+	}
+}
+
+func TestUserTOTPDisablePost(t *testing.T) {
+	type testData struct {
+		description        string
+		code               string
+		codeValid          bool
+		recoveryCodeValid  bool
+		secretUnreadable   bool
+		expectedHTTPStatus int
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Valid TOTP code",
+			code:               "123456",
+			codeValid:          true,
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description:        "Valid recovery code",
+			code:               "ABCD-EFGH",
+			recoveryCodeValid:  true,
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description:        "Invalid code",
+			code:               "654321",
+			expectedHTTPStatus: http.StatusUnauthorized,
+		},
+		testData{
+			description:        "Secret can not be decrypted and a valid recovery code",
+			code:               "ABCD-EFGH",
+			recoveryCodeValid:  true,
+			secretUnreadable:   true,
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description:        "Secret can not be decrypted and an invalid code",
+			code:               "654321",
+			secretUnreadable:   true,
+			expectedHTTPStatus: http.StatusUnauthorized,
+		},
+	}
+	enabledAt := time.Now()
+	user := &common.User{ID: validUserID, TOTPSecret: "encrypted", TOTPEnabledAt: &enabledAt}
+	for _, td := range testTable {
+		params, err := json.Marshal(map[string]string{"code": td.code})
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/user/totp/disable", bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupTOTPTest(req)
+		mockWarehouse.On("GetUserWithID", validUserID).Return(user, nil)
+		if td.secretUnreadable {
+			mockUtil.On("DecryptSecret", user.TOTPSecret).Return("", errors.New("cipher: message authentication failed"))
+		} else {
+			mockUtil.On("DecryptSecret", user.TOTPSecret).Return("JBSWY3DPEHPK3PXP", nil)
+			mockUtil.On("CheckTOTPCode", "JBSWY3DPEHPK3PXP", td.code).Return(int64(100), td.codeValid)
+		}
+		if td.codeValid {
+			mockWarehouse.On("UseTOTPStep", validUserID, int64(100)).Return(nil)
+		} else if td.recoveryCodeValid {
+			mockWarehouse.On("UseRecoveryCode", validUserID, util.HashToken("abcdefgh")).Return(nil)
+		} else {
+			mockWarehouse.On("UseRecoveryCode", validUserID, util.HashToken(td.code)).Return(common.ErrTOTPCodeInvalid)
+		}
+		if td.expectedHTTPStatus == http.StatusOK {
+			mockWarehouse.On("DisableTOTP", validUserID).Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+	}
+}
+
+func TestUserTOTPLockout(t *testing.T) {
+	type testData struct {
+		description        string
+		path               string
+		code               string
+		codeValid          bool
+		lockedOutFor       time.Duration
+		expectedHTTPStatus int
+		expectedRetryAfter string
+	}
+
+	testTable := []testData{
+		testData{
+			description:        "Confirm while locked out",
+			path:               "/user/totp/confirm",
+			code:               "123456",
+			lockedOutFor:       90*time.Second + time.Millisecond,
+			expectedHTTPStatus: http.StatusTooManyRequests,
+			expectedRetryAfter: "91",
+		},
+		testData{
+			description:        "Confirm with a wrong code counts a failure",
+			path:               "/user/totp/confirm",
+			code:               "654321",
+			expectedHTTPStatus: http.StatusUnauthorized,
+		},
+		testData{
+			description:        "Confirm with a valid code resets the failures",
+			path:               "/user/totp/confirm",
+			code:               "123456",
+			codeValid:          true,
+			expectedHTTPStatus: http.StatusOK,
+		},
+		testData{
+			description:        "Disable while locked out",
+			path:               "/user/totp/disable",
+			code:               "123456",
+			lockedOutFor:       time.Minute,
+			expectedHTTPStatus: http.StatusTooManyRequests,
+			expectedRetryAfter: "60",
+		},
+		testData{
+			description:        "Disable with a wrong code counts a failure",
+			path:               "/user/totp/disable",
+			code:               "654321",
+			expectedHTTPStatus: http.StatusUnauthorized,
+		},
+		testData{
+			description:        "Disable with a valid code resets the failures",
+			path:               "/user/totp/disable",
+			code:               "123456",
+			codeValid:          true,
+			expectedHTTPStatus: http.StatusOK,
+		},
+	}
+	for _, td := range testTable {
+		params, err := json.Marshal(map[string]string{"code": td.code})
+		if err != nil {
+			t.Fatalf("Error marshalling for test %q: %v", td.description, err)
+		}
+		req, err := http.NewRequest(http.MethodPost, td.path, bytes.NewReader(params))
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder, mockUtil, mockWarehouse := setupTOTPTest(req)
+		user := &common.User{ID: validUserID, TOTPSecret: "encrypted"}
+		if td.path == "/user/totp/disable" {
+			enabledAt := time.Now()
+			user.TOTPEnabledAt = &enabledAt
+		}
+		mockWarehouse.On("GetUserWithID", validUserID).Return(user, nil)
+		emailLockout := lockout.MockTracker{}
+		emailLockout.On("Check", mfaLockoutKey(validUserID)).Return(td.lockedOutFor, nil)
+		if td.lockedOutFor == 0 {
+			mockUtil.On("DecryptSecret", user.TOTPSecret).Return("JBSWY3DPEHPK3PXP", nil)
+			mockUtil.On("CheckTOTPCode", "JBSWY3DPEHPK3PXP", td.code).Return(int64(100), td.codeValid)
+		}
+		if td.codeValid {
+			mockWarehouse.On("UseTOTPStep", validUserID, int64(100)).Return(nil)
+			emailLockout.On("Reset", mfaLockoutKey(validUserID)).Return(nil)
+			if user.TOTPEnabledAt != nil {
+				mockWarehouse.On("DisableTOTP", validUserID).Return(nil)
+			} else {
+				mockUtil.On("CreateRecoveryCodes").Return([]string{"abcd-efgh"}, nil)
+				mockWarehouse.On("EnableTOTP", validUserID, []string{util.HashToken("abcdefgh")}).Return(nil)
+			}
+		} else if td.lockedOutFor == 0 {
+			emailLockout.On("Fail", mfaLockoutKey(validUserID)).Return(time.Duration(0), nil)
+			if user.TOTPEnabledAt != nil {
+				mockWarehouse.On("UseRecoveryCode", validUserID, util.HashToken(td.code)).Return(common.ErrTOTPCodeInvalid)
+			}
+		}
+		a.emailLockout = &emailLockout
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		emailLockout.AssertExpectations(t)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description)
+		assert.Equal(t, td.expectedRetryAfter, responseRecorder.Header().Get("Retry-After"), td.description)
+	}
+}
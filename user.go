@@ -3,12 +3,22 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/util"
 )
 
-// loginPost returns a JSON token if the login was successful
+const (
+	emailVerificationExpiration = time.Duration(24 * time.Hour)
+	// emailVerificationResendInterval is how long a user waits before another verification email is sent
+	emailVerificationResendInterval = time.Duration(5 * time.Minute)
+)
+
+// userPost registers a new user and returns a JSON token
 func (a *app) userPost(w http.ResponseWriter, r *http.Request) {
 	rr := common.RegisterRequest{}
 	if err := json.NewDecoder(r.Body).Decode(&rr); err != nil {
@@ -21,6 +31,9 @@ func (a *app) userPost(w http.ResponseWriter, r *http.Request) {
 		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", err))
 		return
 	}
+	if !a.checkPasswordPolicy(w, rr.Password, &common.User{Email: rr.Email, DisplayName: rr.DisplayName}) {
+		return
+	}
 	hashedPassword, err := a.util.CreateHashedPassword(rr.Password)
 	if err != nil {
 		a.logrus.WithError(err).Error("Unable to hash password")
@@ -28,27 +41,138 @@ func (a *app) userPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	rr.Password = string(hashedPassword)
-	user, err := a.warehouse.CreateUser(rr)
+	var user *common.User
+	if rr.InviteCode != "" {
+		user, err = a.warehouse.CreateUserWithInvite(rr, util.HashToken(rr.InviteCode))
+	} else {
+		user, err = a.warehouse.CreateUser(rr)
+	}
 	if err != nil {
-		if err == common.ErrLoginUserAlreadyExists {
+		switch err {
+		case common.ErrLoginUserAlreadyExists:
 			a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Email %s is already registered", rr.Email))
 			return
+		case common.ErrClubInviteNotFound, common.ErrClubInviteEmailMismatch:
+			a.respondWithError(w, http.StatusBadRequest, err.Error())
+			return
 		}
 		a.logrus.WithError(err).Error("Unable to create user")
 		a.respondWithError(w, http.StatusInternalServerError, "Error creating the user")
 		return
 	}
+	if err = a.sendEmailVerification(user, user.Email); err != nil {
+		// The account exists, so carry on. The user can still use the unverified routes
+		a.logrus.WithError(err).Error("Unable to send verification email")
+	}
 	// Create the JSON token as the login is valid
-	jsonToken, err := a.util.CreateJSONToken(user)
+	tokens, err := a.createTokens(user, nil)
 	if err != nil {
-		a.logrus.WithError(err).Error("Unable to create JSON token")
+		a.logrus.WithError(err).Error("Unable to create tokens")
 		a.respondWithError(w, http.StatusInternalServerError, "Unable to create JSON token")
 		return
 	}
-	a.respondWithJSON(w, http.StatusCreated, map[string]string{"token": jsonToken})
+	a.respondWithJSON(w, http.StatusCreated, tokens)
 }
 
 // userOptions returns the allowed options
 func (a *app) userOptions(w http.ResponseWriter, r *http.Request) {
 	a.optionsHeaders(w)
 }
+
+// userVerifyGet marks the email of the user as verified using the token from the verification email
+func (a *app) userVerifyGet(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Missing parameters: %v", common.ErrEmailVerificationTokenNotPresent))
+		return
+	}
+	ev, err := a.warehouse.GetEmailVerification(util.HashToken(token))
+	if err != nil {
+		if err == common.ErrEmailVerificationNotFound {
+			a.respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to get verification token")
+		a.respondWithError(w, http.StatusInternalServerError, "Error verifying the email")
+		return
+	}
+	if ev.UsedAt != nil || ev.ExpiresAt.Before(time.Now()) {
+		a.respondWithError(w, http.StatusBadRequest, common.ErrEmailVerificationNotFound.Error())
+		return
+	}
+	if err = a.warehouse.VerifyEmail(ev); err != nil {
+		switch err {
+		case common.ErrEmailVerificationNotFound:
+			a.respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		case common.ErrLoginUserAlreadyExists:
+			a.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Email %s is already registered", ev.Email))
+			return
+		}
+		a.logrus.WithError(err).Error("Unable to verify email")
+		a.respondWithError(w, http.StatusInternalServerError, "Error verifying the email")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Email has been verified"})
+}
+
+// userVerifyResendPost sends the verification email again, to the pending email when the user is changing
+// their email. Links expire, so this is how a user who missed theirs gets a new one
+func (a *app) userVerifyResendPost(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.requestUser(w, r)
+	if !ok {
+		return
+	}
+	email := user.PendingEmail
+	if email == "" {
+		if user.EmailVerifiedAt != nil {
+			a.respondWithError(w, http.StatusBadRequest, common.ErrEmailAlreadyVerified.Error())
+			return
+		}
+		email = user.Email
+	}
+	lastSentAt, err := a.warehouse.GetLastEmailVerificationAt(user.ID)
+	if err != nil {
+		a.logrus.WithError(err).Error("Unable to get the last verification email")
+		a.respondWithError(w, http.StatusInternalServerError, "Error sending the verification email")
+		return
+	}
+	if lastSentAt != nil {
+		if retryAfter := time.Until(lastSentAt.Add(emailVerificationResendInterval)); retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			a.respondWithError(w, http.StatusTooManyRequests, common.ErrEmailVerificationSentRecently.Error())
+			return
+		}
+	}
+	if err = a.sendEmailVerification(user, email); err != nil {
+		a.logrus.WithError(err).Error("Unable to send verification email")
+		a.respondWithError(w, http.StatusInternalServerError, "Error sending the verification email")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"message": "Verification email has been sent"})
+}
+
+// userVerifyOptions returns the allowed options
+func (a *app) userVerifyOptions(w http.ResponseWriter, r *http.Request) {
+	a.optionsHeaders(w)
+}
+
+// sendEmailVerification emails a link the user can follow to verify the email, their current one or the
+// one they are changing to
+func (a *app) sendEmailVerification(user *common.User, email string) error {
+	token, err := a.util.CreateRandomToken()
+	if err != nil {
+		return err
+	}
+	err = a.warehouse.CreateEmailVerification(user.ID, email, util.HashToken(token),
+		time.Now().Add(emailVerificationExpiration))
+	if err != nil {
+		return err
+	}
+	return a.mailer.Send(common.Email{
+		To:      email,
+		Subject: "Verify your book club email",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to verify your email, it expires in %s.\n\n%s/user/verify?token=%s\n",
+			user.DisplayName, emailVerificationExpiration, a.conf.BaseURL, token),
+	})
+}
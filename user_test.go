@@ -6,11 +6,14 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/garycarr/book_club/common"
+	"github.com/garycarr/book_club/mailer"
 	"github.com/garycarr/book_club/util"
 	"github.com/garycarr/book_club/warehouse"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestUserPost(t *testing.T) {
@@ -73,6 +76,7 @@ func TestUserPost(t *testing.T) {
 		},
 	}
 	jwt := "Bearer JWT"
+	refreshToken := "refreshToken"
 	for _, td := range testTable {
 		params, err := json.Marshal(td.params)
 		if err != nil {
@@ -85,11 +89,16 @@ func TestUserPost(t *testing.T) {
 		a, responseRecorder := setupTest(req)
 		mockUtil := util.MockUtil{}
 		mockWarehouse := warehouse.MockWarehouse{}
+		mockMailer := mailer.MockMailer{}
 		if td.expectedError == nil {
 			createrUser := &common.User{
 				DisplayName: td.params["displayName"],
 				Email:       td.params["email"],
 			}
+			mockUtil.On("CheckPasswordPolicy", td.params["password"], &common.User{
+				DisplayName: td.params["displayName"],
+				Email:       td.params["email"],
+			}).Return(nil)
 			// The bcrypt does not matter here as everything is mocked
 			mockUtil.On("CreateHashedPassword", td.params["password"]).Return(td.params["password"], nil)
 			mockWarehouse.On("CreateUser", common.RegisterRequest{
@@ -97,14 +106,25 @@ func TestUserPost(t *testing.T) {
 				Email:       td.params["email"],
 				Password:    td.params["password"],
 			}).Return(createrUser, nil)
+			// The same random token is used for the verification and the refresh token
+			mockUtil.On("CreateRandomToken").Return(refreshToken, nil)
+			mockWarehouse.On("CreateEmailVerification", createrUser.ID, createrUser.Email, util.HashToken(refreshToken),
+				mock.AnythingOfType("time.Time")).Return(nil)
+			mockMailer.On("Send", mock.MatchedBy(func(email common.Email) bool {
+				return email.To == createrUser.Email
+			})).Return(nil)
+			mockWarehouse.On("CreateRefreshToken", createrUser.ID, util.HashToken(refreshToken), mock.AnythingOfType("time.Time")).
+				Return(&common.RefreshToken{}, nil)
 			mockUtil.On("CreateJSONToken", createrUser).Return(jwt, nil)
 		}
 		a.util = &mockUtil
 		a.warehouse = &mockWarehouse
+		a.mailer = &mockMailer
 
 		a.Router.ServeHTTP(responseRecorder, req)
 		mockUtil.AssertExpectations(t)
 		mockWarehouse.AssertExpectations(t)
+		mockMailer.AssertExpectations(t)
 		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
 			// We got a different status code than expected
 			continue
@@ -128,5 +148,240 @@ func TestUserPost(t *testing.T) {
 			continue
 		}
 		assert.Equal(t, jwt, tokenString, td.description)
+		assert.Equal(t, refreshToken, jsonResp["refreshToken"], td.description)
+	}
+}
+
+func TestUserVerifyGet(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedError      error
+		expectedHTTPStatus int
+		storedVerification *common.EmailVerification
+		token              string
+		verifyError        error
+	}
+
+	usedAt := time.Now().Add(-time.Minute)
+	testTable := []testData{
+		testData{
+			description:        "Valid verification token",
+			expectedHTTPStatus: http.StatusOK,
+			storedVerification: &common.EmailVerification{
+				ID:        "verificationID",
+				UserID:    validUserID,
+				Email:     validUserEmail,
+				ExpiresAt: time.Now().Add(time.Hour),
+			},
+			token: "verificationToken",
+		},
+		testData{
+			description:        "Token not present",
+			expectedError:      common.ErrEmailVerificationTokenNotPresent,
+			expectedHTTPStatus: http.StatusBadRequest,
+		},
+		testData{
+			description:        "Unknown token",
+			expectedError:      common.ErrEmailVerificationNotFound,
+			expectedHTTPStatus: http.StatusBadRequest,
+			token:              "verificationToken",
+		},
+		testData{
+			description:        "Expired token",
+			expectedError:      common.ErrEmailVerificationNotFound,
+			expectedHTTPStatus: http.StatusBadRequest,
+			storedVerification: &common.EmailVerification{
+				ID:        "verificationID",
+				ExpiresAt: time.Now().Add(-time.Hour),
+			},
+			token: "verificationToken",
+		},
+		testData{
+			description:        "Used token",
+			expectedError:      common.ErrEmailVerificationNotFound,
+			expectedHTTPStatus: http.StatusBadRequest,
+			storedVerification: &common.EmailVerification{
+				ID:        "verificationID",
+				ExpiresAt: time.Now().Add(time.Hour),
+				UsedAt:    &usedAt,
+			},
+			token: "verificationToken",
+		},
+		testData{
+			description:        "Pending email was registered by another user",
+			expectedError:      fmt.Errorf("Email %s is already registered", "new@example.com"),
+			expectedHTTPStatus: http.StatusBadRequest,
+			storedVerification: &common.EmailVerification{
+				ID:        "verificationID",
+				UserID:    validUserID,
+				Email:     "new@example.com",
+				ExpiresAt: time.Now().Add(time.Hour),
+			},
+			token:       "verificationToken",
+			verifyError: common.ErrLoginUserAlreadyExists,
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/user/verify?token=%s", td.token), nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		a, responseRecorder := setupTest(req)
+		mockWarehouse := warehouse.MockWarehouse{}
+		if td.token != "" {
+			if td.storedVerification == nil {
+				mockWarehouse.On("GetEmailVerification", util.HashToken(td.token)).Return(nil, common.ErrEmailVerificationNotFound)
+			} else {
+				mockWarehouse.On("GetEmailVerification", util.HashToken(td.token)).Return(td.storedVerification, nil)
+			}
+		}
+		if td.expectedError == nil || td.verifyError != nil {
+			mockWarehouse.On("VerifyEmail", td.storedVerification).Return(td.verifyError)
+		}
+		a.warehouse = &mockWarehouse
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockWarehouse.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+		}
+	}
+}
+
+func TestUserVerifyResendPost(t *testing.T) {
+	type testData struct {
+		description        string
+		expectedEmail      string
+		expectedError      error
+		expectedHTTPStatus int
+		expectedRetryAfter string
+		lastSentAt         *time.Time
+		user               *common.User
+	}
+
+	verifiedAt := time.Now().Add(-time.Hour)
+	longAgo := time.Now().Add(-time.Hour)
+	recently := time.Now().Add(-time.Minute)
+	testTable := []testData{
+		testData{
+			description:        "Sends the email again to an unverified email",
+			expectedEmail:      validUserEmail,
+			expectedHTTPStatus: http.StatusOK,
+			lastSentAt:         &longAgo,
+			user:               &common.User{ID: validUserID, Email: validUserEmail},
+		},
+		testData{
+			description:        "Sends the email to the pending email",
+			expectedEmail:      "new@example.com",
+			expectedHTTPStatus: http.StatusOK,
+			user: &common.User{ID: validUserID, Email: validUserEmail, EmailVerifiedAt: &verifiedAt,
+				PendingEmail: "new@example.com"},
+		},
+		testData{
+			description:        "Email already verified",
+			expectedError:      common.ErrEmailAlreadyVerified,
+			expectedHTTPStatus: http.StatusBadRequest,
+			user:               &common.User{ID: validUserID, Email: validUserEmail, EmailVerifiedAt: &verifiedAt},
+		},
+		testData{
+			description:        "Email sent too recently",
+			expectedError:      common.ErrEmailVerificationSentRecently,
+			expectedHTTPStatus: http.StatusTooManyRequests,
+			expectedRetryAfter: "240",
+			lastSentAt:         &recently,
+			user:               &common.User{ID: validUserID, Email: validUserEmail},
+		},
+	}
+	for _, td := range testTable {
+		req, err := http.NewRequest(http.MethodPost, "/user/verify/resend", nil)
+		if err != nil {
+			t.Fatalf("Error creating new request for test %q: %v", td.description, err)
+		}
+		// The route is in unverified_routes, so a user who has not verified their email can use it
+		a, responseRecorder, mockUtil, mockWarehouse := setupAuthTest(req,
+			&common.TokenClaims{ID: "jti", UserID: validUserID})
+		mockMailer := mailer.MockMailer{}
+		a.mailer = &mockMailer
+		mockWarehouse.On("GetUserWithID", validUserID).Return(td.user, nil)
+		if td.expectedError != common.ErrEmailAlreadyVerified {
+			if td.lastSentAt == nil {
+				mockWarehouse.On("GetLastEmailVerificationAt", validUserID).Return(nil, nil)
+			} else {
+				mockWarehouse.On("GetLastEmailVerificationAt", validUserID).Return(td.lastSentAt, nil)
+			}
+		}
+		if td.expectedHTTPStatus == http.StatusOK {
+			mockUtil.On("CreateRandomToken").Return("verifyToken", nil)
+			mockWarehouse.On("CreateEmailVerification", validUserID, td.expectedEmail, util.HashToken("verifyToken"),
+				mock.AnythingOfType("time.Time")).Return(nil)
+			mockMailer.On("Send", mock.MatchedBy(func(email common.Email) bool {
+				return email.To == td.expectedEmail
+			})).Return(nil)
+		}
+
+		a.Router.ServeHTTP(responseRecorder, req)
+		mockUtil.AssertExpectations(t)
+		mockWarehouse.AssertExpectations(t)
+		mockMailer.AssertExpectations(t)
+		if !assert.Equal(t, td.expectedHTTPStatus, responseRecorder.Code, td.description) {
+			// We got a different status code than expected
+			continue
+		}
+		assert.Equal(t, td.expectedRetryAfter, responseRecorder.Header().Get("Retry-After"), td.description)
+		if td.expectedError != nil {
+			jsonResp := map[string]string{}
+			if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+				t.Errorf("Unable to decode JSON response for test %q: %v", td.description, err)
+				continue
+			}
+			assert.Contains(t, jsonResp["error"], td.expectedError.Error(), td.description)
+		}
+	}
+}
+
+func TestUserPostPasswordPolicy(t *testing.T) {
+	params, err := json.Marshal(map[string]string{
+		"email":       "gcarr@example.com",
+		"displayName": "gcarr",
+		"password":    "gcarr",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "/user", bytes.NewReader(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The util from the test config checks the policy, nothing should be stored
+	a, responseRecorder := setupTest(req)
+	mockWarehouse := warehouse.MockWarehouse{}
+	a.warehouse = &mockWarehouse
+
+	a.Router.ServeHTTP(responseRecorder, req)
+	mockWarehouse.AssertExpectations(t)
+	if !assert.Equal(t, http.StatusBadRequest, responseRecorder.Code) {
+		t.FailNow()
+	}
+	jsonResp := struct {
+		Error  string              `json:"error"`
+		Fields []common.FieldError `json:"fields"`
+	}{}
+	if err = json.NewDecoder(responseRecorder.Body).Decode(&jsonResp); err != nil {
+		t.Fatalf("Unable to decode JSON response: %v", err)
+	}
+	assert.Equal(t, common.ErrPasswordPolicy.Error(), jsonResp.Error)
+	var rules []string
+	for _, fe := range jsonResp.Fields {
+		rules = append(rules, fe.Rule)
 	}
+	assert.Equal(t, []string{util.PasswordRuleMinLength, util.PasswordRuleContainsEmail, util.PasswordRuleContainsDisplayName}, rules)
 }
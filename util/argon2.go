@@ -0,0 +1,76 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+	argon2Prefix     = "$argon2id$"
+)
+
+// argon2Hasher stores hashes in the PHC string format, $argon2id$v=19$m=65536,t=3,p=2$salt$key
+type argon2Hasher struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+func (ah argon2Hasher) hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, ah.time, ah.memory, ah.threads, argon2KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2Prefix, argon2.Version, ah.memory, ah.time, ah.threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (ah argon2Hasher) check(hash, password string) error {
+	params, salt, key, err := parseArgon2Hash(hash)
+	if err != nil {
+		return err
+	}
+	given := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(given, key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (ah argon2Hasher) current(hash string) bool {
+	params, _, key, err := parseArgon2Hash(hash)
+	return err == nil && params == ah && len(key) == argon2KeyLength
+}
+
+func parseArgon2Hash(hash string) (argon2Hasher, []byte, []byte, error) {
+	params := argon2Hasher{}
+	// "", "argon2id", "v=19", "m=65536,t=3,p=2", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errHashNotSupported
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errHashNotSupported
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, err
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	return params, salt, key, nil
+}
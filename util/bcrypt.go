@@ -1,25 +1,24 @@
 package util
 
-import (
-	"golang.org/x/crypto/bcrypt"
-)
+import "golang.org/x/crypto/bcrypt"
 
-const bcryptCost = 10
+type bcryptHasher struct {
+	cost int
+}
 
-// CreateHashedPassword is mainly in a function so it can be mocked
-func (u *Util) CreateHashedPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+func (bh bcryptHasher) hash(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bh.cost)
 	if err != nil {
 		return "", err
 	}
 	return string(hashedPassword), nil
 }
 
-// CheckHashedPassword ...
-func (u *Util) CheckHashedPassword(dbPassword, givenPassword string) error {
-	// Make sure the password is valid
-	if err := bcrypt.CompareHashAndPassword([]byte(dbPassword), []byte(givenPassword)); err != nil {
-		return err
-	}
-	return nil
+func (bh bcryptHasher) check(hash, password string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+}
+
+func (bh bcryptHasher) current(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost == bh.cost
 }
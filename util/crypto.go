@@ -0,0 +1,71 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"strings"
+)
+
+var (
+	errCiphertextTooShort   = errors.New("Ciphertext is too short")
+	errSecretKeyFileMissing = errors.New("Secret key file is not configured")
+)
+
+// LoadSecretKey reads the base64 encoded secret key from the file. The key is kept out of the config so
+// it is never committed with it
+func LoadSecretKey(file string) ([]byte, error) {
+	if file == "" {
+		return nil, errSecretKeyFileMissing
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+}
+
+// EncryptSecret encrypts the secret with AES-GCM, the nonce is prepended to the base64 output
+func (u *Util) EncryptSecret(secret string) (string, error) {
+	gcm, err := u.gcm()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret reverses EncryptSecret
+func (u *Util) DecryptSecret(encrypted string) (string, error) {
+	gcm, err := u.gcm()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errCiphertextTooShort
+	}
+	secret, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+func (u *Util) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(u.secretKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,78 @@
+package util
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptSecret(t *testing.T) {
+	u := newTestUtil(t)
+	encrypted, err := u.EncryptSecret("JBSWY3DPEHPK3PXP")
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.NotContains(t, encrypted, "JBSWY3DPEHPK3PXP")
+
+	secret, err := u.DecryptSecret(encrypted)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", secret)
+
+	again, err := u.EncryptSecret("JBSWY3DPEHPK3PXP")
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.NotEqual(t, encrypted, again, "every encryption should use a new nonce")
+}
+
+func TestDecryptSecretTampered(t *testing.T) {
+	u := newTestUtil(t)
+	encrypted, err := u.EncryptSecret("JBSWY3DPEHPK3PXP")
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	tampered := []byte(encrypted)
+	if tampered[10] == 'A' {
+		tampered[10] = 'B'
+	} else {
+		tampered[10] = 'A'
+	}
+	_, err = u.DecryptSecret(string(tampered))
+	assert.NotNil(t, err)
+
+	_, err = u.DecryptSecret("c2hvcnQ=")
+	assert.Equal(t, errCiphertextTooShort, err)
+}
+
+func TestLoadSecretKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key := bytes.Repeat([]byte("k"), 32)
+	valid := filepath.Join(dir, "secret.key")
+	if err = ioutil.WriteFile(valid, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	notBase64 := filepath.Join(dir, "not_base64.key")
+	if err = ioutil.WriteFile(notBase64, []byte("not a key!"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadSecretKey(valid)
+	if assert.Nil(t, err) {
+		assert.Equal(t, key, loaded)
+	}
+	for _, file := range []string{"", filepath.Join(dir, "missing.key"), notBase64} {
+		_, err = LoadSecretKey(file)
+		assert.NotNil(t, err, file)
+	}
+}
@@ -0,0 +1,120 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/garycarr/book_club/common"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+const (
+	defaultBcryptCost     = 10
+	defaultArgon2Time     = 3
+	defaultArgon2MemoryKB = 64 * 1024
+	defaultArgon2Threads  = 2
+)
+
+var (
+	// ErrPasswordMismatch is returned by CheckHashedPassword when the password is wrong, whatever
+	// algorithm the hash uses
+	ErrPasswordMismatch = bcrypt.ErrMismatchedHashAndPassword
+
+	errHashNotSupported = errors.New("Password hash algorithm is not supported")
+)
+
+// PasswordHashConfig picks the algorithm and cost new passwords are hashed with. Existing hashes
+// made with another algorithm or cost still work and are upgraded when the user logs in
+type PasswordHashConfig struct {
+	Algorithm      string `json:"algorithm"`
+	BcryptCost     int    `json:"bcrypt_cost"`
+	Argon2Time     uint32 `json:"argon2_time"`
+	Argon2MemoryKB uint32 `json:"argon2_memory_kb"`
+	Argon2Threads  uint8  `json:"argon2_threads"`
+}
+
+// passwordHasher creates and checks hashes for one algorithm
+type passwordHasher interface {
+	hash(password string) (string, error)
+	check(hash, password string) error
+	// current is false when the hash was made by this algorithm with other parameters
+	current(hash string) bool
+}
+
+func newPasswordHashers(conf PasswordHashConfig) (passwordHasher, []passwordHasher, error) {
+	bh := bcryptHasher{cost: conf.BcryptCost}
+	if bh.cost == 0 {
+		bh.cost = defaultBcryptCost
+	}
+	if bh.cost < bcrypt.MinCost || bh.cost > bcrypt.MaxCost {
+		return nil, nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	ah := argon2Hasher{time: conf.Argon2Time, memory: conf.Argon2MemoryKB, threads: conf.Argon2Threads}
+	if ah.time == 0 {
+		ah.time = defaultArgon2Time
+	}
+	if ah.memory == 0 {
+		ah.memory = defaultArgon2MemoryKB
+	}
+	if ah.threads == 0 {
+		ah.threads = defaultArgon2Threads
+	}
+	hashers := []passwordHasher{bh, ah}
+	switch conf.Algorithm {
+	case HashBcrypt, "":
+		return bh, hashers, nil
+	case HashArgon2id:
+		return ah, hashers, nil
+	}
+	return nil, nil, fmt.Errorf("Unknown password hash algorithm %q", conf.Algorithm)
+}
+
+// CreateHashedPassword hashes with the configured algorithm
+func (u *Util) CreateHashedPassword(password string) (string, error) {
+	return u.hasher.hash(password)
+}
+
+// CheckHashedPassword checks the password with whichever algorithm made the hash. Users without a
+// password never match
+func (u *Util) CheckHashedPassword(dbPassword, givenPassword string) error {
+	if dbPassword == common.NoPassword {
+		return ErrPasswordMismatch
+	}
+	ph, err := u.hasherFor(dbPassword)
+	if err != nil {
+		return err
+	}
+	return ph.check(dbPassword, givenPassword)
+}
+
+// PasswordNeedsRehash is true when the hash was not made with the configured algorithm and cost
+func (u *Util) PasswordNeedsRehash(dbPassword string) bool {
+	ph, err := u.hasherFor(dbPassword)
+	if err != nil {
+		return true
+	}
+	return ph != u.hasher || !ph.current(dbPassword)
+}
+
+func (u *Util) hasherFor(hash string) (passwordHasher, error) {
+	for _, ph := range u.hashers {
+		switch ph.(type) {
+		case bcryptHasher:
+			if strings.HasPrefix(hash, "$2") {
+				return ph, nil
+			}
+		case argon2Hasher:
+			if strings.HasPrefix(hash, argon2Prefix) {
+				return ph, nil
+			}
+		}
+	}
+	return nil, errHashNotSupported
+}
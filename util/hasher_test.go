@@ -0,0 +1,101 @@
+package util
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestHashUtil(t *testing.T, conf PasswordHashConfig) *Util {
+	u, err := NewUtil(Config{
+		SecretKey:    bytes.Repeat([]byte("k"), 32),
+		SigningKey:   KeyFile{ID: "ec", File: "testdata/ec.pem"},
+		PasswordHash: conf,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestHashedPassword(t *testing.T) {
+	type testData struct {
+		description    string
+		conf           PasswordHashConfig
+		expectedPrefix string
+	}
+
+	testTable := []testData{
+		testData{
+			description:    "bcrypt is the default",
+			conf:           PasswordHashConfig{BcryptCost: 4},
+			expectedPrefix: "$2a$04$",
+		},
+		testData{
+			description:    "argon2id",
+			conf:           PasswordHashConfig{Algorithm: HashArgon2id, Argon2Time: 1, Argon2MemoryKB: 1024, Argon2Threads: 1},
+			expectedPrefix: "$argon2id$v=19$m=1024,t=1,p=1$",
+		},
+	}
+	for _, td := range testTable {
+		u := newTestHashUtil(t, td.conf)
+		hash, err := u.CreateHashedPassword("password")
+		if !assert.Nil(t, err, td.description) {
+			continue
+		}
+		assert.True(t, strings.HasPrefix(hash, td.expectedPrefix), "%s: got %s", td.description, hash)
+		assert.Nil(t, u.CheckHashedPassword(hash, "password"), td.description)
+		assert.Equal(t, ErrPasswordMismatch, u.CheckHashedPassword(hash, "wrong"), td.description)
+		assert.False(t, u.PasswordNeedsRehash(hash), td.description)
+		// Hashes are salted
+		again, _ := u.CreateHashedPassword("password")
+		assert.NotEqual(t, hash, again, td.description)
+		assert.Equal(t, ErrPasswordMismatch, u.CheckHashedPassword(common.NoPassword, common.NoPassword), td.description)
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	oldBcrypt := newTestHashUtil(t, PasswordHashConfig{BcryptCost: 4})
+	bcryptHash, err := oldBcrypt.CreateHashedPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldArgon2 := newTestHashUtil(t, PasswordHashConfig{Algorithm: HashArgon2id, Argon2Time: 1, Argon2MemoryKB: 1024, Argon2Threads: 1})
+	argon2Hash, err := oldArgon2.CreateHashedPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Higher bcrypt cost
+	u := newTestHashUtil(t, PasswordHashConfig{BcryptCost: 5})
+	assert.True(t, u.PasswordNeedsRehash(bcryptHash))
+	assert.True(t, u.PasswordNeedsRehash(argon2Hash))
+	assert.Nil(t, u.CheckHashedPassword(argon2Hash, "password"), "old algorithms can still be checked")
+
+	// Moving to argon2id, or to a higher argon2id cost
+	u = newTestHashUtil(t, PasswordHashConfig{Algorithm: HashArgon2id, Argon2Time: 2, Argon2MemoryKB: 1024, Argon2Threads: 1})
+	assert.True(t, u.PasswordNeedsRehash(bcryptHash))
+	assert.True(t, u.PasswordNeedsRehash(argon2Hash))
+	assert.Nil(t, u.CheckHashedPassword(bcryptHash, "password"), "old algorithms can still be checked")
+
+	assert.True(t, u.PasswordNeedsRehash("not a hash"))
+	assert.NotNil(t, u.CheckHashedPassword("not a hash", "password"))
+}
+
+func TestNewUtilPasswordHash(t *testing.T) {
+	_, err := NewUtil(Config{
+		SecretKey:    bytes.Repeat([]byte("k"), 32),
+		SigningKey:   KeyFile{ID: "ec", File: "testdata/ec.pem"},
+		PasswordHash: PasswordHashConfig{Algorithm: "md5"},
+	})
+	assert.NotNil(t, err)
+	_, err = NewUtil(Config{
+		SecretKey:    bytes.Repeat([]byte("k"), 32),
+		SigningKey:   KeyFile{ID: "ec", File: "testdata/ec.pem"},
+		PasswordHash: PasswordHashConfig{BcryptCost: 40},
+	})
+	assert.NotNil(t, err)
+}
@@ -6,6 +6,17 @@ import "github.com/garycarr/book_club/common"
 type UtilIn interface {
 	CreateHashedPassword(string) (string, error)
 	CheckHashedPassword(string, string) error
-	CheckJSONToken(string) error
+	PasswordNeedsRehash(string) bool
+	CheckPasswordPolicy(string, *common.User) []common.FieldError
+	CheckJSONToken(string) (*common.TokenClaims, error)
 	CreateJSONToken(*common.User) (string, error)
+	JSONWebKeySet() common.JSONWebKeySet
+	CheckMFAToken(string) (*common.TokenClaims, error)
+	CreateMFAToken(*common.User) (string, error)
+	CreateRandomToken() (string, error)
+	EncryptSecret(string) (string, error)
+	DecryptSecret(string) (string, error)
+	CreateTOTPSecret() (string, error)
+	CheckTOTPCode(string, string) (int64, bool)
+	CreateRecoveryCodes() ([]string, error)
 }
@@ -1,6 +1,9 @@
 package util
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"strings"
 	"time"
 
@@ -9,48 +12,117 @@ import (
 )
 
 const (
-	JWTSecret     = "Environmentalise"
 	jwtIssuer     = "Me"
 	jwtExpiration = time.Duration(1 * time.Hour)
+	jwtIDBytes    = 16
+
+	// jwtPurposeMFAPending tokens only prove the password was correct, they can only be
+	// exchanged for a real token along with a TOTP code
+	jwtPurposeMFAPending = "mfa_pending"
+	mfaTokenExpiration   = time.Duration(5 * time.Minute)
 )
 
 // customJWTClaims ..
 type customJWTClaims struct {
-	DisplayName string `json:"displayName"`
+	DisplayName   string            `json:"displayName"`
+	EmailVerified bool              `json:"emailVerified"`
+	Roles         []string          `json:"roles,omitempty"`
+	ClubRoles     map[string]string `json:"clubRoles,omitempty"`
+	Purpose       string            `json:"purpose,omitempty"`
 	jwt.StandardClaims
 }
 
 // CreateJSONToken ..
 func (u *Util) CreateJSONToken(user *common.User) (string, error) {
-	// Create the JSON token as the login is valid
+	return u.createToken(user, "", jwtExpiration)
+}
+
+// CreateMFAToken creates a short lived token for a user who still has to give a TOTP code
+func (u *Util) CreateMFAToken(user *common.User) (string, error) {
+	return u.createToken(user, jwtPurposeMFAPending, mfaTokenExpiration)
+}
+
+func (u *Util) createToken(user *common.User, purpose string, expiration time.Duration) (string, error) {
+	jti, err := newJWTID()
+	if err != nil {
+		return "", err
+	}
 	claims := &customJWTClaims{
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(jwtExpiration).Unix(),
+			ExpiresAt: time.Now().Add(expiration).Unix(),
 			Issuer:    jwtIssuer,
 			IssuedAt:  time.Now().Unix(),
-			Id:        user.ID,
+			Id:        jti,
+			Subject:   user.ID,
 		},
-		DisplayName: user.DisplayName,
+		DisplayName:   user.DisplayName,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Roles:         user.Roles,
+		ClubRoles:     user.ClubRoles,
+		Purpose:       purpose,
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(JWTSecret))
+	token := jwt.NewWithClaims(u.signingKey.method, claims)
+	token.Header["kid"] = u.signingKey.id
+	tokenString, err := token.SignedString(u.signingKey.privateKey)
 	if err != nil {
 		return "", err
 	}
 	return tokenString, nil
 }
 
-// CheckJSONToken ...
-func (u *Util) CheckJSONToken(token string) error {
+// CheckJSONToken verifies the token and returns its claims
+func (u *Util) CheckJSONToken(token string) (*common.TokenClaims, error) {
 	if token == "" || !strings.HasPrefix(token, "Bearer ") {
-		return common.ErrJSONTokenNoBearer
+		return nil, common.ErrJSONTokenNoBearer
 	}
-	jwToken := strings.TrimPrefix(token, "Bearer ")
-	_, err := jwt.Parse(jwToken, func(jwToken *jwt.Token) (interface{}, error) {
-		return []byte(JWTSecret), nil
-	})
+	return u.checkToken(strings.TrimPrefix(token, "Bearer "), "")
+}
+
+// CheckMFAToken verifies a token created by CreateMFAToken and returns its claims
+func (u *Util) CheckMFAToken(token string) (*common.TokenClaims, error) {
+	return u.checkToken(token, jwtPurposeMFAPending)
+}
+
+func (u *Util) checkToken(jwToken, purpose string) (*common.TokenClaims, error) {
+	claims := customJWTClaims{}
+	_, err := jwt.ParseWithClaims(jwToken, &claims, u.verificationKey)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if claims.Purpose != purpose {
+		return nil, common.ErrJSONTokenWrongPurpose
+	}
+	return &common.TokenClaims{
+		ID:            claims.Id,
+		UserID:        claims.Subject,
+		DisplayName:   claims.DisplayName,
+		EmailVerified: claims.EmailVerified,
+		Roles:         claims.Roles,
+		ClubRoles:     claims.ClubRoles,
+		IssuedAt:      time.Unix(claims.IssuedAt, 0),
+		ExpiresAt:     time.Unix(claims.ExpiresAt, 0),
+	}, nil
+}
+
+// verificationKey finds the key from the kid header. The algorithm has to be the one of the key,
+// otherwise a public key could be passed off as an HMAC secret
+func (u *Util) verificationKey(jwToken *jwt.Token) (interface{}, error) {
+	kid, _ := jwToken.Header["kid"].(string)
+	key, ok := u.verificationKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("Unknown key id: %q", kid)
+	}
+	if jwToken.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("Unexpected signing method: %v", jwToken.Header["alg"])
+	}
+	return key.publicKey, nil
+}
+
+// newJWTID returns a random ID so every token can be revoked on its own
+func newJWTID() (string, error) {
+	b := make([]byte, jwtIDBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	return nil
+	return hex.EncodeToString(b), nil
 }
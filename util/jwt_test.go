@@ -18,6 +18,7 @@ func TestCreateJSONToken(t *testing.T) {
 		user           *common.User
 	}
 
+	verifiedAt := time.Now()
 	testTable := []testData{
 		testData{
 			description: "should create token",
@@ -26,8 +27,16 @@ func TestCreateJSONToken(t *testing.T) {
 				ID:          "abc123",
 			},
 		},
+		testData{
+			description: "should create token for a verified email",
+			user: &common.User{
+				DisplayName:     "Bob",
+				EmailVerifiedAt: &verifiedAt,
+				ID:              "abc123",
+			},
+		},
 	}
-	u := NewUtil()
+	u := newTestUtil(t)
 	for _, td := range testTable {
 		jwToken, err := u.CreateJSONToken(td.user)
 		if err != nil {
@@ -35,16 +44,19 @@ func TestCreateJSONToken(t *testing.T) {
 		}
 		claims := customJWTClaims{}
 		_, err = jwt.ParseWithClaims(jwToken, &claims, func(jwToken *jwt.Token) (interface{}, error) {
-			return []byte(JWTSecret), nil
+			return u.signingKey.publicKey, nil
 		})
 		if err != nil {
 			t.Errorf("Error parsing jwt for %q: %v", td.description, err)
 			continue
 		}
 		//
-		assert.Equal(t, td.user.ID, claims.Id, td.description)
+		assert.Equal(t, td.user.ID, claims.Subject, td.description)
+		assert.NotEqual(t, td.user.ID, claims.Id, td.description)
+		assert.NotEmpty(t, claims.Id, td.description)
 		assert.Equal(t, jwtIssuer, claims.Issuer, td.description)
 		assert.Equal(t, td.user.DisplayName, claims.DisplayName, td.description)
+		assert.Equal(t, td.user.EmailVerifiedAt != nil, claims.EmailVerified, td.description)
 		// Just make sure the expirationDate is within a minute of the expected
 		if claims.ExpiresAt > (time.Now().Add(jwtExpiration).Add(time.Hour).Unix()) {
 			t.Errorf("ExpiresAt was greater than expected range for %q, got %d",
@@ -57,6 +69,31 @@ func TestCreateJSONToken(t *testing.T) {
 	}
 }
 
+func TestCreateJSONTokenUniqueID(t *testing.T) {
+	u := newTestUtil(t)
+	user := &common.User{
+		DisplayName: "Bob",
+		ID:          "abc123",
+	}
+	first, err := u.CreateJSONToken(user)
+	if !assert.Nil(t, err) {
+		t.Fatal(err)
+	}
+	second, err := u.CreateJSONToken(user)
+	if !assert.Nil(t, err) {
+		t.Fatal(err)
+	}
+	firstClaims, err := u.CheckJSONToken(fmt.Sprintf("Bearer %s", first))
+	if !assert.Nil(t, err) {
+		t.Fatal(err)
+	}
+	secondClaims, err := u.CheckJSONToken(fmt.Sprintf("Bearer %s", second))
+	if !assert.Nil(t, err) {
+		t.Fatal(err)
+	}
+	assert.NotEqual(t, firstClaims.ID, secondClaims.ID, "every token should have its own jti")
+}
+
 func TestCheckJSONToken(t *testing.T) {
 	type testData struct {
 		description   string
@@ -72,6 +109,8 @@ func TestCheckJSONToken(t *testing.T) {
 			user: &common.User{
 				DisplayName: "Bob",
 				ID:          "abc123",
+				Roles:       []string{"member"},
+				ClubRoles:   map[string]string{"club1": "owner"},
 			},
 		},
 		testData{
@@ -81,11 +120,11 @@ func TestCheckJSONToken(t *testing.T) {
 		},
 		testData{
 			description:   "Invalid With bearer",
-			expectedError: jwt.ValidationError{Inner: jwt.ErrSignatureInvalid},
-			invalidJWT:    fmt.Sprintf("Bearer %s1", jwtForFailingTests), // The one on the end makes it invalid
+			expectedError: jwt.ValidationError{Inner: fmt.Errorf("Unknown key id: %q", "")},
+			invalidJWT:    fmt.Sprintf("Bearer %s", jwtForFailingTests), // Signed with a shared secret and no kid
 		},
 	}
-	u := NewUtil()
+	u := newTestUtil(t)
 	for _, td := range testTable {
 		// Make a valid token - yeah yeah, shouldn't use prod functions for tests
 		if td.expectedError == nil {
@@ -94,10 +133,45 @@ func TestCheckJSONToken(t *testing.T) {
 			if err != nil {
 				t.Errorf("Unexpected err for %q: %v", td.description, td.expectedError)
 			}
-			assert.Nil(t, u.CheckJSONToken(jwToken), td.description)
+			claims, err := u.CheckJSONToken(jwToken)
+			if !assert.Nil(t, err, td.description) {
+				continue
+			}
+			assert.Equal(t, td.user.ID, claims.UserID, td.description)
+			assert.NotEmpty(t, claims.ID, td.description)
+			assert.Equal(t, td.user.DisplayName, claims.DisplayName, td.description)
+			assert.Equal(t, td.user.Roles, claims.Roles, td.description)
+			assert.Equal(t, td.user.ClubRoles, claims.ClubRoles, td.description)
 		} else {
-			err := u.CheckJSONToken(td.invalidJWT)
+			_, err := u.CheckJSONToken(td.invalidJWT)
 			assert.Equal(t, err.Error(), td.expectedError.Error(), td.description)
 		}
 	}
 }
+
+func TestMFAToken(t *testing.T) {
+	u := newTestUtil(t)
+	user := &common.User{
+		DisplayName: "Bob",
+		ID:          "abc123",
+	}
+	mfaToken, err := u.CreateMFAToken(user)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	claims, err := u.CheckMFAToken(mfaToken)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, user.ID, claims.UserID)
+	// An MFA token must not be accepted as a full token, or the other way around
+	_, err = u.CheckJSONToken(fmt.Sprintf("Bearer %s", mfaToken))
+	assert.Equal(t, common.ErrJSONTokenWrongPurpose, err)
+
+	jwToken, err := u.CreateJSONToken(user)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	_, err = u.CheckMFAToken(jwToken)
+	assert.Equal(t, common.ErrJSONTokenWrongPurpose, err)
+}
@@ -0,0 +1,138 @@
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/garycarr/book_club/common"
+)
+
+var (
+	errKeyNotPEM           = errors.New("Key is not PEM encoded")
+	errKeyNotPrivate       = errors.New("Signing key must be a private key")
+	errKeyIDMissing        = errors.New("Key needs an id")
+	errKeyTypeNotSupported = errors.New("Key must be an RSA or a P-256 ECDSA key")
+)
+
+// KeyFile is a PEM encoded key and the id it is published under in the kid header and the JWKS
+type KeyFile struct {
+	ID   string `json:"id"`
+	File string `json:"file"`
+}
+
+// jwtKey is a key that JSON tokens can be verified with, privateKey is only set for the signing key
+type jwtKey struct {
+	id         string
+	method     jwt.SigningMethod
+	publicKey  crypto.PublicKey
+	privateKey crypto.PrivateKey
+}
+
+// loadJWTKey reads an RSA or P-256 ECDSA key, public or private, from a PEM file
+func loadJWTKey(kf KeyFile) (*jwtKey, error) {
+	if kf.ID == "" {
+		return nil, errKeyIDMissing
+	}
+	data, err := ioutil.ReadFile(kf.File)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errKeyNotPEM
+	}
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("Unsupported PEM block %q in %s", block.Type, kf.File)
+	}
+	if err != nil {
+		return nil, err
+	}
+	key := jwtKey{id: kf.ID}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.privateKey, key.publicKey = k, &k.PublicKey
+	case *ecdsa.PrivateKey:
+		key.privateKey, key.publicKey = k, &k.PublicKey
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		key.publicKey = k
+	}
+	switch k := key.publicKey.(type) {
+	case *rsa.PublicKey:
+		key.method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errKeyTypeNotSupported
+		}
+		key.method = jwt.SigningMethodES256
+	default:
+		return nil, errKeyTypeNotSupported
+	}
+	return &key, nil
+}
+
+// jsonWebKey returns the public part of the key as described in RFC 7517
+func (k *jwtKey) jsonWebKey() common.JSONWebKey {
+	jwk := common.JSONWebKey{
+		KeyID:     k.id,
+		Use:       "sig",
+		Algorithm: k.method.Alg(),
+	}
+	switch pub := k.publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64URL(pub.N.Bytes())
+		jwk.E = base64URL(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = pub.Curve.Params().Name
+		jwk.X = base64URL(padLeft(pub.X.Bytes(), size))
+		jwk.Y = base64URL(padLeft(pub.Y.Bytes(), size))
+	}
+	return jwk
+}
+
+// JSONWebKeySet returns every key JSON tokens can currently be verified with
+func (u *Util) JSONWebKeySet() common.JSONWebKeySet {
+	jwks := common.JSONWebKeySet{Keys: []common.JSONWebKey{}}
+	for _, id := range u.verificationKeyIDs {
+		jwks.Keys = append(jwks.Keys, u.verificationKeys[id].jsonWebKey())
+	}
+	return jwks
+}
+
+func base64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// padLeft pads EC coordinates to the size of the curve, as the JWK spec requires
+func padLeft(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
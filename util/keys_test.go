@@ -0,0 +1,156 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadJWTKey(t *testing.T) {
+	type testData struct {
+		description    string
+		expectedError  bool
+		expectedMethod jwt.SigningMethod
+		keyFile        KeyFile
+		private        bool
+	}
+
+	testTable := []testData{
+		testData{
+			description:    "EC private key",
+			expectedMethod: jwt.SigningMethodES256,
+			keyFile:        KeyFile{ID: "ec", File: "testdata/ec.pem"},
+			private:        true,
+		},
+		testData{
+			description:    "EC public key",
+			expectedMethod: jwt.SigningMethodES256,
+			keyFile:        KeyFile{ID: "ec", File: "testdata/ec_public.pem"},
+		},
+		testData{
+			description:    "RSA private key",
+			expectedMethod: jwt.SigningMethodRS256,
+			keyFile:        KeyFile{ID: "rsa", File: "testdata/rsa.pem"},
+			private:        true,
+		},
+		testData{
+			description:   "P-384 key",
+			expectedError: true,
+			keyFile:       KeyFile{ID: "p384", File: "testdata/ec_p384.pem"},
+		},
+		testData{
+			description:   "Missing id",
+			expectedError: true,
+			keyFile:       KeyFile{File: "testdata/ec.pem"},
+		},
+		testData{
+			description:   "Missing file",
+			expectedError: true,
+			keyFile:       KeyFile{ID: "missing", File: "testdata/missing.pem"},
+		},
+	}
+	for _, td := range testTable {
+		key, err := loadJWTKey(td.keyFile)
+		if td.expectedError {
+			assert.NotNil(t, err, td.description)
+			continue
+		}
+		if !assert.Nil(t, err, td.description) {
+			continue
+		}
+		assert.Equal(t, td.keyFile.ID, key.id, td.description)
+		assert.Equal(t, td.expectedMethod, key.method, td.description)
+		assert.Equal(t, td.private, key.privateKey != nil, td.description)
+	}
+}
+
+func TestJSONWebKeySet(t *testing.T) {
+	u, err := NewUtil(Config{
+		SecretKey:        bytes.Repeat([]byte("k"), 32),
+		SigningKey:       KeyFile{ID: "ec", File: "testdata/ec.pem"},
+		VerificationKeys: []KeyFile{KeyFile{ID: "rsa", File: "testdata/rsa.pem"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := u.JSONWebKeySet()
+	if !assert.Len(t, jwks.Keys, 2) {
+		t.FailNow()
+	}
+	ec, rsa := jwks.Keys[0], jwks.Keys[1]
+	assert.Equal(t, "ec", ec.KeyID)
+	assert.Equal(t, "EC", ec.KeyType)
+	assert.Equal(t, "ES256", ec.Algorithm)
+	assert.Equal(t, "P-256", ec.Curve)
+	assert.Equal(t, "sig", ec.Use)
+	// P-256 coordinates are 32 bytes, 43 characters without padding
+	assert.Len(t, ec.X, 43)
+	assert.Len(t, ec.Y, 43)
+	assert.Empty(t, ec.N)
+
+	assert.Equal(t, "rsa", rsa.KeyID)
+	assert.Equal(t, "RSA", rsa.KeyType)
+	assert.Equal(t, "RS256", rsa.Algorithm)
+	assert.Equal(t, "AQAB", rsa.E)
+	assert.NotEmpty(t, rsa.N)
+	assert.Empty(t, rsa.Curve)
+}
+
+func TestJSONTokenKeyRotation(t *testing.T) {
+	secretKey := bytes.Repeat([]byte("k"), 32)
+	old, err := NewUtil(Config{SecretKey: secretKey, SigningKey: KeyFile{ID: "rsa", File: "testdata/rsa.pem"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &common.User{DisplayName: "Bob", ID: "abc123"}
+	oldToken, err := old.CreateJSONToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After the rotation tokens signed by the old key are accepted while it is a verification key
+	rotated, err := NewUtil(Config{
+		SecretKey:        secretKey,
+		SigningKey:       KeyFile{ID: "ec", File: "testdata/ec.pem"},
+		VerificationKeys: []KeyFile{KeyFile{ID: "rsa", File: "testdata/rsa.pem"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := rotated.CheckJSONToken(fmt.Sprintf("Bearer %s", oldToken))
+	if assert.Nil(t, err) {
+		assert.Equal(t, user.ID, claims.UserID)
+	}
+	newToken, err := rotated.CreateJSONToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := jwt.Parse(newToken, nil)
+	assert.Equal(t, "ec", parsed.Header["kid"])
+	assert.Equal(t, "ES256", parsed.Header["alg"])
+
+	// Once the old key is dropped its tokens are refused
+	dropped := newTestUtil(t)
+	_, err = dropped.CheckJSONToken(fmt.Sprintf("Bearer %s", oldToken))
+	assert.NotNil(t, err)
+}
+
+func TestCheckJSONTokenWrongAlgorithm(t *testing.T) {
+	u := newTestUtil(t)
+	// A token signed with HMAC using the public key as the secret must not be accepted
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, customJWTClaims{
+		StandardClaims: jwt.StandardClaims{Subject: "abc123", Id: "jti"},
+	})
+	token.Header["kid"] = "ec"
+	jwkey := u.JSONWebKeySet().Keys[0]
+	signed, err := token.SignedString([]byte(jwkey.X + jwkey.Y))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = u.CheckJSONToken(fmt.Sprintf("Bearer %s", signed))
+	assert.NotNil(t, err)
+}
@@ -29,7 +29,85 @@ func (mw *MockUtil) CreateJSONToken(user *common.User) (string, error) {
 }
 
 // CheckJSONToken is used to assert the method is called
-func (mw *MockUtil) CheckJSONToken(token string) error {
+func (mw *MockUtil) CheckJSONToken(token string) (*common.TokenClaims, error) {
 	args := mw.Called(token)
-	return args.Error(0)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.TokenClaims), args.Error(1)
+}
+
+// CreateRandomToken is used to assert the method is called
+func (mw *MockUtil) CreateRandomToken() (string, error) {
+	args := mw.Called()
+	return args.Get(0).(string), args.Error(1)
+}
+
+// CreateMFAToken is used to assert the method is called
+func (mw *MockUtil) CreateMFAToken(user *common.User) (string, error) {
+	args := mw.Called(user)
+	return args.Get(0).(string), args.Error(1)
+}
+
+// CheckMFAToken is used to assert the method is called
+func (mw *MockUtil) CheckMFAToken(token string) (*common.TokenClaims, error) {
+	args := mw.Called(token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.TokenClaims), args.Error(1)
+}
+
+// EncryptSecret is used to assert the method is called
+func (mw *MockUtil) EncryptSecret(secret string) (string, error) {
+	args := mw.Called(secret)
+	return args.Get(0).(string), args.Error(1)
+}
+
+// DecryptSecret is used to assert the method is called
+func (mw *MockUtil) DecryptSecret(encrypted string) (string, error) {
+	args := mw.Called(encrypted)
+	return args.Get(0).(string), args.Error(1)
+}
+
+// CreateTOTPSecret is used to assert the method is called
+func (mw *MockUtil) CreateTOTPSecret() (string, error) {
+	args := mw.Called()
+	return args.Get(0).(string), args.Error(1)
+}
+
+// CheckTOTPCode is used to assert the method is called
+func (mw *MockUtil) CheckTOTPCode(secret, code string) (int64, bool) {
+	args := mw.Called(secret, code)
+	return args.Get(0).(int64), args.Bool(1)
+}
+
+// CreateRecoveryCodes is used to assert the method is called
+func (mw *MockUtil) CreateRecoveryCodes() ([]string, error) {
+	args := mw.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+// JSONWebKeySet is used to assert the method is called
+func (mw *MockUtil) JSONWebKeySet() common.JSONWebKeySet {
+	args := mw.Called()
+	return args.Get(0).(common.JSONWebKeySet)
+}
+
+// CheckPasswordPolicy is used to assert the method is called
+func (mw *MockUtil) CheckPasswordPolicy(password string, user *common.User) []common.FieldError {
+	args := mw.Called(password, user)
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).([]common.FieldError)
+}
+
+// PasswordNeedsRehash is used to assert the method is called
+func (mw *MockUtil) PasswordNeedsRehash(dbPassword string) bool {
+	args := mw.Called(dbPassword)
+	return args.Bool(0)
 }
@@ -0,0 +1,150 @@
+package util
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/garycarr/book_club/common"
+)
+
+const (
+	defaultPasswordMinLength = 8
+	defaultPasswordMaxLength = 64
+
+	// breachedPrefixLength is the length of the hash prefix the breached passwords are grouped by,
+	// the same as the k-anonymity range API of Have I Been Pwned
+	breachedPrefixLength = 5
+	// minForbiddenLength stops short display names forbidding most passwords
+	minForbiddenLength = 3
+)
+
+// Password policy rules, they are returned in the field errors
+const (
+	PasswordRuleMinLength           = "min_length"
+	PasswordRuleMaxLength           = "max_length"
+	PasswordRuleContainsEmail       = "contains_email"
+	PasswordRuleContainsDisplayName = "contains_display_name"
+	PasswordRuleForbiddenWord       = "forbidden_word"
+	PasswordRuleBreached            = "breached"
+)
+
+// PasswordPolicyConfig ...
+type PasswordPolicyConfig struct {
+	MinLength int `json:"min_length"`
+	MaxLength int `json:"max_length"`
+	// ForbiddenWords can not appear anywhere in a password, case is ignored
+	ForbiddenWords []string `json:"forbidden_words"`
+	// BreachedFile has the upper case SHA-1 hash of a breached password on each line, optionally
+	// followed by :count as in the Have I Been Pwned downloads
+	BreachedFile string `json:"breached_file"`
+}
+
+type passwordPolicy struct {
+	minLength      int
+	maxLength      int
+	forbiddenWords []string
+	// breached is keyed by the hash prefix, then the rest of the hash
+	breached map[string]map[string]struct{}
+}
+
+func newPasswordPolicy(conf PasswordPolicyConfig) (*passwordPolicy, error) {
+	pp := &passwordPolicy{
+		minLength: conf.MinLength,
+		maxLength: conf.MaxLength,
+		breached:  map[string]map[string]struct{}{},
+	}
+	if pp.minLength <= 0 {
+		pp.minLength = defaultPasswordMinLength
+	}
+	if pp.maxLength <= 0 {
+		pp.maxLength = defaultPasswordMaxLength
+	}
+	for _, word := range conf.ForbiddenWords {
+		pp.forbiddenWords = append(pp.forbiddenWords, strings.ToLower(word))
+	}
+	if conf.BreachedFile == "" {
+		return pp, nil
+	}
+	if err := pp.loadBreached(conf.BreachedFile); err != nil {
+		return nil, fmt.Errorf("Unable to load breached passwords: %v", err)
+	}
+	return pp, nil
+}
+
+func (pp *passwordPolicy) loadBreached(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hash := strings.ToUpper(strings.TrimSpace(strings.SplitN(scanner.Text(), ":", 2)[0]))
+		if hash == "" {
+			continue
+		}
+		if len(hash) != sha1.Size*2 {
+			return fmt.Errorf("%q is not a SHA-1 hash", hash)
+		}
+		prefix, suffix := hash[:breachedPrefixLength], hash[breachedPrefixLength:]
+		if pp.breached[prefix] == nil {
+			pp.breached[prefix] = map[string]struct{}{}
+		}
+		pp.breached[prefix][suffix] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+// isBreached only looks up the hash prefix of the password, so the list could be swapped for the
+// range API without the password or its full hash leaving the service
+func (pp *passwordPolicy) isBreached(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	_, ok := pp.breached[hash[:breachedPrefixLength]][hash[breachedPrefixLength:]]
+	return ok
+}
+
+// CheckPasswordPolicy returns a field error for each rule the password breaks, the email and display
+// name of the user can not be part of their password
+func (u *Util) CheckPasswordPolicy(password string, user *common.User) []common.FieldError {
+	pp := u.passwordPolicy
+	var fieldErrors []common.FieldError
+	fail := func(rule, message string) {
+		fieldErrors = append(fieldErrors, common.FieldError{Field: "password", Rule: rule, Message: message})
+	}
+	length := utf8.RuneCountInString(password)
+	if length < pp.minLength {
+		fail(PasswordRuleMinLength, fmt.Sprintf("Password must be at least %d characters", pp.minLength))
+	}
+	if length > pp.maxLength {
+		fail(PasswordRuleMaxLength, fmt.Sprintf("Password must be at most %d characters", pp.maxLength))
+	}
+	lower := strings.ToLower(password)
+	if user != nil {
+		email := strings.ToLower(user.Email)
+		local := strings.SplitN(email, "@", 2)[0]
+		if (email != "" && strings.Contains(lower, email)) ||
+			(len(local) >= minForbiddenLength && strings.Contains(lower, local)) {
+			fail(PasswordRuleContainsEmail, "Password can not contain your email address")
+		}
+		displayName := strings.ToLower(user.DisplayName)
+		if len(displayName) >= minForbiddenLength && strings.Contains(lower, displayName) {
+			fail(PasswordRuleContainsDisplayName, "Password can not contain your display name")
+		}
+	}
+	for _, word := range pp.forbiddenWords {
+		if strings.Contains(lower, word) {
+			fail(PasswordRuleForbiddenWord, fmt.Sprintf("Password can not contain %q", word))
+			break
+		}
+	}
+	if pp.isBreached(password) {
+		fail(PasswordRuleBreached, "Password has appeared in a data breach, choose another")
+	}
+	return fieldErrors
+}
@@ -0,0 +1,111 @@
+package util
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedRules []string
+		password      string
+		user          *common.User
+	}
+
+	user := &common.User{Email: "gary.carr@example.com", DisplayName: "Gary"}
+	testTable := []testData{
+		testData{
+			description: "Good password",
+			password:    "tall purple giraffes",
+			user:        user,
+		},
+		testData{
+			description:   "Too short",
+			expectedRules: []string{PasswordRuleMinLength},
+			password:      "short",
+			user:          user,
+		},
+		testData{
+			description:   "Too long",
+			expectedRules: []string{PasswordRuleMaxLength},
+			password:      strings.Repeat("a", 31),
+			user:          user,
+		},
+		testData{
+			description:   "Length is counted in characters",
+			expectedRules: []string{PasswordRuleMinLength},
+			password:      "ééééééé",
+			user:          user,
+		},
+		testData{
+			description:   "Contains the email",
+			expectedRules: []string{PasswordRuleContainsEmail, PasswordRuleContainsDisplayName},
+			password:      "GARY.CARR@example.com!",
+			user:          user,
+		},
+		testData{
+			description:   "Contains the start of the email",
+			expectedRules: []string{PasswordRuleContainsEmail},
+			password:      "secret gary.carr",
+			user:          &common.User{Email: "gary.carr@example.com", DisplayName: "Bob"},
+		},
+		testData{
+			description:   "Contains the display name",
+			expectedRules: []string{PasswordRuleContainsDisplayName},
+			password:      "xx gary xx gary",
+			user:          user,
+		},
+		testData{
+			description:   "Contains a forbidden word",
+			expectedRules: []string{PasswordRuleForbiddenWord},
+			password:      "my BookClub rocks",
+			user:          user,
+		},
+		testData{
+			description:   "Breached",
+			expectedRules: []string{PasswordRuleBreached},
+			password:      "correcthorsebatterystaple",
+			user:          user,
+		},
+		testData{
+			description:   "Everything at once",
+			expectedRules: []string{PasswordRuleMinLength, PasswordRuleBreached},
+			password:      "qwerty",
+		},
+	}
+	u, err := NewUtil(Config{
+		SecretKey:  bytes.Repeat([]byte("k"), 32),
+		SigningKey: KeyFile{ID: "ec", File: "testdata/ec.pem"},
+		PasswordPolicy: PasswordPolicyConfig{
+			MinLength:      8,
+			MaxLength:      30,
+			ForbiddenWords: []string{"BookClub"},
+			BreachedFile:   "testdata/breached_passwords.txt",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, td := range testTable {
+		var rules []string
+		for _, fe := range u.CheckPasswordPolicy(td.password, td.user) {
+			assert.Equal(t, "password", fe.Field, td.description)
+			assert.NotEmpty(t, fe.Message, td.description)
+			rules = append(rules, fe.Rule)
+		}
+		assert.Equal(t, td.expectedRules, rules, td.description)
+	}
+}
+
+func TestNewPasswordPolicyBreachedFile(t *testing.T) {
+	_, err := newPasswordPolicy(PasswordPolicyConfig{BreachedFile: "testdata/missing.txt"})
+	assert.NotNil(t, err)
+	// A PEM file is not a list of hashes
+	_, err = newPasswordPolicy(PasswordPolicyConfig{BreachedFile: "testdata/ec.pem"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,40 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateRandomToken(t *testing.T) {
+	u := newTestUtil(t)
+	first, err := u.CreateRandomToken()
+	if !assert.Nil(t, err) {
+		t.Fatal(err)
+	}
+	second, err := u.CreateRandomToken()
+	if !assert.Nil(t, err) {
+		t.Fatal(err)
+	}
+	assert.NotEmpty(t, first)
+	assert.NotEqual(t, first, second, "tokens should be random")
+}
+
+func TestHashToken(t *testing.T) {
+	type testData struct {
+		description  string
+		expectedHash string
+		token        string
+	}
+
+	testTable := []testData{
+		testData{
+			description:  "Hashes the token",
+			expectedHash: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+			token:        "test",
+		},
+	}
+	for _, td := range testTable {
+		assert.Equal(t, td.expectedHash, HashToken(td.token), td.description)
+	}
+}
@@ -0,0 +1,108 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP as described in RFC 6238, using the defaults authenticator apps expect
+const (
+	totpSecretBytes = 20
+	totpPeriod      = 30
+	totpDigits      = 6
+	totpModulo      = 1000000
+	// totpSkew is how many periods either side of now are accepted, for clocks that have drifted
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 5
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// CreateTOTPSecret returns a random base32 encoded secret
+func (u *Util) CreateTOTPSecret() (string, error) {
+	b := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32NoPadding.EncodeToString(b), nil
+}
+
+// CheckTOTPCode checks the code against the secret allowing for clock skew. The time step the code
+// matched is returned so a code can not be used twice
+func (u *Util) CheckTOTPCode(secret, code string) (int64, bool) {
+	return checkTOTPCode(secret, code, time.Now())
+}
+
+// CreateRecoveryCodes returns single use codes that can be given instead of a TOTP code
+func (u *Util) CreateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32NoPadding.EncodeToString(b))
+		codes[i] = fmt.Sprintf("%s-%s", code[:4], code[4:])
+	}
+	return codes, nil
+}
+
+// NormaliseRecoveryCode strips the formatting from a recovery code so it can be hashed
+func NormaliseRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.Replace(code, "-", "", -1)
+}
+
+// TOTPCode returns the code for the secret at the time given
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, t.Unix()/totpPeriod), nil
+}
+
+// TOTPURI returns the otpauth URI authenticator apps read from a QR code
+func TOTPURI(secret, account, issuer string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("digits", fmt.Sprintf("%d", totpDigits))
+	v.Set("period", fmt.Sprintf("%d", totpPeriod))
+	return fmt.Sprintf("otpauth://totp/%s:%s?%s", url.PathEscape(issuer), url.PathEscape(account), v.Encode())
+}
+
+func checkTOTPCode(secret, code string, t time.Time) (int64, bool) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	step := t.Unix() / totpPeriod
+	for i := int64(-totpSkew); i <= totpSkew; i++ {
+		if hmac.Equal([]byte(hotp(key, step+i)), []byte(code)) {
+			return step + i, true
+		}
+	}
+	return 0, false
+}
+
+// hotp is the HMAC based one time password from RFC 4226
+func hotp(key []byte, counter int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, code%totpModulo)
+}
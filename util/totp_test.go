@@ -0,0 +1,120 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfc6238Secret is the SHA1 test secret from RFC 6238, "12345678901234567890" in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	type testData struct {
+		description  string
+		expectedCode string
+		time         time.Time
+	}
+
+	// The RFC uses 8 digits, these are the last 6
+	testTable := []testData{
+		testData{
+			description:  "RFC 6238 at 59",
+			expectedCode: "287082",
+			time:         time.Unix(59, 0),
+		},
+		testData{
+			description:  "RFC 6238 at 1111111109",
+			expectedCode: "081804",
+			time:         time.Unix(1111111109, 0),
+		},
+		testData{
+			description:  "RFC 6238 at 1234567890",
+			expectedCode: "005924",
+			time:         time.Unix(1234567890, 0),
+		},
+		testData{
+			description:  "RFC 6238 at 2000000000",
+			expectedCode: "279037",
+			time:         time.Unix(2000000000, 0),
+		},
+	}
+	for _, td := range testTable {
+		code, err := TOTPCode(rfc6238Secret, td.time)
+		if !assert.Nil(t, err, td.description) {
+			continue
+		}
+		assert.Equal(t, td.expectedCode, code, td.description)
+	}
+}
+
+func TestCheckTOTPCode(t *testing.T) {
+	type testData struct {
+		description  string
+		codeTime     time.Time
+		expectedStep int64
+		expectedOK   bool
+	}
+
+	now := time.Unix(1111111109, 0)
+	step := now.Unix() / totpPeriod
+	testTable := []testData{
+		testData{
+			description:  "Code for now",
+			codeTime:     now,
+			expectedStep: step,
+			expectedOK:   true,
+		},
+		testData{
+			description:  "Code from the previous period",
+			codeTime:     now.Add(-totpPeriod * time.Second),
+			expectedStep: step - 1,
+			expectedOK:   true,
+		},
+		testData{
+			description:  "Code from the next period",
+			codeTime:     now.Add(totpPeriod * time.Second),
+			expectedStep: step + 1,
+			expectedOK:   true,
+		},
+		testData{
+			description: "Code from outside the skew window",
+			codeTime:    now.Add(-3 * totpPeriod * time.Second),
+		},
+	}
+	for _, td := range testTable {
+		code, err := TOTPCode(rfc6238Secret, td.codeTime)
+		if !assert.Nil(t, err, td.description) {
+			continue
+		}
+		gotStep, ok := checkTOTPCode(rfc6238Secret, code, now)
+		assert.Equal(t, td.expectedOK, ok, td.description)
+		assert.Equal(t, td.expectedStep, gotStep, td.description)
+	}
+	_, ok := checkTOTPCode(rfc6238Secret, "12345", now)
+	assert.False(t, ok, "short codes should not match")
+}
+
+func TestCreateRecoveryCodes(t *testing.T) {
+	u := newTestUtil(t)
+	codes, err := u.CreateRecoveryCodes()
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	assert.Len(t, codes, recoveryCodeCount)
+	seen := map[string]bool{}
+	for _, code := range codes {
+		assert.Len(t, code, 9)
+		assert.False(t, seen[code], "recovery codes should be unique")
+		seen[code] = true
+		assert.Equal(t, strings.Replace(code, "-", "", -1), NormaliseRecoveryCode(strings.ToUpper(code)))
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("JBSWY3DPEHPK3PXP", "gcarr@example.com", "Book Club")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Book%20Club:gcarr@example.com?"), uri)
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+}
@@ -1,9 +1,75 @@
 package util
 
+import "fmt"
+
+const secretKeyLength = 32
+
+// Config ...
+type Config struct {
+	// SecretKey encrypts secrets that are stored in the warehouse, it must be 32 bytes for AES-256
+	SecretKey []byte
+	// SigningKey is the private key new JSON tokens are signed with
+	SigningKey KeyFile
+	// VerificationKeys are extra keys JSON tokens are still accepted from, such as the signing key
+	// before a rotation. They can be public or private keys
+	VerificationKeys []KeyFile
+	PasswordPolicy   PasswordPolicyConfig
+	PasswordHash     PasswordHashConfig
+}
+
 // Util ...
-type Util struct{}
+type Util struct {
+	secretKey          []byte
+	signingKey         *jwtKey
+	verificationKeys   map[string]*jwtKey
+	verificationKeyIDs []string
+	passwordPolicy     *passwordPolicy
+	// hasher makes new password hashes, hashers can check every supported algorithm
+	hasher  passwordHasher
+	hashers []passwordHasher
+}
 
 // NewUtil ...
-func NewUtil() *Util {
-	return &Util{}
+func NewUtil(conf Config) (*Util, error) {
+	if len(conf.SecretKey) != secretKeyLength {
+		return nil, fmt.Errorf("Secret key must be %d bytes, got %d", secretKeyLength, len(conf.SecretKey))
+	}
+	signingKey, err := loadJWTKey(conf.SigningKey)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load signing key: %v", err)
+	}
+	if signingKey.privateKey == nil {
+		return nil, errKeyNotPrivate
+	}
+	pp, err := newPasswordPolicy(conf.PasswordPolicy)
+	if err != nil {
+		return nil, err
+	}
+	hasher, hashers, err := newPasswordHashers(conf.PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+	u := &Util{
+		hasher:             hasher,
+		hashers:            hashers,
+		passwordPolicy:     pp,
+		secretKey:          conf.SecretKey,
+		signingKey:         signingKey,
+		verificationKeys:   map[string]*jwtKey{signingKey.id: signingKey},
+		verificationKeyIDs: []string{signingKey.id},
+	}
+	for _, kf := range conf.VerificationKeys {
+		key, err := loadJWTKey(kf)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load verification key %q: %v", kf.ID, err)
+		}
+		if _, ok := u.verificationKeys[key.id]; ok {
+			return nil, fmt.Errorf("Key id %q is used more than once", key.id)
+		}
+		// Only the public key is needed to verify
+		key.privateKey = nil
+		u.verificationKeys[key.id] = key
+		u.verificationKeyIDs = append(u.verificationKeyIDs, key.id)
+	}
+	return u, nil
 }
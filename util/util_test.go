@@ -0,0 +1,81 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewUtil(t *testing.T) {
+	type testData struct {
+		description      string
+		secretKey        []byte
+		signingKey       KeyFile
+		verificationKeys []KeyFile
+		expectError      bool
+	}
+
+	signingKey := KeyFile{ID: "ec", File: "testdata/ec.pem"}
+	testTable := []testData{
+		testData{
+			description: "32 byte secret key",
+			secretKey:   bytes.Repeat([]byte("k"), 32),
+			signingKey:  signingKey,
+		},
+		testData{
+			description: "Short secret key",
+			secretKey:   []byte("short"),
+			signingKey:  signingKey,
+			expectError: true,
+		},
+		testData{
+			description: "No secret key",
+			signingKey:  signingKey,
+			expectError: true,
+		},
+		testData{
+			description: "No signing key",
+			secretKey:   bytes.Repeat([]byte("k"), 32),
+			expectError: true,
+		},
+		testData{
+			description: "Public signing key",
+			secretKey:   bytes.Repeat([]byte("k"), 32),
+			signingKey:  KeyFile{ID: "ec", File: "testdata/ec_public.pem"},
+			expectError: true,
+		},
+		testData{
+			description:      "Verification keys",
+			secretKey:        bytes.Repeat([]byte("k"), 32),
+			signingKey:       signingKey,
+			verificationKeys: []KeyFile{KeyFile{ID: "rsa", File: "testdata/rsa.pem"}},
+		},
+		testData{
+			description:      "Duplicate key id",
+			secretKey:        bytes.Repeat([]byte("k"), 32),
+			signingKey:       signingKey,
+			verificationKeys: []KeyFile{KeyFile{ID: "ec", File: "testdata/rsa.pem"}},
+			expectError:      true,
+		},
+	}
+	for _, td := range testTable {
+		_, err := NewUtil(Config{
+			SecretKey:        td.secretKey,
+			SigningKey:       td.signingKey,
+			VerificationKeys: td.verificationKeys,
+		})
+		assert.Equal(t, td.expectError, err != nil, td.description)
+	}
+}
+
+func newTestUtil(t *testing.T) *Util {
+	u, err := NewUtil(Config{
+		SecretKey:  bytes.Repeat([]byte("k"), 32),
+		SigningKey: KeyFile{ID: "ec", File: "testdata/ec.pem"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
@@ -0,0 +1,142 @@
+package warehouse
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+)
+
+// bookColumns are selected by every book query and read by scanBook. Missing ISBNs and page counts
+// are stored as NULL so the unique indexes ignore them. The average rating is worked out from the
+// cached sum so the reviews are not read
+const bookColumns = `id, title, authors, COALESCE(isbn_10, ''), COALESCE(isbn_13, ''), publisher, published_date,
+		COALESCE(page_count, 0), description, cover_url, language, rating_count,
+		COALESCE(round(rating_sum / NULLIF(rating_count, 0), 2), 0), rating_histogram, created_at, updated_at`
+
+// CreateBook adds the book to the catalog, the id and times are set on book
+func (w *Warehouse) CreateBook(book *common.Book) error {
+	err := w.DB.QueryRow(`INSERT INTO book (title, authors, isbn_10, isbn_13, publisher, published_date, page_count,
+			description, cover_url, language)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, NULLIF($7, 0), $8, $9, $10)
+		RETURNING id, created_at, updated_at`, book.Title, pq.Array(book.Authors), book.ISBN10, book.ISBN13,
+		book.Publisher, book.PublishedDate, book.PageCount, book.Description, book.CoverURL, book.Language).
+		Scan(&book.ID, &book.CreatedAt, &book.UpdatedAt)
+	return bookError(err)
+}
+
+// GetBook ignores deleted books
+func (w *Warehouse) GetBook(id string) (*common.Book, error) {
+	book, err := scanBook(w.DB.QueryRow(`SELECT `+bookColumns+`
+		FROM book
+		WHERE id = $1 AND deleted_at IS NULL`, id))
+	if err != nil {
+		return nil, bookError(err)
+	}
+	return book, nil
+}
+
+// ListBooks returns a page of the books that match the filter ordered by title, and how many match
+// in total
+func (w *Warehouse) ListBooks(filter common.BookFilter) ([]common.Book, int, error) {
+	conditions := []string{"deleted_at IS NULL"}
+	args := []interface{}{}
+	if filter.Title != "" {
+		args = append(args, likePattern(filter.Title))
+		conditions = append(conditions, fmt.Sprintf("title ILIKE $%d", len(args)))
+	}
+	if filter.Author != "" {
+		args = append(args, likePattern(filter.Author))
+		conditions = append(conditions, fmt.Sprintf("EXISTS (SELECT 1 FROM unnest(authors) AS author WHERE author ILIKE $%d)", len(args)))
+	}
+	if filter.ISBN != "" {
+		args = append(args, filter.ISBN)
+		conditions = append(conditions, fmt.Sprintf("(isbn_10 = $%d OR isbn_13 = $%d)", len(args), len(args)))
+	}
+	where := strings.Join(conditions, " AND ")
+	var total int
+	if err := w.DB.QueryRow(`SELECT COUNT(*) FROM book WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	rows, err := w.DB.Query(fmt.Sprintf(`SELECT `+bookColumns+`
+		FROM book
+		WHERE %s
+		ORDER BY lower(title), id
+		LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	books := []common.Book{}
+	for rows.Next() {
+		book, err := scanBook(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		books = append(books, *book)
+	}
+	return books, total, rows.Err()
+}
+
+// UpdateBook replaces every detail of the book, updated_at is set on book
+func (w *Warehouse) UpdateBook(book *common.Book) error {
+	err := w.DB.QueryRow(`UPDATE book SET title = $1, authors = $2, isbn_10 = NULLIF($3, ''), isbn_13 = NULLIF($4, ''),
+			publisher = $5, published_date = $6, page_count = NULLIF($7, 0), description = $8, cover_url = $9,
+			language = $10, updated_at = NOW()
+		WHERE id = $11 AND deleted_at IS NULL
+		RETURNING updated_at`, book.Title, pq.Array(book.Authors), book.ISBN10, book.ISBN13, book.Publisher,
+		book.PublishedDate, book.PageCount, book.Description, book.CoverURL, book.Language, book.ID).
+		Scan(&book.UpdatedAt)
+	return bookError(err)
+}
+
+// DeleteBook soft deletes the book. The row is kept for anything that refers to it
+func (w *Warehouse) DeleteBook(id string) error {
+	res, err := w.DB.Exec(`UPDATE book SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		return bookError(err)
+	}
+	return expectRowsAffected(res, common.ErrBookNotFound)
+}
+
+func scanBook(row scanner) (*common.Book, error) {
+	b := common.Book{}
+	var histogram pq.Int64Array
+	err := row.Scan(&b.ID, &b.Title, pq.Array(&b.Authors), &b.ISBN10, &b.ISBN13, &b.Publisher, &b.PublishedDate,
+		&b.PageCount, &b.Description, &b.CoverURL, &b.Language, &b.Rating.Count, &b.Rating.Average, &histogram,
+		&b.CreatedAt, &b.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	b.Rating.Histogram = make([]int, len(histogram))
+	for i, count := range histogram {
+		b.Rating.Histogram[i] = int(count)
+	}
+	return &b, nil
+}
+
+// bookError turns the errors for a missing book, an id that is not a uuid and a duplicate ISBN into
+// the errors the handlers expect
+func bookError(err error) error {
+	if err == sql.ErrNoRows {
+		return common.ErrBookNotFound
+	}
+	if pqErr, ok := err.(*pq.Error); ok {
+		switch pqErr.Code.Name() {
+		case "unique_violation":
+			return common.ErrBookAlreadyExists
+		case "invalid_text_representation":
+			return common.ErrBookNotFound
+		}
+	}
+	return err
+}
+
+// likePattern matches s anywhere in a value, the wildcards LIKE uses are escaped in s
+func likePattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
+}
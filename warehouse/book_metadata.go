@@ -0,0 +1,47 @@
+package warehouse
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/garycarr/book_club/common"
+)
+
+// GetBookMetadata returns the cached result of looking the ISBN-13 up, or
+// common.ErrBookMetadataNotCached if it has not been looked up
+func (w *Warehouse) GetBookMetadata(isbn13 string) (*common.BookMetadata, error) {
+	bm := common.BookMetadata{ISBN13: isbn13}
+	var details []byte
+	err := w.DB.QueryRow(`SELECT details, fetched_at FROM book_metadata WHERE isbn_13 = $1`, isbn13).
+		Scan(&details, &bm.FetchedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, common.ErrBookMetadataNotCached
+		}
+		return nil, err
+	}
+	if details != nil {
+		if err = json.Unmarshal(details, &bm.Details); err != nil {
+			return nil, err
+		}
+	}
+	return &bm, nil
+}
+
+// SaveBookMetadata caches the result of looking an ISBN-13 up, replacing any earlier result
+func (w *Warehouse) SaveBookMetadata(bm common.BookMetadata) error {
+	// A nil interface rather than a nil slice, so a miss is stored as NULL
+	var details interface{}
+	if bm.Details != nil {
+		data, err := json.Marshal(bm.Details)
+		if err != nil {
+			return err
+		}
+		details = data
+	}
+	_, err := w.DB.Exec(`INSERT INTO book_metadata (isbn_13, details, fetched_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (isbn_13) DO UPDATE SET details = EXCLUDED.details, fetched_at = EXCLUDED.fetched_at`,
+		bm.ISBN13, details, bm.FetchedAt)
+	return err
+}
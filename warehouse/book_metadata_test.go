@@ -0,0 +1,87 @@
+package warehouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseGetBookMetadata(t *testing.T) {
+	type testData struct {
+		description      string
+		details          interface{}
+		expectedError    error
+		expectedMetadata *common.BookMetadata
+		found            bool
+	}
+
+	fetchedAt := time.Now()
+	testTable := []testData{
+		testData{
+			description: "Cached details",
+			details:     []byte(`{"title": "Dune", "authors": ["Frank Herbert"]}`),
+			expectedMetadata: &common.BookMetadata{ISBN13: "9780441172719", FetchedAt: fetchedAt,
+				Details: &common.BookDetails{Title: "Dune", Authors: []string{"Frank Herbert"}}},
+			found: true,
+		},
+		testData{
+			description:      "Cached miss",
+			expectedMetadata: &common.BookMetadata{ISBN13: "9780441172719", FetchedAt: fetchedAt},
+			found:            true,
+		},
+		testData{
+			description:   "Not looked up",
+			expectedError: common.ErrBookMetadataNotCached,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		rows := sqlmock.NewRows([]string{"details", "fetched_at"})
+		if td.found {
+			rows.AddRow(td.details, fetchedAt)
+		}
+		mock.ExpectQuery("SELECT details, fetched_at FROM book_metadata WHERE isbn_13 = \\$1").
+			WithArgs("9780441172719").
+			WillReturnRows(rows)
+		bm, err := w.GetBookMetadata("9780441172719")
+		assert.Equal(t, td.expectedError, err, td.description)
+		assert.Equal(t, td.expectedMetadata, bm, td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseSaveBookMetadata(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	fetchedAt := time.Now()
+	mock.ExpectExec("INSERT INTO book_metadata \\(isbn_13, details, fetched_at\\) .+ ON CONFLICT \\(isbn_13\\) DO UPDATE").
+		WithArgs("9780441172719", []byte(`{"title":"Dune","authors":null,"isbn10":"","isbn13":"","publisher":"",`+
+			`"publishedDate":"","pageCount":0,"description":"","coverURL":"","language":""}`), fetchedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO book_metadata").
+		WithArgs("9780441172719", nil, fetchedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.Nil(t, w.SaveBookMetadata(common.BookMetadata{ISBN13: "9780441172719", FetchedAt: fetchedAt,
+		Details: &common.BookDetails{Title: "Dune"}}))
+	assert.Nil(t, w.SaveBookMetadata(common.BookMetadata{ISBN13: "9780441172719", FetchedAt: fetchedAt}))
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
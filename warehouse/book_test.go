@@ -0,0 +1,225 @@
+package warehouse
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var bookColumnNames = []string{"id", "title", "authors", "isbn_10", "isbn_13", "publisher", "published_date", "page_count",
+	"description", "cover_url", "language", "rating_count", "rating_average", "rating_histogram", "created_at",
+	"updated_at"}
+
+func TestWarehouseCreateBook(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		insertError   error
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Adds the book",
+		},
+		testData{
+			description:   "ISBN already in the catalog",
+			expectedError: common.ErrBookAlreadyExists,
+			insertError:   &pq.Error{Code: "23505"},
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	createdAt := time.Now()
+	for _, td := range testTable {
+		book := &common.Book{BookDetails: common.BookDetails{Title: "Dune", Authors: []string{"Frank Herbert"}, ISBN13: "9780441172719"}}
+		expect := mock.ExpectQuery("INSERT INTO book \\(title, authors, isbn_10, isbn_13, .+ NULLIF\\(\\$3, ''\\), NULLIF\\(\\$4, ''\\)").
+			WithArgs("Dune", sqlmock.AnyArg(), "", "9780441172719", "", "", 0, "", "", "")
+		if td.insertError != nil {
+			expect.WillReturnError(td.insertError)
+		} else {
+			expect.WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("bookID", createdAt, createdAt))
+		}
+		err := w.CreateBook(book)
+		assert.Equal(t, td.expectedError, err, td.description)
+		if td.expectedError == nil {
+			assert.Equal(t, "bookID", book.ID, td.description)
+			assert.Equal(t, createdAt, book.CreatedAt, td.description)
+		}
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseGetBook(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		found         bool
+		queryError    error
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Gets the book",
+			found:       true,
+		},
+		testData{
+			description:   "Unknown or deleted book",
+			expectedError: common.ErrBookNotFound,
+		},
+		testData{
+			description:   "Id is not a uuid",
+			expectedError: common.ErrBookNotFound,
+			queryError:    &pq.Error{Code: "22P02"},
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	createdAt := time.Now()
+	for _, td := range testTable {
+		expect := mock.ExpectQuery("SELECT id, title, authors, .+ FROM book WHERE id = \\$1 AND deleted_at IS NULL").
+			WithArgs("bookID")
+		rows := sqlmock.NewRows(bookColumnNames)
+		if td.found {
+			rows.AddRow("bookID", "Dune", "{\"Frank Herbert\"}", "", "9780441172719", "Ace", "1965", 412, "", "", "en",
+				2, "4.25", "{0,0,0,0,0,0,0,1,0,1}", createdAt, createdAt)
+		}
+		if td.queryError != nil {
+			expect.WillReturnError(td.queryError)
+		} else {
+			expect.WillReturnRows(rows)
+		}
+		book, err := w.GetBook("bookID")
+		assert.Equal(t, td.expectedError, err, td.description)
+		if td.expectedError == nil {
+			assert.Equal(t, &common.Book{
+				ID: "bookID",
+				BookDetails: common.BookDetails{Title: "Dune", Authors: []string{"Frank Herbert"}, ISBN13: "9780441172719",
+					Publisher: "Ace", PublishedDate: "1965", PageCount: 412, Language: "en"},
+				Rating:    common.BookRating{Average: 4.25, Count: 2, Histogram: []int{0, 0, 0, 0, 0, 0, 0, 1, 0, 1}},
+				CreatedAt: createdAt,
+				UpdatedAt: createdAt,
+			}, book, td.description)
+		}
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseListBooks(t *testing.T) {
+	type testData struct {
+		description  string
+		countQuery   string
+		expectedArgs []driver.Value
+		filter       common.BookFilter
+		listQuery    string
+	}
+
+	testTable := []testData{
+		testData{
+			description:  "No filters",
+			countQuery:   "SELECT COUNT\\(\\*\\) FROM book WHERE deleted_at IS NULL$",
+			expectedArgs: []driver.Value{},
+			filter:       common.BookFilter{Pagination: common.Pagination{Limit: 20}},
+			listQuery:    "FROM book WHERE deleted_at IS NULL ORDER BY lower\\(title\\), id LIMIT \\$1 OFFSET \\$2",
+		},
+		testData{
+			description: "Every filter, with the LIKE wildcards escaped",
+			countQuery: "SELECT COUNT\\(\\*\\) FROM book WHERE deleted_at IS NULL AND title ILIKE \\$1 AND " +
+				"EXISTS \\(SELECT 1 FROM unnest\\(authors\\) AS author WHERE author ILIKE \\$2\\) AND \\(isbn_10 = \\$3 OR isbn_13 = \\$3\\)",
+			expectedArgs: []driver.Value{"%100\\%%", "%le\\_guin%", "0441478123"},
+			filter: common.BookFilter{Title: "100%", Author: "le_guin", ISBN: "0441478123",
+				Pagination: common.Pagination{Limit: 5, Offset: 10}},
+			listQuery: "AND \\(isbn_10 = \\$3 OR isbn_13 = \\$3\\) ORDER BY lower\\(title\\), id LIMIT \\$4 OFFSET \\$5",
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	createdAt := time.Now()
+	for _, td := range testTable {
+		mock.ExpectQuery(td.countQuery).
+			WithArgs(td.expectedArgs...).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(21))
+		mock.ExpectQuery(td.listQuery).
+			WithArgs(append(td.expectedArgs, td.filter.Limit, td.filter.Offset)...).
+			WillReturnRows(sqlmock.NewRows(bookColumnNames).
+				AddRow("bookID", "Dune", "{}", "", "", "", "", 0, "", "", "", 0, "0", "{0,0,0,0,0,0,0,0,0,0}", createdAt, createdAt))
+		books, total, err := w.ListBooks(td.filter)
+		if assert.Nil(t, err, td.description) {
+			assert.Equal(t, 21, total, td.description)
+			assert.Len(t, books, 1, td.description)
+		}
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseUpdateBook(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	updatedAt := time.Now()
+	book := &common.Book{ID: "bookID", BookDetails: common.BookDetails{Title: "Dune", Authors: []string{}, PageCount: 412}}
+	mock.ExpectQuery("UPDATE book SET title = \\$1, .+ WHERE id = \\$11 AND deleted_at IS NULL RETURNING updated_at").
+		WithArgs("Dune", sqlmock.AnyArg(), "", "", "", "", 412, "", "", "", "bookID").
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(updatedAt))
+	mock.ExpectQuery("UPDATE book SET title = \\$1, .+ WHERE id = \\$11 AND deleted_at IS NULL RETURNING updated_at").
+		WithArgs("Dune", sqlmock.AnyArg(), "", "", "", "", 412, "", "", "", "bookID").
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}))
+
+	assert.Nil(t, w.UpdateBook(book))
+	assert.Equal(t, updatedAt, book.UpdatedAt)
+	assert.Equal(t, common.ErrBookNotFound, w.UpdateBook(book))
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseDeleteBook(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	mock.ExpectExec("UPDATE book SET deleted_at = NOW\\(\\), updated_at = NOW\\(\\) WHERE id = \\$1 AND deleted_at IS NULL").
+		WithArgs("bookID").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE book SET deleted_at = NOW\\(\\)").
+		WithArgs("bookID").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Nil(t, w.DeleteBook("bookID"))
+	assert.Equal(t, common.ErrBookNotFound, w.DeleteBook("bookID"))
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
@@ -0,0 +1,384 @@
+package warehouse
+
+import (
+	"database/sql"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+)
+
+// clubColumns are selected by every club query and read by scanClub. Deleted users are not counted
+// as members
+const clubColumns = `id, name, description, visibility,
+		(SELECT COUNT(*) FROM club_role JOIN user_data ON user_data.id = club_role.user_id
+			WHERE club_role.club_id = club.id AND user_data.deleted_at IS NULL),
+		created_at, updated_at`
+
+// CreateClub adds the club with the user as its owner in one transaction, the id and times are set
+// on club
+func (w *Warehouse) CreateClub(club *common.Club, ownerID string) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	err = tx.QueryRow(`INSERT INTO club (name, description, visibility) VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at`, club.Name, club.Description, club.Visibility).
+		Scan(&club.ID, &club.CreatedAt, &club.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`INSERT INTO club_role (club_id, user_id, role) VALUES ($1, $2, $3)`,
+		club.ID, ownerID, common.ClubRoleOwner); err != nil {
+		return err
+	}
+	club.MemberCount = 1
+	return tx.Commit()
+}
+
+// GetClub returns ErrClubNotFound for an unknown club
+func (w *Warehouse) GetClub(id string) (*common.Club, error) {
+	club, err := scanClub(w.DB.QueryRow(`SELECT `+clubColumns+` FROM club WHERE id = $1`, id))
+	if err != nil {
+		return nil, clubError(err)
+	}
+	return club, nil
+}
+
+// UpdateClub replaces the name, description and visibility of the club, updated_at is set on club
+func (w *Warehouse) UpdateClub(club *common.Club) error {
+	err := w.DB.QueryRow(`UPDATE club SET name = $1, description = $2, visibility = $3, updated_at = NOW()
+		WHERE id = $4
+		RETURNING updated_at`, club.Name, club.Description, club.Visibility, club.ID).Scan(&club.UpdatedAt)
+	return clubError(err)
+}
+
+// JoinClub makes the user a member of a public club, or asks to join a private club. It returns true
+// when the user has to wait for the request to be approved
+func (w *Warehouse) JoinClub(clubID, userID string) (bool, error) {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	// Sharing the lock keeps the visibility from changing until the user has joined
+	var visibility string
+	if err = tx.QueryRow(`SELECT visibility FROM club WHERE id = $1 FOR SHARE`, clubID).Scan(&visibility); err != nil {
+		err = clubError(err)
+		return false, err
+	}
+	var member bool
+	if err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM club_role WHERE club_id = $1 AND user_id = $2)`,
+		clubID, userID).Scan(&member); err != nil {
+		return false, err
+	}
+	if member {
+		err = common.ErrClubAlreadyMember
+		return false, err
+	}
+	if visibility == common.ClubVisibilityPublic {
+		if _, err = tx.Exec(`INSERT INTO club_role (club_id, user_id, role) VALUES ($1, $2, $3)`,
+			clubID, userID, common.ClubRoleMember); err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+				err = common.ErrClubAlreadyMember
+			}
+			return false, err
+		}
+		return false, tx.Commit()
+	}
+	var res sql.Result
+	if res, err = tx.Exec(`INSERT INTO club_join_request (club_id, user_id) VALUES ($1, $2)
+		ON CONFLICT (club_id, user_id) DO NOTHING`, clubID, userID); err != nil {
+		return false, err
+	}
+	if err = expectRowsAffected(res, common.ErrClubJoinRequestExists); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// LeaveClub removes the user from the club, or withdraws their request to join it. The last owner
+// can not leave
+func (w *Warehouse) LeaveClub(clubID, userID string) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	if err = lockClub(tx, clubID); err != nil {
+		return err
+	}
+	var res sql.Result
+	if res, err = tx.Exec(`DELETE FROM club_join_request WHERE club_id = $1 AND user_id = $2`, clubID, userID); err != nil {
+		return err
+	}
+	var withdrawn int64
+	if withdrawn, err = res.RowsAffected(); err != nil {
+		return err
+	}
+	var role string
+	err = tx.QueryRow(`DELETE FROM club_role WHERE club_id = $1 AND user_id = $2 RETURNING role`, clubID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		if withdrawn == 0 {
+			err = common.ErrClubNotMember
+			return err
+		}
+		err = nil
+		return tx.Commit()
+	}
+	if err != nil {
+		return err
+	}
+	if role == common.ClubRoleOwner {
+		if err = checkClubHasOwner(tx, clubID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetClubMember returns ErrClubNotMember if the user has no role in the club
+func (w *Warehouse) GetClubMember(clubID, userID string) (*common.ClubMember, error) {
+	m := common.ClubMember{}
+	err := w.DB.QueryRow(`SELECT club_role.user_id, user_data.display_name, club_role.role, club_role.created_at
+		FROM club_role JOIN user_data ON user_data.id = club_role.user_id
+		WHERE club_role.club_id = $1 AND club_role.user_id = $2 AND user_data.deleted_at IS NULL`, clubID, userID).
+		Scan(&m.UserID, &m.DisplayName, &m.Role, &m.JoinedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, common.ErrClubNotMember
+		}
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "invalid_text_representation" {
+			return nil, common.ErrClubNotMember
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ListClubMembers returns a page of the members of the club, owners first then moderators, and how
+// many members there are in total
+func (w *Warehouse) ListClubMembers(clubID string, p common.Pagination) ([]common.ClubMember, int, error) {
+	var total int
+	if err := w.DB.QueryRow(`SELECT COUNT(*) FROM club_role JOIN user_data ON user_data.id = club_role.user_id
+		WHERE club_role.club_id = $1 AND user_data.deleted_at IS NULL`, clubID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := w.DB.Query(`SELECT club_role.user_id, user_data.display_name, club_role.role, club_role.created_at
+		FROM club_role JOIN user_data ON user_data.id = club_role.user_id
+		WHERE club_role.club_id = $1 AND user_data.deleted_at IS NULL
+		ORDER BY CASE club_role.role WHEN 'owner' THEN 0 WHEN 'moderator' THEN 1 ELSE 2 END, club_role.created_at, club_role.user_id
+		LIMIT $2 OFFSET $3`, clubID, p.Limit, p.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	members := []common.ClubMember{}
+	for rows.Next() {
+		m := common.ClubMember{}
+		if err = rows.Scan(&m.UserID, &m.DisplayName, &m.Role, &m.JoinedAt); err != nil {
+			return nil, 0, err
+		}
+		members = append(members, m)
+	}
+	return members, total, rows.Err()
+}
+
+// ChangeClubRole changes the role of a member of the club. The last owner can not be given another role
+func (w *Warehouse) ChangeClubRole(clubID, userID, role string) error {
+	if !common.ValidClubRole(role) {
+		return common.ErrRoleInvalid
+	}
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	if err = lockClub(tx, clubID); err != nil {
+		return err
+	}
+	var oldRole string
+	err = tx.QueryRow(`SELECT role FROM club_role WHERE club_id = $1 AND user_id = $2`, clubID, userID).Scan(&oldRole)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = common.ErrClubNotMember
+		}
+		return err
+	}
+	if _, err = tx.Exec(`UPDATE club_role SET role = $3, updated_at = NOW() WHERE club_id = $1 AND user_id = $2`,
+		clubID, userID, role); err != nil {
+		return err
+	}
+	if oldRole == common.ClubRoleOwner && role != common.ClubRoleOwner {
+		if err = checkClubHasOwner(tx, clubID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListClubJoinRequests returns a page of the requests to join the club, oldest first, and how many
+// there are in total
+func (w *Warehouse) ListClubJoinRequests(clubID string, p common.Pagination) ([]common.ClubJoinRequest, int, error) {
+	var total int
+	if err := w.DB.QueryRow(`SELECT COUNT(*) FROM club_join_request JOIN user_data ON user_data.id = club_join_request.user_id
+		WHERE club_join_request.club_id = $1 AND user_data.deleted_at IS NULL`, clubID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := w.DB.Query(`SELECT club_join_request.user_id, user_data.display_name, club_join_request.created_at
+		FROM club_join_request JOIN user_data ON user_data.id = club_join_request.user_id
+		WHERE club_join_request.club_id = $1 AND user_data.deleted_at IS NULL
+		ORDER BY club_join_request.created_at, club_join_request.user_id
+		LIMIT $2 OFFSET $3`, clubID, p.Limit, p.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	requests := []common.ClubJoinRequest{}
+	for rows.Next() {
+		jr := common.ClubJoinRequest{}
+		if err = rows.Scan(&jr.UserID, &jr.DisplayName, &jr.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		requests = append(requests, jr)
+	}
+	return requests, total, rows.Err()
+}
+
+// ApproveClubJoinRequest makes the user who asked to join a member of the club
+func (w *Warehouse) ApproveClubJoinRequest(clubID, userID string) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	var res sql.Result
+	if res, err = tx.Exec(`DELETE FROM club_join_request WHERE club_id = $1 AND user_id = $2`, clubID, userID); err != nil {
+		return joinRequestError(err)
+	}
+	if err = expectRowsAffected(res, common.ErrClubJoinRequestNotFound); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`INSERT INTO club_role (club_id, user_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (club_id, user_id) DO NOTHING`, clubID, userID, common.ClubRoleMember); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RejectClubJoinRequest turns down the request of the user to join the club
+func (w *Warehouse) RejectClubJoinRequest(clubID, userID string) error {
+	res, err := w.DB.Exec(`DELETE FROM club_join_request WHERE club_id = $1 AND user_id = $2`, clubID, userID)
+	if err != nil {
+		return joinRequestError(err)
+	}
+	return expectRowsAffected(res, common.ErrClubJoinRequestNotFound)
+}
+
+// lockClub stops the owners of the club changing until the transaction ends
+func lockClub(tx *sql.Tx, clubID string) error {
+	var id string
+	err := tx.QueryRow(`SELECT id FROM club WHERE id = $1 FOR UPDATE`, clubID).Scan(&id)
+	return clubError(err)
+}
+
+// handOverClubs makes another member the owner of each club the user is the only owner of, so the
+// user can be removed without leaving the club without an owner. The longest standing moderator is
+// chosen, or the longest standing member when there is no moderator. A club with nobody else in it
+// is left as it is
+func handOverClubs(tx *sql.Tx, userID string) error {
+	rows, err := tx.Query(`SELECT club_id FROM club_role WHERE user_id = $1 AND role = $2 ORDER BY club_id`,
+		userID, common.ClubRoleOwner)
+	if err != nil {
+		return err
+	}
+	clubIDs := []string{}
+	for rows.Next() {
+		var clubID string
+		if err = rows.Scan(&clubID); err != nil {
+			rows.Close()
+			return err
+		}
+		clubIDs = append(clubIDs, clubID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, clubID := range clubIDs {
+		if err = lockClub(tx, clubID); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`UPDATE club_role SET role = $3, updated_at = NOW()
+			WHERE club_id = $1 AND user_id = (
+				SELECT user_id FROM club_role WHERE club_id = $1 AND user_id <> $2
+				ORDER BY role = $4 DESC, created_at, user_id
+				LIMIT 1)
+			AND NOT EXISTS (SELECT 1 FROM club_role WHERE club_id = $1 AND user_id <> $2 AND role = $3)`,
+			clubID, userID, common.ClubRoleOwner, common.ClubRoleModerator); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkClubHasOwner returns ErrClubLastOwner if the club has been left without an owner
+func checkClubHasOwner(tx *sql.Tx, clubID string) error {
+	var owners int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM club_role WHERE club_id = $1 AND role = $2`,
+		clubID, common.ClubRoleOwner).Scan(&owners); err != nil {
+		return err
+	}
+	if owners == 0 {
+		return common.ErrClubLastOwner
+	}
+	return nil
+}
+
+func scanClub(row scanner) (*common.Club, error) {
+	c := common.Club{}
+	err := row.Scan(&c.ID, &c.Name, &c.Description, &c.Visibility, &c.MemberCount, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// clubError turns the errors for a missing club, or an id that is not a uuid, into ErrClubNotFound
+func clubError(err error) error {
+	if err == sql.ErrNoRows {
+		return common.ErrClubNotFound
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "invalid_text_representation" {
+		return common.ErrClubNotFound
+	}
+	return err
+}
+
+// joinRequestError turns the error for an id that is not a uuid into ErrClubJoinRequestNotFound
+func joinRequestError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "invalid_text_representation" {
+		return common.ErrClubJoinRequestNotFound
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+package warehouse
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+)
+
+// clubInviteColumns are selected by every invite query and read by scanClubInvite
+const clubInviteColumns = `id, club_id, COALESCE(email, ''), max_uses, uses, created_by, expires_at, created_at`
+
+// outstandingInvite is the condition for an invite that can still be used
+const outstandingInvite = `revoked_at IS NULL AND expires_at > NOW() AND uses < max_uses`
+
+// CreateClubInvite stores the invite with the hash of its code, the id and created_at are set on invite
+func (w *Warehouse) CreateClubInvite(invite *common.ClubInvite, codeHash string) error {
+	err := w.DB.QueryRow(`INSERT INTO club_invite (club_id, code_hash, email, max_uses, created_by, expires_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6)
+		RETURNING id, created_at`, invite.ClubID, codeHash, invite.Email, invite.MaxUses, invite.CreatedBy,
+		invite.ExpiresAt).Scan(&invite.ID, &invite.CreatedAt)
+	return clubError(err)
+}
+
+// ListClubInvites returns the invites of the club that can still be used, newest first
+func (w *Warehouse) ListClubInvites(clubID string) ([]common.ClubInvite, error) {
+	rows, err := w.DB.Query(`SELECT `+clubInviteColumns+`
+		FROM club_invite
+		WHERE club_id = $1 AND `+outstandingInvite+`
+		ORDER BY created_at DESC`, clubID)
+	if err != nil {
+		return nil, clubError(err)
+	}
+	defer rows.Close()
+	invites := []common.ClubInvite{}
+	for rows.Next() {
+		invite, err := scanClubInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, *invite)
+	}
+	return invites, rows.Err()
+}
+
+// RevokeClubInvite stops an outstanding invite of the club from being used
+func (w *Warehouse) RevokeClubInvite(clubID, id string) error {
+	res, err := w.DB.Exec(`UPDATE club_invite SET revoked_at = NOW()
+		WHERE id = $1 AND club_id = $2 AND `+outstandingInvite, id, clubID)
+	if err != nil {
+		return clubInviteError(err)
+	}
+	return expectRowsAffected(res, common.ErrClubInviteNotFound)
+}
+
+// GetClubInviteWithCode returns ErrClubInviteNotFound unless the invite can still be used
+func (w *Warehouse) GetClubInviteWithCode(codeHash string) (*common.ClubInvite, error) {
+	invite, err := scanClubInvite(w.DB.QueryRow(`SELECT `+clubInviteColumns+`
+		FROM club_invite
+		WHERE code_hash = $1 AND `+outstandingInvite, codeHash))
+	if err != nil {
+		return nil, clubInviteError(err)
+	}
+	return invite, nil
+}
+
+// AcceptClubInvite makes the user a member of the club of the invite and returns the club id
+func (w *Warehouse) AcceptClubInvite(codeHash, userID string) (string, error) {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	var email string
+	if err = tx.QueryRow(`SELECT email FROM user_data WHERE id = $1 AND deleted_at IS NULL`, userID).Scan(&email); err != nil {
+		if err == sql.ErrNoRows {
+			err = common.ErrUserNotFound
+		}
+		return "", err
+	}
+	var clubID string
+	if clubID, err = acceptClubInvite(tx, codeHash, userID, email); err != nil {
+		return "", err
+	}
+	return clubID, tx.Commit()
+}
+
+// CreateUserWithInvite registers the user and makes them a member of the club of the invite in one
+// transaction, so the account is not created if the invite can not be used
+func (w *Warehouse) CreateUserWithInvite(rr common.RegisterRequest, codeHash string) (*common.User, error) {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	user := common.User{
+		Email:       rr.Email,
+		DisplayName: rr.DisplayName,
+		Roles:       []string{common.RoleMember},
+		ClubRoles:   map[string]string{},
+	}
+	err = tx.QueryRow(`INSERT INTO user_data (display_name, password, email)
+		VALUES ($1, $2, $3)
+		RETURNING id`, rr.DisplayName, rr.Password, rr.Email).Scan(&user.ID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			err = common.ErrLoginUserAlreadyExists
+		}
+		return nil, err
+	}
+	var clubID string
+	if clubID, err = acceptClubInvite(tx, codeHash, user.ID, rr.Email); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	user.ClubRoles[clubID] = common.ClubRoleMember
+	return &user, nil
+}
+
+// acceptClubInvite uses the invite for the user with the email. The invite row is locked so two users
+// can not take its last use
+func acceptClubInvite(tx *sql.Tx, codeHash, userID, email string) (string, error) {
+	var id, clubID, inviteEmail string
+	err := tx.QueryRow(`SELECT id, club_id, COALESCE(email, '')
+		FROM club_invite
+		WHERE code_hash = $1 AND `+outstandingInvite+`
+		FOR UPDATE`, codeHash).Scan(&id, &clubID, &inviteEmail)
+	if err != nil {
+		return "", clubInviteError(err)
+	}
+	if inviteEmail != "" && !strings.EqualFold(inviteEmail, email) {
+		return "", common.ErrClubInviteEmailMismatch
+	}
+	res, err := tx.Exec(`INSERT INTO club_role (club_id, user_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (club_id, user_id) DO NOTHING`, clubID, userID, common.ClubRoleMember)
+	if err != nil {
+		return "", err
+	}
+	if err = expectRowsAffected(res, common.ErrClubAlreadyMember); err != nil {
+		return "", err
+	}
+	if _, err = tx.Exec(`UPDATE club_invite SET uses = uses + 1 WHERE id = $1`, id); err != nil {
+		return "", err
+	}
+	// A request to join is no longer needed once the user is a member
+	if _, err = tx.Exec(`DELETE FROM club_join_request WHERE club_id = $1 AND user_id = $2`, clubID, userID); err != nil {
+		return "", err
+	}
+	return clubID, nil
+}
+
+func scanClubInvite(row scanner) (*common.ClubInvite, error) {
+	ci := common.ClubInvite{}
+	err := row.Scan(&ci.ID, &ci.ClubID, &ci.Email, &ci.MaxUses, &ci.Uses, &ci.CreatedBy, &ci.ExpiresAt, &ci.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &ci, nil
+}
+
+// clubInviteError turns the errors for a missing invite, or an id that is not a uuid, into
+// ErrClubInviteNotFound
+func clubInviteError(err error) error {
+	if err == sql.ErrNoRows {
+		return common.ErrClubInviteNotFound
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "invalid_text_representation" {
+		return common.ErrClubInviteNotFound
+	}
+	return err
+}
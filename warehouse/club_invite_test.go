@@ -0,0 +1,179 @@
+package warehouse
+
+import (
+	"testing"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseAcceptClubInvite(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		found         bool
+		inviteEmail   string
+		member        bool
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Link invite",
+			found:       true,
+		},
+		testData{
+			description: "Invite sent to the email of the user",
+			found:       true,
+			inviteEmail: "reader@example.com",
+		},
+		testData{
+			description:   "Invite sent to another email",
+			expectedError: common.ErrClubInviteEmailMismatch,
+			found:         true,
+			inviteEmail:   "someone@example.com",
+		},
+		testData{
+			description:   "Already a member",
+			expectedError: common.ErrClubAlreadyMember,
+			found:         true,
+			member:        true,
+		},
+		testData{
+			description:   "Invite expired, used up or revoked",
+			expectedError: common.ErrClubInviteNotFound,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT email FROM user_data WHERE id = \\$1 AND deleted_at IS NULL").
+			WithArgs("userID").
+			WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("Reader@example.com"))
+		rows := sqlmock.NewRows([]string{"id", "club_id", "email"})
+		if td.found {
+			rows.AddRow("inviteID", "clubID", td.inviteEmail)
+		}
+		mock.ExpectQuery("SELECT id, club_id, COALESCE\\(email, ''\\)\\s+FROM club_invite\\s+WHERE code_hash = \\$1 AND " +
+			"revoked_at IS NULL AND expires_at > NOW\\(\\) AND uses < max_uses\\s+FOR UPDATE").
+			WithArgs("codeHash").
+			WillReturnRows(rows)
+		if td.found && td.expectedError != common.ErrClubInviteEmailMismatch {
+			var added int64 = 1
+			if td.member {
+				added = 0
+			}
+			mock.ExpectExec("INSERT INTO club_role \\(club_id, user_id, role\\) VALUES \\(\\$1, \\$2, \\$3\\)\\s+ON CONFLICT").
+				WithArgs("clubID", "userID", common.ClubRoleMember).
+				WillReturnResult(sqlmock.NewResult(0, added))
+		}
+		if td.expectedError == nil {
+			mock.ExpectExec("UPDATE club_invite SET uses = uses \\+ 1 WHERE id = \\$1").
+				WithArgs("inviteID").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("DELETE FROM club_join_request WHERE club_id = \\$1 AND user_id = \\$2").
+				WithArgs("clubID", "userID").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+		} else {
+			mock.ExpectRollback()
+		}
+		clubID, err := w.AcceptClubInvite("codeHash", "userID")
+		assert.Equal(t, td.expectedError, err, td.description)
+		if td.expectedError == nil {
+			assert.Equal(t, "clubID", clubID, td.description)
+		}
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseCreateUserWithInvite(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		found         bool
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Registers and joins the club",
+			found:       true,
+		},
+		testData{
+			description:   "Account is not created when the invite can not be used",
+			expectedError: common.ErrClubInviteNotFound,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	rr := common.RegisterRequest{DisplayName: "reader", Email: "reader@example.com", Password: "hash", InviteCode: "code"}
+	for _, td := range testTable {
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO user_data \\(display_name, password, email\\)").
+			WithArgs("reader", "hash", "reader@example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("userID"))
+		rows := sqlmock.NewRows([]string{"id", "club_id", "email"})
+		if td.found {
+			rows.AddRow("inviteID", "clubID", "reader@example.com")
+		}
+		mock.ExpectQuery("SELECT id, club_id, COALESCE\\(email, ''\\)\\s+FROM club_invite").
+			WithArgs("codeHash").
+			WillReturnRows(rows)
+		if td.found {
+			mock.ExpectExec("INSERT INTO club_role \\(club_id, user_id, role\\)").
+				WithArgs("clubID", "userID", common.ClubRoleMember).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE club_invite SET uses = uses \\+ 1 WHERE id = \\$1").
+				WithArgs("inviteID").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("DELETE FROM club_join_request WHERE club_id = \\$1 AND user_id = \\$2").
+				WithArgs("clubID", "userID").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+		} else {
+			mock.ExpectRollback()
+		}
+		user, err := w.CreateUserWithInvite(rr, "codeHash")
+		assert.Equal(t, td.expectedError, err, td.description)
+		if td.found {
+			assert.Equal(t, &common.User{ID: "userID", Email: "reader@example.com", DisplayName: "reader",
+				Roles: []string{common.RoleMember}, ClubRoles: map[string]string{"clubID": common.ClubRoleMember}}, user, td.description)
+		}
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseRevokeClubInvite(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, affected := range []int64{1, 0} {
+		mock.ExpectExec("UPDATE club_invite SET revoked_at = NOW\\(\\)\\s+WHERE id = \\$1 AND club_id = \\$2 AND revoked_at IS NULL").
+			WithArgs("inviteID", "clubID").
+			WillReturnResult(sqlmock.NewResult(0, affected))
+	}
+	assert.Nil(t, w.RevokeClubInvite("clubID", "inviteID"))
+	assert.Equal(t, common.ErrClubInviteNotFound, w.RevokeClubInvite("clubID", "inviteID"))
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
@@ -0,0 +1,378 @@
+package warehouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseCreateClub(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	createdAt := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO club \\(name, description, visibility\\) VALUES \\(\\$1, \\$2, \\$3\\)").
+		WithArgs("Readers", "", common.ClubVisibilityPrivate).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("clubID", createdAt, createdAt))
+	mock.ExpectExec("INSERT INTO club_role \\(club_id, user_id, role\\) VALUES \\(\\$1, \\$2, \\$3\\)").
+		WithArgs("clubID", "userID", common.ClubRoleOwner).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	club := &common.Club{Name: "Readers", Visibility: common.ClubVisibilityPrivate}
+	if assert.Nil(t, w.CreateClub(club, "userID")) {
+		assert.Equal(t, &common.Club{ID: "clubID", Name: "Readers", Visibility: common.ClubVisibilityPrivate, MemberCount: 1,
+			CreatedAt: createdAt, UpdatedAt: createdAt}, club)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseGetClub(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		found         bool
+		queryError    error
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Gets the club",
+			found:       true,
+		},
+		testData{
+			description:   "Unknown club",
+			expectedError: common.ErrClubNotFound,
+		},
+		testData{
+			description:   "Id is not a uuid",
+			expectedError: common.ErrClubNotFound,
+			queryError:    &pq.Error{Code: "22P02"},
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	createdAt := time.Now()
+	for _, td := range testTable {
+		expect := mock.ExpectQuery("SELECT id, name, description, visibility, .+ FROM club WHERE id = \\$1").WithArgs("clubID")
+		rows := sqlmock.NewRows([]string{"id", "name", "description", "visibility", "count", "created_at", "updated_at"})
+		if td.found {
+			rows.AddRow("clubID", "Readers", "", common.ClubVisibilityPublic, 3, createdAt, createdAt)
+		}
+		if td.queryError != nil {
+			expect.WillReturnError(td.queryError)
+		} else {
+			expect.WillReturnRows(rows)
+		}
+		club, err := w.GetClub("clubID")
+		assert.Equal(t, td.expectedError, err, td.description)
+		if td.found {
+			assert.Equal(t, &common.Club{ID: "clubID", Name: "Readers", Visibility: common.ClubVisibilityPublic, MemberCount: 3,
+				CreatedAt: createdAt, UpdatedAt: createdAt}, club, td.description)
+		}
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseJoinClub(t *testing.T) {
+	type testData struct {
+		description     string
+		expectedError   error
+		expectedPending bool
+		member          bool
+		requestAdded    bool
+		visibility      string
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Joins a public club",
+			visibility:  common.ClubVisibilityPublic,
+		},
+		testData{
+			description:     "Asks to join a private club",
+			expectedPending: true,
+			requestAdded:    true,
+			visibility:      common.ClubVisibilityPrivate,
+		},
+		testData{
+			description:   "Already asked to join a private club",
+			expectedError: common.ErrClubJoinRequestExists,
+			visibility:    common.ClubVisibilityPrivate,
+		},
+		testData{
+			description:   "Already a member",
+			expectedError: common.ErrClubAlreadyMember,
+			member:        true,
+			visibility:    common.ClubVisibilityPublic,
+		},
+		testData{
+			description:   "Unknown club",
+			expectedError: common.ErrClubNotFound,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		mock.ExpectBegin()
+		rows := sqlmock.NewRows([]string{"visibility"})
+		if td.visibility != "" {
+			rows.AddRow(td.visibility)
+		}
+		mock.ExpectQuery("SELECT visibility FROM club WHERE id = \\$1 FOR SHARE").WithArgs("clubID").WillReturnRows(rows)
+		if td.visibility == "" {
+			mock.ExpectRollback()
+		} else {
+			mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM club_role WHERE club_id = \\$1 AND user_id = \\$2\\)").
+				WithArgs("clubID", "userID").
+				WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(td.member))
+		}
+		switch {
+		case td.visibility == "":
+		case td.member:
+			mock.ExpectRollback()
+		case td.visibility == common.ClubVisibilityPublic:
+			mock.ExpectExec("INSERT INTO club_role \\(club_id, user_id, role\\) VALUES \\(\\$1, \\$2, \\$3\\)").
+				WithArgs("clubID", "userID", common.ClubRoleMember).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+		default:
+			var added int64
+			if td.requestAdded {
+				added = 1
+			}
+			mock.ExpectExec("INSERT INTO club_join_request \\(club_id, user_id\\) VALUES \\(\\$1, \\$2\\)\\s+ON CONFLICT").
+				WithArgs("clubID", "userID").
+				WillReturnResult(sqlmock.NewResult(0, added))
+			if td.requestAdded {
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+		}
+		pending, err := w.JoinClub("clubID", "userID")
+		assert.Equal(t, td.expectedError, err, td.description)
+		assert.Equal(t, td.expectedPending, pending, td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseLeaveClub(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		owners        int
+		role          string
+		withdrawn     int64
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Member leaves",
+			role:        common.ClubRoleMember,
+		},
+		testData{
+			description: "Withdraws a join request",
+			withdrawn:   1,
+		},
+		testData{
+			description: "Owner leaves another owner",
+			owners:      1,
+			role:        common.ClubRoleOwner,
+		},
+		testData{
+			description:   "Last owner can not leave",
+			expectedError: common.ErrClubLastOwner,
+			role:          common.ClubRoleOwner,
+		},
+		testData{
+			description:   "Not a member",
+			expectedError: common.ErrClubNotMember,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id FROM club WHERE id = \\$1 FOR UPDATE").
+			WithArgs("clubID").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("clubID"))
+		mock.ExpectExec("DELETE FROM club_join_request WHERE club_id = \\$1 AND user_id = \\$2").
+			WithArgs("clubID", "userID").
+			WillReturnResult(sqlmock.NewResult(0, td.withdrawn))
+		rows := sqlmock.NewRows([]string{"role"})
+		if td.role != "" {
+			rows.AddRow(td.role)
+		}
+		mock.ExpectQuery("DELETE FROM club_role WHERE club_id = \\$1 AND user_id = \\$2 RETURNING role").
+			WithArgs("clubID", "userID").
+			WillReturnRows(rows)
+		if td.role == common.ClubRoleOwner {
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM club_role WHERE club_id = \\$1 AND role = \\$2").
+				WithArgs("clubID", common.ClubRoleOwner).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(td.owners))
+		}
+		if td.expectedError == nil {
+			mock.ExpectCommit()
+		} else {
+			mock.ExpectRollback()
+		}
+		assert.Equal(t, td.expectedError, w.LeaveClub("clubID", "userID"), td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseChangeClubRole(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		oldRole       string
+		owners        int
+		role          string
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Member made a moderator",
+			oldRole:     common.ClubRoleMember,
+			role:        common.ClubRoleModerator,
+		},
+		testData{
+			description: "Owner made a member while another owner is left",
+			oldRole:     common.ClubRoleOwner,
+			owners:      1,
+			role:        common.ClubRoleMember,
+		},
+		testData{
+			description:   "Last owner made a member",
+			expectedError: common.ErrClubLastOwner,
+			oldRole:       common.ClubRoleOwner,
+			role:          common.ClubRoleMember,
+		},
+		testData{
+			description:   "Not a member",
+			expectedError: common.ErrClubNotMember,
+			role:          common.ClubRoleModerator,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id FROM club WHERE id = \\$1 FOR UPDATE").
+			WithArgs("clubID").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("clubID"))
+		rows := sqlmock.NewRows([]string{"role"})
+		if td.oldRole != "" {
+			rows.AddRow(td.oldRole)
+		}
+		mock.ExpectQuery("SELECT role FROM club_role WHERE club_id = \\$1 AND user_id = \\$2").
+			WithArgs("clubID", "userID").
+			WillReturnRows(rows)
+		if td.oldRole != "" {
+			mock.ExpectExec("UPDATE club_role SET role = \\$3, updated_at = NOW\\(\\) WHERE club_id = \\$1 AND user_id = \\$2").
+				WithArgs("clubID", "userID", td.role).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		if td.oldRole == common.ClubRoleOwner {
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM club_role WHERE club_id = \\$1 AND role = \\$2").
+				WithArgs("clubID", common.ClubRoleOwner).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(td.owners))
+		}
+		if td.expectedError == nil {
+			mock.ExpectCommit()
+		} else {
+			mock.ExpectRollback()
+		}
+		assert.Equal(t, td.expectedError, w.ChangeClubRole("clubID", "userID", td.role), td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+	assert.Equal(t, common.ErrRoleInvalid, w.ChangeClubRole("clubID", "userID", "admin"))
+}
+
+func TestWarehouseApproveClubJoinRequest(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		found         bool
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Approves the request",
+			found:       true,
+		},
+		testData{
+			description:   "No request to approve",
+			expectedError: common.ErrClubJoinRequestNotFound,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		var deleted int64
+		if td.found {
+			deleted = 1
+		}
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM club_join_request WHERE club_id = \\$1 AND user_id = \\$2").
+			WithArgs("clubID", "userID").
+			WillReturnResult(sqlmock.NewResult(0, deleted))
+		if td.found {
+			mock.ExpectExec("INSERT INTO club_role \\(club_id, user_id, role\\) VALUES \\(\\$1, \\$2, \\$3\\)\\s+ON CONFLICT").
+				WithArgs("clubID", "userID", common.ClubRoleMember).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+		} else {
+			mock.ExpectRollback()
+		}
+		assert.Equal(t, td.expectedError, w.ApproveClubJoinRequest("clubID", "userID"), td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
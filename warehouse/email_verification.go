@@ -0,0 +1,85 @@
+package warehouse
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+)
+
+// CreateEmailVerification ...
+func (w *Warehouse) CreateEmailVerification(userID, email, tokenHash string, expiresAt time.Time) error {
+	_, err := w.DB.Exec(`INSERT INTO email_verification (user_id, email, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)`, userID, email, tokenHash, expiresAt)
+	return err
+}
+
+// GetEmailVerification ...
+func (w *Warehouse) GetEmailVerification(tokenHash string) (*common.EmailVerification, error) {
+	ev := common.EmailVerification{}
+	sqlStatement := `SELECT id, user_id, email, expires_at, used_at
+		FROM email_verification
+		WHERE token_hash = $1`
+	err := w.DB.QueryRow(sqlStatement, tokenHash).Scan(&ev.ID, &ev.UserID, &ev.Email, &ev.ExpiresAt, &ev.UsedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, common.ErrEmailVerificationNotFound
+		}
+		return nil, err
+	}
+	return &ev, nil
+}
+
+// GetLastEmailVerificationAt returns when the last verification email was sent to the user, nil if none
+// has been sent
+func (w *Warehouse) GetLastEmailVerificationAt(userID string) (*time.Time, error) {
+	var createdAt *time.Time
+	err := w.DB.QueryRow(`SELECT MAX(created_at) FROM email_verification WHERE user_id = $1`, userID).Scan(&createdAt)
+	return createdAt, err
+}
+
+// VerifyEmail uses up the verification token and marks the email of the user as verified, as long
+// as the token is for the email or the pending email of the user. A verified pending email replaces
+// the email, ErrLoginUserAlreadyExists is returned if another user registered it in the meantime
+func (w *Warehouse) VerifyEmail(ev *common.EmailVerification) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	res, err := tx.Exec(`UPDATE email_verification SET used_at = NOW()
+		WHERE id = $1 AND used_at IS NULL`, ev.ID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		err = common.ErrEmailVerificationNotFound
+		return err
+	}
+	res, err = tx.Exec(`UPDATE user_data SET email = $2, email_verified_at = NOW(),
+		pending_email = CASE WHEN email = $2 THEN pending_email END, updated_at = NOW()
+		WHERE id = $1 AND (email = $2 OR pending_email = $2)`, ev.UserID, ev.Email)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			err = common.ErrLoginUserAlreadyExists
+		}
+		return err
+	}
+	if rows, err = res.RowsAffected(); err != nil {
+		return err
+	}
+	if rows == 0 {
+		err = common.ErrEmailVerificationNotFound
+		return err
+	}
+	return tx.Commit()
+}
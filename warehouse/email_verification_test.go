@@ -0,0 +1,113 @@
+package warehouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseVerifyEmail(t *testing.T) {
+	type testData struct {
+		description      string
+		expectedError    error
+		tokenRowsUpdated int64
+		userError        error
+		userRowsUpdated  int64
+	}
+
+	testTable := []testData{
+		testData{
+			description:      "Verifies the email",
+			tokenRowsUpdated: 1,
+			userRowsUpdated:  1,
+		},
+		testData{
+			description:      "Verification token was already used",
+			expectedError:    common.ErrEmailVerificationNotFound,
+			tokenRowsUpdated: 0,
+		},
+		testData{
+			description:      "Email was changed after the token was sent",
+			expectedError:    common.ErrEmailVerificationNotFound,
+			tokenRowsUpdated: 1,
+			userRowsUpdated:  0,
+		},
+		testData{
+			description:      "Pending email was registered by another user",
+			expectedError:    common.ErrLoginUserAlreadyExists,
+			tokenRowsUpdated: 1,
+			userError:        &pq.Error{Code: "23505"},
+		},
+	}
+	ev := &common.EmailVerification{
+		ID:     "verificationID",
+		UserID: "userID",
+		Email:  "email@example.com",
+	}
+	for _, td := range testTable {
+		w := Warehouse{}
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		w.DB = db
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE email_verification SET used_at = NOW\\(\\) WHERE id = \\$1 AND used_at IS NULL").
+			WithArgs(ev.ID).
+			WillReturnResult(sqlmock.NewResult(0, td.tokenRowsUpdated))
+		if td.tokenRowsUpdated > 0 {
+			expect := mock.ExpectExec("UPDATE user_data SET email = \\$2, email_verified_at = NOW\\(\\), .+ "+
+				"WHERE id = \\$1 AND \\(email = \\$2 OR pending_email = \\$2\\)").
+				WithArgs(ev.UserID, ev.Email)
+			if td.userError != nil {
+				expect.WillReturnError(td.userError)
+			} else {
+				expect.WillReturnResult(sqlmock.NewResult(0, td.userRowsUpdated))
+			}
+		}
+		if td.expectedError == nil {
+			mock.ExpectCommit()
+		} else {
+			mock.ExpectRollback()
+		}
+
+		err = w.VerifyEmail(ev)
+		assert.Equal(t, td.expectedError, err, td.description)
+		if err = mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectation error for %q: %s", td.description, err)
+		}
+		db.Close()
+	}
+}
+
+func TestWarehouseGetLastEmailVerificationAt(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	sentAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	mock.ExpectQuery("SELECT MAX\\(created_at\\) FROM email_verification WHERE user_id = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(sentAt))
+	mock.ExpectQuery("SELECT MAX\\(created_at\\) FROM email_verification WHERE user_id = \\$1").
+		WithArgs("newUserID").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+
+	lastSentAt, err := w.GetLastEmailVerificationAt("userID")
+	if assert.NoError(t, err) && assert.NotNil(t, lastSentAt) {
+		assert.Equal(t, sentAt, *lastSentAt)
+	}
+	lastSentAt, err = w.GetLastEmailVerificationAt("newUserID")
+	assert.NoError(t, err)
+	assert.Nil(t, lastSentAt, "No verification email sent")
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
@@ -0,0 +1,108 @@
+package warehouse
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+)
+
+// erasedDisplayName replaces the display name of an erased user, wherever their content is still shown
+const erasedDisplayName = "Erased user"
+
+// EraseUser removes the personal data of a user from every table in one transaction, this can not
+// be undone. Rows other members rely on are kept but no longer identify the user, the user row itself
+// is kept as an anonymous placeholder. The erasure is recorded in the audit log. Soft deleted users
+// can be erased, ErrUserNotFound is returned for unknown or already erased users
+func (w *Warehouse) EraseUser(userID, erasedBy string) (*common.UserErasure, error) {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	var email string
+	err = tx.QueryRow(`SELECT email FROM user_data WHERE id = $1 AND erased_at IS NULL FOR UPDATE`, userID).Scan(&email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = common.ErrUserNotFound
+		}
+		return nil, err
+	}
+	erasure := common.UserErasure{UserID: userID, ErasedBy: erasedBy}
+	// Reviews are removed first so their ratings come off the books they rated
+	if erasure.RowsRemoved, err = removeReviews(tx, userID); err != nil {
+		return nil, err
+	}
+	// The places the user held at meetings go to the waitlists
+	var rsvps int64
+	if rsvps, err = removeRSVPs(tx, userID); err != nil {
+		return nil, err
+	}
+	erasure.RowsRemoved += rsvps
+	// Clubs the user is the only owner of get a new owner before the user is removed from them
+	if err = handOverClubs(tx, userID); err != nil {
+		return nil, err
+	}
+	deletes := []struct {
+		sqlStatement string
+		arg          interface{}
+	}{
+		{`DELETE FROM refresh_token WHERE user_id = $1`, userID},
+		{`DELETE FROM password_reset WHERE user_id = $1`, userID},
+		{`DELETE FROM email_verification WHERE user_id = $1`, userID},
+		{`DELETE FROM club_role WHERE user_id = $1`, userID},
+		{`DELETE FROM club_join_request WHERE user_id = $1`, userID},
+		{`DELETE FROM reading_progress WHERE user_id = $1`, userID},
+		{`DELETE FROM review_vote WHERE user_id = $1`, userID},
+		{`DELETE FROM personal_access_token WHERE user_id = $1`, userID},
+		{`DELETE FROM user_identity WHERE user_id = $1`, userID},
+		// Invites are removed both when the user sent them and when they were sent to the user
+		{`DELETE FROM club_invite WHERE created_by = $1`, userID},
+		{`DELETE FROM club_invite WHERE email = $1`, strings.ToLower(email)},
+		// The failed logins are counted under the email and the wrong two factor codes under the id, as
+		// emailLockoutKey and mfaLockoutKey build the keys
+		{`DELETE FROM login_attempt WHERE key = $1`, "email:" + strings.ToLower(email)},
+		{`DELETE FROM login_attempt WHERE key = $1`, "mfa:" + userID},
+		// Replies to the posts of the user are kept, so the posts stay as deleted posts without a body
+		{`DELETE FROM thread_post_revision USING thread_post
+			WHERE thread_post_revision.post_id = thread_post.id AND thread_post.author_id = $1`, userID},
+		{`UPDATE thread_post SET body = '', deleted_at = COALESCE(deleted_at, NOW()) WHERE author_id = $1`, userID},
+		{`DELETE FROM nomination WHERE nominated_by = $1`, userID},
+		// Ballots are kept without the user so the results of closed polls do not change
+		{`UPDATE poll_ballot SET user_id = NULL WHERE user_id = $1`, userID},
+	}
+	for _, d := range deletes {
+		var res sql.Result
+		if res, err = tx.Exec(d.sqlStatement, d.arg); err != nil {
+			return nil, err
+		}
+		var removed int64
+		if removed, err = res.RowsAffected(); err != nil {
+			return nil, err
+		}
+		erasure.RowsRemoved += removed
+	}
+	// The email is replaced with one that can never be delivered or registered
+	_, err = tx.Exec(`UPDATE user_data SET email = id::text || '@erased.invalid', email_verified_at = NULL, pending_email = NULL, password = $4,
+		display_name = $2, bio = '', totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL,
+		totp_recovery_codes = NULL, roles = $3, time_zone = 'UTC', sessions_revoked_at = NOW(),
+		deleted_at = COALESCE(deleted_at, NOW()), erased_at = NOW(), updated_at = NOW()
+		WHERE id = $1`, userID, erasedDisplayName, pq.Array([]string{}), common.NoPassword)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.QueryRow(`INSERT INTO user_erasure (user_id, erased_by, rows_removed) VALUES ($1, $2, $3)
+		RETURNING id, created_at`, userID, erasedBy, erasure.RowsRemoved).Scan(&erasure.ID, &erasure.ErasedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &erasure, nil
+}
@@ -0,0 +1,142 @@
+package warehouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseEraseUser(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	erasedAt := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT email FROM user_data WHERE id = \\$1 AND erased_at IS NULL FOR UPDATE").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("Gary@example.com"))
+	mock.ExpectQuery("DELETE FROM review WHERE user_id = \\$1 RETURNING book_id, rating").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"book_id", "rating"}).AddRow("bookID", "4.5"))
+	mock.ExpectExec("UPDATE book SET rating_count = rating_count \\+ \\$3::integer").
+		WithArgs("bookID", 4.5, -1, 9).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The user held a place at meetingB, which goes to the member waiting for it
+	mock.ExpectQuery("DELETE FROM meeting_rsvp WHERE user_id = \\$1 RETURNING meeting_id").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"meeting_id"}).AddRow("meetingB").AddRow("meetingA"))
+	mock.ExpectQuery("SELECT COALESCE\\(capacity, 0\\) FROM meeting WHERE id = \\$1 FOR UPDATE").
+		WithArgs("meetingA").
+		WillReturnRows(sqlmock.NewRows([]string{"capacity"}).AddRow(0))
+	mock.ExpectQuery("SELECT user_id, guests FROM meeting_rsvp WHERE meeting_id = \\$1 AND waitlisted").
+		WithArgs("meetingA").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "guests"}))
+	mock.ExpectQuery("SELECT COALESCE\\(capacity, 0\\) FROM meeting WHERE id = \\$1 FOR UPDATE").
+		WithArgs("meetingB").
+		WillReturnRows(sqlmock.NewRows([]string{"capacity"}).AddRow(4))
+	mock.ExpectQuery("SELECT user_id, guests FROM meeting_rsvp WHERE meeting_id = \\$1 AND waitlisted").
+		WithArgs("meetingB").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "guests"}).AddRow("waitingUserID", 1))
+	mock.ExpectQuery("SELECT COALESCE\\(SUM\\(1 \\+ guests\\), 0\\) FROM meeting_rsvp").
+		WithArgs("meetingB", "").
+		WillReturnRows(sqlmock.NewRows([]string{"taken"}).AddRow(2))
+	mock.ExpectExec("UPDATE meeting_rsvp SET waitlisted = false").
+		WithArgs("meetingB", "waitingUserID").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The user owns two clubs, the other owner of clubB keeps it and nobody is promoted there
+	mock.ExpectQuery("SELECT club_id FROM club_role WHERE user_id = \\$1 AND role = \\$2 ORDER BY club_id").
+		WithArgs("userID", common.ClubRoleOwner).
+		WillReturnRows(sqlmock.NewRows([]string{"club_id"}).AddRow("clubA").AddRow("clubB"))
+	for _, clubID := range []string{"clubA", "clubB"} {
+		promoted := int64(1)
+		if clubID == "clubB" {
+			promoted = 0
+		}
+		mock.ExpectQuery("SELECT id FROM club WHERE id = \\$1 FOR UPDATE").
+			WithArgs(clubID).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(clubID))
+		mock.ExpectExec("UPDATE club_role SET role = \\$3, updated_at = NOW\\(\\)").
+			WithArgs(clubID, "userID", common.ClubRoleOwner, common.ClubRoleModerator).
+			WillReturnResult(sqlmock.NewResult(0, promoted))
+	}
+	for _, table := range []string{"refresh_token", "password_reset", "email_verification", "club_role",
+		"club_join_request", "reading_progress",
+		"review_vote", "personal_access_token", "user_identity"} {
+		mock.ExpectExec("DELETE FROM " + table + " WHERE user_id = \\$1").
+			WithArgs("userID").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+	}
+	mock.ExpectExec("DELETE FROM club_invite WHERE created_by = \\$1").
+		WithArgs("userID").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM club_invite WHERE email = \\$1").
+		WithArgs("gary@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM login_attempt WHERE key = \\$1").
+		WithArgs("email:gary@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM login_attempt WHERE key = \\$1").
+		WithArgs("mfa:userID").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM thread_post_revision USING thread_post").
+		WithArgs("userID").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE thread_post SET body = '', deleted_at = COALESCE\\(deleted_at, NOW\\(\\)\\) WHERE author_id = \\$1").
+		WithArgs("userID").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("DELETE FROM nomination WHERE nominated_by = \\$1").
+		WithArgs("userID").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE poll_ballot SET user_id = NULL WHERE user_id = \\$1").
+		WithArgs("userID").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE user_data SET email = id::text \\|\\| '@erased.invalid'").
+		WithArgs("userID", erasedDisplayName, sqlmock.AnyArg(), common.NoPassword).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO user_erasure \\(user_id, erased_by, rows_removed\\) VALUES \\(\\$1, \\$2, \\$3\\)").
+		WithArgs("userID", "adminID", int64(33)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("erasureID", erasedAt))
+	mock.ExpectCommit()
+
+	erasure, err := w.EraseUser("userID", "adminID")
+	if assert.Nil(t, err) {
+		assert.Equal(t, &common.UserErasure{
+			ID:          "erasureID",
+			UserID:      "userID",
+			ErasedBy:    "adminID",
+			RowsRemoved: 33,
+			ErasedAt:    erasedAt,
+		}, erasure)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseEraseUserNotFound(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT email FROM user_data WHERE id = \\$1 AND erased_at IS NULL FOR UPDATE").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}))
+	mock.ExpectRollback()
+
+	_, err = w.EraseUser("userID", "adminID")
+	assert.Equal(t, common.ErrUserNotFound, err)
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
@@ -0,0 +1,288 @@
+package warehouse
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+)
+
+// ExportUser collects the personal data stored about the user for the data export
+func (w *Warehouse) ExportUser(userID string) (*common.UserExport, error) {
+	user, err := w.GetUserWithID(userID)
+	if err != nil {
+		return nil, err
+	}
+	export := common.UserExport{
+		ExportedAt:           time.Now().UTC(),
+		Profile:              user.Profile(),
+		ClubMemberships:      []common.ExportClubMembership{},
+		ClubJoinRequests:     []common.ExportClubJoinRequest{},
+		ClubInvites:          []common.ExportClubInvite{},
+		MeetingRSVPs:         []common.ExportMeetingRSVP{},
+		ReadingProgress:      []common.ExportReadingProgress{},
+		Reviews:              []common.ExportReview{},
+		HelpfulVotes:         []common.ExportHelpfulVote{},
+		Threads:              []common.ExportThread{},
+		Posts:                []common.ExportPost{},
+		PostRevisions:        []common.ExportPostRevision{},
+		Nominations:          []common.ExportNomination{},
+		Polls:                []common.ExportPoll{},
+		Ballots:              []common.ExportBallot{},
+		Sessions:             []common.ExportSession{},
+		EmailVerifications:   []common.ExportEmailVerification{},
+		PasswordResets:       []common.ExportPasswordReset{},
+		PersonalAccessTokens: []common.ExportPersonalAccessToken{},
+		Identities:           []common.ExportIdentity{},
+	}
+	if err = w.DB.QueryRow(`SELECT created_at FROM user_data WHERE id = $1`, userID).Scan(&export.CreatedAt); err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT club_id, role, share_progress, created_at FROM club_role
+		WHERE user_id = $1 ORDER BY created_at`, userID,
+		func(rows *sql.Rows) error {
+			m := common.ExportClubMembership{}
+			if err := rows.Scan(&m.ClubID, &m.Role, &m.ShareProgress, &m.CreatedAt); err != nil {
+				return err
+			}
+			export.ClubMemberships = append(export.ClubMemberships, m)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT club_id, created_at FROM club_join_request WHERE user_id = $1 ORDER BY created_at`, userID,
+		func(rows *sql.Rows) error {
+			jr := common.ExportClubJoinRequest{}
+			if err := rows.Scan(&jr.ClubID, &jr.CreatedAt); err != nil {
+				return err
+			}
+			export.ClubJoinRequests = append(export.ClubJoinRequests, jr)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT club_id, COALESCE(email, ''), max_uses, uses, expires_at, revoked_at, created_at
+		FROM club_invite WHERE created_by = $1 ORDER BY created_at`, userID,
+		func(rows *sql.Rows) error {
+			ci := common.ExportClubInvite{}
+			if err := rows.Scan(&ci.ClubID, &ci.Email, &ci.MaxUses, &ci.Uses, &ci.ExpiresAt, &ci.RevokedAt, &ci.CreatedAt); err != nil {
+				return err
+			}
+			export.ClubInvites = append(export.ClubInvites, ci)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT meeting_id, response, guests, waitlisted, created_at, updated_at
+		FROM meeting_rsvp WHERE user_id = $1 ORDER BY created_at`, userID,
+		func(rows *sql.Rows) error {
+			mr := common.ExportMeetingRSVP{}
+			if err := rows.Scan(&mr.MeetingID, &mr.Response, &mr.Guests, &mr.Waitlisted, &mr.CreatedAt, &mr.UpdatedAt); err != nil {
+				return err
+			}
+			export.MeetingRSVPs = append(export.MeetingRSVPs, mr)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT book_id, page, percent, chapter, recorded_at FROM reading_progress
+		WHERE user_id = $1 ORDER BY recorded_at`, userID,
+		func(rows *sql.Rows) error {
+			rp := common.ExportReadingProgress{}
+			if err := rows.Scan(&rp.BookID, &rp.Page, &rp.Percent, &rp.Chapter, &rp.RecordedAt); err != nil {
+				return err
+			}
+			export.ReadingProgress = append(export.ReadingProgress, rp)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT book_id, rating, body, spoiler, created_at, updated_at FROM review
+		WHERE user_id = $1 ORDER BY created_at`, userID,
+		func(rows *sql.Rows) error {
+			r := common.ExportReview{}
+			if err := rows.Scan(&r.BookID, &r.Rating, &r.Body, &r.Spoiler, &r.CreatedAt, &r.UpdatedAt); err != nil {
+				return err
+			}
+			export.Reviews = append(export.Reviews, r)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT review_id, created_at FROM review_vote WHERE user_id = $1 ORDER BY created_at`, userID,
+		func(rows *sql.Rows) error {
+			v := common.ExportHelpfulVote{}
+			if err := rows.Scan(&v.ReviewID, &v.CreatedAt); err != nil {
+				return err
+			}
+			export.HelpfulVotes = append(export.HelpfulVotes, v)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT club_id, title, created_at FROM thread WHERE created_by = $1 ORDER BY created_at`, userID,
+		func(rows *sql.Rows) error {
+			t := common.ExportThread{}
+			if err := rows.Scan(&t.ClubID, &t.Title, &t.CreatedAt); err != nil {
+				return err
+			}
+			export.Threads = append(export.Threads, t)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT id, thread_id, COALESCE(parent_id::text, ''), body, created_at, edited_at, deleted_at
+		FROM thread_post WHERE author_id = $1 ORDER BY created_at`, userID,
+		func(rows *sql.Rows) error {
+			p := common.ExportPost{}
+			if err := rows.Scan(&p.ID, &p.ThreadID, &p.ParentID, &p.Body, &p.CreatedAt, &p.EditedAt, &p.DeletedAt); err != nil {
+				return err
+			}
+			export.Posts = append(export.Posts, p)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT thread_post_revision.post_id, thread_post_revision.body, thread_post_revision.created_at,
+			thread_post_revision.replaced_at
+		FROM thread_post_revision JOIN thread_post ON thread_post.id = thread_post_revision.post_id
+		WHERE thread_post.author_id = $1 ORDER BY thread_post_revision.replaced_at`, userID,
+		func(rows *sql.Rows) error {
+			r := common.ExportPostRevision{}
+			if err := rows.Scan(&r.PostID, &r.Body, &r.CreatedAt, &r.ReplacedAt); err != nil {
+				return err
+			}
+			export.PostRevisions = append(export.PostRevisions, r)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT club_id, book_id, note, created_at FROM nomination
+		WHERE nominated_by = $1 ORDER BY created_at`, userID,
+		func(rows *sql.Rows) error {
+			n := common.ExportNomination{}
+			if err := rows.Scan(&n.ClubID, &n.BookID, &n.Note, &n.CreatedAt); err != nil {
+				return err
+			}
+			export.Nominations = append(export.Nominations, n)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT club_id, title, created_at FROM poll WHERE created_by = $1 ORDER BY created_at`, userID,
+		func(rows *sql.Rows) error {
+			p := common.ExportPoll{}
+			if err := rows.Scan(&p.ClubID, &p.Title, &p.CreatedAt); err != nil {
+				return err
+			}
+			export.Polls = append(export.Polls, p)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT poll_id, choices, created_at, updated_at FROM poll_ballot
+		WHERE user_id = $1 ORDER BY created_at`, userID,
+		func(rows *sql.Rows) error {
+			b := common.ExportBallot{}
+			if err := rows.Scan(&b.PollID, pq.Array(&b.Choices), &b.CreatedAt, &b.UpdatedAt); err != nil {
+				return err
+			}
+			export.Ballots = append(export.Ballots, b)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT created_at, expires_at, used_at, revoked_at FROM refresh_token
+		WHERE user_id = $1 ORDER BY created_at`, userID,
+		func(rows *sql.Rows) error {
+			s := common.ExportSession{}
+			if err := rows.Scan(&s.CreatedAt, &s.ExpiresAt, &s.UsedAt, &s.RevokedAt); err != nil {
+				return err
+			}
+			export.Sessions = append(export.Sessions, s)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT email, created_at, used_at FROM email_verification WHERE user_id = $1 ORDER BY created_at`, userID,
+		func(rows *sql.Rows) error {
+			ev := common.ExportEmailVerification{}
+			if err := rows.Scan(&ev.Email, &ev.CreatedAt, &ev.UsedAt); err != nil {
+				return err
+			}
+			export.EmailVerifications = append(export.EmailVerifications, ev)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT created_at, used_at FROM password_reset WHERE user_id = $1 ORDER BY created_at`, userID,
+		func(rows *sql.Rows) error {
+			pr := common.ExportPasswordReset{}
+			if err := rows.Scan(&pr.CreatedAt, &pr.UsedAt); err != nil {
+				return err
+			}
+			export.PasswordResets = append(export.PasswordResets, pr)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT name, scopes, created_at, expires_at, last_used_at, revoked_at FROM personal_access_token
+		WHERE user_id = $1 ORDER BY created_at`, userID,
+		func(rows *sql.Rows) error {
+			pat := common.ExportPersonalAccessToken{}
+			err := rows.Scan(&pat.Name, pq.Array(&pat.Scopes), &pat.CreatedAt, &pat.ExpiresAt, &pat.LastUsedAt, &pat.RevokedAt)
+			if err != nil {
+				return err
+			}
+			export.PersonalAccessTokens = append(export.PersonalAccessTokens, pat)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	err = w.queryExportRows(`SELECT provider, subject, email, created_at FROM user_identity WHERE user_id = $1 ORDER BY created_at`,
+		userID, func(rows *sql.Rows) error {
+			identity := common.ExportIdentity{}
+			if err := rows.Scan(&identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt); err != nil {
+				return err
+			}
+			export.Identities = append(export.Identities, identity)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// queryExportRows calls scan for each row the query returns for the user
+func (w *Warehouse) queryExportRows(sqlStatement, userID string, scan func(*sql.Rows) error) error {
+	rows, err := w.DB.Query(sqlStatement, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,137 @@
+package warehouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseExportUser(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	mock.ExpectQuery("SELECT id, email, .+ FROM user_data WHERE id = \\$1 AND deleted_at IS NULL").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "email_verified_at", "password", "display_name", "bio", "totp_secret",
+			"totp_enabled_at", "roles", "club_roles", "time_zone", "pending_email"}).
+			AddRow("userID", "email@example.com", createdAt, "hash", "gcarr", "Reads a lot", "secret", nil, "{member}",
+				`{"clubID": "owner"}`, "Europe/London", ""))
+	mock.ExpectQuery("SELECT created_at FROM user_data WHERE id = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(createdAt))
+	mock.ExpectQuery("SELECT club_id, role, share_progress, created_at FROM club_role WHERE user_id = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"club_id", "role", "share_progress", "created_at"}).
+			AddRow("clubID", "owner", true, createdAt))
+	mock.ExpectQuery("SELECT club_id, created_at FROM club_join_request WHERE user_id = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"club_id", "created_at"}).AddRow("privateClubID", createdAt))
+	mock.ExpectQuery("SELECT club_id, COALESCE\\(email, ''\\), max_uses, uses, expires_at, revoked_at, created_at\\s+FROM club_invite WHERE created_by = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"club_id", "email", "max_uses", "uses", "expires_at", "revoked_at", "created_at"}).
+			AddRow("clubID", "", 10, 2, createdAt, nil, createdAt))
+	mock.ExpectQuery("SELECT meeting_id, response, guests, waitlisted, created_at, updated_at\\s+FROM meeting_rsvp WHERE user_id = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"meeting_id", "response", "guests", "waitlisted", "created_at", "updated_at"}).
+			AddRow("meetingID", "yes", 1, true, createdAt, createdAt))
+	mock.ExpectQuery("SELECT book_id, page, percent, chapter, recorded_at FROM reading_progress\\s+WHERE user_id = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"book_id", "page", "percent", "chapter", "recorded_at"}).
+			AddRow("bookID", 120, nil, nil, createdAt))
+	mock.ExpectQuery("SELECT book_id, rating, body, spoiler, created_at, updated_at FROM review\\s+WHERE user_id = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"book_id", "rating", "body", "spoiler", "created_at", "updated_at"}).
+			AddRow("bookID", "4.5", "Loved it", false, createdAt, createdAt))
+	mock.ExpectQuery("SELECT review_id, created_at FROM review_vote WHERE user_id = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"review_id", "created_at"}).AddRow("reviewID", createdAt))
+	mock.ExpectQuery("SELECT club_id, title, created_at FROM thread WHERE created_by = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"club_id", "title", "created_at"}).AddRow("clubID", "Chapter one", createdAt))
+	mock.ExpectQuery("SELECT id, thread_id, COALESCE\\(parent_id::text, ''\\), body, created_at, edited_at, deleted_at\\s+FROM thread_post").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "thread_id", "parent_id", "body", "created_at", "edited_at", "deleted_at"}).
+			AddRow("postID", "threadID", "", "What a start", createdAt, createdAt, nil))
+	mock.ExpectQuery("SELECT thread_post_revision.post_id, .+ FROM thread_post_revision").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"post_id", "body", "created_at", "replaced_at"}).
+			AddRow("postID", "What a strat", createdAt, createdAt))
+	mock.ExpectQuery("SELECT club_id, book_id, note, created_at FROM nomination\\s+WHERE nominated_by = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"club_id", "book_id", "note", "created_at"}).
+			AddRow("clubID", "bookID", "Short and sharp", createdAt))
+	mock.ExpectQuery("SELECT club_id, title, created_at FROM poll WHERE created_by = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"club_id", "title", "created_at"}).AddRow("clubID", "Next book", createdAt))
+	mock.ExpectQuery("SELECT poll_id, choices, created_at, updated_at FROM poll_ballot\\s+WHERE user_id = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"poll_id", "choices", "created_at", "updated_at"}).
+			AddRow("pollID", "{bookID,otherBookID}", createdAt, createdAt))
+	mock.ExpectQuery("SELECT created_at, expires_at, used_at, revoked_at FROM refresh_token WHERE user_id = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "expires_at", "used_at", "revoked_at"}).
+			AddRow(createdAt, createdAt, nil, nil))
+	mock.ExpectQuery("SELECT email, created_at, used_at FROM email_verification WHERE user_id = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"email", "created_at", "used_at"}).AddRow("email@example.com", createdAt, createdAt))
+	mock.ExpectQuery("SELECT created_at, used_at FROM password_reset WHERE user_id = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "used_at"}))
+	mock.ExpectQuery("SELECT name, scopes, created_at, expires_at, last_used_at, revoked_at FROM personal_access_token WHERE user_id = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "scopes", "created_at", "expires_at", "last_used_at", "revoked_at"}).
+			AddRow("deploy script", "{club:read}", createdAt, nil, createdAt, nil))
+	mock.ExpectQuery("SELECT provider, subject, email, created_at FROM user_identity WHERE user_id = \\$1").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows([]string{"provider", "subject", "email", "created_at"}).
+			AddRow("example", "subject", "email@example.com", createdAt))
+
+	export, err := w.ExportUser("userID")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "gcarr", export.Profile.DisplayName)
+	assert.Equal(t, "Europe/London", export.Profile.TimeZone)
+	assert.Equal(t, createdAt, export.CreatedAt)
+	assert.Equal(t, []common.ExportClubMembership{{ClubID: "clubID", Role: "owner", ShareProgress: true, CreatedAt: createdAt}},
+		export.ClubMemberships)
+	assert.Equal(t, []common.ExportClubJoinRequest{{ClubID: "privateClubID", CreatedAt: createdAt}}, export.ClubJoinRequests)
+	assert.Equal(t, []common.ExportClubInvite{{ClubID: "clubID", MaxUses: 10, Uses: 2, ExpiresAt: createdAt, CreatedAt: createdAt}},
+		export.ClubInvites)
+	assert.Equal(t, []common.ExportMeetingRSVP{{MeetingID: "meetingID", Response: "yes", Guests: 1, Waitlisted: true,
+		CreatedAt: createdAt, UpdatedAt: createdAt}}, export.MeetingRSVPs)
+	page := 120
+	assert.Equal(t, []common.ExportReadingProgress{{BookID: "bookID", Page: &page, RecordedAt: createdAt}}, export.ReadingProgress)
+	assert.Equal(t, []common.ExportReview{{BookID: "bookID", Rating: 4.5, Body: "Loved it", CreatedAt: createdAt,
+		UpdatedAt: createdAt}}, export.Reviews)
+	assert.Equal(t, []common.ExportHelpfulVote{{ReviewID: "reviewID", CreatedAt: createdAt}}, export.HelpfulVotes)
+	assert.Equal(t, []common.ExportThread{{ClubID: "clubID", Title: "Chapter one", CreatedAt: createdAt}}, export.Threads)
+	assert.Equal(t, []common.ExportPost{{ID: "postID", ThreadID: "threadID", Body: "What a start", CreatedAt: createdAt,
+		EditedAt: &createdAt}}, export.Posts)
+	assert.Equal(t, []common.ExportPostRevision{{PostID: "postID", Body: "What a strat", CreatedAt: createdAt,
+		ReplacedAt: createdAt}}, export.PostRevisions)
+	assert.Equal(t, []common.ExportNomination{{ClubID: "clubID", BookID: "bookID", Note: "Short and sharp",
+		CreatedAt: createdAt}}, export.Nominations)
+	assert.Equal(t, []common.ExportPoll{{ClubID: "clubID", Title: "Next book", CreatedAt: createdAt}}, export.Polls)
+	assert.Equal(t, []common.ExportBallot{{PollID: "pollID", Choices: []string{"bookID", "otherBookID"},
+		CreatedAt: createdAt, UpdatedAt: createdAt}}, export.Ballots)
+	assert.Equal(t, []common.ExportSession{{CreatedAt: createdAt, ExpiresAt: createdAt}}, export.Sessions)
+	assert.Equal(t, []common.ExportEmailVerification{{Email: "email@example.com", CreatedAt: createdAt, UsedAt: &createdAt}},
+		export.EmailVerifications)
+	assert.Equal(t, []common.ExportPasswordReset{}, export.PasswordResets)
+	assert.Equal(t, []common.ExportPersonalAccessToken{{Name: "deploy script", Scopes: []string{common.PermissionClubRead},
+		CreatedAt: createdAt, LastUsedAt: &createdAt}}, export.PersonalAccessTokens)
+	assert.Equal(t, []common.ExportIdentity{{Provider: "example", Subject: "subject", Email: "email@example.com",
+		CreatedAt: createdAt}}, export.Identities)
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
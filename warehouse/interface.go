@@ -1,10 +1,145 @@
 package warehouse
 
-import "github.com/garycarr/book_club/common"
+import (
+	"time"
+
+	"github.com/garycarr/book_club/common"
+)
 
 // WarehouseIn ...
 type WarehouseIn interface {
 	Close()
 	CreateUser(common.RegisterRequest) (*common.User, error)
 	GetUserWithEmail(string) (*common.User, error)
+	GetUserWithID(string) (*common.User, error)
+	UpdatePassword(string, string) error
+	UpdateUser(*common.User, bool) error
+	ChangePassword(string, string) error
+	DeleteUser(string) error
+	ExportUser(string) (*common.UserExport, error)
+	EraseUser(string, string) (*common.UserErasure, error)
+
+	CreateRefreshToken(string, string, time.Time) (*common.RefreshToken, error)
+	GetRefreshToken(string) (*common.RefreshToken, error)
+	RotateRefreshToken(*common.RefreshToken, string, time.Time) (*common.RefreshToken, error)
+	RevokeRefreshTokenFamily(string) error
+
+	RevokeJSONToken(string, time.Time) error
+	IsJSONTokenRevoked(*common.TokenClaims) (bool, error)
+	DeleteExpiredRevokedTokens() (int64, error)
+
+	CreatePasswordReset(string, string, time.Time) error
+	GetPasswordReset(string) (*common.PasswordReset, error)
+	ResetPassword(*common.PasswordReset, string) error
+
+	CreateEmailVerification(string, string, string, time.Time) error
+	GetEmailVerification(string) (*common.EmailVerification, error)
+	GetLastEmailVerificationAt(string) (*time.Time, error)
+	VerifyEmail(*common.EmailVerification) error
+
+	SetTOTPSecret(string, string) error
+	EnableTOTP(string, []string) error
+	DisableTOTP(string) error
+	UseTOTPStep(string, int64) error
+	UseRecoveryCode(string, string) error
+
+	SetUserRoles(string, []string) error
+	SetClubRole(string, string, string) error
+	DeleteClubRole(string, string) error
+
+	CreatePersonalAccessToken(*common.PersonalAccessToken, string) error
+	ListPersonalAccessTokens(string) ([]common.PersonalAccessToken, error)
+	RevokePersonalAccessToken(string, string) error
+	UsePersonalAccessToken(string) (*common.PersonalAccessToken, error)
+
+	CreateOIDCLogin(string, common.OIDCLogin) error
+	UseOIDCLogin(string) (*common.OIDCLogin, error)
+	GetUserWithIdentity(string, string) (*common.User, error)
+	LinkUserIdentity(string, common.UserIdentity) error
+	CreateUserWithIdentity(string, bool, common.UserIdentity) (*common.User, error)
+
+	RecordLoginFailure(string, time.Time) (int, error)
+	LockLogin(string, time.Time) error
+	GetLoginLockedUntil(string) (*time.Time, error)
+	ResetLoginFailures(string) error
+
+	CreateBook(*common.Book) error
+	GetBook(string) (*common.Book, error)
+	ListBooks(common.BookFilter) ([]common.Book, int, error)
+	UpdateBook(*common.Book) error
+	DeleteBook(string) error
+	GetBookMetadata(string) (*common.BookMetadata, error)
+	SaveBookMetadata(common.BookMetadata) error
+
+	CreateClub(*common.Club, string) error
+	GetClub(string) (*common.Club, error)
+	UpdateClub(*common.Club) error
+	JoinClub(string, string) (bool, error)
+	LeaveClub(string, string) error
+	GetClubMember(string, string) (*common.ClubMember, error)
+	ListClubMembers(string, common.Pagination) ([]common.ClubMember, int, error)
+	ChangeClubRole(string, string, string) error
+	ListClubJoinRequests(string, common.Pagination) ([]common.ClubJoinRequest, int, error)
+	ApproveClubJoinRequest(string, string) error
+	RejectClubJoinRequest(string, string) error
+	CreateClubInvite(*common.ClubInvite, string) error
+	ListClubInvites(string) ([]common.ClubInvite, error)
+	RevokeClubInvite(string, string) error
+	GetClubInviteWithCode(string) (*common.ClubInvite, error)
+	AcceptClubInvite(string, string) (string, error)
+	CreateUserWithInvite(common.RegisterRequest, string) (*common.User, error)
+
+	CreateMeeting(*common.Meeting) error
+	GetMeeting(string, string) (*common.Meeting, error)
+	ListMeetings(string, bool, common.Pagination) ([]common.Meeting, int, error)
+	UpdateMeeting(*common.Meeting) error
+	DeleteMeeting(string, string) error
+	SetRSVP(string, string, string, int) (*common.MeetingRSVP, error)
+	DeleteRSVP(string, string) error
+	ListRSVPs(string) ([]common.MeetingRSVP, error)
+
+	CreateReadingPlan(*common.ReadingPlan) error
+	GetReadingPlan(string, string) (*common.ReadingPlan, error)
+	ListReadingPlans(string) ([]common.ReadingPlan, error)
+	UpdateReadingPlan(*common.ReadingPlan) error
+	DeleteReadingPlan(string, string) error
+
+	RecordProgress(string, *common.ReadingProgress) error
+	ListProgress(string, string) ([]common.ReadingProgress, error)
+	SetProgressSharing(string, string, bool) error
+	ClubProgress(string, string, string) ([]common.MemberProgress, int, error)
+
+	CreateReview(*common.Review) error
+	GetReview(string, string) (*common.Review, error)
+	ListReviews(string, string, common.Pagination) ([]common.Review, int, error)
+	UpdateReview(*common.Review) error
+	DeleteReview(string, string) error
+	AddHelpfulVote(string, string, string) error
+	RemoveHelpfulVote(string, string, string) error
+
+	CreateThread(*common.Thread, *common.Post) error
+	GetThread(string, string) (*common.Thread, error)
+	ListThreads(common.ThreadFilter) ([]common.Thread, *common.Cursor, error)
+	UpdateThread(*common.Thread) error
+	DeleteThread(string, string) error
+	CreatePost(*common.Post) error
+	GetPost(string, string) (*common.Post, error)
+	ListPosts(string, common.CursorPagination) ([]common.Post, *common.Cursor, error)
+	UpdatePost(*common.Post) error
+	DeletePost(string, string, string) error
+	ListPostRevisions(string) ([]common.PostRevision, error)
+
+	CreateNomination(*common.Nomination) error
+	GetNomination(string, string) (*common.Nomination, error)
+	ListNominations(string, common.Pagination) ([]common.Nomination, int, error)
+	DeleteNomination(string, string) error
+	CreatePoll(*common.Poll, []string) error
+	GetPoll(string, string) (*common.Poll, error)
+	ListPolls(string, common.Pagination) ([]common.Poll, int, error)
+	ClosePoll(*common.Poll) error
+	DeletePoll(string, string) error
+	SetBallot(*common.Ballot) error
+	GetBallot(string, string) (*common.Ballot, error)
+	DeleteBallot(string, string) error
+	ListBallots(string) ([]common.Ballot, error)
 }
@@ -0,0 +1,41 @@
+package warehouse
+
+import (
+	"database/sql"
+	"time"
+)
+
+// RecordLoginFailure counts a failed login for the key and returns the number of failures. Failures
+// are forgotten when the last failure and lockout were both before forgetBefore
+func (w *Warehouse) RecordLoginFailure(key string, forgetBefore time.Time) (int, error) {
+	var failures int
+	err := w.DB.QueryRow(`INSERT INTO login_attempt (key, failures, last_failure_at) VALUES ($1, 1, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN GREATEST(login_attempt.last_failure_at, login_attempt.locked_until) < $2
+				THEN 1 ELSE login_attempt.failures + 1 END,
+			last_failure_at = NOW()
+		RETURNING failures`, key, forgetBefore).Scan(&failures)
+	return failures, err
+}
+
+// LockLogin stops the key from logging in until the given time
+func (w *Warehouse) LockLogin(key string, until time.Time) error {
+	_, err := w.DB.Exec(`UPDATE login_attempt SET locked_until = $1 WHERE key = $2`, until, key)
+	return err
+}
+
+// GetLoginLockedUntil returns when the lockout of the key ends, nil if it has never been locked out
+func (w *Warehouse) GetLoginLockedUntil(key string) (*time.Time, error) {
+	var lockedUntil *time.Time
+	err := w.DB.QueryRow(`SELECT locked_until FROM login_attempt WHERE key = $1`, key).Scan(&lockedUntil)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return lockedUntil, err
+}
+
+// ResetLoginFailures forgets the failed logins of the key
+func (w *Warehouse) ResetLoginFailures(key string) error {
+	_, err := w.DB.Exec(`DELETE FROM login_attempt WHERE key = $1`, key)
+	return err
+}
@@ -0,0 +1,78 @@
+package warehouse
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseRecordLoginFailure(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	forgetBefore := time.Now().Add(-time.Hour)
+	mock.ExpectQuery("INSERT INTO login_attempt \\(key, failures, last_failure_at\\) VALUES \\(\\$1, 1, NOW\\(\\)\\) ON CONFLICT \\(key\\) DO UPDATE").
+		WithArgs("email:email@example.com", forgetBefore).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(3))
+	failures, err := w.RecordLoginFailure("email:email@example.com", forgetBefore)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, failures)
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseGetLoginLockedUntil(t *testing.T) {
+	type testData struct {
+		description string
+		lockedUntil *time.Time
+		noRows      bool
+	}
+
+	lockedUntil := time.Now().Add(time.Minute)
+	testTable := []testData{
+		testData{
+			description: "Locked out",
+			lockedUntil: &lockedUntil,
+		},
+		testData{
+			description: "Failed but not locked out",
+		},
+		testData{
+			description: "Never failed",
+			noRows:      true,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		query := mock.ExpectQuery("SELECT locked_until FROM login_attempt WHERE key = \\$1").WithArgs("ip:127.0.0.1")
+		if td.noRows {
+			query.WillReturnError(sql.ErrNoRows)
+		} else if td.lockedUntil != nil {
+			query.WillReturnRows(sqlmock.NewRows([]string{"locked_until"}).AddRow(*td.lockedUntil))
+		} else {
+			query.WillReturnRows(sqlmock.NewRows([]string{"locked_until"}).AddRow(nil))
+		}
+		got, err := w.GetLoginLockedUntil("ip:127.0.0.1")
+		if !assert.Nil(t, err, td.description) {
+			continue
+		}
+		assert.Equal(t, td.lockedUntil, got, td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
@@ -0,0 +1,373 @@
+package warehouse
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+)
+
+// meetingColumns are selected by every meeting query and read by scanMeeting. Guests count towards
+// the places taken
+const meetingColumns = `id, club_id, COALESCE(book_id::text, ''), title, description, starts_at, ends_at, time_zone,
+		location, video_url, COALESCE(capacity, 0),
+		(SELECT COALESCE(SUM(1 + guests), 0) FROM meeting_rsvp
+			WHERE meeting_rsvp.meeting_id = meeting.id AND response = 'yes' AND NOT waitlisted),
+		(SELECT COUNT(*) FROM meeting_rsvp WHERE meeting_rsvp.meeting_id = meeting.id AND waitlisted),
+		created_by, created_at, updated_at`
+
+// rsvpColumns are selected by every RSVP query and read by scanRSVP
+const rsvpColumns = `meeting_rsvp.user_id, user_data.display_name, meeting_rsvp.response, meeting_rsvp.guests,
+		meeting_rsvp.waitlisted, meeting_rsvp.updated_at`
+
+// CreateMeeting adds the meeting, the id and times are set on meeting
+func (w *Warehouse) CreateMeeting(meeting *common.Meeting) error {
+	err := w.DB.QueryRow(`INSERT INTO meeting (club_id, book_id, title, description, starts_at, ends_at, time_zone,
+			location, video_url, capacity, created_by)
+		VALUES ($1, NULLIF($2, '')::uuid, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, 0), $11)
+		RETURNING id, created_at, updated_at`, meeting.ClubID, meeting.BookID, meeting.Title, meeting.Description,
+		meeting.StartsAt, meeting.EndsAt, meeting.TimeZone, meeting.Location, meeting.VideoURL, meeting.Capacity,
+		meeting.CreatedBy).Scan(&meeting.ID, &meeting.CreatedAt, &meeting.UpdatedAt)
+	return bookReferenceError(err)
+}
+
+// GetMeeting returns ErrMeetingNotFound for an unknown meeting, or one of another club
+func (w *Warehouse) GetMeeting(clubID, id string) (*common.Meeting, error) {
+	meeting, err := scanMeeting(w.DB.QueryRow(`SELECT `+meetingColumns+` FROM meeting WHERE id = $1 AND club_id = $2`,
+		id, clubID))
+	if err != nil {
+		return nil, meetingError(err)
+	}
+	return meeting, nil
+}
+
+// ListMeetings returns a page of the meetings of the club and how many there are in total. Upcoming
+// meetings are soonest first, past meetings are most recent first
+func (w *Warehouse) ListMeetings(clubID string, past bool, p common.Pagination) ([]common.Meeting, int, error) {
+	where, order := `ends_at > NOW()`, `starts_at, id`
+	if past {
+		where, order = `ends_at <= NOW()`, `starts_at DESC, id`
+	}
+	var total int
+	if err := w.DB.QueryRow(`SELECT COUNT(*) FROM meeting WHERE club_id = $1 AND `+where, clubID).Scan(&total); err != nil {
+		return nil, 0, clubError(err)
+	}
+	rows, err := w.DB.Query(`SELECT `+meetingColumns+` FROM meeting
+		WHERE club_id = $1 AND `+where+`
+		ORDER BY `+order+`
+		LIMIT $2 OFFSET $3`, clubID, p.Limit, p.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	meetings := []common.Meeting{}
+	for rows.Next() {
+		meeting, err := scanMeeting(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		meetings = append(meetings, *meeting)
+	}
+	return meetings, total, rows.Err()
+}
+
+// UpdateMeeting replaces the details of the meeting. Raising the capacity moves people up from the
+// waitlist in the same transaction, the counts and updated_at are set on meeting
+func (w *Warehouse) UpdateMeeting(meeting *common.Meeting) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	var res sql.Result
+	if res, err = tx.Exec(`UPDATE meeting SET book_id = NULLIF($1, '')::uuid, title = $2, description = $3, starts_at = $4,
+			ends_at = $5, time_zone = $6, location = $7, video_url = $8, capacity = NULLIF($9, 0), updated_at = NOW()
+		WHERE id = $10 AND club_id = $11`, meeting.BookID, meeting.Title, meeting.Description, meeting.StartsAt,
+		meeting.EndsAt, meeting.TimeZone, meeting.Location, meeting.VideoURL, meeting.Capacity, meeting.ID,
+		meeting.ClubID); err != nil {
+		err = bookReferenceError(err)
+		return err
+	}
+	if err = expectRowsAffected(res, common.ErrMeetingNotFound); err != nil {
+		return err
+	}
+	if err = promoteWaitlist(tx, meeting.ID, meeting.Capacity); err != nil {
+		return err
+	}
+	var updated *common.Meeting
+	if updated, err = scanMeeting(tx.QueryRow(`SELECT `+meetingColumns+` FROM meeting WHERE id = $1`, meeting.ID)); err != nil {
+		return err
+	}
+	*meeting = *updated
+	return tx.Commit()
+}
+
+// DeleteMeeting removes the meeting of the club and its RSVPs
+func (w *Warehouse) DeleteMeeting(clubID, id string) error {
+	res, err := w.DB.Exec(`DELETE FROM meeting WHERE id = $1 AND club_id = $2`, id, clubID)
+	if err != nil {
+		return meetingError(err)
+	}
+	return expectRowsAffected(res, common.ErrMeetingNotFound)
+}
+
+// SetRSVP records the response of the user to the meeting. A new yes that does not fit, or that would
+// jump people already waiting, is waitlisted. A waitlisted yes keeps its place in the queue and a
+// confirmed yes keeps its place unless it brings more guests than there is room for, which returns
+// ErrRSVPNoRoomForGuests. Places freed by the change go to the waitlist in the same transaction
+func (w *Warehouse) SetRSVP(meetingID, userID, response string, guests int) (*common.MeetingRSVP, error) {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	var capacity int
+	if capacity, err = lockMeeting(tx, meetingID); err != nil {
+		return nil, err
+	}
+	var oldResponse string
+	var oldWaitlisted bool
+	err = tx.QueryRow(`SELECT response, waitlisted FROM meeting_rsvp WHERE meeting_id = $1 AND user_id = $2`,
+		meetingID, userID).Scan(&oldResponse, &oldWaitlisted)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	err = nil
+	waitlisted := false
+	if response == common.RSVPYes && capacity > 0 {
+		confirmed := oldResponse == common.RSVPYes && !oldWaitlisted
+		var taken int
+		if taken, err = placesTaken(tx, meetingID, userID); err != nil {
+			return nil, err
+		}
+		fits := taken+1+guests <= capacity
+		switch {
+		case confirmed && !fits:
+			err = common.ErrRSVPNoRoomForGuests
+			return nil, err
+		case oldWaitlisted:
+			waitlisted = true
+		case !confirmed:
+			var waiting int
+			if err = tx.QueryRow(`SELECT COUNT(*) FROM meeting_rsvp WHERE meeting_id = $1 AND waitlisted`,
+				meetingID).Scan(&waiting); err != nil {
+				return nil, err
+			}
+			waitlisted = waiting > 0 || !fits
+		}
+	}
+	if _, err = tx.Exec(`INSERT INTO meeting_rsvp (meeting_id, user_id, response, guests, waitlisted, waitlisted_at)
+		VALUES ($1, $2, $3, $4, $5, CASE WHEN $5 THEN NOW() END)
+		ON CONFLICT (meeting_id, user_id) DO UPDATE SET response = EXCLUDED.response, guests = EXCLUDED.guests,
+			waitlisted = EXCLUDED.waitlisted,
+			waitlisted_at = CASE WHEN EXCLUDED.waitlisted THEN COALESCE(meeting_rsvp.waitlisted_at, EXCLUDED.waitlisted_at) END,
+			updated_at = NOW()`, meetingID, userID, response, guests, waitlisted); err != nil {
+		return nil, err
+	}
+	if err = promoteWaitlist(tx, meetingID, capacity); err != nil {
+		return nil, err
+	}
+	var rsvp *common.MeetingRSVP
+	if rsvp, err = scanRSVP(tx.QueryRow(`SELECT `+rsvpColumns+`
+		FROM meeting_rsvp JOIN user_data ON user_data.id = meeting_rsvp.user_id
+		WHERE meeting_rsvp.meeting_id = $1 AND meeting_rsvp.user_id = $2`, meetingID, userID)); err != nil {
+		return nil, err
+	}
+	return rsvp, tx.Commit()
+}
+
+// DeleteRSVP removes the response of the user to the meeting, their place goes to the waitlist in
+// the same transaction
+func (w *Warehouse) DeleteRSVP(meetingID, userID string) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	var capacity int
+	if capacity, err = lockMeeting(tx, meetingID); err != nil {
+		return err
+	}
+	var res sql.Result
+	if res, err = tx.Exec(`DELETE FROM meeting_rsvp WHERE meeting_id = $1 AND user_id = $2`, meetingID, userID); err != nil {
+		return err
+	}
+	if err = expectRowsAffected(res, common.ErrRSVPNotFound); err != nil {
+		return err
+	}
+	if err = promoteWaitlist(tx, meetingID, capacity); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListRSVPs returns the responses to the meeting, confirmed yes first then the waitlist in order,
+// maybe and no. Deleted users are left out
+func (w *Warehouse) ListRSVPs(meetingID string) ([]common.MeetingRSVP, error) {
+	rows, err := w.DB.Query(`SELECT `+rsvpColumns+`
+		FROM meeting_rsvp JOIN user_data ON user_data.id = meeting_rsvp.user_id
+		WHERE meeting_rsvp.meeting_id = $1 AND user_data.deleted_at IS NULL
+		ORDER BY CASE WHEN meeting_rsvp.response = 'yes' AND NOT meeting_rsvp.waitlisted THEN 0
+			WHEN meeting_rsvp.waitlisted THEN 1 WHEN meeting_rsvp.response = 'maybe' THEN 2 ELSE 3 END,
+			meeting_rsvp.waitlisted_at, meeting_rsvp.created_at, meeting_rsvp.user_id`, meetingID)
+	if err != nil {
+		return nil, meetingError(err)
+	}
+	defer rows.Close()
+	rsvps := []common.MeetingRSVP{}
+	for rows.Next() {
+		rsvp, err := scanRSVP(rows)
+		if err != nil {
+			return nil, err
+		}
+		rsvps = append(rsvps, *rsvp)
+	}
+	return rsvps, rows.Err()
+}
+
+// lockMeeting stops the RSVPs and capacity of the meeting changing until the transaction ends, it
+// returns the capacity
+func lockMeeting(tx *sql.Tx, meetingID string) (int, error) {
+	var capacity int
+	err := tx.QueryRow(`SELECT COALESCE(capacity, 0) FROM meeting WHERE id = $1 FOR UPDATE`, meetingID).Scan(&capacity)
+	return capacity, meetingError(err)
+}
+
+// placesTaken counts the confirmed places at the meeting, with guests, leaving out those of exceptUserID
+func placesTaken(tx *sql.Tx, meetingID, exceptUserID string) (int, error) {
+	var taken int
+	err := tx.QueryRow(`SELECT COALESCE(SUM(1 + guests), 0) FROM meeting_rsvp
+		WHERE meeting_id = $1 AND user_id::text <> $2 AND response = 'yes' AND NOT waitlisted`,
+		meetingID, exceptUserID).Scan(&taken)
+	return taken, err
+}
+
+// promoteWaitlist confirms waitlisted RSVPs in the order they joined the waitlist for as long as they
+// fit. It stops at the first that does not fit so nobody is jumped by a smaller party
+func promoteWaitlist(tx *sql.Tx, meetingID string, capacity int) error {
+	rows, err := tx.Query(`SELECT user_id, guests FROM meeting_rsvp WHERE meeting_id = $1 AND waitlisted
+		ORDER BY waitlisted_at, user_id`, meetingID)
+	if err != nil {
+		return err
+	}
+	type waiting struct {
+		userID string
+		guests int
+	}
+	queue := []waiting{}
+	for rows.Next() {
+		wt := waiting{}
+		if err = rows.Scan(&wt.userID, &wt.guests); err != nil {
+			rows.Close()
+			return err
+		}
+		queue = append(queue, wt)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil || len(queue) == 0 {
+		return err
+	}
+	taken, err := placesTaken(tx, meetingID, "")
+	if err != nil {
+		return err
+	}
+	for _, wt := range queue {
+		if capacity > 0 && taken+1+wt.guests > capacity {
+			break
+		}
+		if _, err = tx.Exec(`UPDATE meeting_rsvp SET waitlisted = false, waitlisted_at = NULL, updated_at = NOW()
+			WHERE meeting_id = $1 AND user_id = $2`, meetingID, wt.userID); err != nil {
+			return err
+		}
+		taken += 1 + wt.guests
+	}
+	return nil
+}
+
+// removeRSVPs deletes every response of the user to a meeting and promotes the waitlists of those
+// meetings, as the places the user held are free. It returns how many were removed
+func removeRSVPs(tx *sql.Tx, userID string) (int64, error) {
+	rows, err := tx.Query(`DELETE FROM meeting_rsvp WHERE user_id = $1 RETURNING meeting_id`, userID)
+	if err != nil {
+		return 0, err
+	}
+	meetingIDs := []string{}
+	for rows.Next() {
+		var meetingID string
+		if err = rows.Scan(&meetingID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		meetingIDs = append(meetingIDs, meetingID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	// The meetings are locked in order so two erasures can not wait on each other
+	sort.Strings(meetingIDs)
+	for _, meetingID := range meetingIDs {
+		var capacity int
+		if capacity, err = lockMeeting(tx, meetingID); err != nil {
+			return 0, err
+		}
+		if err = promoteWaitlist(tx, meetingID, capacity); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(meetingIDs)), nil
+}
+
+func scanMeeting(row scanner) (*common.Meeting, error) {
+	m := common.Meeting{}
+	err := row.Scan(&m.ID, &m.ClubID, &m.BookID, &m.Title, &m.Description, &m.StartsAt, &m.EndsAt, &m.TimeZone,
+		&m.Location, &m.VideoURL, &m.Capacity, &m.Attending, &m.Waitlisted, &m.CreatedBy, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	// The times are stored without a time zone, they are always UTC
+	m.StartsAt, m.EndsAt = m.StartsAt.UTC(), m.EndsAt.UTC()
+	return &m, nil
+}
+
+func scanRSVP(row scanner) (*common.MeetingRSVP, error) {
+	r := common.MeetingRSVP{}
+	if err := row.Scan(&r.UserID, &r.DisplayName, &r.Response, &r.Guests, &r.Waitlisted, &r.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// meetingError turns the errors for a missing meeting, or an id that is not a uuid, into ErrMeetingNotFound
+func meetingError(err error) error {
+	if err == sql.ErrNoRows {
+		return common.ErrMeetingNotFound
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "invalid_text_representation" {
+		return common.ErrMeetingNotFound
+	}
+	return err
+}
+
+// bookReferenceError turns the error for a book_id that is not in the catalog into ErrBookNotFound
+func bookReferenceError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "foreign_key_violation" &&
+		strings.HasSuffix(pqErr.Constraint, "_book_id_fkey") {
+		return common.ErrBookNotFound
+	}
+	return err
+}
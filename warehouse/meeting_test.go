@@ -0,0 +1,194 @@
+package warehouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseSetRSVP(t *testing.T) {
+	type testData struct {
+		description        string
+		capacity           int
+		expectedError      error
+		expectedWaitlisted bool
+		guests             int
+		oldResponse        string
+		oldWaitlisted      bool
+		response           string
+		taken              int
+		waiting            int
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Yes when there is no limit",
+			response:    common.RSVPYes,
+			guests:      2,
+		},
+		testData{
+			description: "Yes that fits",
+			capacity:    4,
+			response:    common.RSVPYes,
+			guests:      1,
+			taken:       2,
+		},
+		testData{
+			description:        "Yes that does not fit is waitlisted",
+			capacity:           4,
+			expectedWaitlisted: true,
+			response:           common.RSVPYes,
+			guests:             2,
+			taken:              2,
+		},
+		testData{
+			description:        "Yes that fits does not jump people waiting",
+			capacity:           4,
+			expectedWaitlisted: true,
+			response:           common.RSVPYes,
+			taken:              2,
+			waiting:            1,
+		},
+		testData{
+			description:   "Confirmed yes bringing more guests than there is room for",
+			capacity:      4,
+			expectedError: common.ErrRSVPNoRoomForGuests,
+			oldResponse:   common.RSVPYes,
+			response:      common.RSVPYes,
+			guests:        2,
+			taken:         2,
+		},
+		testData{
+			description:        "Waitlisted yes keeps its place in the queue",
+			capacity:           4,
+			expectedWaitlisted: true,
+			oldResponse:        common.RSVPYes,
+			oldWaitlisted:      true,
+			response:           common.RSVPYes,
+			taken:              2,
+		},
+		testData{
+			description: "Maybe is never waitlisted",
+			capacity:    4,
+			response:    common.RSVPMaybe,
+			guests:      3,
+			taken:       4,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	updatedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, td := range testTable {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT COALESCE\\(capacity, 0\\) FROM meeting WHERE id = \\$1 FOR UPDATE").
+			WithArgs("meetingID").
+			WillReturnRows(sqlmock.NewRows([]string{"capacity"}).AddRow(td.capacity))
+		rows := sqlmock.NewRows([]string{"response", "waitlisted"})
+		if td.oldResponse != "" {
+			rows.AddRow(td.oldResponse, td.oldWaitlisted)
+		}
+		mock.ExpectQuery("SELECT response, waitlisted FROM meeting_rsvp WHERE meeting_id = \\$1 AND user_id = \\$2").
+			WithArgs("meetingID", "userID").
+			WillReturnRows(rows)
+		if td.response == common.RSVPYes && td.capacity > 0 {
+			mock.ExpectQuery("SELECT COALESCE\\(SUM\\(1 \\+ guests\\), 0\\) FROM meeting_rsvp").
+				WithArgs("meetingID", "userID").
+				WillReturnRows(sqlmock.NewRows([]string{"taken"}).AddRow(td.taken))
+			if td.oldResponse == "" {
+				mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM meeting_rsvp WHERE meeting_id = \\$1 AND waitlisted").
+					WithArgs("meetingID").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(td.waiting))
+			}
+		}
+		if td.expectedError != nil {
+			mock.ExpectRollback()
+		} else {
+			mock.ExpectExec("INSERT INTO meeting_rsvp \\(meeting_id, user_id, response, guests, waitlisted, waitlisted_at\\)").
+				WithArgs("meetingID", "userID", td.response, td.guests, td.expectedWaitlisted).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			// Nobody is waiting, so nobody is moved up
+			mock.ExpectQuery("SELECT user_id, guests FROM meeting_rsvp WHERE meeting_id = \\$1 AND waitlisted").
+				WithArgs("meetingID").
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "guests"}))
+			mock.ExpectQuery("SELECT meeting_rsvp.user_id, user_data.display_name, .+ FROM meeting_rsvp JOIN user_data").
+				WithArgs("meetingID", "userID").
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "display_name", "response", "guests", "waitlisted", "updated_at"}).
+					AddRow("userID", "gcarr", td.response, td.guests, td.expectedWaitlisted, updatedAt))
+			mock.ExpectCommit()
+		}
+		rsvp, err := w.SetRSVP("meetingID", "userID", td.response, td.guests)
+		if !assert.Equal(t, td.expectedError, err, td.description) || err != nil {
+			continue
+		}
+		assert.Equal(t, &common.MeetingRSVP{UserID: "userID", DisplayName: "gcarr", Response: td.response, Guests: td.guests,
+			Waitlisted: td.expectedWaitlisted, UpdatedAt: updatedAt}, rsvp, td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseDeleteRSVPPromotesWaitlist(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COALESCE\\(capacity, 0\\) FROM meeting WHERE id = \\$1 FOR UPDATE").
+		WithArgs("meetingID").
+		WillReturnRows(sqlmock.NewRows([]string{"capacity"}).AddRow(6))
+	mock.ExpectExec("DELETE FROM meeting_rsvp WHERE meeting_id = \\$1 AND user_id = \\$2").
+		WithArgs("meetingID", "userID").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The first in the queue fits, the second does not and the third, although it would fit, waits its turn
+	mock.ExpectQuery("SELECT user_id, guests FROM meeting_rsvp WHERE meeting_id = \\$1 AND waitlisted\\s+ORDER BY waitlisted_at").
+		WithArgs("meetingID").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "guests"}).
+			AddRow("firstID", 1).AddRow("secondID", 3).AddRow("thirdID", 0))
+	mock.ExpectQuery("SELECT COALESCE\\(SUM\\(1 \\+ guests\\), 0\\) FROM meeting_rsvp").
+		WithArgs("meetingID", "").
+		WillReturnRows(sqlmock.NewRows([]string{"taken"}).AddRow(3))
+	mock.ExpectExec("UPDATE meeting_rsvp SET waitlisted = false, waitlisted_at = NULL").
+		WithArgs("meetingID", "firstID").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, w.DeleteRSVP("meetingID", "userID"))
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseDeleteRSVPNotFound(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COALESCE\\(capacity, 0\\) FROM meeting WHERE id = \\$1 FOR UPDATE").
+		WithArgs("meetingID").
+		WillReturnRows(sqlmock.NewRows([]string{"capacity"}).AddRow(0))
+	mock.ExpectExec("DELETE FROM meeting_rsvp WHERE meeting_id = \\$1 AND user_id = \\$2").
+		WithArgs("meetingID", "userID").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	assert.Equal(t, common.ErrRSVPNotFound, w.DeleteRSVP("meetingID", "userID"))
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
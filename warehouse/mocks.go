@@ -1,6 +1,8 @@
 package warehouse
 
 import (
+	"time"
+
 	"github.com/garycarr/book_club/common"
 	"github.com/stretchr/testify/mock"
 )
@@ -25,5 +27,835 @@ func (mw *MockWarehouse) GetUserWithEmail(email string) (*common.User, error) {
 	return args.Get(0).(*common.User), args.Error(1)
 }
 
+// GetUserWithID is used to assert the method is called
+func (mw *MockWarehouse) GetUserWithID(id string) (*common.User, error) {
+	args := mw.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.User), args.Error(1)
+}
+
+// CreateRefreshToken is used to assert the method is called
+func (mw *MockWarehouse) CreateRefreshToken(userID, tokenHash string, expiresAt time.Time) (*common.RefreshToken, error) {
+	args := mw.Called(userID, tokenHash, expiresAt)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.RefreshToken), args.Error(1)
+}
+
+// GetRefreshToken is used to assert the method is called
+func (mw *MockWarehouse) GetRefreshToken(tokenHash string) (*common.RefreshToken, error) {
+	args := mw.Called(tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.RefreshToken), args.Error(1)
+}
+
+// RotateRefreshToken is used to assert the method is called
+func (mw *MockWarehouse) RotateRefreshToken(rt *common.RefreshToken, tokenHash string, expiresAt time.Time) (*common.RefreshToken, error) {
+	args := mw.Called(rt, tokenHash, expiresAt)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.RefreshToken), args.Error(1)
+}
+
+// RevokeRefreshTokenFamily is used to assert the method is called
+func (mw *MockWarehouse) RevokeRefreshTokenFamily(familyID string) error {
+	args := mw.Called(familyID)
+	return args.Error(0)
+}
+
+// RevokeJSONToken is used to assert the method is called
+func (mw *MockWarehouse) RevokeJSONToken(jti string, expiresAt time.Time) error {
+	args := mw.Called(jti, expiresAt)
+	return args.Error(0)
+}
+
+// IsJSONTokenRevoked is used to assert the method is called
+func (mw *MockWarehouse) IsJSONTokenRevoked(claims *common.TokenClaims) (bool, error) {
+	args := mw.Called(claims)
+	return args.Bool(0), args.Error(1)
+}
+
+// DeleteExpiredRevokedTokens is used to assert the method is called
+func (mw *MockWarehouse) DeleteExpiredRevokedTokens() (int64, error) {
+	args := mw.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// CreatePasswordReset is used to assert the method is called
+func (mw *MockWarehouse) CreatePasswordReset(userID, tokenHash string, expiresAt time.Time) error {
+	args := mw.Called(userID, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+// GetPasswordReset is used to assert the method is called
+func (mw *MockWarehouse) GetPasswordReset(tokenHash string) (*common.PasswordReset, error) {
+	args := mw.Called(tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.PasswordReset), args.Error(1)
+}
+
+// ResetPassword is used to assert the method is called
+func (mw *MockWarehouse) ResetPassword(pr *common.PasswordReset, hashedPassword string) error {
+	args := mw.Called(pr, hashedPassword)
+	return args.Error(0)
+}
+
+// CreateEmailVerification is used to assert the method is called
+func (mw *MockWarehouse) CreateEmailVerification(userID, email, tokenHash string, expiresAt time.Time) error {
+	args := mw.Called(userID, email, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+// GetEmailVerification is used to assert the method is called
+func (mw *MockWarehouse) GetEmailVerification(tokenHash string) (*common.EmailVerification, error) {
+	args := mw.Called(tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.EmailVerification), args.Error(1)
+}
+
+// GetLastEmailVerificationAt is used to assert the method is called
+func (mw *MockWarehouse) GetLastEmailVerificationAt(userID string) (*time.Time, error) {
+	args := mw.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*time.Time), args.Error(1)
+}
+
+// VerifyEmail is used to assert the method is called
+func (mw *MockWarehouse) VerifyEmail(ev *common.EmailVerification) error {
+	args := mw.Called(ev)
+	return args.Error(0)
+}
+
+// SetTOTPSecret is used to assert the method is called
+func (mw *MockWarehouse) SetTOTPSecret(userID, encryptedSecret string) error {
+	args := mw.Called(userID, encryptedSecret)
+	return args.Error(0)
+}
+
+// EnableTOTP is used to assert the method is called
+func (mw *MockWarehouse) EnableTOTP(userID string, recoveryCodeHashes []string) error {
+	args := mw.Called(userID, recoveryCodeHashes)
+	return args.Error(0)
+}
+
+// DisableTOTP is used to assert the method is called
+func (mw *MockWarehouse) DisableTOTP(userID string) error {
+	args := mw.Called(userID)
+	return args.Error(0)
+}
+
+// UseTOTPStep is used to assert the method is called
+func (mw *MockWarehouse) UseTOTPStep(userID string, step int64) error {
+	args := mw.Called(userID, step)
+	return args.Error(0)
+}
+
+// UseRecoveryCode is used to assert the method is called
+func (mw *MockWarehouse) UseRecoveryCode(userID, codeHash string) error {
+	args := mw.Called(userID, codeHash)
+	return args.Error(0)
+}
+
+// SetUserRoles is used to assert the method is called
+func (mw *MockWarehouse) SetUserRoles(userID string, roles []string) error {
+	args := mw.Called(userID, roles)
+	return args.Error(0)
+}
+
+// SetClubRole is used to assert the method is called
+func (mw *MockWarehouse) SetClubRole(clubID, userID, role string) error {
+	args := mw.Called(clubID, userID, role)
+	return args.Error(0)
+}
+
+// DeleteClubRole is used to assert the method is called
+func (mw *MockWarehouse) DeleteClubRole(clubID, userID string) error {
+	args := mw.Called(clubID, userID)
+	return args.Error(0)
+}
+
+// RecordLoginFailure is used to assert the method is called
+func (mw *MockWarehouse) RecordLoginFailure(key string, forgetBefore time.Time) (int, error) {
+	args := mw.Called(key, forgetBefore)
+	return args.Int(0), args.Error(1)
+}
+
+// LockLogin is used to assert the method is called
+func (mw *MockWarehouse) LockLogin(key string, until time.Time) error {
+	args := mw.Called(key, until)
+	return args.Error(0)
+}
+
+// GetLoginLockedUntil is used to assert the method is called
+func (mw *MockWarehouse) GetLoginLockedUntil(key string) (*time.Time, error) {
+	args := mw.Called(key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*time.Time), args.Error(1)
+}
+
+// ResetLoginFailures is used to assert the method is called
+func (mw *MockWarehouse) ResetLoginFailures(key string) error {
+	args := mw.Called(key)
+	return args.Error(0)
+}
+
+// UpdatePassword is used to assert the method is called
+func (mw *MockWarehouse) UpdatePassword(userID, hashedPassword string) error {
+	args := mw.Called(userID, hashedPassword)
+	return args.Error(0)
+}
+
+// UpdateUser is used to assert the method is called
+func (mw *MockWarehouse) UpdateUser(user *common.User, emailChanged bool) error {
+	args := mw.Called(user, emailChanged)
+	return args.Error(0)
+}
+
+// ChangePassword is used to assert the method is called
+func (mw *MockWarehouse) ChangePassword(userID, hashedPassword string) error {
+	args := mw.Called(userID, hashedPassword)
+	return args.Error(0)
+}
+
+// DeleteUser is used to assert the method is called
+func (mw *MockWarehouse) DeleteUser(userID string) error {
+	args := mw.Called(userID)
+	return args.Error(0)
+}
+
+// ExportUser is used to assert the method is called
+func (mw *MockWarehouse) ExportUser(userID string) (*common.UserExport, error) {
+	args := mw.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.UserExport), args.Error(1)
+}
+
+// EraseUser is used to assert the method is called
+func (mw *MockWarehouse) EraseUser(userID, erasedBy string) (*common.UserErasure, error) {
+	args := mw.Called(userID, erasedBy)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.UserErasure), args.Error(1)
+}
+
+// CreatePersonalAccessToken is used to assert the method is called
+func (mw *MockWarehouse) CreatePersonalAccessToken(pat *common.PersonalAccessToken, tokenHash string) error {
+	args := mw.Called(pat, tokenHash)
+	return args.Error(0)
+}
+
+// ListPersonalAccessTokens is used to assert the method is called
+func (mw *MockWarehouse) ListPersonalAccessTokens(userID string) ([]common.PersonalAccessToken, error) {
+	args := mw.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]common.PersonalAccessToken), args.Error(1)
+}
+
+// RevokePersonalAccessToken is used to assert the method is called
+func (mw *MockWarehouse) RevokePersonalAccessToken(userID, id string) error {
+	args := mw.Called(userID, id)
+	return args.Error(0)
+}
+
+// UsePersonalAccessToken is used to assert the method is called
+func (mw *MockWarehouse) UsePersonalAccessToken(tokenHash string) (*common.PersonalAccessToken, error) {
+	args := mw.Called(tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.PersonalAccessToken), args.Error(1)
+}
+
+// CreateOIDCLogin is used to assert the method is called
+func (mw *MockWarehouse) CreateOIDCLogin(stateHash string, login common.OIDCLogin) error {
+	args := mw.Called(stateHash, login)
+	return args.Error(0)
+}
+
+// UseOIDCLogin is used to assert the method is called
+func (mw *MockWarehouse) UseOIDCLogin(stateHash string) (*common.OIDCLogin, error) {
+	args := mw.Called(stateHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.OIDCLogin), args.Error(1)
+}
+
+// GetUserWithIdentity is used to assert the method is called
+func (mw *MockWarehouse) GetUserWithIdentity(provider, subject string) (*common.User, error) {
+	args := mw.Called(provider, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.User), args.Error(1)
+}
+
+// LinkUserIdentity is used to assert the method is called
+func (mw *MockWarehouse) LinkUserIdentity(userID string, identity common.UserIdentity) error {
+	args := mw.Called(userID, identity)
+	return args.Error(0)
+}
+
+// CreateUserWithIdentity is used to assert the method is called
+func (mw *MockWarehouse) CreateUserWithIdentity(displayName string, emailVerified bool, identity common.UserIdentity) (*common.User, error) {
+	args := mw.Called(displayName, emailVerified, identity)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.User), args.Error(1)
+}
+
+// CreateBook is used to assert the method is called
+func (mw *MockWarehouse) CreateBook(book *common.Book) error {
+	args := mw.Called(book)
+	return args.Error(0)
+}
+
+// GetBook is used to assert the method is called
+func (mw *MockWarehouse) GetBook(id string) (*common.Book, error) {
+	args := mw.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.Book), args.Error(1)
+}
+
+// ListBooks is used to assert the method is called
+func (mw *MockWarehouse) ListBooks(filter common.BookFilter) ([]common.Book, int, error) {
+	args := mw.Called(filter)
+	if args.Get(0) == nil {
+		return nil, args.Int(1), args.Error(2)
+	}
+	return args.Get(0).([]common.Book), args.Int(1), args.Error(2)
+}
+
+// UpdateBook is used to assert the method is called
+func (mw *MockWarehouse) UpdateBook(book *common.Book) error {
+	args := mw.Called(book)
+	return args.Error(0)
+}
+
+// DeleteBook is used to assert the method is called
+func (mw *MockWarehouse) DeleteBook(id string) error {
+	args := mw.Called(id)
+	return args.Error(0)
+}
+
+// GetBookMetadata is used to assert the method is called
+func (mw *MockWarehouse) GetBookMetadata(isbn13 string) (*common.BookMetadata, error) {
+	args := mw.Called(isbn13)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.BookMetadata), args.Error(1)
+}
+
+// SaveBookMetadata is used to assert the method is called
+func (mw *MockWarehouse) SaveBookMetadata(bm common.BookMetadata) error {
+	args := mw.Called(bm)
+	return args.Error(0)
+}
+
+// CreateClub is used to assert the method is called
+func (mw *MockWarehouse) CreateClub(club *common.Club, ownerID string) error {
+	args := mw.Called(club, ownerID)
+	return args.Error(0)
+}
+
+// GetClub is used to assert the method is called
+func (mw *MockWarehouse) GetClub(id string) (*common.Club, error) {
+	args := mw.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.Club), args.Error(1)
+}
+
+// UpdateClub is used to assert the method is called
+func (mw *MockWarehouse) UpdateClub(club *common.Club) error {
+	args := mw.Called(club)
+	return args.Error(0)
+}
+
+// JoinClub is used to assert the method is called
+func (mw *MockWarehouse) JoinClub(clubID, userID string) (bool, error) {
+	args := mw.Called(clubID, userID)
+	return args.Bool(0), args.Error(1)
+}
+
+// LeaveClub is used to assert the method is called
+func (mw *MockWarehouse) LeaveClub(clubID, userID string) error {
+	args := mw.Called(clubID, userID)
+	return args.Error(0)
+}
+
+// GetClubMember is used to assert the method is called
+func (mw *MockWarehouse) GetClubMember(clubID, userID string) (*common.ClubMember, error) {
+	args := mw.Called(clubID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.ClubMember), args.Error(1)
+}
+
+// ListClubMembers is used to assert the method is called
+func (mw *MockWarehouse) ListClubMembers(clubID string, p common.Pagination) ([]common.ClubMember, int, error) {
+	args := mw.Called(clubID, p)
+	if args.Get(0) == nil {
+		return nil, args.Int(1), args.Error(2)
+	}
+	return args.Get(0).([]common.ClubMember), args.Int(1), args.Error(2)
+}
+
+// ChangeClubRole is used to assert the method is called
+func (mw *MockWarehouse) ChangeClubRole(clubID, userID, role string) error {
+	args := mw.Called(clubID, userID, role)
+	return args.Error(0)
+}
+
+// ListClubJoinRequests is used to assert the method is called
+func (mw *MockWarehouse) ListClubJoinRequests(clubID string, p common.Pagination) ([]common.ClubJoinRequest, int, error) {
+	args := mw.Called(clubID, p)
+	if args.Get(0) == nil {
+		return nil, args.Int(1), args.Error(2)
+	}
+	return args.Get(0).([]common.ClubJoinRequest), args.Int(1), args.Error(2)
+}
+
+// ApproveClubJoinRequest is used to assert the method is called
+func (mw *MockWarehouse) ApproveClubJoinRequest(clubID, userID string) error {
+	args := mw.Called(clubID, userID)
+	return args.Error(0)
+}
+
+// RejectClubJoinRequest is used to assert the method is called
+func (mw *MockWarehouse) RejectClubJoinRequest(clubID, userID string) error {
+	args := mw.Called(clubID, userID)
+	return args.Error(0)
+}
+
+// CreateClubInvite is used to assert the method is called
+func (mw *MockWarehouse) CreateClubInvite(invite *common.ClubInvite, codeHash string) error {
+	args := mw.Called(invite, codeHash)
+	return args.Error(0)
+}
+
+// ListClubInvites is used to assert the method is called
+func (mw *MockWarehouse) ListClubInvites(clubID string) ([]common.ClubInvite, error) {
+	args := mw.Called(clubID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]common.ClubInvite), args.Error(1)
+}
+
+// RevokeClubInvite is used to assert the method is called
+func (mw *MockWarehouse) RevokeClubInvite(clubID, id string) error {
+	args := mw.Called(clubID, id)
+	return args.Error(0)
+}
+
+// GetClubInviteWithCode is used to assert the method is called
+func (mw *MockWarehouse) GetClubInviteWithCode(codeHash string) (*common.ClubInvite, error) {
+	args := mw.Called(codeHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.ClubInvite), args.Error(1)
+}
+
+// AcceptClubInvite is used to assert the method is called
+func (mw *MockWarehouse) AcceptClubInvite(codeHash, userID string) (string, error) {
+	args := mw.Called(codeHash, userID)
+	return args.String(0), args.Error(1)
+}
+
+// CreateUserWithInvite is used to assert the method is called
+func (mw *MockWarehouse) CreateUserWithInvite(rr common.RegisterRequest, codeHash string) (*common.User, error) {
+	args := mw.Called(rr, codeHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.User), args.Error(1)
+}
+
+// CreateMeeting is used to assert the method is called
+func (mw *MockWarehouse) CreateMeeting(meeting *common.Meeting) error {
+	args := mw.Called(meeting)
+	return args.Error(0)
+}
+
+// GetMeeting is used to assert the method is called
+func (mw *MockWarehouse) GetMeeting(clubID, id string) (*common.Meeting, error) {
+	args := mw.Called(clubID, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.Meeting), args.Error(1)
+}
+
+// ListMeetings is used to assert the method is called
+func (mw *MockWarehouse) ListMeetings(clubID string, past bool, p common.Pagination) ([]common.Meeting, int, error) {
+	args := mw.Called(clubID, past, p)
+	if args.Get(0) == nil {
+		return nil, args.Int(1), args.Error(2)
+	}
+	return args.Get(0).([]common.Meeting), args.Int(1), args.Error(2)
+}
+
+// UpdateMeeting is used to assert the method is called
+func (mw *MockWarehouse) UpdateMeeting(meeting *common.Meeting) error {
+	args := mw.Called(meeting)
+	return args.Error(0)
+}
+
+// DeleteMeeting is used to assert the method is called
+func (mw *MockWarehouse) DeleteMeeting(clubID, id string) error {
+	args := mw.Called(clubID, id)
+	return args.Error(0)
+}
+
+// SetRSVP is used to assert the method is called
+func (mw *MockWarehouse) SetRSVP(meetingID, userID, response string, guests int) (*common.MeetingRSVP, error) {
+	args := mw.Called(meetingID, userID, response, guests)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.MeetingRSVP), args.Error(1)
+}
+
+// DeleteRSVP is used to assert the method is called
+func (mw *MockWarehouse) DeleteRSVP(meetingID, userID string) error {
+	args := mw.Called(meetingID, userID)
+	return args.Error(0)
+}
+
+// ListRSVPs is used to assert the method is called
+func (mw *MockWarehouse) ListRSVPs(meetingID string) ([]common.MeetingRSVP, error) {
+	args := mw.Called(meetingID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]common.MeetingRSVP), args.Error(1)
+}
+
+// CreateReadingPlan is used to assert the method is called
+func (mw *MockWarehouse) CreateReadingPlan(plan *common.ReadingPlan) error {
+	args := mw.Called(plan)
+	return args.Error(0)
+}
+
+// GetReadingPlan is used to assert the method is called
+func (mw *MockWarehouse) GetReadingPlan(clubID, id string) (*common.ReadingPlan, error) {
+	args := mw.Called(clubID, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.ReadingPlan), args.Error(1)
+}
+
+// ListReadingPlans is used to assert the method is called
+func (mw *MockWarehouse) ListReadingPlans(clubID string) ([]common.ReadingPlan, error) {
+	args := mw.Called(clubID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]common.ReadingPlan), args.Error(1)
+}
+
+// UpdateReadingPlan is used to assert the method is called
+func (mw *MockWarehouse) UpdateReadingPlan(plan *common.ReadingPlan) error {
+	args := mw.Called(plan)
+	return args.Error(0)
+}
+
+// DeleteReadingPlan is used to assert the method is called
+func (mw *MockWarehouse) DeleteReadingPlan(clubID, id string) error {
+	args := mw.Called(clubID, id)
+	return args.Error(0)
+}
+
+// RecordProgress is used to assert the method is called
+func (mw *MockWarehouse) RecordProgress(userID string, progress *common.ReadingProgress) error {
+	args := mw.Called(userID, progress)
+	return args.Error(0)
+}
+
+// ListProgress is used to assert the method is called
+func (mw *MockWarehouse) ListProgress(userID, bookID string) ([]common.ReadingProgress, error) {
+	args := mw.Called(userID, bookID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]common.ReadingProgress), args.Error(1)
+}
+
+// SetProgressSharing is used to assert the method is called
+func (mw *MockWarehouse) SetProgressSharing(clubID, userID string, share bool) error {
+	args := mw.Called(clubID, userID, share)
+	return args.Error(0)
+}
+
+// ClubProgress is used to assert the method is called
+func (mw *MockWarehouse) ClubProgress(clubID, bookID, viewerID string) ([]common.MemberProgress, int, error) {
+	args := mw.Called(clubID, bookID, viewerID)
+	if args.Get(0) == nil {
+		return nil, args.Int(1), args.Error(2)
+	}
+	return args.Get(0).([]common.MemberProgress), args.Int(1), args.Error(2)
+}
+
+// CreateReview is used to assert the method is called
+func (mw *MockWarehouse) CreateReview(review *common.Review) error {
+	args := mw.Called(review)
+	return args.Error(0)
+}
+
+// GetReview is used to assert the method is called
+func (mw *MockWarehouse) GetReview(bookID, userID string) (*common.Review, error) {
+	args := mw.Called(bookID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.Review), args.Error(1)
+}
+
+// ListReviews is used to assert the method is called
+func (mw *MockWarehouse) ListReviews(bookID, sort string, p common.Pagination) ([]common.Review, int, error) {
+	args := mw.Called(bookID, sort, p)
+	if args.Get(0) == nil {
+		return nil, args.Int(1), args.Error(2)
+	}
+	return args.Get(0).([]common.Review), args.Int(1), args.Error(2)
+}
+
+// UpdateReview is used to assert the method is called
+func (mw *MockWarehouse) UpdateReview(review *common.Review) error {
+	args := mw.Called(review)
+	return args.Error(0)
+}
+
+// DeleteReview is used to assert the method is called
+func (mw *MockWarehouse) DeleteReview(bookID, userID string) error {
+	args := mw.Called(bookID, userID)
+	return args.Error(0)
+}
+
+// AddHelpfulVote is used to assert the method is called
+func (mw *MockWarehouse) AddHelpfulVote(bookID, reviewID, userID string) error {
+	args := mw.Called(bookID, reviewID, userID)
+	return args.Error(0)
+}
+
+// RemoveHelpfulVote is used to assert the method is called
+func (mw *MockWarehouse) RemoveHelpfulVote(bookID, reviewID, userID string) error {
+	args := mw.Called(bookID, reviewID, userID)
+	return args.Error(0)
+}
+
+// CreateThread is used to assert the method is called
+func (mw *MockWarehouse) CreateThread(thread *common.Thread, post *common.Post) error {
+	args := mw.Called(thread, post)
+	return args.Error(0)
+}
+
+// GetThread is used to assert the method is called
+func (mw *MockWarehouse) GetThread(clubID, id string) (*common.Thread, error) {
+	args := mw.Called(clubID, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.Thread), args.Error(1)
+}
+
+// ListThreads is used to assert the method is called
+func (mw *MockWarehouse) ListThreads(filter common.ThreadFilter) ([]common.Thread, *common.Cursor, error) {
+	args := mw.Called(filter)
+	var next *common.Cursor
+	if args.Get(1) != nil {
+		next = args.Get(1).(*common.Cursor)
+	}
+	if args.Get(0) == nil {
+		return nil, next, args.Error(2)
+	}
+	return args.Get(0).([]common.Thread), next, args.Error(2)
+}
+
+// UpdateThread is used to assert the method is called
+func (mw *MockWarehouse) UpdateThread(thread *common.Thread) error {
+	args := mw.Called(thread)
+	return args.Error(0)
+}
+
+// DeleteThread is used to assert the method is called
+func (mw *MockWarehouse) DeleteThread(clubID, id string) error {
+	args := mw.Called(clubID, id)
+	return args.Error(0)
+}
+
+// CreatePost is used to assert the method is called
+func (mw *MockWarehouse) CreatePost(post *common.Post) error {
+	args := mw.Called(post)
+	return args.Error(0)
+}
+
+// GetPost is used to assert the method is called
+func (mw *MockWarehouse) GetPost(threadID, id string) (*common.Post, error) {
+	args := mw.Called(threadID, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.Post), args.Error(1)
+}
+
+// ListPosts is used to assert the method is called
+func (mw *MockWarehouse) ListPosts(threadID string, p common.CursorPagination) ([]common.Post, *common.Cursor, error) {
+	args := mw.Called(threadID, p)
+	var next *common.Cursor
+	if args.Get(1) != nil {
+		next = args.Get(1).(*common.Cursor)
+	}
+	if args.Get(0) == nil {
+		return nil, next, args.Error(2)
+	}
+	return args.Get(0).([]common.Post), next, args.Error(2)
+}
+
+// UpdatePost is used to assert the method is called
+func (mw *MockWarehouse) UpdatePost(post *common.Post) error {
+	args := mw.Called(post)
+	return args.Error(0)
+}
+
+// DeletePost is used to assert the method is called
+func (mw *MockWarehouse) DeletePost(threadID, id, deletedBy string) error {
+	args := mw.Called(threadID, id, deletedBy)
+	return args.Error(0)
+}
+
+// ListPostRevisions is used to assert the method is called
+func (mw *MockWarehouse) ListPostRevisions(postID string) ([]common.PostRevision, error) {
+	args := mw.Called(postID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]common.PostRevision), args.Error(1)
+}
+
+// CreateNomination is used to assert the method is called
+func (mw *MockWarehouse) CreateNomination(nomination *common.Nomination) error {
+	args := mw.Called(nomination)
+	return args.Error(0)
+}
+
+// GetNomination is used to assert the method is called
+func (mw *MockWarehouse) GetNomination(clubID, id string) (*common.Nomination, error) {
+	args := mw.Called(clubID, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.Nomination), args.Error(1)
+}
+
+// ListNominations is used to assert the method is called
+func (mw *MockWarehouse) ListNominations(clubID string, p common.Pagination) ([]common.Nomination, int, error) {
+	args := mw.Called(clubID, p)
+	if args.Get(0) == nil {
+		return nil, args.Int(1), args.Error(2)
+	}
+	return args.Get(0).([]common.Nomination), args.Int(1), args.Error(2)
+}
+
+// DeleteNomination is used to assert the method is called
+func (mw *MockWarehouse) DeleteNomination(clubID, id string) error {
+	args := mw.Called(clubID, id)
+	return args.Error(0)
+}
+
+// CreatePoll is used to assert the method is called
+func (mw *MockWarehouse) CreatePoll(poll *common.Poll, bookIDs []string) error {
+	args := mw.Called(poll, bookIDs)
+	return args.Error(0)
+}
+
+// GetPoll is used to assert the method is called
+func (mw *MockWarehouse) GetPoll(clubID, id string) (*common.Poll, error) {
+	args := mw.Called(clubID, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.Poll), args.Error(1)
+}
+
+// ListPolls is used to assert the method is called
+func (mw *MockWarehouse) ListPolls(clubID string, p common.Pagination) ([]common.Poll, int, error) {
+	args := mw.Called(clubID, p)
+	if args.Get(0) == nil {
+		return nil, args.Int(1), args.Error(2)
+	}
+	return args.Get(0).([]common.Poll), args.Int(1), args.Error(2)
+}
+
+// ClosePoll is used to assert the method is called
+func (mw *MockWarehouse) ClosePoll(poll *common.Poll) error {
+	args := mw.Called(poll)
+	return args.Error(0)
+}
+
+// DeletePoll is used to assert the method is called
+func (mw *MockWarehouse) DeletePoll(clubID, id string) error {
+	args := mw.Called(clubID, id)
+	return args.Error(0)
+}
+
+// SetBallot is used to assert the method is called
+func (mw *MockWarehouse) SetBallot(ballot *common.Ballot) error {
+	args := mw.Called(ballot)
+	return args.Error(0)
+}
+
+// GetBallot is used to assert the method is called
+func (mw *MockWarehouse) GetBallot(pollID, userID string) (*common.Ballot, error) {
+	args := mw.Called(pollID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*common.Ballot), args.Error(1)
+}
+
+// DeleteBallot is used to assert the method is called
+func (mw *MockWarehouse) DeleteBallot(pollID, userID string) error {
+	args := mw.Called(pollID, userID)
+	return args.Error(0)
+}
+
+// ListBallots is used to assert the method is called
+func (mw *MockWarehouse) ListBallots(pollID string) ([]common.Ballot, error) {
+	args := mw.Called(pollID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]common.Ballot), args.Error(1)
+}
+
 // Close is used to assert the method is called
 func (mw *MockWarehouse) Close() {}
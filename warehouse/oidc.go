@@ -0,0 +1,101 @@
+package warehouse
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+)
+
+// CreateOIDCLogin stores a login that has been sent to an identity provider, logins that were never
+// finished are removed once they expire
+func (w *Warehouse) CreateOIDCLogin(stateHash string, login common.OIDCLogin) error {
+	_, err := w.DB.Exec(`WITH expired AS (DELETE FROM oidc_login WHERE expires_at < NOW())
+		INSERT INTO oidc_login (state_hash, provider, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`, stateHash, login.Provider, login.Nonce, login.CodeVerifier, login.ExpiresAt)
+	return err
+}
+
+// UseOIDCLogin removes the login so the state can only be used once. ErrOIDCStateInvalid is returned
+// for unknown or expired logins
+func (w *Warehouse) UseOIDCLogin(stateHash string) (*common.OIDCLogin, error) {
+	login := common.OIDCLogin{}
+	err := w.DB.QueryRow(`DELETE FROM oidc_login WHERE state_hash = $1
+		RETURNING provider, nonce, code_verifier, expires_at`, stateHash).
+		Scan(&login.Provider, &login.Nonce, &login.CodeVerifier, &login.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, common.ErrOIDCStateInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if login.ExpiresAt.Before(time.Now()) {
+		return nil, common.ErrOIDCStateInvalid
+	}
+	return &login, nil
+}
+
+// GetUserWithIdentity returns the user linked to the account at the identity provider, deleted users
+// are ignored
+func (w *Warehouse) GetUserWithIdentity(provider, subject string) (*common.User, error) {
+	sqlStatement := `SELECT ` + userColumns + `
+		FROM user_data
+		WHERE id = (SELECT user_id FROM user_identity WHERE provider = $1 AND subject = $2) AND deleted_at IS NULL`
+	u, err := scanUser(w.DB.QueryRow(sqlStatement, provider, subject))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, common.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
+// LinkUserIdentity links an existing user to their account at an identity provider
+func (w *Warehouse) LinkUserIdentity(userID string, identity common.UserIdentity) error {
+	_, err := w.DB.Exec(`INSERT INTO user_identity (provider, subject, user_id, email) VALUES ($1, $2, $3, $4)`,
+		identity.Provider, identity.Subject, userID, identity.Email)
+	return err
+}
+
+// CreateUserWithIdentity creates a user who logs in through an identity provider, they have no
+// password. The email is verified when the provider says it is. ErrLoginUserAlreadyExists is
+// returned if the email is registered
+func (w *Warehouse) CreateUserWithIdentity(displayName string, emailVerified bool, identity common.UserIdentity) (*common.User, error) {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	user := common.User{
+		Email:       identity.Email,
+		DisplayName: displayName,
+		Password:    common.NoPassword,
+		Roles:       []string{common.RoleMember},
+		ClubRoles:   map[string]string{},
+	}
+	err = tx.QueryRow(`INSERT INTO user_data (display_name, password, email, email_verified_at)
+		VALUES ($1, $2, $3, CASE WHEN $4 THEN NOW() END)
+		RETURNING id, email_verified_at`, displayName, common.NoPassword, identity.Email, emailVerified).
+		Scan(&user.ID, &user.EmailVerifiedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			err = common.ErrLoginUserAlreadyExists
+		}
+		return nil, err
+	}
+	_, err = tx.Exec(`INSERT INTO user_identity (provider, subject, user_id, email) VALUES ($1, $2, $3, $4)`,
+		identity.Provider, identity.Subject, user.ID, identity.Email)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
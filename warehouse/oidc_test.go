@@ -0,0 +1,178 @@
+package warehouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseCreateOIDCLogin(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	login := common.OIDCLogin{Provider: "test", Nonce: "nonce", CodeVerifier: "verifier", ExpiresAt: time.Now()}
+	mock.ExpectExec("WITH expired AS \\(DELETE FROM oidc_login WHERE expires_at < NOW\\(\\)\\) INSERT INTO oidc_login").
+		WithArgs("stateHash", "test", "nonce", "verifier", login.ExpiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.Nil(t, w.CreateOIDCLogin("stateHash", login))
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseUseOIDCLogin(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		expiresAt     time.Time
+		found         bool
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Uses the login",
+			expiresAt:   time.Now().Add(time.Minute),
+			found:       true,
+		},
+		testData{
+			description:   "Expired login",
+			expectedError: common.ErrOIDCStateInvalid,
+			expiresAt:     time.Now().Add(-time.Minute),
+			found:         true,
+		},
+		testData{
+			description:   "Unknown or used state",
+			expectedError: common.ErrOIDCStateInvalid,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		rows := sqlmock.NewRows([]string{"provider", "nonce", "code_verifier", "expires_at"})
+		if td.found {
+			rows.AddRow("test", "nonce", "verifier", td.expiresAt)
+		}
+		mock.ExpectQuery("DELETE FROM oidc_login WHERE state_hash = \\$1 RETURNING provider, nonce, code_verifier, expires_at").
+			WithArgs("stateHash").
+			WillReturnRows(rows)
+		login, err := w.UseOIDCLogin("stateHash")
+		assert.Equal(t, td.expectedError, err, td.description)
+		if td.expectedError == nil {
+			assert.Equal(t, &common.OIDCLogin{Provider: "test", Nonce: "nonce", CodeVerifier: "verifier", ExpiresAt: td.expiresAt},
+				login, td.description)
+		}
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseGetUserWithIdentity(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	mock.ExpectQuery("SELECT id, email, .+ FROM user_data WHERE id = \\(SELECT user_id FROM user_identity WHERE provider = \\$1 AND subject = \\$2\\) AND deleted_at IS NULL").
+		WithArgs("test", "subject").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "email_verified_at", "password", "display_name", "bio", "totp_secret",
+			"totp_enabled_at", "roles", "club_roles", "time_zone", "pending_email"}).
+			AddRow("userID", "email@example.com", nil, common.NoPassword, "gcarr", "", "", nil, "{member}", `{}`, "UTC", ""))
+	mock.ExpectQuery("SELECT id, email, .+ FROM user_data WHERE id = \\(SELECT user_id FROM user_identity").
+		WithArgs("test", "unknown").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	user, err := w.GetUserWithIdentity("test", "subject")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "userID", user.ID)
+	}
+	_, err = w.GetUserWithIdentity("test", "unknown")
+	assert.Equal(t, common.ErrUserNotFound, err)
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseCreateUserWithIdentity(t *testing.T) {
+	type testData struct {
+		description   string
+		emailVerified bool
+		expectedError error
+		insertError   error
+	}
+
+	testTable := []testData{
+		testData{
+			description:   "Creates a user with a verified email",
+			emailVerified: true,
+		},
+		testData{
+			description: "Creates a user with an unverified email",
+		},
+		testData{
+			description:   "Email already registered",
+			expectedError: common.ErrLoginUserAlreadyExists,
+			insertError:   &pq.Error{Code: "23505"},
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	identity := common.UserIdentity{Provider: "test", Subject: "subject", Email: "email@example.com"}
+	for _, td := range testTable {
+		var verifiedAt *time.Time
+		if td.emailVerified {
+			now := time.Now()
+			verifiedAt = &now
+		}
+		mock.ExpectBegin()
+		expect := mock.ExpectQuery("INSERT INTO user_data \\(display_name, password, email, email_verified_at\\)").
+			WithArgs("gcarr", common.NoPassword, identity.Email, td.emailVerified)
+		if td.insertError != nil {
+			expect.WillReturnError(td.insertError)
+			mock.ExpectRollback()
+		} else {
+			expect.WillReturnRows(sqlmock.NewRows([]string{"id", "email_verified_at"}).AddRow("userID", verifiedAt))
+			mock.ExpectExec("INSERT INTO user_identity \\(provider, subject, user_id, email\\)").
+				WithArgs("test", "subject", "userID", identity.Email).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+		}
+		user, err := w.CreateUserWithIdentity("gcarr", td.emailVerified, identity)
+		assert.Equal(t, td.expectedError, err, td.description)
+		if td.expectedError == nil {
+			assert.Equal(t, &common.User{
+				ID:              "userID",
+				Email:           identity.Email,
+				EmailVerifiedAt: verifiedAt,
+				DisplayName:     "gcarr",
+				Password:        common.NoPassword,
+				Roles:           []string{common.RoleMember},
+				ClubRoles:       map[string]string{},
+			}, user, td.description)
+		}
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
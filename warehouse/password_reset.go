@@ -0,0 +1,67 @@
+package warehouse
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+)
+
+// CreatePasswordReset ...
+func (w *Warehouse) CreatePasswordReset(userID, tokenHash string, expiresAt time.Time) error {
+	_, err := w.DB.Exec(`INSERT INTO password_reset (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)`, userID, tokenHash, expiresAt)
+	return err
+}
+
+// GetPasswordReset ...
+func (w *Warehouse) GetPasswordReset(tokenHash string) (*common.PasswordReset, error) {
+	pr := common.PasswordReset{}
+	sqlStatement := `SELECT id, user_id, expires_at, used_at
+		FROM password_reset
+		WHERE token_hash = $1`
+	err := w.DB.QueryRow(sqlStatement, tokenHash).Scan(&pr.ID, &pr.UserID, &pr.ExpiresAt, &pr.UsedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, common.ErrPasswordResetNotFound
+		}
+		return nil, err
+	}
+	return &pr, nil
+}
+
+// ResetPassword uses up the reset token, sets the new password and ends every existing session of
+// the user in one transaction. ErrPasswordResetNotFound is returned if the token was already used
+func (w *Warehouse) ResetPassword(pr *common.PasswordReset, hashedPassword string) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	res, err := tx.Exec(`UPDATE password_reset SET used_at = NOW()
+		WHERE id = $1 AND used_at IS NULL`, pr.ID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		err = common.ErrPasswordResetNotFound
+		return err
+	}
+	if _, err = tx.Exec(`UPDATE user_data SET password = $1, sessions_revoked_at = NOW(), updated_at = NOW()
+		WHERE id = $2`, hashedPassword, pr.UserID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`UPDATE refresh_token SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL`, pr.UserID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
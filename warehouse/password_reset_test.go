@@ -0,0 +1,63 @@
+package warehouse
+
+import (
+	"testing"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseResetPassword(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		rowsAffected  int64
+	}
+
+	testTable := []testData{
+		testData{
+			description:  "Resets the password and ends the sessions",
+			rowsAffected: 1,
+		},
+		testData{
+			description:   "Reset token was already used",
+			expectedError: common.ErrPasswordResetNotFound,
+			rowsAffected:  0,
+		},
+	}
+	pr := &common.PasswordReset{
+		ID:     "resetID",
+		UserID: "userID",
+	}
+	for _, td := range testTable {
+		w := Warehouse{}
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		w.DB = db
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE password_reset SET used_at = NOW\\(\\) WHERE id = \\$1 AND used_at IS NULL").
+			WithArgs(pr.ID).
+			WillReturnResult(sqlmock.NewResult(0, td.rowsAffected))
+		if td.expectedError == nil {
+			mock.ExpectExec("UPDATE user_data SET password = \\$1, sessions_revoked_at = NOW\\(\\), updated_at = NOW\\(\\) WHERE id = \\$2").
+				WithArgs("hashedPassword", pr.UserID).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE refresh_token SET revoked_at = NOW\\(\\) WHERE user_id = \\$1 AND revoked_at IS NULL").
+				WithArgs(pr.UserID).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectCommit()
+		} else {
+			mock.ExpectRollback()
+		}
+
+		err = w.ResetPassword(pr, "hashedPassword")
+		assert.Equal(t, td.expectedError, err, td.description)
+		if err = mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectation error for %q: %s", td.description, err)
+		}
+		db.Close()
+	}
+}
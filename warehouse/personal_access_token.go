@@ -0,0 +1,83 @@
+package warehouse
+
+import (
+	"database/sql"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+)
+
+// CreatePersonalAccessToken stores the hash of a new personal access token, the id and creation time
+// are set on pat
+func (w *Warehouse) CreatePersonalAccessToken(pat *common.PersonalAccessToken, tokenHash string) error {
+	return w.DB.QueryRow(`INSERT INTO personal_access_token (user_id, name, scopes, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`, pat.UserID, pat.Name, pq.Array(pat.Scopes), tokenHash, pat.ExpiresAt).
+		Scan(&pat.ID, &pat.CreatedAt)
+}
+
+// ListPersonalAccessTokens returns the tokens of the user that have not been revoked, newest first.
+// Expired tokens are included so the user can see them
+func (w *Warehouse) ListPersonalAccessTokens(userID string) ([]common.PersonalAccessToken, error) {
+	rows, err := w.DB.Query(`SELECT id, user_id, name, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_token
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pats := []common.PersonalAccessToken{}
+	for rows.Next() {
+		pat, err := scanPersonalAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		pats = append(pats, *pat)
+	}
+	return pats, rows.Err()
+}
+
+// RevokePersonalAccessToken stops the token of the user from being used
+func (w *Warehouse) RevokePersonalAccessToken(userID, id string) error {
+	res, err := w.DB.Exec(`UPDATE personal_access_token SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, id, userID)
+	if err != nil {
+		return personalAccessTokenError(err)
+	}
+	return expectRowsAffected(res, common.ErrPersonalAccessTokenNotFound)
+}
+
+// UsePersonalAccessToken returns the token with the hash and records that it was used.
+// ErrPersonalAccessTokenNotFound is returned for unknown, revoked or expired tokens
+func (w *Warehouse) UsePersonalAccessToken(tokenHash string) (*common.PersonalAccessToken, error) {
+	pat, err := scanPersonalAccessToken(w.DB.QueryRow(`UPDATE personal_access_token SET last_used_at = NOW()
+		WHERE token_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+		RETURNING id, user_id, name, scopes, expires_at, last_used_at, created_at`, tokenHash))
+	if err == sql.ErrNoRows {
+		return nil, common.ErrPersonalAccessTokenNotFound
+	}
+	return pat, err
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPersonalAccessToken(row scanner) (*common.PersonalAccessToken, error) {
+	pat := common.PersonalAccessToken{}
+	err := row.Scan(&pat.ID, &pat.UserID, &pat.Name, pq.Array(&pat.Scopes), &pat.ExpiresAt, &pat.LastUsedAt, &pat.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &pat, nil
+}
+
+// personalAccessTokenError turns the error for an id that is not a uuid into ErrPersonalAccessTokenNotFound
+func personalAccessTokenError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "invalid_text_representation" {
+		return common.ErrPersonalAccessTokenNotFound
+	}
+	return err
+}
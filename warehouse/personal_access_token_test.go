@@ -0,0 +1,156 @@
+package warehouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var personalAccessTokenColumns = []string{"id", "user_id", "name", "scopes", "expires_at", "last_used_at", "created_at"}
+
+func TestWarehouseCreatePersonalAccessToken(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	createdAt := time.Now()
+	pat := &common.PersonalAccessToken{UserID: "userID", Name: "deploy script", Scopes: []string{common.PermissionClubRead}}
+	mock.ExpectQuery("INSERT INTO personal_access_token \\(user_id, name, scopes, token_hash, expires_at\\)").
+		WithArgs("userID", "deploy script", sqlmock.AnyArg(), "tokenHash", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("patID", createdAt))
+
+	assert.Nil(t, w.CreatePersonalAccessToken(pat, "tokenHash"))
+	assert.Equal(t, "patID", pat.ID)
+	assert.Equal(t, createdAt, pat.CreatedAt)
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseListPersonalAccessTokens(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	createdAt := time.Now()
+	mock.ExpectQuery("SELECT id, user_id, name, scopes, expires_at, last_used_at, created_at FROM personal_access_token WHERE user_id = \\$1 AND revoked_at IS NULL").
+		WithArgs("userID").
+		WillReturnRows(sqlmock.NewRows(personalAccessTokenColumns).
+			AddRow("patID", "userID", "deploy script", "{club:read,club:manage}", nil, createdAt, createdAt))
+
+	pats, err := w.ListPersonalAccessTokens("userID")
+	assert.Nil(t, err)
+	assert.Equal(t, []common.PersonalAccessToken{
+		common.PersonalAccessToken{
+			ID:         "patID",
+			UserID:     "userID",
+			Name:       "deploy script",
+			Scopes:     []string{common.PermissionClubRead, common.PermissionClubManage},
+			LastUsedAt: &createdAt,
+			CreatedAt:  createdAt,
+		},
+	}, pats)
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseRevokePersonalAccessToken(t *testing.T) {
+	type testData struct {
+		description   string
+		execError     error
+		expectedError error
+		rowsAffected  int64
+	}
+
+	testTable := []testData{
+		testData{
+			description:  "Revokes the token",
+			rowsAffected: 1,
+		},
+		testData{
+			description:   "Unknown, revoked or another user's token",
+			expectedError: common.ErrPersonalAccessTokenNotFound,
+		},
+		testData{
+			description:   "Id that is not a uuid",
+			execError:     &pq.Error{Code: "22P02"},
+			expectedError: common.ErrPersonalAccessTokenNotFound,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		expect := mock.ExpectExec("UPDATE personal_access_token SET revoked_at = NOW\\(\\) WHERE id = \\$1 AND user_id = \\$2").
+			WithArgs("patID", "userID")
+		if td.execError != nil {
+			expect.WillReturnError(td.execError)
+		} else {
+			expect.WillReturnResult(sqlmock.NewResult(0, td.rowsAffected))
+		}
+		assert.Equal(t, td.expectedError, w.RevokePersonalAccessToken("userID", "patID"), td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseUsePersonalAccessToken(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		found         bool
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Records the use of the token",
+			found:       true,
+		},
+		testData{
+			description:   "Unknown, revoked or expired token",
+			expectedError: common.ErrPersonalAccessTokenNotFound,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	now := time.Now()
+	for _, td := range testTable {
+		rows := sqlmock.NewRows(personalAccessTokenColumns)
+		if td.found {
+			rows.AddRow("patID", "userID", "deploy script", "{club:read}", nil, now, now)
+		}
+		mock.ExpectQuery("UPDATE personal_access_token SET last_used_at = NOW\\(\\) WHERE token_hash = \\$1 AND revoked_at IS NULL AND \\(expires_at IS NULL OR expires_at > NOW\\(\\)\\)").
+			WithArgs("tokenHash").
+			WillReturnRows(rows)
+		pat, err := w.UsePersonalAccessToken("tokenHash")
+		assert.Equal(t, td.expectedError, err, td.description)
+		if td.found && assert.NotNil(t, pat, td.description) {
+			assert.Equal(t, "userID", pat.UserID, td.description)
+			assert.Equal(t, &now, pat.LastUsedAt, td.description)
+		}
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
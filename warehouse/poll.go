@@ -0,0 +1,382 @@
+package warehouse
+
+import (
+	"database/sql"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+)
+
+// nominationColumns are selected by every nomination query and read by scanNomination
+const nominationColumns = `nomination.id, nomination.club_id, nomination.book_id, book.title, nomination.nominated_by,
+		user_data.display_name, nomination.note, nomination.created_at`
+
+// nominationTables are the tables every nomination query selects from
+const nominationTables = `nomination JOIN book ON book.id = nomination.book_id
+		JOIN user_data ON user_data.id = nomination.nominated_by`
+
+// pollStatus is the status of a poll. It is worked out by the database so it agrees with the checks
+// made when ballots are cast
+const pollStatus = `CASE WHEN NOW() < opens_at THEN 'upcoming' WHEN NOW() < closes_at THEN 'open' ELSE 'closed' END`
+
+// pollColumns are selected by every poll query and read by scanPoll
+const pollColumns = `id, club_id, title, method, opens_at, closes_at, hide_results, ` + pollStatus + `,
+		created_by, created_at, updated_at`
+
+// pollOpen is true for a poll that can be voted in
+const pollOpen = `poll.opens_at <= NOW() AND poll.closes_at > NOW()`
+
+// CreateNomination nominates the book in the club, the id and created_at are set on nomination.
+// ErrNominationAlreadyExists is returned if the book has already been nominated in the club
+func (w *Warehouse) CreateNomination(nomination *common.Nomination) error {
+	err := w.DB.QueryRow(`INSERT INTO nomination (club_id, book_id, nominated_by, note)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`, nomination.ClubID, nomination.BookID, nomination.NominatedBy, nomination.Note).
+		Scan(&nomination.ID, &nomination.CreatedAt)
+	return nominationError(err)
+}
+
+// GetNomination returns ErrNominationNotFound for an unknown nomination, or one of another club
+func (w *Warehouse) GetNomination(clubID, id string) (*common.Nomination, error) {
+	nomination, err := scanNomination(w.DB.QueryRow(`SELECT `+nominationColumns+` FROM `+nominationTables+`
+		WHERE nomination.id = $1 AND nomination.club_id = $2`, id, clubID))
+	if err != nil {
+		return nil, nominationError(err)
+	}
+	return nomination, nil
+}
+
+// ListNominations returns a page of the nominations of the club in the order they were made, and how
+// many there are in total
+func (w *Warehouse) ListNominations(clubID string, p common.Pagination) ([]common.Nomination, int, error) {
+	var total int
+	if err := w.DB.QueryRow(`SELECT COUNT(*) FROM nomination WHERE club_id = $1`, clubID).Scan(&total); err != nil {
+		return nil, 0, clubError(err)
+	}
+	rows, err := w.DB.Query(`SELECT `+nominationColumns+` FROM `+nominationTables+`
+		WHERE nomination.club_id = $1
+		ORDER BY nomination.created_at, nomination.id
+		LIMIT $2 OFFSET $3`, clubID, p.Limit, p.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	nominations := []common.Nomination{}
+	for rows.Next() {
+		nomination, err := scanNomination(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		nominations = append(nominations, *nomination)
+	}
+	return nominations, total, rows.Err()
+}
+
+// DeleteNomination withdraws the nomination of the club, polls it is already in keep the book
+func (w *Warehouse) DeleteNomination(clubID, id string) error {
+	res, err := w.DB.Exec(`DELETE FROM nomination WHERE id = $1 AND club_id = $2`, id, clubID)
+	if err != nil {
+		return nominationError(err)
+	}
+	return expectRowsAffected(res, common.ErrNominationNotFound)
+}
+
+// CreatePoll adds the poll with its options in one transaction. The options are the books of bookIDs
+// in that order, or every nomination of the club in the order they were nominated when bookIDs is
+// empty. ErrPollOptionNotNominated is returned for a book that is not nominated in the club and
+// ErrPollTooFewOptions when there are not enough. The id, options, status and times are set on poll
+func (w *Warehouse) CreatePoll(poll *common.Poll, bookIDs []string) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	err = tx.QueryRow(`INSERT INTO poll (club_id, title, method, opens_at, closes_at, hide_results, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, `+pollStatus+`, created_at, updated_at`, poll.ClubID, poll.Title, poll.Method, poll.OpensAt,
+		poll.ClosesAt, poll.HideResults, poll.CreatedBy).Scan(&poll.ID, &poll.Status, &poll.CreatedAt, &poll.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	var res sql.Result
+	if len(bookIDs) == 0 {
+		res, err = tx.Exec(`INSERT INTO poll_option (poll_id, book_id, position)
+			SELECT $1, book_id, ROW_NUMBER() OVER (ORDER BY created_at, id) FROM nomination
+			WHERE club_id = $2`, poll.ID, poll.ClubID)
+	} else {
+		res, err = tx.Exec(`INSERT INTO poll_option (poll_id, book_id, position)
+			SELECT $1, nomination.book_id, chosen.position
+			FROM unnest($3::uuid[]) WITH ORDINALITY AS chosen (book_id, position)
+			JOIN nomination ON nomination.book_id = chosen.book_id AND nomination.club_id = $2`,
+			poll.ID, poll.ClubID, pq.Array(bookIDs))
+	}
+	if err != nil {
+		err = pollOptionError(err)
+		return err
+	}
+	var added int64
+	if added, err = res.RowsAffected(); err != nil {
+		return err
+	}
+	if len(bookIDs) > 0 && int(added) != len(bookIDs) {
+		err = common.ErrPollOptionNotNominated
+		return err
+	}
+	if added < common.MinPollOptions {
+		err = common.ErrPollTooFewOptions
+		return err
+	}
+	polls := []common.Poll{*poll}
+	if err = loadPollOptions(tx.Query, polls); err != nil {
+		return err
+	}
+	poll.Options = polls[0].Options
+	err = tx.Commit()
+	return err
+}
+
+// GetPoll returns the poll with its options, ErrPollNotFound is returned for an unknown poll or one of
+// another club
+func (w *Warehouse) GetPoll(clubID, id string) (*common.Poll, error) {
+	poll, err := scanPoll(w.DB.QueryRow(`SELECT `+pollColumns+` FROM poll WHERE id = $1 AND club_id = $2`, id, clubID))
+	if err != nil {
+		return nil, pollError(err)
+	}
+	polls := []common.Poll{*poll}
+	if err = loadPollOptions(w.DB.Query, polls); err != nil {
+		return nil, err
+	}
+	return &polls[0], nil
+}
+
+// ListPolls returns a page of the polls of the club with their options, the latest to close first,
+// and how many there are in total
+func (w *Warehouse) ListPolls(clubID string, p common.Pagination) ([]common.Poll, int, error) {
+	var total int
+	if err := w.DB.QueryRow(`SELECT COUNT(*) FROM poll WHERE club_id = $1`, clubID).Scan(&total); err != nil {
+		return nil, 0, clubError(err)
+	}
+	rows, err := w.DB.Query(`SELECT `+pollColumns+` FROM poll
+		WHERE club_id = $1
+		ORDER BY closes_at DESC, id
+		LIMIT $2 OFFSET $3`, clubID, p.Limit, p.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	polls := []common.Poll{}
+	for rows.Next() {
+		poll, err := scanPoll(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		polls = append(polls, *poll)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if err = loadPollOptions(w.DB.Query, polls); err != nil {
+		return nil, 0, err
+	}
+	return polls, total, nil
+}
+
+// ClosePoll closes an open poll now rather than at its close time, the times and status are set on
+// poll. ErrPollNotOpen is returned for a poll that has not opened or has already closed
+func (w *Warehouse) ClosePoll(poll *common.Poll) error {
+	err := w.DB.QueryRow(`UPDATE poll SET closes_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND club_id = $2 AND `+pollOpen+`
+		RETURNING closes_at, updated_at`, poll.ID, poll.ClubID).Scan(&poll.ClosesAt, &poll.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return common.ErrPollNotOpen
+		}
+		return pollError(err)
+	}
+	poll.ClosesAt = poll.ClosesAt.UTC()
+	poll.Status = common.PollStatusClosed
+	return nil
+}
+
+// DeletePoll removes the poll of the club with its options and ballots
+func (w *Warehouse) DeletePoll(clubID, id string) error {
+	res, err := w.DB.Exec(`DELETE FROM poll WHERE id = $1 AND club_id = $2`, id, clubID)
+	if err != nil {
+		return pollError(err)
+	}
+	return expectRowsAffected(res, common.ErrPollNotFound)
+}
+
+// SetBallot casts the ballot of the user or replaces the one they cast, the times are set on ballot.
+// The choices are checked against the poll by the caller. ErrPollNotOpen is returned once the poll has
+// closed, so no ballot is counted after the close time
+func (w *Warehouse) SetBallot(ballot *common.Ballot) error {
+	err := w.DB.QueryRow(`INSERT INTO poll_ballot (poll_id, user_id, choices)
+		SELECT poll.id, $2, $3 FROM poll WHERE poll.id = $1 AND `+pollOpen+`
+		ON CONFLICT (poll_id, user_id) DO UPDATE SET choices = EXCLUDED.choices, updated_at = NOW()
+		RETURNING created_at, updated_at`, ballot.PollID, ballot.UserID, pq.Array(ballot.Choices)).
+		Scan(&ballot.CreatedAt, &ballot.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return common.ErrPollNotOpen
+		}
+		return pollError(err)
+	}
+	return nil
+}
+
+// GetBallot returns the ballot the user cast in the poll
+func (w *Warehouse) GetBallot(pollID, userID string) (*common.Ballot, error) {
+	ballot, err := scanBallot(w.DB.QueryRow(`SELECT poll_id, user_id::text, choices, created_at, updated_at
+		FROM poll_ballot WHERE poll_id = $1 AND user_id = $2`, pollID, userID))
+	if err != nil {
+		return nil, ballotError(err)
+	}
+	return ballot, nil
+}
+
+// DeleteBallot takes back the ballot of the user while the poll is open, ErrBallotNotFound is returned
+// when the user has not voted or the poll has closed
+func (w *Warehouse) DeleteBallot(pollID, userID string) error {
+	res, err := w.DB.Exec(`DELETE FROM poll_ballot USING poll
+		WHERE poll_ballot.poll_id = $1 AND poll_ballot.user_id = $2
+			AND poll.id = poll_ballot.poll_id AND `+pollOpen, pollID, userID)
+	if err != nil {
+		return ballotError(err)
+	}
+	return expectRowsAffected(res, common.ErrBallotNotFound)
+}
+
+// ListBallots returns every ballot cast in the poll, to be tallied
+func (w *Warehouse) ListBallots(pollID string) ([]common.Ballot, error) {
+	rows, err := w.DB.Query(`SELECT poll_id, COALESCE(user_id::text, ''), choices, created_at, updated_at
+		FROM poll_ballot WHERE poll_id = $1 ORDER BY created_at, id`, pollID)
+	if err != nil {
+		return nil, pollError(err)
+	}
+	defer rows.Close()
+	ballots := []common.Ballot{}
+	for rows.Next() {
+		ballot, err := scanBallot(rows)
+		if err != nil {
+			return nil, err
+		}
+		ballots = append(ballots, *ballot)
+	}
+	return ballots, rows.Err()
+}
+
+// loadPollOptions sets the options on each of the polls in the order they are voted on, query is
+// the Query of the database or of a transaction
+func loadPollOptions(query func(string, ...interface{}) (*sql.Rows, error), polls []common.Poll) error {
+	if len(polls) == 0 {
+		return nil
+	}
+	index := map[string]int{}
+	ids := []string{}
+	for i := range polls {
+		index[polls[i].ID] = i
+		ids = append(ids, polls[i].ID)
+		polls[i].Options = []common.PollOption{}
+	}
+	rows, err := query(`SELECT poll_option.poll_id, poll_option.book_id, book.title
+		FROM poll_option JOIN book ON book.id = poll_option.book_id
+		WHERE poll_option.poll_id = ANY($1::uuid[])
+		ORDER BY poll_option.poll_id, poll_option.position`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pollID string
+		o := common.PollOption{}
+		if err = rows.Scan(&pollID, &o.BookID, &o.Title); err != nil {
+			return err
+		}
+		i := index[pollID]
+		polls[i].Options = append(polls[i].Options, o)
+	}
+	return rows.Err()
+}
+
+func scanNomination(row scanner) (*common.Nomination, error) {
+	n := common.Nomination{}
+	err := row.Scan(&n.ID, &n.ClubID, &n.BookID, &n.BookTitle, &n.NominatedBy, &n.DisplayName, &n.Note, &n.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func scanPoll(row scanner) (*common.Poll, error) {
+	p := common.Poll{}
+	err := row.Scan(&p.ID, &p.ClubID, &p.Title, &p.Method, &p.OpensAt, &p.ClosesAt, &p.HideResults, &p.Status,
+		&p.CreatedBy, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	// The times are stored without a time zone, they are always UTC
+	p.OpensAt, p.ClosesAt = p.OpensAt.UTC(), p.ClosesAt.UTC()
+	return &p, nil
+}
+
+func scanBallot(row scanner) (*common.Ballot, error) {
+	b := common.Ballot{}
+	if err := row.Scan(&b.PollID, &b.UserID, pq.Array(&b.Choices), &b.CreatedAt, &b.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// nominationError turns the errors for a missing nomination, an id that is not a uuid, a book
+// nominated twice and a book that is not in the catalog into the errors the handlers expect
+func nominationError(err error) error {
+	if err == sql.ErrNoRows {
+		return common.ErrNominationNotFound
+	}
+	if pqErr, ok := err.(*pq.Error); ok {
+		switch pqErr.Code.Name() {
+		case "unique_violation":
+			return common.ErrNominationAlreadyExists
+		case "invalid_text_representation":
+			return common.ErrNominationNotFound
+		}
+	}
+	return bookReferenceError(err)
+}
+
+// pollError turns the errors for a missing poll, or an id that is not a uuid, into ErrPollNotFound
+func pollError(err error) error {
+	if err == sql.ErrNoRows {
+		return common.ErrPollNotFound
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "invalid_text_representation" {
+		return common.ErrPollNotFound
+	}
+	return err
+}
+
+// pollOptionError turns the error for a book id that is not a uuid into ErrPollOptionNotNominated, as
+// it can not be a nominated book
+func pollOptionError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "invalid_text_representation" {
+		return common.ErrPollOptionNotNominated
+	}
+	return err
+}
+
+// ballotError turns the errors for a missing ballot, or a poll id that is not a uuid, into
+// ErrBallotNotFound
+func ballotError(err error) error {
+	if err == sql.ErrNoRows {
+		return common.ErrBallotNotFound
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "invalid_text_representation" {
+		return common.ErrBallotNotFound
+	}
+	return err
+}
@@ -0,0 +1,155 @@
+package warehouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseCreatePoll(t *testing.T) {
+	type testData struct {
+		description   string
+		added         int64
+		bookIDs       []string
+		expectedError error
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Every nomination",
+			added:       3,
+		},
+		testData{
+			description: "Chosen books",
+			added:       2,
+			bookIDs:     []string{"otherBookID", "bookID"},
+		},
+		testData{
+			description:   "A chosen book is not nominated",
+			added:         1,
+			bookIDs:       []string{"otherBookID", "bookID"},
+			expectedError: common.ErrPollOptionNotNominated,
+		},
+		testData{
+			description:   "Not enough nominations",
+			added:         1,
+			expectedError: common.ErrPollTooFewOptions,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	closesAt := createdAt.Add(72 * time.Hour)
+	for _, td := range testTable {
+		poll := &common.Poll{ClubID: "clubID", Title: "Next book", Method: common.PollMethodRanked, OpensAt: createdAt,
+			ClosesAt: closesAt, CreatedBy: "userID"}
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO poll \\(club_id, title, method, opens_at, closes_at, hide_results, created_by\\)").
+			WithArgs("clubID", "Next book", common.PollMethodRanked, createdAt, closesAt, false, "userID").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "status", "created_at", "updated_at"}).
+				AddRow("pollID", common.PollStatusOpen, createdAt, createdAt))
+		if td.bookIDs == nil {
+			mock.ExpectExec("INSERT INTO poll_option \\(poll_id, book_id, position\\)\\s+SELECT .+ FROM nomination").
+				WithArgs("pollID", "clubID").
+				WillReturnResult(sqlmock.NewResult(0, td.added))
+		} else {
+			mock.ExpectExec("INSERT INTO poll_option \\(poll_id, book_id, position\\)\\s+SELECT .+ unnest").
+				WithArgs("pollID", "clubID", pq.Array(td.bookIDs)).
+				WillReturnResult(sqlmock.NewResult(0, td.added))
+		}
+		if td.expectedError != nil {
+			mock.ExpectRollback()
+		} else {
+			rows := sqlmock.NewRows([]string{"poll_id", "book_id", "title"})
+			for i := int64(0); i < td.added; i++ {
+				rows.AddRow("pollID", "bookID", "Dune")
+			}
+			mock.ExpectQuery("SELECT poll_option.poll_id, poll_option.book_id, book.title").
+				WithArgs(pq.Array([]string{"pollID"})).
+				WillReturnRows(rows)
+			mock.ExpectCommit()
+		}
+
+		assert.Equal(t, td.expectedError, w.CreatePoll(poll, td.bookIDs), td.description)
+		if td.expectedError == nil {
+			assert.Equal(t, "pollID", poll.ID, td.description)
+			assert.Equal(t, common.PollStatusOpen, poll.Status, td.description)
+			assert.Len(t, poll.Options, int(td.added), td.description)
+		}
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseSetBallot(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		open          bool
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Open poll",
+			open:        true,
+		},
+		testData{
+			description:   "Closed poll",
+			expectedError: common.ErrPollNotOpen,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	castAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, td := range testTable {
+		ballot := &common.Ballot{PollID: "pollID", UserID: "userID", Choices: []string{"bookID", "otherBookID"}}
+		rows := sqlmock.NewRows([]string{"created_at", "updated_at"})
+		if td.open {
+			rows.AddRow(castAt, castAt)
+		}
+		mock.ExpectQuery("INSERT INTO poll_ballot \\(poll_id, user_id, choices\\)\\s+SELECT .+ AND poll.opens_at <= NOW\\(\\) AND poll.closes_at > NOW\\(\\)\\s+ON CONFLICT").
+			WithArgs("pollID", "userID", pq.Array(ballot.Choices)).
+			WillReturnRows(rows)
+
+		assert.Equal(t, td.expectedError, w.SetBallot(ballot), td.description)
+		if td.open {
+			assert.Equal(t, castAt, ballot.UpdatedAt, td.description)
+		}
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseClosePollNotOpen(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	mock.ExpectQuery("UPDATE poll SET closes_at = NOW\\(\\), updated_at = NOW\\(\\)").
+		WithArgs("pollID", "clubID").
+		WillReturnRows(sqlmock.NewRows([]string{"closes_at", "updated_at"}))
+
+	assert.Equal(t, common.ErrPollNotOpen, w.ClosePoll(&common.Poll{ID: "pollID", ClubID: "clubID"}))
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
@@ -0,0 +1,214 @@
+package warehouse
+
+import (
+	"database/sql"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+)
+
+// readingPlanColumns are selected by every reading plan query and read by scanReadingPlan
+const readingPlanColumns = `id, club_id, book_id, unit, created_by, created_at, updated_at`
+
+// readingPlanSectionColumns are selected by every section query and read by scanReadingPlanSection
+const readingPlanSectionColumns = `reading_plan_section.id, reading_plan_section.position, reading_plan_section.title,
+		reading_plan_section.range_start, reading_plan_section.range_end,
+		to_char(reading_plan_section.due_date, 'YYYY-MM-DD')`
+
+// CreateReadingPlan adds the plan and its sections in one transaction, the id and times are set on plan
+func (w *Warehouse) CreateReadingPlan(plan *common.ReadingPlan) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	err = tx.QueryRow(`INSERT INTO reading_plan (club_id, book_id, unit, created_by) VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at`, plan.ClubID, plan.BookID, plan.Unit, plan.CreatedBy).
+		Scan(&plan.ID, &plan.CreatedAt, &plan.UpdatedAt)
+	if err != nil {
+		err = bookReferenceError(err)
+		return err
+	}
+	for i := range plan.Sections {
+		// The sections of a new plan are all new, whatever ids were given
+		plan.Sections[i].ID = ""
+		if err = saveReadingPlanSection(tx, plan.ID, &plan.Sections[i]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetReadingPlan returns ErrReadingPlanNotFound for an unknown plan, or one of another club
+func (w *Warehouse) GetReadingPlan(clubID, id string) (*common.ReadingPlan, error) {
+	plan, err := scanReadingPlan(w.DB.QueryRow(`SELECT `+readingPlanColumns+` FROM reading_plan
+		WHERE id = $1 AND club_id = $2`, id, clubID))
+	if err != nil {
+		return nil, readingPlanError(err)
+	}
+	rows, err := w.DB.Query(`SELECT `+readingPlanSectionColumns+` FROM reading_plan_section
+		WHERE plan_id = $1 ORDER BY position`, plan.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		s, err := scanReadingPlanSection(rows)
+		if err != nil {
+			return nil, err
+		}
+		plan.Sections = append(plan.Sections, *s)
+	}
+	return plan, rows.Err()
+}
+
+// ListReadingPlans returns the reading plans of the club with their sections, newest first
+func (w *Warehouse) ListReadingPlans(clubID string) ([]common.ReadingPlan, error) {
+	rows, err := w.DB.Query(`SELECT `+readingPlanColumns+` FROM reading_plan
+		WHERE club_id = $1 ORDER BY created_at DESC, id`, clubID)
+	if err != nil {
+		return nil, clubError(err)
+	}
+	defer rows.Close()
+	plans := []common.ReadingPlan{}
+	index := map[string]int{}
+	for rows.Next() {
+		plan, err := scanReadingPlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[plan.ID] = len(plans)
+		plans = append(plans, *plan)
+	}
+	if err = rows.Err(); err != nil || len(plans) == 0 {
+		return plans, err
+	}
+	sectionRows, err := w.DB.Query(`SELECT reading_plan_section.plan_id, `+readingPlanSectionColumns+`
+		FROM reading_plan_section JOIN reading_plan ON reading_plan.id = reading_plan_section.plan_id
+		WHERE reading_plan.club_id = $1
+		ORDER BY reading_plan_section.plan_id, reading_plan_section.position`, clubID)
+	if err != nil {
+		return nil, err
+	}
+	defer sectionRows.Close()
+	for sectionRows.Next() {
+		var planID string
+		s := common.ReadingPlanSection{}
+		if err = sectionRows.Scan(&planID, &s.ID, &s.Position, &s.Title, &s.Start, &s.End, &s.DueDate); err != nil {
+			return nil, err
+		}
+		// A plan added since the first query is left out
+		if i, ok := index[planID]; ok {
+			plans[i].Sections = append(plans[i].Sections, s)
+		}
+	}
+	return plans, sectionRows.Err()
+}
+
+// UpdateReadingPlan replaces the book, unit and sections of the plan in one transaction, updated_at
+// and the ids of new sections are set on plan. Sections with an id keep it and the sections of the plan
+// left out are removed. ErrReadingPlanSectionNotFound is returned for an id that is not a section of
+// the plan
+func (w *Warehouse) UpdateReadingPlan(plan *common.ReadingPlan) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	err = tx.QueryRow(`UPDATE reading_plan SET book_id = $1, unit = $2, updated_at = NOW()
+		WHERE id = $3 AND club_id = $4
+		RETURNING updated_at`, plan.BookID, plan.Unit, plan.ID, plan.ClubID).Scan(&plan.UpdatedAt)
+	if err != nil {
+		err = bookReferenceError(readingPlanError(err))
+		return err
+	}
+	kept := []string{}
+	for _, s := range plan.Sections {
+		if s.ID != "" {
+			kept = append(kept, s.ID)
+		}
+	}
+	_, err = tx.Exec(`DELETE FROM reading_plan_section WHERE plan_id = $1 AND NOT (id = ANY($2::uuid[]))`,
+		plan.ID, pq.Array(kept))
+	if err != nil {
+		err = readingPlanSectionError(err)
+		return err
+	}
+	for i := range plan.Sections {
+		if err = saveReadingPlanSection(tx, plan.ID, &plan.Sections[i]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteReadingPlan removes the plan of the club and its sections
+func (w *Warehouse) DeleteReadingPlan(clubID, id string) error {
+	res, err := w.DB.Exec(`DELETE FROM reading_plan WHERE id = $1 AND club_id = $2`, id, clubID)
+	if err != nil {
+		return readingPlanError(err)
+	}
+	return expectRowsAffected(res, common.ErrReadingPlanNotFound)
+}
+
+// saveReadingPlanSection adds the section to the plan, setting its id, or updates it when it has an id.
+// Positions are only checked to be unique when the transaction commits, so sections can change places
+func saveReadingPlanSection(tx *sql.Tx, planID string, s *common.ReadingPlanSection) error {
+	if s.ID == "" {
+		return tx.QueryRow(`INSERT INTO reading_plan_section (plan_id, position, title, range_start, range_end, due_date)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id`, planID, s.Position, s.Title, s.Start, s.End, s.DueDate).Scan(&s.ID)
+	}
+	res, err := tx.Exec(`UPDATE reading_plan_section SET position = $3, title = $4, range_start = $5, range_end = $6,
+			due_date = $7
+		WHERE id = $1 AND plan_id = $2`, s.ID, planID, s.Position, s.Title, s.Start, s.End, s.DueDate)
+	if err != nil {
+		return readingPlanSectionError(err)
+	}
+	return expectRowsAffected(res, common.ErrReadingPlanSectionNotFound)
+}
+
+func scanReadingPlan(row scanner) (*common.ReadingPlan, error) {
+	p := common.ReadingPlan{Sections: []common.ReadingPlanSection{}}
+	if err := row.Scan(&p.ID, &p.ClubID, &p.BookID, &p.Unit, &p.CreatedBy, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func scanReadingPlanSection(row scanner) (*common.ReadingPlanSection, error) {
+	s := common.ReadingPlanSection{}
+	if err := row.Scan(&s.ID, &s.Position, &s.Title, &s.Start, &s.End, &s.DueDate); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// readingPlanError turns the errors for a missing plan, or an id that is not a uuid, into
+// ErrReadingPlanNotFound
+func readingPlanError(err error) error {
+	if err == sql.ErrNoRows {
+		return common.ErrReadingPlanNotFound
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "invalid_text_representation" {
+		return common.ErrReadingPlanNotFound
+	}
+	return err
+}
+
+// readingPlanSectionError turns the error for a section id that is not a uuid into
+// ErrReadingPlanSectionNotFound
+func readingPlanSectionError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "invalid_text_representation" {
+		return common.ErrReadingPlanSectionNotFound
+	}
+	return err
+}
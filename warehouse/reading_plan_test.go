@@ -0,0 +1,177 @@
+package warehouse
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseCreateReadingPlan(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	plan := &common.ReadingPlan{ClubID: "clubID", BookID: "bookID", Unit: common.ReadingPlanUnitChapter, CreatedBy: "userID",
+		Sections: []common.ReadingPlanSection{
+			{ID: "copiedSectionID", Position: 1, Title: "Chapters 1 to 8", Start: 1, End: 8, DueDate: "2030-03-12"},
+			{Position: 2, Title: "Chapters 9 to 20", Start: 9, End: 20, DueDate: "2030-03-26"},
+		}}
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO reading_plan \\(club_id, book_id, unit, created_by\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\)").
+		WithArgs("clubID", "bookID", common.ReadingPlanUnitChapter, "userID").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("planID", createdAt, createdAt))
+	// Ids given for the sections of a new plan are not kept
+	for _, s := range plan.Sections {
+		mock.ExpectQuery("INSERT INTO reading_plan_section \\(plan_id, position, title, range_start, range_end, due_date\\)").
+			WithArgs("planID", s.Position, s.Title, s.Start, s.End, s.DueDate).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(fmt.Sprintf("sectionID%d", s.Position)))
+	}
+	mock.ExpectCommit()
+
+	assert.Nil(t, w.CreateReadingPlan(plan))
+	assert.Equal(t, "planID", plan.ID)
+	assert.Equal(t, createdAt, plan.CreatedAt)
+	assert.Equal(t, "sectionID1", plan.Sections[0].ID)
+	assert.Equal(t, "sectionID2", plan.Sections[1].ID)
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseListReadingPlans(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	mock.ExpectQuery("SELECT id, club_id, book_id, unit, created_by, created_at, updated_at FROM reading_plan\\s+WHERE club_id = \\$1").
+		WithArgs("clubID").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "club_id", "book_id", "unit", "created_by", "created_at", "updated_at"}).
+			AddRow("newPlanID", "clubID", "bookID", "page", "userID", createdAt, createdAt).
+			AddRow("oldPlanID", "clubID", "otherBookID", "chapter", "userID", createdAt, createdAt))
+	mock.ExpectQuery("SELECT reading_plan_section.plan_id, reading_plan_section.id, reading_plan_section.position").
+		WithArgs("clubID").
+		WillReturnRows(sqlmock.NewRows([]string{"plan_id", "id", "position", "title", "range_start", "range_end", "due_date"}).
+			AddRow("newPlanID", "sectionID1", 1, "Pages 1 to 100", 1, 100, "2030-03-07").
+			AddRow("newPlanID", "sectionID2", 2, "Pages 101 to 200", 101, 200, "2030-03-14").
+			AddRow("oldPlanID", "sectionID3", 1, "Chapters 1 to 8", 1, 8, "2029-03-12"))
+
+	plans, err := w.ListReadingPlans("clubID")
+	if !assert.Nil(t, err) {
+		return
+	}
+	if assert.Len(t, plans, 2) {
+		assert.Equal(t, "newPlanID", plans[0].ID)
+		assert.Len(t, plans[0].Sections, 2)
+		assert.Equal(t, []common.ReadingPlanSection{{ID: "sectionID3", Position: 1, Title: "Chapters 1 to 8", Start: 1,
+			End: 8, DueDate: "2029-03-12"}}, plans[1].Sections)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseGetReadingPlanNotFound(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	mock.ExpectQuery("SELECT id, club_id, book_id, unit, created_by, created_at, updated_at FROM reading_plan\\s+WHERE id = \\$1 AND club_id = \\$2").
+		WithArgs("planID", "clubID").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "club_id", "book_id", "unit", "created_by", "created_at", "updated_at"}))
+
+	_, err = w.GetReadingPlan("clubID", "planID")
+	assert.Equal(t, common.ErrReadingPlanNotFound, err)
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseUpdateReadingPlan(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		missingID     bool
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Kept sections keep their id and new sections are added",
+		},
+		testData{
+			description:   "Section id of another plan",
+			expectedError: common.ErrReadingPlanSectionNotFound,
+			missingID:     true,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	updatedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, td := range testTable {
+		// A section is added before the second section, which moves to position 3
+		plan := &common.ReadingPlan{ID: "planID", ClubID: "clubID", BookID: "bookID", Unit: common.ReadingPlanUnitPage,
+			Sections: []common.ReadingPlanSection{
+				{ID: "sectionID1", Position: 1, Title: "Pages 1 to 100", Start: 1, End: 100, DueDate: "2030-03-07"},
+				{Position: 2, Title: "Pages 101 to 150", Start: 101, End: 150, DueDate: "2030-03-10"},
+				{ID: "sectionID2", Position: 3, Title: "Pages 151 to 200", Start: 151, End: 200, DueDate: "2030-03-14"},
+			}}
+		mock.ExpectBegin()
+		mock.ExpectQuery("UPDATE reading_plan SET book_id = \\$1, unit = \\$2, updated_at = NOW\\(\\)").
+			WithArgs("bookID", common.ReadingPlanUnitPage, "planID", "clubID").
+			WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(updatedAt))
+		mock.ExpectExec("DELETE FROM reading_plan_section WHERE plan_id = \\$1 AND NOT \\(id = ANY\\(\\$2::uuid\\[\\]\\)\\)").
+			WithArgs("planID", "{\"sectionID1\",\"sectionID2\"}").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		s := plan.Sections[0]
+		mock.ExpectExec("UPDATE reading_plan_section SET position = \\$3").
+			WithArgs("sectionID1", "planID", s.Position, s.Title, s.Start, s.End, s.DueDate).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		s = plan.Sections[1]
+		mock.ExpectQuery("INSERT INTO reading_plan_section \\(plan_id, position, title, range_start, range_end, due_date\\)").
+			WithArgs("planID", s.Position, s.Title, s.Start, s.End, s.DueDate).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("sectionID3"))
+		s = plan.Sections[2]
+		rowsAffected := int64(1)
+		if td.missingID {
+			rowsAffected = 0
+		}
+		mock.ExpectExec("UPDATE reading_plan_section SET position = \\$3").
+			WithArgs("sectionID2", "planID", s.Position, s.Title, s.Start, s.End, s.DueDate).
+			WillReturnResult(sqlmock.NewResult(0, rowsAffected))
+		if td.expectedError != nil {
+			mock.ExpectRollback()
+		} else {
+			mock.ExpectCommit()
+		}
+
+		err := w.UpdateReadingPlan(plan)
+		assert.Equal(t, td.expectedError, err, td.description)
+		if td.expectedError == nil {
+			assert.Equal(t, updatedAt, plan.UpdatedAt, td.description)
+			assert.Equal(t, []string{"sectionID1", "sectionID3", "sectionID2"},
+				[]string{plan.Sections[0].ID, plan.Sections[1].ID, plan.Sections[2].ID}, td.description)
+		}
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
@@ -0,0 +1,98 @@
+package warehouse
+
+import (
+	"time"
+
+	"github.com/garycarr/book_club/common"
+)
+
+// readingProgressColumns are selected by every progress query and read by scanReadingProgress
+const readingProgressColumns = `id, book_id, page, percent, chapter, recorded_at`
+
+// RecordProgress adds a record of how far the user is through the book, the id and recorded_at are
+// set on progress
+func (w *Warehouse) RecordProgress(userID string, progress *common.ReadingProgress) error {
+	err := w.DB.QueryRow(`INSERT INTO reading_progress (user_id, book_id, page, percent, chapter)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, recorded_at`, userID, progress.BookID, progress.Page, progress.Percent, progress.Chapter).
+		Scan(&progress.ID, &progress.RecordedAt)
+	return bookReferenceError(err)
+}
+
+// ListProgress returns the progress the user has recorded through the book, newest first
+func (w *Warehouse) ListProgress(userID, bookID string) ([]common.ReadingProgress, error) {
+	rows, err := w.DB.Query(`SELECT `+readingProgressColumns+` FROM reading_progress
+		WHERE user_id = $1 AND book_id = $2
+		ORDER BY recorded_at DESC, id`, userID, bookID)
+	if err != nil {
+		return nil, bookError(err)
+	}
+	defer rows.Close()
+	history := []common.ReadingProgress{}
+	for rows.Next() {
+		p, err := scanReadingProgress(rows)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, *p)
+	}
+	return history, rows.Err()
+}
+
+// SetProgressSharing chooses whether the club can see the reading progress of the user
+func (w *Warehouse) SetProgressSharing(clubID, userID string, share bool) error {
+	res, err := w.DB.Exec(`UPDATE club_role SET share_progress = $3, updated_at = NOW()
+		WHERE club_id = $1 AND user_id = $2`, clubID, userID, share)
+	if err != nil {
+		return err
+	}
+	return expectRowsAffected(res, common.ErrClubNotMember)
+}
+
+// ClubProgress returns the latest progress through the book of the members of the club who share it,
+// and of the viewer, ordered by display name. It also returns how many members do not share it
+func (w *Warehouse) ClubProgress(clubID, bookID, viewerID string) ([]common.MemberProgress, int, error) {
+	var hidden int
+	if err := w.DB.QueryRow(`SELECT COUNT(*) FROM club_role JOIN user_data ON user_data.id = club_role.user_id
+		WHERE club_role.club_id = $1 AND user_data.deleted_at IS NULL AND NOT club_role.share_progress
+			AND club_role.user_id <> $2`, clubID, viewerID).Scan(&hidden); err != nil {
+		return nil, 0, clubError(err)
+	}
+	rows, err := w.DB.Query(`SELECT club_role.user_id, user_data.display_name, latest.id, latest.page, latest.percent,
+			latest.chapter, latest.recorded_at
+		FROM club_role JOIN user_data ON user_data.id = club_role.user_id
+		LEFT JOIN LATERAL (SELECT `+readingProgressColumns+` FROM reading_progress
+			WHERE reading_progress.user_id = club_role.user_id AND reading_progress.book_id = $2
+			ORDER BY recorded_at DESC, id LIMIT 1) latest ON true
+		WHERE club_role.club_id = $1 AND user_data.deleted_at IS NULL
+			AND (club_role.share_progress OR club_role.user_id = $3)
+		ORDER BY user_data.display_name, club_role.user_id`, clubID, bookID, viewerID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	members := []common.MemberProgress{}
+	for rows.Next() {
+		m := common.MemberProgress{}
+		var id *string
+		p := common.ReadingProgress{BookID: bookID}
+		var recordedAt *time.Time
+		if err = rows.Scan(&m.UserID, &m.DisplayName, &id, &p.Page, &p.Percent, &p.Chapter, &recordedAt); err != nil {
+			return nil, 0, err
+		}
+		if id != nil {
+			p.ID, p.RecordedAt = *id, *recordedAt
+			m.Progress = &p
+		}
+		members = append(members, m)
+	}
+	return members, hidden, rows.Err()
+}
+
+func scanReadingProgress(row scanner) (*common.ReadingProgress, error) {
+	p := common.ReadingProgress{}
+	if err := row.Scan(&p.ID, &p.BookID, &p.Page, &p.Percent, &p.Chapter, &p.RecordedAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,85 @@
+package warehouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseRecordProgress(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	recordedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	page := 120
+	progress := &common.ReadingProgress{BookID: "bookID", Page: &page}
+	mock.ExpectQuery("INSERT INTO reading_progress \\(user_id, book_id, page, percent, chapter\\)").
+		WithArgs("userID", "bookID", &page, nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "recorded_at"}).AddRow("progressID", recordedAt))
+
+	assert.Nil(t, w.RecordProgress("userID", progress))
+	assert.Equal(t, "progressID", progress.ID)
+	assert.Equal(t, recordedAt, progress.RecordedAt)
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseClubProgress(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	recordedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM club_role").
+		WithArgs("clubID", "userID").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("SELECT club_role.user_id, user_data.display_name, latest.id").
+		WithArgs("clubID", "bookID", "userID").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "display_name", "id", "page", "percent", "chapter", "recorded_at"}).
+			AddRow("otherID", "Ada", "progressID", nil, 40, nil, recordedAt).
+			AddRow("userID", "Grace", nil, nil, nil, nil, nil))
+
+	members, hidden, err := w.ClubProgress("clubID", "bookID", "userID")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 3, hidden)
+	percent := 40
+	assert.Equal(t, []common.MemberProgress{
+		{UserID: "otherID", DisplayName: "Ada", Progress: &common.ReadingProgress{ID: "progressID", BookID: "bookID",
+			Percent: &percent, RecordedAt: recordedAt}},
+		{UserID: "userID", DisplayName: "Grace"},
+	}, members)
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseSetProgressSharingNotMember(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	mock.ExpectExec("UPDATE club_role SET share_progress = \\$3").
+		WithArgs("clubID", "userID", true).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Equal(t, common.ErrClubNotMember, w.SetProgressSharing("clubID", "userID", true))
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
@@ -0,0 +1,91 @@
+package warehouse
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+)
+
+// CreateRefreshToken stores a refresh token that starts a new token family
+func (w *Warehouse) CreateRefreshToken(userID, tokenHash string, expiresAt time.Time) (*common.RefreshToken, error) {
+	rt := common.RefreshToken{
+		UserID:    userID,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+	}
+	sqlStatement := `INSERT INTO refresh_token (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, family_id`
+	if err := w.DB.QueryRow(sqlStatement, userID, tokenHash, expiresAt).Scan(&rt.ID, &rt.FamilyID); err != nil {
+		return nil, err
+	}
+	return &rt, nil
+}
+
+// GetRefreshToken ...
+func (w *Warehouse) GetRefreshToken(tokenHash string) (*common.RefreshToken, error) {
+	rt := common.RefreshToken{}
+	sqlStatement := `SELECT id, user_id, family_id, token_hash, expires_at, used_at, revoked_at
+		FROM refresh_token
+		WHERE token_hash = $1`
+	err := w.DB.QueryRow(sqlStatement, tokenHash).Scan(&rt.ID, &rt.UserID, &rt.FamilyID, &rt.TokenHash,
+		&rt.ExpiresAt, &rt.UsedAt, &rt.RevokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, common.ErrRefreshTokenNotFound
+		}
+		return nil, err
+	}
+	return &rt, nil
+}
+
+// RotateRefreshToken marks the refresh token as used and stores its replacement in the same family.
+// If the token was used by someone else in the meantime ErrRefreshTokenReused is returned
+func (w *Warehouse) RotateRefreshToken(old *common.RefreshToken, tokenHash string, expiresAt time.Time) (*common.RefreshToken, error) {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	res, err := tx.Exec(`UPDATE refresh_token SET used_at = NOW()
+		WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL`, old.ID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		err = common.ErrRefreshTokenReused
+		return nil, err
+	}
+	rt := common.RefreshToken{
+		UserID:    old.UserID,
+		FamilyID:  old.FamilyID,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+	}
+	sqlStatement := `INSERT INTO refresh_token (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`
+	if err = tx.QueryRow(sqlStatement, rt.UserID, rt.FamilyID, tokenHash, expiresAt).Scan(&rt.ID); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &rt, nil
+}
+
+// RevokeRefreshTokenFamily revokes every token that was rotated from the same login
+func (w *Warehouse) RevokeRefreshTokenFamily(familyID string) error {
+	_, err := w.DB.Exec(`UPDATE refresh_token SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL`, familyID)
+	return err
+}
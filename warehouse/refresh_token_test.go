@@ -0,0 +1,115 @@
+package warehouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseCreateRefreshToken(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	expiresAt := time.Now().Add(time.Hour)
+	mock.ExpectQuery("INSERT INTO refresh_token \\(user_id, token_hash, expires_at\\) VALUES \\(\\$1, \\$2, \\$3\\) RETURNING id, family_id").
+		WithArgs("userID", "hash", expiresAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "family_id"}).AddRow("tokenID", "familyID"))
+
+	rt, err := w.CreateRefreshToken("userID", "hash", expiresAt)
+	if !assert.Nil(t, err) {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &common.RefreshToken{
+		ID:        "tokenID",
+		UserID:    "userID",
+		FamilyID:  "familyID",
+		TokenHash: "hash",
+		ExpiresAt: expiresAt,
+	}, rt)
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseGetRefreshTokenNotFound(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	mock.ExpectQuery("SELECT id, user_id, family_id, token_hash, expires_at, used_at, revoked_at FROM refresh_token WHERE token_hash = \\$1").
+		WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "family_id", "token_hash", "expires_at", "used_at", "revoked_at"}))
+
+	_, err = w.GetRefreshToken("missing")
+	assert.Equal(t, common.ErrRefreshTokenNotFound, err)
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseRotateRefreshToken(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		rowsAffected  int64
+	}
+
+	testTable := []testData{
+		testData{
+			description:  "Rotates an unused token",
+			rowsAffected: 1,
+		},
+		testData{
+			description:   "Token was already used",
+			expectedError: common.ErrRefreshTokenReused,
+			rowsAffected:  0,
+		},
+	}
+	old := &common.RefreshToken{
+		ID:       "oldID",
+		UserID:   "userID",
+		FamilyID: "familyID",
+	}
+	expiresAt := time.Now().Add(time.Hour)
+	for _, td := range testTable {
+		w := Warehouse{}
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		w.DB = db
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE refresh_token SET used_at = NOW\\(\\) WHERE id = \\$1 AND used_at IS NULL AND revoked_at IS NULL").
+			WithArgs(old.ID).
+			WillReturnResult(sqlmock.NewResult(0, td.rowsAffected))
+		if td.expectedError == nil {
+			mock.ExpectQuery("INSERT INTO refresh_token \\(user_id, family_id, token_hash, expires_at\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\) RETURNING id").
+				WithArgs(old.UserID, old.FamilyID, "newHash", expiresAt).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("newID"))
+			mock.ExpectCommit()
+		} else {
+			mock.ExpectRollback()
+		}
+
+		rt, err := w.RotateRefreshToken(old, "newHash", expiresAt)
+		assert.Equal(t, td.expectedError, err, td.description)
+		if td.expectedError == nil {
+			assert.Equal(t, "newID", rt.ID, td.description)
+			assert.Equal(t, old.FamilyID, rt.FamilyID, td.description)
+		}
+		if err = mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectation error for %q: %s", td.description, err)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,249 @@
+package warehouse
+
+import (
+	"database/sql"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+)
+
+// reviewColumns are selected by every review query and read by scanReview, helpful can be ordered by
+const reviewColumns = `review.id, review.book_id, review.user_id, user_data.display_name, review.rating,
+		review.body, review.spoiler,
+		(SELECT COUNT(*) FROM review_vote WHERE review_vote.review_id = review.id) AS helpful,
+		review.created_at, review.updated_at`
+
+// reviewOrders are the ORDER BY clauses of the orders reviews can be listed in, newer reviews come
+// first when the order ties
+var reviewOrders = map[string]string{
+	common.ReviewSortNewest:  `review.created_at DESC, review.id`,
+	common.ReviewSortHelpful: `helpful DESC, review.created_at DESC, review.id`,
+	common.ReviewSortRating:  `review.rating DESC, review.created_at DESC, review.id`,
+}
+
+// CreateReview adds the review and its rating to the book in one transaction, the id and times are set
+// on review. ErrReviewAlreadyExists is returned if the user has already reviewed the book
+func (w *Warehouse) CreateReview(review *common.Review) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	err = tx.QueryRow(`INSERT INTO review (book_id, user_id, rating, body, spoiler)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at`, review.BookID, review.UserID, review.Rating, review.Body, review.Spoiler).
+		Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt)
+	if err != nil {
+		err = reviewError(err)
+		return err
+	}
+	if err = adjustRating(tx, review.BookID, review.Rating, 1); err != nil {
+		return err
+	}
+	err = tx.Commit()
+	return err
+}
+
+// GetReview returns the review the user wrote of the book
+func (w *Warehouse) GetReview(bookID, userID string) (*common.Review, error) {
+	review, err := scanReview(w.DB.QueryRow(`SELECT `+reviewColumns+`
+		FROM review JOIN user_data ON user_data.id = review.user_id
+		WHERE review.book_id = $1 AND review.user_id = $2`, bookID, userID))
+	if err != nil {
+		return nil, reviewError(err)
+	}
+	return review, nil
+}
+
+// ListReviews returns a page of the reviews of the book in the order, and how many there are in total
+func (w *Warehouse) ListReviews(bookID, sort string, p common.Pagination) ([]common.Review, int, error) {
+	order, ok := reviewOrders[sort]
+	if !ok {
+		return nil, 0, common.ErrReviewSortInvalid
+	}
+	var total int
+	if err := w.DB.QueryRow(`SELECT COUNT(*) FROM review WHERE book_id = $1`, bookID).Scan(&total); err != nil {
+		return nil, 0, bookError(err)
+	}
+	rows, err := w.DB.Query(`SELECT `+reviewColumns+`
+		FROM review JOIN user_data ON user_data.id = review.user_id
+		WHERE review.book_id = $1
+		ORDER BY `+order+`
+		LIMIT $2 OFFSET $3`, bookID, p.Limit, p.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	reviews := []common.Review{}
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		reviews = append(reviews, *review)
+	}
+	return reviews, total, rows.Err()
+}
+
+// UpdateReview saves the rating, body and spoiler of the review, updated_at is set on review. A change
+// of rating moves it in the rating of the book in the same transaction
+func (w *Warehouse) UpdateReview(review *common.Review) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	// The row is locked so the rating taken off the book is the one being replaced
+	var previous float64
+	err = tx.QueryRow(`SELECT rating FROM review WHERE id = $1 FOR UPDATE`, review.ID).Scan(&previous)
+	if err != nil {
+		err = reviewError(err)
+		return err
+	}
+	err = tx.QueryRow(`UPDATE review SET rating = $2, body = $3, spoiler = $4, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at`, review.ID, review.Rating, review.Body, review.Spoiler).Scan(&review.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if previous != review.Rating {
+		if err = adjustRating(tx, review.BookID, previous, -1); err != nil {
+			return err
+		}
+		if err = adjustRating(tx, review.BookID, review.Rating, 1); err != nil {
+			return err
+		}
+	}
+	err = tx.Commit()
+	return err
+}
+
+// DeleteReview removes the review the user wrote of the book and takes its rating off the book in one
+// transaction. The helpful votes for it go with it
+func (w *Warehouse) DeleteReview(bookID, userID string) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	var rating float64
+	err = tx.QueryRow(`DELETE FROM review WHERE book_id = $1 AND user_id = $2
+		RETURNING rating`, bookID, userID).Scan(&rating)
+	if err != nil {
+		err = reviewError(err)
+		return err
+	}
+	if err = adjustRating(tx, bookID, rating, -1); err != nil {
+		return err
+	}
+	err = tx.Commit()
+	return err
+}
+
+// AddHelpfulVote records that the user found the review of the book helpful, voting again changes
+// nothing. ErrReviewVoteOwn is returned for a review the user wrote
+func (w *Warehouse) AddHelpfulVote(bookID, reviewID, userID string) error {
+	var authorID string
+	err := w.DB.QueryRow(`SELECT user_id FROM review WHERE id = $1 AND book_id = $2`, reviewID, bookID).Scan(&authorID)
+	if err != nil {
+		return reviewError(err)
+	}
+	if authorID == userID {
+		return common.ErrReviewVoteOwn
+	}
+	_, err = w.DB.Exec(`INSERT INTO review_vote (review_id, user_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`, reviewID, userID)
+	return err
+}
+
+// RemoveHelpfulVote takes back the vote of the user for the review of the book, if they made one
+func (w *Warehouse) RemoveHelpfulVote(bookID, reviewID, userID string) error {
+	_, err := w.DB.Exec(`DELETE FROM review_vote USING review
+		WHERE review_vote.review_id = $1 AND review_vote.user_id = $3
+			AND review.id = review_vote.review_id AND review.book_id = $2`, reviewID, bookID, userID)
+	return reviewError(err)
+}
+
+// removeReviews deletes every review the user wrote and takes their ratings off the books, it returns
+// how many were removed
+func removeReviews(tx *sql.Tx, userID string) (int64, error) {
+	rows, err := tx.Query(`DELETE FROM review WHERE user_id = $1 RETURNING book_id, rating`, userID)
+	if err != nil {
+		return 0, err
+	}
+	type removed struct {
+		bookID string
+		rating float64
+	}
+	reviews := []removed{}
+	for rows.Next() {
+		r := removed{}
+		if err = rows.Scan(&r.bookID, &r.rating); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		reviews = append(reviews, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, r := range reviews {
+		if err = adjustRating(tx, r.bookID, r.rating, -1); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(reviews)), nil
+}
+
+// adjustRating adds a rating to the cached rating of the book when delta is 1, and takes it off when
+// delta is -1. Updating the book row locks it, so concurrent reviews are counted in turn
+func adjustRating(tx *sql.Tx, bookID string, rating float64, delta int) error {
+	res, err := tx.Exec(`UPDATE book SET rating_count = rating_count + $3::integer,
+			rating_sum = rating_sum + $2::numeric * $3::integer,
+			rating_histogram[$4] = rating_histogram[$4] + $3::integer
+		WHERE id = $1`, bookID, rating, delta, common.RatingBucket(rating)+1)
+	if err != nil {
+		return err
+	}
+	return expectRowsAffected(res, common.ErrBookNotFound)
+}
+
+func scanReview(row scanner) (*common.Review, error) {
+	r := common.Review{}
+	err := row.Scan(&r.ID, &r.BookID, &r.UserID, &r.DisplayName, &r.Rating, &r.Body, &r.Spoiler, &r.Helpful,
+		&r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// reviewError turns the errors for a missing review, an id that is not a uuid, a second review of the
+// same book and a book that is not in the catalog into the errors the handlers expect
+func reviewError(err error) error {
+	if err == sql.ErrNoRows {
+		return common.ErrReviewNotFound
+	}
+	if pqErr, ok := err.(*pq.Error); ok {
+		switch pqErr.Code.Name() {
+		case "unique_violation":
+			return common.ErrReviewAlreadyExists
+		case "invalid_text_representation":
+			return common.ErrReviewNotFound
+		}
+	}
+	return bookReferenceError(err)
+}
@@ -0,0 +1,170 @@
+package warehouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseCreateReview(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		insertError   error
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Rating added to the book",
+		},
+		testData{
+			description:   "Already reviewed",
+			expectedError: common.ErrReviewAlreadyExists,
+			insertError:   &pq.Error{Code: "23505"},
+		},
+		testData{
+			description:   "Book not in the catalog",
+			expectedError: common.ErrBookNotFound,
+			insertError:   &pq.Error{Code: "23503", Constraint: "review_book_id_fkey"},
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, td := range testTable {
+		review := &common.Review{BookID: "bookID", UserID: "userID", Rating: 3.5, Body: "Slow start"}
+		mock.ExpectBegin()
+		expect := mock.ExpectQuery("INSERT INTO review \\(book_id, user_id, rating, body, spoiler\\)").
+			WithArgs("bookID", "userID", 3.5, "Slow start", false)
+		if td.insertError != nil {
+			expect.WillReturnError(td.insertError)
+			mock.ExpectRollback()
+		} else {
+			expect.WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
+				AddRow("reviewID", createdAt, createdAt))
+			mock.ExpectExec("UPDATE book SET rating_count = rating_count \\+ \\$3::integer").
+				WithArgs("bookID", 3.5, 1, 7).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+		}
+
+		assert.Equal(t, td.expectedError, w.CreateReview(review), td.description)
+		if td.expectedError == nil {
+			assert.Equal(t, "reviewID", review.ID, td.description)
+		}
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseUpdateReviewMovesRating(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	updatedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	review := &common.Review{ID: "reviewID", BookID: "bookID", UserID: "userID", Rating: 2, Body: "Went off it"}
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT rating FROM review WHERE id = \\$1 FOR UPDATE").
+		WithArgs("reviewID").
+		WillReturnRows(sqlmock.NewRows([]string{"rating"}).AddRow("4.5"))
+	mock.ExpectQuery("UPDATE review SET rating = \\$2, body = \\$3, spoiler = \\$4").
+		WithArgs("reviewID", 2.0, "Went off it", false).
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(updatedAt))
+	mock.ExpectExec("UPDATE book SET rating_count").
+		WithArgs("bookID", 4.5, -1, 9).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE book SET rating_count").
+		WithArgs("bookID", 2.0, 1, 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, w.UpdateReview(review))
+	assert.Equal(t, updatedAt, review.UpdatedAt)
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseDeleteReview(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	mock.ExpectBegin()
+	mock.ExpectQuery("DELETE FROM review WHERE book_id = \\$1 AND user_id = \\$2\\s+RETURNING rating").
+		WithArgs("bookID", "userID").
+		WillReturnRows(sqlmock.NewRows([]string{"rating"}).AddRow("0.5"))
+	mock.ExpectExec("UPDATE book SET rating_count").
+		WithArgs("bookID", 0.5, -1, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, w.DeleteReview("bookID", "userID"))
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseListReviewsHelpful(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM review WHERE book_id = \\$1").
+		WithArgs("bookID").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("ORDER BY helpful DESC, review.created_at DESC, review.id\\s+LIMIT \\$2 OFFSET \\$3").
+		WithArgs("bookID", 20, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "user_id", "display_name", "rating", "body", "spoiler",
+			"helpful", "created_at", "updated_at"}).
+			AddRow("reviewID", "bookID", "userID", "gcarr", "4.5", "Loved it", false, 3, createdAt, createdAt))
+
+	reviews, total, err := w.ListReviews("bookID", common.ReviewSortHelpful, common.Pagination{Limit: 20})
+	if assert.Nil(t, err) {
+		assert.Equal(t, 1, total)
+		assert.Equal(t, []common.Review{{ID: "reviewID", BookID: "bookID", UserID: "userID", DisplayName: "gcarr",
+			Rating: 4.5, Body: "Loved it", Helpful: 3, CreatedAt: createdAt, UpdatedAt: createdAt}}, reviews)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseAddHelpfulVoteOwnReview(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	mock.ExpectQuery("SELECT user_id FROM review WHERE id = \\$1 AND book_id = \\$2").
+		WithArgs("reviewID", "bookID").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow("userID"))
+
+	assert.Equal(t, common.ErrReviewVoteOwn, w.AddHelpfulVote("bookID", "reviewID", "userID"))
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
@@ -0,0 +1,38 @@
+package warehouse
+
+import (
+	"time"
+
+	"github.com/garycarr/book_club/common"
+)
+
+// RevokeJSONToken stores the jti of a JSON token so it is rejected until it expires
+func (w *Warehouse) RevokeJSONToken(jti string, expiresAt time.Time) error {
+	_, err := w.DB.Exec(`INSERT INTO revoked_token (jti, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING`, jti, expiresAt)
+	return err
+}
+
+// IsJSONTokenRevoked checks if the token itself was revoked, or if it was issued before every
+// session of the user was ended. iat is in whole seconds so the revocation time is truncated to
+// match, a token issued in the same second, such as a login straight after a reset, is kept
+func (w *Warehouse) IsJSONTokenRevoked(claims *common.TokenClaims) (bool, error) {
+	var revoked bool
+	sqlStatement := `SELECT EXISTS (SELECT 1 FROM revoked_token WHERE jti = $1)
+		OR EXISTS (SELECT 1 FROM user_data WHERE id = $2 AND date_trunc('second', sessions_revoked_at) > $3)`
+	if err := w.DB.QueryRow(sqlStatement, claims.ID, claims.UserID, claims.IssuedAt).Scan(&revoked); err != nil {
+		return false, err
+	}
+	return revoked, nil
+}
+
+// DeleteExpiredRevokedTokens removes the revocations of tokens that have expired anyway,
+// it returns how many were removed
+func (w *Warehouse) DeleteExpiredRevokedTokens() (int64, error) {
+	res, err := w.DB.Exec(`DELETE FROM revoked_token WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
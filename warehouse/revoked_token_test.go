@@ -0,0 +1,90 @@
+package warehouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseRevokeJSONToken(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	expiresAt := time.Now().Add(time.Hour)
+	mock.ExpectExec("INSERT INTO revoked_token \\(jti, expires_at\\) VALUES \\(\\$1, \\$2\\) ON CONFLICT \\(jti\\) DO NOTHING").
+		WithArgs("jti", expiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, w.RevokeJSONToken("jti", expiresAt))
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseIsJSONTokenRevoked(t *testing.T) {
+	type testData struct {
+		description string
+		claims      *common.TokenClaims
+		revoked     bool
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Revoked token",
+			claims:      &common.TokenClaims{ID: "revoked", UserID: "userID", IssuedAt: time.Now()},
+			revoked:     true,
+		},
+		testData{
+			description: "Token that was not revoked",
+			claims:      &common.TokenClaims{ID: "valid", UserID: "userID", IssuedAt: time.Now()},
+			revoked:     false,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM revoked_token WHERE jti = \\$1\\) "+
+			"OR EXISTS \\(SELECT 1 FROM user_data WHERE id = \\$2 AND date_trunc\\('second', sessions_revoked_at\\) > \\$3\\)").
+			WithArgs(td.claims.ID, td.claims.UserID, td.claims.IssuedAt).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(td.revoked))
+		revoked, err := w.IsJSONTokenRevoked(td.claims)
+		if !assert.Nil(t, err, td.description) {
+			continue
+		}
+		assert.Equal(t, td.revoked, revoked, td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseDeleteExpiredRevokedTokens(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	mock.ExpectExec("DELETE FROM revoked_token WHERE expires_at < NOW\\(\\)").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	deleted, err := w.DeleteExpiredRevokedTokens()
+	if !assert.Nil(t, err) {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(3), deleted)
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
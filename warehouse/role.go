@@ -0,0 +1,37 @@
+package warehouse
+
+import (
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+)
+
+// SetUserRoles replaces the site wide roles of a user. The change is seen when the user next gets
+// a JSON token
+func (w *Warehouse) SetUserRoles(userID string, roles []string) error {
+	for _, role := range roles {
+		if role != common.RoleAdmin && role != common.RoleMember {
+			return common.ErrRoleInvalid
+		}
+	}
+	res, err := w.DB.Exec(`UPDATE user_data SET roles = $1, updated_at = NOW() WHERE id = $2`, pq.Array(roles), userID)
+	if err != nil {
+		return err
+	}
+	return expectRowsAffected(res, common.ErrUserNotFound)
+}
+
+// SetClubRole gives the user a role in a club, replacing any role they already had there
+func (w *Warehouse) SetClubRole(clubID, userID, role string) error {
+	if !common.ValidClubRole(role) {
+		return common.ErrRoleInvalid
+	}
+	_, err := w.DB.Exec(`INSERT INTO club_role (club_id, user_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (club_id, user_id) DO UPDATE SET role = EXCLUDED.role, updated_at = NOW()`, clubID, userID, role)
+	return err
+}
+
+// DeleteClubRole removes the role of the user in a club
+func (w *Warehouse) DeleteClubRole(clubID, userID string) error {
+	_, err := w.DB.Exec(`DELETE FROM club_role WHERE club_id = $1 AND user_id = $2`, clubID, userID)
+	return err
+}
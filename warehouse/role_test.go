@@ -0,0 +1,92 @@
+package warehouse
+
+import (
+	"testing"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseSetUserRoles(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		roles         []string
+		rowsAffected  int64
+	}
+
+	testTable := []testData{
+		testData{
+			description:  "Makes the user an admin",
+			roles:        []string{common.RoleAdmin, common.RoleMember},
+			rowsAffected: 1,
+		},
+		testData{
+			description:   "Unknown user",
+			expectedError: common.ErrUserNotFound,
+			roles:         []string{common.RoleMember},
+		},
+		testData{
+			description:   "Invalid role",
+			expectedError: common.ErrRoleInvalid,
+			roles:         []string{"owner"},
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		if td.expectedError != common.ErrRoleInvalid {
+			mock.ExpectExec("UPDATE user_data SET roles = \\$1, updated_at = NOW\\(\\) WHERE id = \\$2").
+				WithArgs(sqlmock.AnyArg(), "userID").
+				WillReturnResult(sqlmock.NewResult(0, td.rowsAffected))
+		}
+		assert.Equal(t, td.expectedError, w.SetUserRoles("userID", td.roles), td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseSetClubRole(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		role          string
+	}
+
+	testTable := []testData{
+		testData{
+			description: "Makes the user a moderator",
+			role:        common.ClubRoleModerator,
+		},
+		testData{
+			description:   "Invalid role",
+			expectedError: common.ErrRoleInvalid,
+			role:          common.RoleAdmin,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		if td.expectedError == nil {
+			mock.ExpectExec("INSERT INTO club_role \\(club_id, user_id, role\\) VALUES \\(\\$1, \\$2, \\$3\\) ON CONFLICT").
+				WithArgs("clubID", "userID", td.role).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		assert.Equal(t, td.expectedError, w.SetClubRole("clubID", "userID", td.role), td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
@@ -0,0 +1,335 @@
+package warehouse
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+)
+
+// threadColumns are selected by every thread query and read by scanThread
+const threadColumns = `id, club_id, COALESCE(book_id::text, ''), COALESCE(plan_id::text, ''),
+		COALESCE(section_id::text, ''),
+		title, created_by, post_count, last_post_at, created_at, updated_at`
+
+// postColumns are selected by every post query and read by scanPost. The body of a deleted post is
+// never read
+const postColumns = `thread_post.id, thread_post.thread_id, COALESCE(thread_post.parent_id::text, ''), thread_post.depth,
+		thread_post.author_id, user_data.display_name,
+		CASE WHEN thread_post.deleted_at IS NULL THEN thread_post.body ELSE '' END,
+		thread_post.deleted_at IS NOT NULL, thread_post.created_at, thread_post.edited_at`
+
+// CreateThread adds the thread to the club with post as its first post in one transaction. The ids
+// and times are set on thread and post
+func (w *Warehouse) CreateThread(thread *common.Thread, post *common.Post) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	err = tx.QueryRow(`INSERT INTO thread (club_id, book_id, plan_id, section_id, title, created_by)
+		VALUES ($1, NULLIF($2, '')::uuid, NULLIF($3, '')::uuid, NULLIF($4, '')::uuid, $5, $6)
+		RETURNING id, created_at, updated_at`, thread.ClubID, thread.BookID, thread.PlanID, thread.SectionID, thread.Title,
+		thread.CreatedBy).Scan(&thread.ID, &thread.CreatedAt, &thread.UpdatedAt)
+	if err != nil {
+		err = bookReferenceError(err)
+		return err
+	}
+	post.ThreadID = thread.ID
+	if err = addPost(tx, post); err != nil {
+		return err
+	}
+	thread.PostCount, thread.LastPostAt = 1, post.CreatedAt
+	err = tx.Commit()
+	return err
+}
+
+// GetThread ignores deleted threads
+func (w *Warehouse) GetThread(clubID, id string) (*common.Thread, error) {
+	thread, err := scanThread(w.DB.QueryRow(`SELECT `+threadColumns+`
+		FROM thread
+		WHERE id = $1 AND club_id = $2 AND deleted_at IS NULL`, id, clubID))
+	if err != nil {
+		return nil, threadError(err)
+	}
+	return thread, nil
+}
+
+// ListThreads returns a page of the threads of the club that match the filter, the most recently
+// posted in first. The cursor of the next page is nil on the last page
+func (w *Warehouse) ListThreads(filter common.ThreadFilter) ([]common.Thread, *common.Cursor, error) {
+	conditions := []string{"club_id = $1", "deleted_at IS NULL"}
+	args := []interface{}{filter.ClubID}
+	if filter.BookID != "" {
+		args = append(args, filter.BookID)
+		conditions = append(conditions, fmt.Sprintf("book_id = $%d", len(args)))
+	}
+	if filter.PlanID != "" {
+		args = append(args, filter.PlanID)
+		conditions = append(conditions, fmt.Sprintf("plan_id = $%d", len(args)))
+		if filter.SectionID != "" {
+			args = append(args, filter.SectionID)
+			conditions = append(conditions, fmt.Sprintf("section_id = $%d", len(args)))
+		}
+	}
+	if filter.After != nil {
+		args = append(args, filter.After.Time, filter.After.ID)
+		conditions = append(conditions, fmt.Sprintf("(last_post_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	// One more than the page is read to know whether there is a next page
+	args = append(args, filter.Limit+1)
+	rows, err := w.DB.Query(fmt.Sprintf(`SELECT `+threadColumns+`
+		FROM thread
+		WHERE %s
+		ORDER BY last_post_at DESC, id DESC
+		LIMIT $%d`, strings.Join(conditions, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, nil, threadError(err)
+	}
+	defer rows.Close()
+	threads := []common.Thread{}
+	for rows.Next() {
+		thread, err := scanThread(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		threads = append(threads, *thread)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(threads) <= filter.Limit {
+		return threads, nil, nil
+	}
+	threads = threads[:filter.Limit]
+	last := threads[len(threads)-1]
+	return threads, &common.Cursor{Time: last.LastPostAt, ID: last.ID}, nil
+}
+
+// UpdateThread saves the title of the thread, updated_at is set on thread
+func (w *Warehouse) UpdateThread(thread *common.Thread) error {
+	err := w.DB.QueryRow(`UPDATE thread SET title = $3, updated_at = NOW()
+		WHERE id = $1 AND club_id = $2 AND deleted_at IS NULL
+		RETURNING updated_at`, thread.ID, thread.ClubID, thread.Title).Scan(&thread.UpdatedAt)
+	return threadError(err)
+}
+
+// DeleteThread soft deletes the thread, its posts can no longer be read
+func (w *Warehouse) DeleteThread(clubID, id string) error {
+	res, err := w.DB.Exec(`UPDATE thread SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND club_id = $2 AND deleted_at IS NULL`, id, clubID)
+	if err != nil {
+		return threadError(err)
+	}
+	return expectRowsAffected(res, common.ErrThreadNotFound)
+}
+
+// CreatePost adds the post to its thread, the id, depth and created_at are set on post.
+// ErrPostParentNotFound is returned when the parent is not in the same thread
+func (w *Warehouse) CreatePost(post *common.Post) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	if err = addPost(tx, post); err != nil {
+		return err
+	}
+	err = tx.Commit()
+	return err
+}
+
+// GetPost returns a post of the thread, deleted posts are returned without their body
+func (w *Warehouse) GetPost(threadID, id string) (*common.Post, error) {
+	post, err := scanPost(w.DB.QueryRow(`SELECT `+postColumns+`
+		FROM thread_post JOIN user_data ON user_data.id = thread_post.author_id
+		WHERE thread_post.id = $1 AND thread_post.thread_id = $2`, id, threadID))
+	if err != nil {
+		return nil, postError(err)
+	}
+	return post, nil
+}
+
+// ListPosts returns a page of the posts of the thread, oldest first. Replies refer to their parent so
+// clients can nest them. The cursor of the next page is nil on the last page
+func (w *Warehouse) ListPosts(threadID string, p common.CursorPagination) ([]common.Post, *common.Cursor, error) {
+	conditions := "thread_post.thread_id = $1"
+	args := []interface{}{threadID}
+	if p.After != nil {
+		args = append(args, p.After.Time, p.After.ID)
+		conditions += " AND (thread_post.created_at, thread_post.id) > ($2, $3)"
+	}
+	// One more than the page is read to know whether there is a next page
+	args = append(args, p.Limit+1)
+	rows, err := w.DB.Query(fmt.Sprintf(`SELECT `+postColumns+`
+		FROM thread_post JOIN user_data ON user_data.id = thread_post.author_id
+		WHERE %s
+		ORDER BY thread_post.created_at, thread_post.id
+		LIMIT $%d`, conditions, len(args)), args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	posts := []common.Post{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		posts = append(posts, *post)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(posts) <= p.Limit {
+		return posts, nil, nil
+	}
+	posts = posts[:p.Limit]
+	last := posts[len(posts)-1]
+	return posts, &common.Cursor{Time: last.CreatedAt, ID: last.ID}, nil
+}
+
+// UpdatePost replaces the body of the post and keeps the body it replaced in the history, in one
+// transaction. edited_at is set on post. Deleted posts can not be edited
+func (w *Warehouse) UpdatePost(post *common.Post) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	// The previous body was written when the post was last edited, or created if it never was
+	_, err = tx.Exec(`INSERT INTO thread_post_revision (post_id, body, created_at)
+		SELECT id, body, COALESCE(edited_at, created_at) FROM thread_post
+		WHERE id = $1 AND thread_id = $2 AND deleted_at IS NULL
+		FOR UPDATE`, post.ID, post.ThreadID)
+	if err != nil {
+		err = postError(err)
+		return err
+	}
+	err = tx.QueryRow(`UPDATE thread_post SET body = $3, edited_at = NOW()
+		WHERE id = $1 AND thread_id = $2 AND deleted_at IS NULL
+		RETURNING edited_at`, post.ID, post.ThreadID, post.Body).Scan(&post.EditedAt)
+	if err != nil {
+		err = postError(err)
+		return err
+	}
+	err = tx.Commit()
+	return err
+}
+
+// DeletePost soft deletes the post of the thread, replies to it are kept. deletedBy is the author or
+// the moderator who removed it
+func (w *Warehouse) DeletePost(threadID, id, deletedBy string) error {
+	res, err := w.DB.Exec(`UPDATE thread_post SET deleted_at = NOW(), deleted_by = $3
+		WHERE id = $1 AND thread_id = $2 AND deleted_at IS NULL`, id, threadID, deletedBy)
+	if err != nil {
+		return postError(err)
+	}
+	return expectRowsAffected(res, common.ErrPostNotFound)
+}
+
+// ListPostRevisions returns the bodies the edits of the post replaced, the most recent first
+func (w *Warehouse) ListPostRevisions(postID string) ([]common.PostRevision, error) {
+	rows, err := w.DB.Query(`SELECT body, created_at FROM thread_post_revision
+		WHERE post_id = $1
+		ORDER BY replaced_at DESC, id`, postID)
+	if err != nil {
+		return nil, postError(err)
+	}
+	defer rows.Close()
+	revisions := []common.PostRevision{}
+	for rows.Next() {
+		r := common.PostRevision{}
+		if err = rows.Scan(&r.Body, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+// addPost adds the post to its thread and counts it on the thread. A reply is one deeper than its parent
+func addPost(tx *sql.Tx, post *common.Post) error {
+	post.Depth = 0
+	if post.ParentID != "" {
+		var depth int
+		err := tx.QueryRow(`SELECT depth FROM thread_post WHERE id = $1 AND thread_id = $2`, post.ParentID,
+			post.ThreadID).Scan(&depth)
+		if err != nil {
+			if postError(err) == common.ErrPostNotFound {
+				return common.ErrPostParentNotFound
+			}
+			return err
+		}
+		post.Depth = depth + 1
+		if post.Depth > common.MaxPostDepth {
+			return common.ErrPostTooDeep
+		}
+	}
+	err := tx.QueryRow(`INSERT INTO thread_post (thread_id, parent_id, depth, author_id, body)
+		VALUES ($1, NULLIF($2, '')::uuid, $3, $4, $5)
+		RETURNING id, created_at`, post.ThreadID, post.ParentID, post.Depth, post.AuthorID, post.Body).
+		Scan(&post.ID, &post.CreatedAt)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE thread SET post_count = post_count + 1, last_post_at = $2 WHERE id = $1`,
+		post.ThreadID, post.CreatedAt)
+	return err
+}
+
+func scanThread(row scanner) (*common.Thread, error) {
+	t := common.Thread{}
+	err := row.Scan(&t.ID, &t.ClubID, &t.BookID, &t.PlanID, &t.SectionID, &t.Title, &t.CreatedBy, &t.PostCount,
+		&t.LastPostAt, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func scanPost(row scanner) (*common.Post, error) {
+	p := common.Post{}
+	err := row.Scan(&p.ID, &p.ThreadID, &p.ParentID, &p.Depth, &p.AuthorID, &p.DisplayName, &p.Body, &p.Deleted,
+		&p.CreatedAt, &p.EditedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// threadError turns the errors for a missing thread, or an id that is not a uuid, into ErrThreadNotFound
+func threadError(err error) error {
+	if err == sql.ErrNoRows {
+		return common.ErrThreadNotFound
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "invalid_text_representation" {
+		return common.ErrThreadNotFound
+	}
+	return err
+}
+
+// postError turns the errors for a missing post, or an id that is not a uuid, into ErrPostNotFound
+func postError(err error) error {
+	if err == sql.ErrNoRows {
+		return common.ErrPostNotFound
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "invalid_text_representation" {
+		return common.ErrPostNotFound
+	}
+	return err
+}
@@ -0,0 +1,183 @@
+package warehouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseCreatePost(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedDepth int
+		expectedError error
+		parentDepth   int
+		parentID      string
+		parentMissing bool
+	}
+
+	testTable := []testData{
+		testData{
+			description:   "Reply to the first post",
+			expectedDepth: 1,
+			parentID:      "postID",
+		},
+		testData{
+			description:   "Reply at the deepest depth",
+			expectedDepth: common.MaxPostDepth,
+			parentDepth:   common.MaxPostDepth - 1,
+			parentID:      "postID",
+		},
+		testData{
+			description:   "Reply too deep",
+			expectedError: common.ErrPostTooDeep,
+			parentDepth:   common.MaxPostDepth,
+			parentID:      "postID",
+		},
+		testData{
+			description:   "Parent in another thread",
+			expectedError: common.ErrPostParentNotFound,
+			parentID:      "otherPostID",
+			parentMissing: true,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, td := range testTable {
+		post := &common.Post{ThreadID: "threadID", ParentID: td.parentID, AuthorID: "userID", Body: "Agreed"}
+		mock.ExpectBegin()
+		expect := mock.ExpectQuery("SELECT depth FROM thread_post").WithArgs(td.parentID, "threadID")
+		if td.parentMissing {
+			expect.WillReturnRows(sqlmock.NewRows([]string{"depth"}))
+		} else {
+			expect.WillReturnRows(sqlmock.NewRows([]string{"depth"}).AddRow(td.parentDepth))
+		}
+		if td.expectedError != nil {
+			mock.ExpectRollback()
+		} else {
+			mock.ExpectQuery("INSERT INTO thread_post \\(thread_id, parent_id, depth, author_id, body\\)").
+				WithArgs("threadID", td.parentID, td.expectedDepth, "userID", "Agreed").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("replyID", createdAt))
+			mock.ExpectExec("UPDATE thread SET post_count = post_count \\+ 1").
+				WithArgs("threadID", createdAt).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+		}
+
+		assert.Equal(t, td.expectedError, w.CreatePost(post), td.description)
+		if td.expectedError == nil {
+			assert.Equal(t, "replyID", post.ID, td.description)
+			assert.Equal(t, td.expectedDepth, post.Depth, td.description)
+		}
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseListPostsCursor(t *testing.T) {
+	type testData struct {
+		description  string
+		after        *common.Cursor
+		expectedIDs  []string
+		expectedNext *common.Cursor
+		rows         []string
+	}
+
+	first := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	postColumnNames := []string{"id", "thread_id", "parent_id", "depth", "author_id", "display_name", "body",
+		"deleted", "created_at", "edited_at"}
+	testTable := []testData{
+		testData{
+			description:  "First page with a next page",
+			expectedIDs:  []string{"post1", "post2"},
+			expectedNext: &common.Cursor{Time: first.Add(time.Minute), ID: "post2"},
+			rows:         []string{"post1", "post2", "post3"},
+		},
+		testData{
+			description: "Last page",
+			after:       &common.Cursor{Time: first.Add(time.Minute), ID: "post2"},
+			expectedIDs: []string{"post3"},
+			rows:        []string{"post3"},
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		rows := sqlmock.NewRows(postColumnNames)
+		for _, id := range td.rows {
+			createdAt := first
+			switch id {
+			case "post2":
+				createdAt = first.Add(time.Minute)
+			case "post3":
+				createdAt = first.Add(2 * time.Minute)
+			}
+			rows.AddRow(id, "threadID", "", 0, "userID", "Reader", "Hello", false, createdAt, nil)
+		}
+		if td.after == nil {
+			mock.ExpectQuery("WHERE thread_post.thread_id = \\$1\\s+ORDER BY").
+				WithArgs("threadID", 3).
+				WillReturnRows(rows)
+		} else {
+			mock.ExpectQuery("\\(thread_post.created_at, thread_post.id\\) > \\(\\$2, \\$3\\)").
+				WithArgs("threadID", td.after.Time, td.after.ID, 3).
+				WillReturnRows(rows)
+		}
+
+		posts, next, err := w.ListPosts("threadID", common.CursorPagination{Limit: 2, After: td.after})
+		if !assert.Nil(t, err, td.description) {
+			continue
+		}
+		ids := []string{}
+		for _, p := range posts {
+			ids = append(ids, p.ID)
+		}
+		assert.Equal(t, td.expectedIDs, ids, td.description)
+		assert.Equal(t, td.expectedNext, next, td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseUpdatePostKeepsRevision(t *testing.T) {
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	editedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	post := &common.Post{ID: "postID", ThreadID: "threadID", Body: "What a start"}
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO thread_post_revision \\(post_id, body, created_at\\)").
+		WithArgs("postID", "threadID").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("UPDATE thread_post SET body = \\$3, edited_at = NOW\\(\\)").
+		WithArgs("postID", "threadID", "What a start").
+		WillReturnRows(sqlmock.NewRows([]string{"edited_at"}).AddRow(editedAt))
+	mock.ExpectCommit()
+
+	if assert.Nil(t, w.UpdatePost(post)) {
+		assert.Equal(t, editedAt, *post.EditedAt)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
@@ -0,0 +1,57 @@
+package warehouse
+
+import (
+	"github.com/garycarr/book_club/common"
+	"github.com/lib/pq"
+)
+
+// SetTOTPSecret stores the encrypted secret for a user enrolling in two factor authentication. It
+// is not used until EnableTOTP is called
+func (w *Warehouse) SetTOTPSecret(userID, encryptedSecret string) error {
+	res, err := w.DB.Exec(`UPDATE user_data SET totp_secret = $1, updated_at = NOW()
+		WHERE id = $2 AND totp_enabled_at IS NULL`, encryptedSecret, userID)
+	if err != nil {
+		return err
+	}
+	return expectRowsAffected(res, common.ErrTOTPAlreadyEnabled)
+}
+
+// EnableTOTP turns on two factor authentication, replacing any recovery codes
+func (w *Warehouse) EnableTOTP(userID string, recoveryCodeHashes []string) error {
+	res, err := w.DB.Exec(`UPDATE user_data SET totp_enabled_at = NOW(), totp_recovery_codes = $1, updated_at = NOW()
+		WHERE id = $2 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL`, pq.Array(recoveryCodeHashes), userID)
+	if err != nil {
+		return err
+	}
+	return expectRowsAffected(res, common.ErrTOTPAlreadyEnabled)
+}
+
+// DisableTOTP turns off two factor authentication and removes the secret and recovery codes
+func (w *Warehouse) DisableTOTP(userID string) error {
+	_, err := w.DB.Exec(`UPDATE user_data SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL,
+		totp_recovery_codes = NULL, updated_at = NOW()
+		WHERE id = $1`, userID)
+	return err
+}
+
+// UseTOTPStep records the time step of a TOTP code that was accepted. ErrTOTPCodeInvalid is returned
+// if a code from the same or a later step has already been used
+func (w *Warehouse) UseTOTPStep(userID string, step int64) error {
+	res, err := w.DB.Exec(`UPDATE user_data SET totp_last_step = $1
+		WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`, step, userID)
+	if err != nil {
+		return err
+	}
+	return expectRowsAffected(res, common.ErrTOTPCodeInvalid)
+}
+
+// UseRecoveryCode removes the recovery code so it can only be used once. ErrTOTPCodeInvalid is
+// returned if the user does not have the code
+func (w *Warehouse) UseRecoveryCode(userID, codeHash string) error {
+	res, err := w.DB.Exec(`UPDATE user_data SET totp_recovery_codes = array_remove(totp_recovery_codes, $1)
+		WHERE id = $2 AND $1 = ANY(totp_recovery_codes)`, codeHash, userID)
+	if err != nil {
+		return err
+	}
+	return expectRowsAffected(res, common.ErrTOTPCodeInvalid)
+}
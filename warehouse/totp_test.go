@@ -0,0 +1,117 @@
+package warehouse
+
+import (
+	"testing"
+
+	"github.com/garycarr/book_club/common"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestWarehouseSetTOTPSecret(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		rowsAffected  int64
+	}
+
+	testTable := []testData{
+		testData{
+			description:  "Stores the secret",
+			rowsAffected: 1,
+		},
+		testData{
+			description:   "Two factor authentication already enabled",
+			expectedError: common.ErrTOTPAlreadyEnabled,
+			rowsAffected:  0,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		mock.ExpectExec("UPDATE user_data SET totp_secret = \\$1, updated_at = NOW\\(\\) WHERE id = \\$2 AND totp_enabled_at IS NULL").
+			WithArgs("encrypted", "userID").
+			WillReturnResult(sqlmock.NewResult(0, td.rowsAffected))
+		assert.Equal(t, td.expectedError, w.SetTOTPSecret("userID", "encrypted"), td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseUseTOTPStep(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		rowsAffected  int64
+	}
+
+	testTable := []testData{
+		testData{
+			description:  "New time step",
+			rowsAffected: 1,
+		},
+		testData{
+			description:   "Time step already used",
+			expectedError: common.ErrTOTPCodeInvalid,
+			rowsAffected:  0,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		mock.ExpectExec("UPDATE user_data SET totp_last_step = \\$1 WHERE id = \\$2 AND \\(totp_last_step IS NULL OR totp_last_step < \\$1\\)").
+			WithArgs(int64(100), "userID").
+			WillReturnResult(sqlmock.NewResult(0, td.rowsAffected))
+		assert.Equal(t, td.expectedError, w.UseTOTPStep("userID", 100), td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseUseRecoveryCode(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		rowsAffected  int64
+	}
+
+	testTable := []testData{
+		testData{
+			description:  "Unused recovery code",
+			rowsAffected: 1,
+		},
+		testData{
+			description:   "Unknown or used recovery code",
+			expectedError: common.ErrTOTPCodeInvalid,
+			rowsAffected:  0,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		mock.ExpectExec("UPDATE user_data SET totp_recovery_codes = array_remove\\(totp_recovery_codes, \\$1\\) WHERE id = \\$2 AND \\$1 = ANY\\(totp_recovery_codes\\)").
+			WithArgs("codeHash", "userID").
+			WillReturnResult(sqlmock.NewResult(0, td.rowsAffected))
+		assert.Equal(t, td.expectedError, w.UseRecoveryCode("userID", "codeHash"), td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
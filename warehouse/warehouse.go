@@ -2,6 +2,7 @@ package warehouse
 
 import (
 	"database/sql"
+	"encoding/json"
 
 	"github.com/garycarr/book_club/common"
 	"github.com/lib/pq"
@@ -55,21 +56,142 @@ func (w *Warehouse) CreateUser(rr common.RegisterRequest) (*common.User, error)
 		ID:          id,
 		Email:       rr.Email,
 		DisplayName: rr.DisplayName,
+		Roles:       []string{common.RoleMember},
+		ClubRoles:   map[string]string{},
 	}, nil
 }
 
-// GetUserWithEmail ...
+// userColumns are selected by every user query and read by scanUser. The club roles are
+// aggregated into a JSON object of club id to role
+const userColumns = `id, email, email_verified_at, password, display_name, bio, COALESCE(totp_secret, ''), totp_enabled_at,
+		roles, COALESCE((SELECT json_object_agg(club_id, role) FROM club_role WHERE user_id = user_data.id), '{}'), time_zone,
+		COALESCE(pending_email, '')`
+
+// GetUserWithEmail ignores deleted users, as does GetUserWithID
 func (w *Warehouse) GetUserWithEmail(email string) (*common.User, error) {
-	u := common.User{}
-	sqlStatement := `SELECT id, email, password, display_name
+	sqlStatement := `SELECT ` + userColumns + `
 		FROM user_data
-		WHERE email = $1`
-	err := w.DB.QueryRow(sqlStatement, email).Scan(&u.ID, &u.Email, &u.Password, &u.DisplayName)
+		WHERE email = $1 AND deleted_at IS NULL`
+	u, err := scanUser(w.DB.QueryRow(sqlStatement, email))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, common.ErrLoginUserNotFound
 		}
 		return nil, err
 	}
+	return u, nil
+}
+
+// GetUserWithID ...
+func (w *Warehouse) GetUserWithID(id string) (*common.User, error) {
+	sqlStatement := `SELECT ` + userColumns + `
+		FROM user_data
+		WHERE id = $1 AND deleted_at IS NULL`
+	u, err := scanUser(w.DB.QueryRow(sqlStatement, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, common.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
+// UpdatePassword replaces the password hash of a user
+func (w *Warehouse) UpdatePassword(userID, hashedPassword string) error {
+	res, err := w.DB.Exec(`UPDATE user_data SET password = $1, updated_at = NOW() WHERE id = $2`, hashedPassword, userID)
+	if err != nil {
+		return err
+	}
+	return expectRowsAffected(res, common.ErrUserNotFound)
+}
+
+// UpdateUser stores the display name, bio, time zone and pending email of the user, the email itself
+// only changes once the pending email is verified. ErrLoginUserAlreadyExists is returned if the
+// pending email changed to one another user has
+func (w *Warehouse) UpdateUser(user *common.User, pendingEmailChanged bool) error {
+	if pendingEmailChanged {
+		var taken bool
+		err := w.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM user_data WHERE email = $1 AND deleted_at IS NULL)`,
+			user.PendingEmail).Scan(&taken)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return common.ErrLoginUserAlreadyExists
+		}
+	}
+	res, err := w.DB.Exec(`UPDATE user_data SET display_name = $1, bio = $2, time_zone = $3,
+		pending_email = NULLIF($4, ''), updated_at = NOW()
+		WHERE id = $5 AND deleted_at IS NULL`, user.DisplayName, user.Bio, user.Location().String(),
+		user.PendingEmail, user.ID)
+	if err != nil {
+		return err
+	}
+	return expectRowsAffected(res, common.ErrUserNotFound)
+}
+
+// ChangePassword sets the new password and ends every existing session of the user
+func (w *Warehouse) ChangePassword(userID, hashedPassword string) error {
+	return w.updateUserAndEndSessions(userID, `UPDATE user_data SET password = $2, sessions_revoked_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL`, hashedPassword)
+}
+
+// DeleteUser soft deletes the user and ends every existing session. The row is kept but the user can
+// no longer be found or log in
+func (w *Warehouse) DeleteUser(userID string) error {
+	return w.updateUserAndEndSessions(userID, `UPDATE user_data SET deleted_at = NOW(), sessions_revoked_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL`)
+}
+
+// updateUserAndEndSessions runs the user update, which must set sessions_revoked_at, and revokes the
+// refresh tokens of the user in one transaction. $1 of the update is the user id
+func (w *Warehouse) updateUserAndEndSessions(userID, sqlStatement string, args ...interface{}) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	res, err := tx.Exec(sqlStatement, append([]interface{}{userID}, args...)...)
+	if err != nil {
+		return err
+	}
+	if err = expectRowsAffected(res, common.ErrUserNotFound); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`UPDATE refresh_token SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func scanUser(row *sql.Row) (*common.User, error) {
+	u := common.User{}
+	var clubRoles []byte
+	err := row.Scan(&u.ID, &u.Email, &u.EmailVerifiedAt, &u.Password, &u.DisplayName, &u.Bio, &u.TOTPSecret, &u.TOTPEnabledAt,
+		pq.Array(&u.Roles), &clubRoles, &u.TimeZone, &u.PendingEmail)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(clubRoles, &u.ClubRoles); err != nil {
+		return nil, err
+	}
 	return &u, nil
 }
+
+// expectRowsAffected returns errNone when the statement did not change anything
+func expectRowsAffected(res sql.Result, errNone error) error {
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errNone
+	}
+	return nil
+}
@@ -22,6 +22,8 @@ func TestWarehouseCreateUserSuccess(t *testing.T) {
 				ID:          "uniqueRowID",
 				DisplayName: "gcarr",
 				Email:       "email@example.com",
+				Roles:       []string{common.RoleMember},
+				ClubRoles:   map[string]string{},
 			},
 			rr: common.RegisterRequest{
 				Password:    "1234",
@@ -95,6 +97,9 @@ func TestWarehouseGetUserWithEmailSuccess(t *testing.T) {
 				DisplayName: "gcarr",
 				Email:       "email@example.com",
 				Password:    "pass123",
+				Roles:       []string{common.RoleMember},
+				ClubRoles:   map[string]string{"clubID": common.ClubRoleOwner},
+				TimeZone:    "UTC",
 			},
 			email: "email@example.com",
 		},
@@ -143,7 +148,7 @@ func TestWarehouseGetUserWithEmailNotFound(t *testing.T) {
 	defer db.Close()
 	w.DB = db
 	for _, td := range testTable {
-		mock.ExpectQuery("SELECT id, email, password, display_name FROM user_data WHERE email = \\$1").
+		mock.ExpectQuery("SELECT id, email, email_verified_at, password, display_name, bio, COALESCE\\(totp_secret, ''\\), totp_enabled_at, roles, .+ FROM user_data WHERE email = \\$1 AND deleted_at IS NULL").
 			WithArgs(td.email).
 			WillReturnError(common.ErrLoginUserNotFound)
 
@@ -162,7 +167,163 @@ func mockInsertUserQuery(m sqlmock.Sqlmock, id, displayName, password, email str
 }
 
 func mockSelectUserWithEmailQuery(m sqlmock.Sqlmock, id, displayName, password, email string) {
-	m.ExpectQuery("SELECT id, email, password, display_name FROM user_data WHERE email = \\$1").
+	m.ExpectQuery("SELECT id, email, email_verified_at, password, display_name, bio, COALESCE\\(totp_secret, ''\\), totp_enabled_at, roles, .+ FROM user_data WHERE email = \\$1 AND deleted_at IS NULL").
 		WithArgs(email).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password", "display_name"}).AddRow(id, email, password, displayName))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "email_verified_at", "password", "display_name", "bio", "totp_secret",
+			"totp_enabled_at", "roles", "club_roles", "time_zone", "pending_email"}).
+			AddRow(id, email, nil, password, displayName, "", "", nil, "{member}", `{"clubID": "owner"}`, "UTC", ""))
+}
+
+func TestWarehouseUpdatePassword(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		rowsAffected  int64
+	}
+
+	testTable := []testData{
+		testData{
+			description:  "Updates the password",
+			rowsAffected: 1,
+		},
+		testData{
+			description:   "Unknown user",
+			expectedError: common.ErrUserNotFound,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		mock.ExpectExec("UPDATE user_data SET password = \\$1, updated_at = NOW\\(\\) WHERE id = \\$2").
+			WithArgs("hash", "userID").
+			WillReturnResult(sqlmock.NewResult(0, td.rowsAffected))
+		assert.Equal(t, td.expectedError, w.UpdatePassword("userID", "hash"), td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseUpdateUser(t *testing.T) {
+	type testData struct {
+		description   string
+		emailChanged  bool
+		emailTaken    bool
+		expectedError error
+		rowsAffected  int64
+	}
+
+	testTable := []testData{
+		testData{
+			description:  "Updates the user",
+			rowsAffected: 1,
+		},
+		testData{
+			description:  "Updates the user and pending email",
+			emailChanged: true,
+			rowsAffected: 1,
+		},
+		testData{
+			description:   "Email already registered",
+			emailChanged:  true,
+			emailTaken:    true,
+			expectedError: common.ErrLoginUserAlreadyExists,
+		},
+		testData{
+			description:   "Unknown user",
+			expectedError: common.ErrUserNotFound,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	user := &common.User{ID: "userID", DisplayName: "gcarr", Email: "email@example.com", Bio: "Reads a lot",
+		PendingEmail: "new@example.com"}
+	for _, td := range testTable {
+		if td.emailChanged {
+			mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM user_data WHERE email = \\$1 AND deleted_at IS NULL\\)").
+				WithArgs(user.PendingEmail).
+				WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(td.emailTaken))
+		}
+		if !td.emailTaken {
+			mock.ExpectExec("UPDATE user_data SET display_name = \\$1, bio = \\$2, time_zone = \\$3, pending_email = NULLIF\\(\\$4, ''\\)").
+				WithArgs(user.DisplayName, user.Bio, "UTC", user.PendingEmail, user.ID).
+				WillReturnResult(sqlmock.NewResult(0, td.rowsAffected))
+		}
+		assert.Equal(t, td.expectedError, w.UpdateUser(user, td.emailChanged), td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
+}
+
+func TestWarehouseChangePasswordAndDeleteUser(t *testing.T) {
+	type testData struct {
+		description   string
+		expectedError error
+		expectedSQL   string
+		rowsAffected  int64
+		run           func(w *Warehouse) error
+	}
+
+	changePassword := func(w *Warehouse) error { return w.ChangePassword("userID", "hash") }
+	deleteUser := func(w *Warehouse) error { return w.DeleteUser("userID") }
+	testTable := []testData{
+		testData{
+			description:  "Changes the password",
+			expectedSQL:  "UPDATE user_data SET password = \\$2, sessions_revoked_at = NOW\\(\\)",
+			rowsAffected: 1,
+			run:          changePassword,
+		},
+		testData{
+			description:   "Changes the password of an unknown user",
+			expectedError: common.ErrUserNotFound,
+			expectedSQL:   "UPDATE user_data SET password = \\$2, sessions_revoked_at = NOW\\(\\)",
+			run:           changePassword,
+		},
+		testData{
+			description:  "Deletes the user",
+			expectedSQL:  "UPDATE user_data SET deleted_at = NOW\\(\\), sessions_revoked_at = NOW\\(\\)",
+			rowsAffected: 1,
+			run:          deleteUser,
+		},
+		testData{
+			description:   "Deletes an unknown user",
+			expectedError: common.ErrUserNotFound,
+			expectedSQL:   "UPDATE user_data SET deleted_at = NOW\\(\\), sessions_revoked_at = NOW\\(\\)",
+			run:           deleteUser,
+		},
+	}
+	w := Warehouse{}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	w.DB = db
+	for _, td := range testTable {
+		mock.ExpectBegin()
+		mock.ExpectExec(td.expectedSQL).WillReturnResult(sqlmock.NewResult(0, td.rowsAffected))
+		if td.expectedError == nil {
+			mock.ExpectExec("UPDATE refresh_token SET revoked_at = NOW\\(\\)").
+				WithArgs("userID").
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectCommit()
+		} else {
+			mock.ExpectRollback()
+		}
+		assert.Equal(t, td.expectedError, td.run(&w), td.description)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectation error: %s", err)
+	}
 }